@@ -0,0 +1,268 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/logging"
+)
+
+// Event types recorded by the service
+const (
+	TypeAuthRejected        = "auth.rejected"
+	TypeTokenRevoked        = "auth.token_revoked"
+	TypePasskeyLogin        = "auth.passkey_login"
+	TypeEmailOTPSent        = "auth.email_otp_sent"
+	TypeEmailOTPLogin       = "auth.email_otp_login"
+	TypeChallengeLogin      = "auth.challenge_login"
+	TypeRefreshTokenReused  = "auth.refresh_token_reused"
+	TypePasskeyRegistered   = "passkey.registered"
+	TypePasskeyRemoved      = "passkey.removed"
+	TypeAccountCreated      = "account.created"
+	TypeAccountEmailChanged = "account.email_changed"
+	TypeAccountDeletion     = "account.deletion"
+	TypeAccountPurged       = "account.purged"
+	TypeDataExport          = "account.data_export"
+	TypeAdminAction         = "admin.action"
+	TypeOrgCreated          = "org.created"
+	TypeOrgMemberInvited    = "org.member_invited"
+	TypeOrgMemberJoined     = "org.member_joined"
+	TypeOrgRoleChanged      = "org.role_changed"
+	TypeMigrationExchange   = "migration.exchange"
+)
+
+// Outcomes of an audited action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// ErrNotQueryable is returned when the configured sink cannot be queried
+var ErrNotQueryable = errors.New("audit sink does not support queries")
+
+// Event is a single audit log entry
+type Event struct {
+	ID        string            `json:"id"`
+	Time      time.Time         `json:"time"`
+	Type      string            `json:"type"`
+	Actor     string            `json:"actor,omitempty"`   // who performed the action
+	Subject   string            `json:"subject,omitempty"` // what the action was performed on
+	IP        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Outcome   string            `json:"outcome"`
+	Reason    string            `json:"reason,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// Filter selects events when querying a sink. Zero values match everything.
+type Filter struct {
+	Type    string
+	Actor   string
+	Subject string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+// Sink persists audit events. Sinks are append-only: events are never
+// updated or removed through this interface.
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+}
+
+// Reader is implemented by sinks that can be queried
+type Reader interface {
+	// Query returns matching events, newest first
+	Query(ctx context.Context, filter Filter) ([]Event, error)
+}
+
+// Logger records audit events to a sink
+type Logger struct {
+	sink Sink
+}
+
+// NewLogger creates an audit logger writing to sink
+func NewLogger(sink Sink) *Logger {
+	return &Logger{sink: sink}
+}
+
+// Record fills in the event ID, time and request details from ctx and writes
+// the event. Failures are logged rather than returned so auditing never
+// breaks the request being audited. A nil Logger discards events.
+func (l *Logger) Record(ctx context.Context, event Event) {
+	if l == nil {
+		return
+	}
+
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.RequestID == "" {
+		event.RequestID = logging.RequestIDFromContext(ctx)
+	}
+	if info, ok := ctx.Value(requestInfoKey).(requestInfo); ok {
+		if event.IP == "" {
+			event.IP = info.ip
+		}
+		if event.UserAgent == "" {
+			event.UserAgent = info.userAgent
+		}
+	}
+
+	if err := l.sink.Write(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "failed to write audit event", "type", event.Type, "error", err)
+	}
+}
+
+// Query returns matching events if the sink supports it
+func (l *Logger) Query(ctx context.Context, filter Filter) ([]Event, error) {
+	if l == nil {
+		return nil, ErrNotQueryable
+	}
+	reader, ok := l.sink.(Reader)
+	if !ok {
+		return nil, ErrNotQueryable
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	return reader.Query(ctx, filter)
+}
+
+type contextKey string
+
+const requestInfoKey contextKey = "audit_request"
+
+type requestInfo struct {
+	ip        string
+	userAgent string
+}
+
+// Middleware captures the caller's IP and user agent for events recorded
+// while handling the request. X-Forwarded-For is only believed when the
+// request comes from one of trustedProxies.
+func Middleware(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), requestInfoKey, requestInfo{
+				ip:        clientIP(r, trustedProxies),
+				userAgent: r.UserAgent(),
+			})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ParseTrustedProxies parses proxy addresses and CIDR ranges, such as the
+// entries of TRUSTED_PROXIES
+func ParseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %q", entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// FromTrustedProxy reports whether r was sent by one of trustedProxies, so
+// its X-Forwarded-* headers can be believed
+func FromTrustedProxy(r *http.Request, trustedProxies []netip.Prefix) bool {
+	return trusted(remoteHost(r), trustedProxies)
+}
+
+// remoteHost returns the address r was sent from, without its port
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientIP returns the remote address, or, when it is a trusted proxy, the
+// nearest X-Forwarded-For address that isn't. Entries left of an untrusted
+// address could have been written by the client, so they are never used.
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host := remoteHost(r)
+	if !trusted(host, trustedProxies) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !trusted(hops[i], trustedProxies) {
+			return hops[i]
+		}
+		host = hops[i]
+	}
+	return host
+}
+
+// trusted reports whether ip is one of the trusted proxies
+func trusted(ip string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether event satisfies filter
+func (f Filter) matches(event Event) bool {
+	switch {
+	case f.Type != "" && event.Type != f.Type:
+		return false
+	case f.Actor != "" && event.Actor != f.Actor:
+		return false
+	case f.Subject != "" && event.Subject != f.Subject:
+		return false
+	case f.Outcome != "" && event.Outcome != f.Outcome:
+		return false
+	case !f.Since.IsZero() && event.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && event.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+// newEventID generates a random 128-bit event ID
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+)
+
+// Sink names accepted in Config.Sink
+const (
+	SinkMemory = "memory"
+	SinkFile   = "file"
+	SinkSQL    = "sql"
+)
+
+// Defaults for Config
+const (
+	DefaultFileMaxBytes = 10 << 20
+	DefaultFileBackups  = 5
+)
+
+// Config holds audit log configuration
+type Config struct {
+	Sink         string // memory (default), file or sql
+	FilePath     string // JSONL file for the file sink
+	FileMaxBytes int64  // rotate the file after this many bytes (default 10 MiB, negative disables rotation)
+	FileBackups  int    // rotated files to keep (default 5)
+	DatabaseURL  string // PostgreSQL connection string for the sql sink
+	Table        string // table for the sql sink (default audit_events)
+}
+
+// Open creates an audit logger backed by the configured sink
+func Open(ctx context.Context, config Config) (*Logger, error) {
+	switch config.Sink {
+	case "", SinkMemory:
+		return NewLogger(NewMemorySink(0)), nil
+	case SinkFile:
+		path := config.FilePath
+		if path == "" {
+			path = "audit.jsonl"
+		}
+		maxBytes, backups := config.FileMaxBytes, config.FileBackups
+		if maxBytes == 0 {
+			maxBytes = DefaultFileMaxBytes
+		}
+		if backups <= 0 {
+			backups = DefaultFileBackups
+		}
+		sink, err := NewFileSink(path, max(maxBytes, 0), backups)
+		if err != nil {
+			return nil, err
+		}
+		return NewLogger(sink), nil
+	case SinkSQL:
+		if config.DatabaseURL == "" {
+			return nil, fmt.Errorf("database URL is required for the sql audit sink")
+		}
+		db, err := sql.Open("pgx", config.DatabaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit database: %w", err)
+		}
+		sink, err := NewSQLSink(ctx, db, config.Table)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return NewLogger(sink), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink: %s", config.Sink)
+	}
+}
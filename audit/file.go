@@ -0,0 +1,173 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileSink appends events as JSON lines to a file, rotating it when it grows
+// past MaxBytes. Rotated files are named <path>.1 (newest) to <path>.N.
+type FileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewFileSink opens (or creates) the audit log at path. A maxBytes of zero
+// disables rotation; maxBackups limits how many rotated files are kept, at
+// least one, so rotating never deletes the log being written.
+func NewFileSink(path string, maxBytes int64, maxBackups int) (*FileSink, error) {
+	if maxBackups < 1 {
+		maxBackups = 1
+	}
+	s := &FileSink{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxBackups: maxBackups,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write appends an event to the log
+func (s *FileSink) Write(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+
+	return s.file.Sync()
+}
+
+// Query scans the current and rotated files and returns matching events,
+// newest first
+func (s *FileSink) Query(ctx context.Context, filter Filter) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []Event
+	for _, path := range s.files() {
+		fileEvents, err := readEvents(path)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(fileEvents) - 1; i >= 0; i-- {
+			if !filter.matches(fileEvents[i]) {
+				continue
+			}
+			events = append(events, fileEvents[i])
+			if filter.Limit > 0 && len(events) >= filter.Limit {
+				return events, nil
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// Close closes the underlying file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// open opens the current log file for appending
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts <path>.N-1 to <path>.N, moves the current file to <path>.1
+// and starts a new one
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+
+	os.Remove(s.backupPath(s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		os.Rename(s.backupPath(i), s.backupPath(i+1))
+	}
+	if err := os.Rename(s.path, s.backupPath(1)); err != nil {
+		// Keep appending to the current file rather than lose events
+		if openErr := s.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+
+	return s.open()
+}
+
+// files lists the log files from newest to oldest
+func (s *FileSink) files() []string {
+	files := []string{s.path}
+	for i := 1; i <= s.maxBackups; i++ {
+		if _, err := os.Stat(s.backupPath(i)); err == nil {
+			files = append(files, s.backupPath(i))
+		}
+	}
+	return files
+}
+
+func (s *FileSink) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
+
+// readEvents decodes every event in a JSONL file, oldest first
+func readEvents(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue // skip a partially written line
+		}
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"context"
+	"sync"
+)
+
+// MemorySink keeps the most recent events in memory (for development)
+type MemorySink struct {
+	mu        sync.RWMutex
+	events    []Event
+	maxEvents int
+}
+
+// NewMemorySink creates an in-memory sink holding at most maxEvents events
+func NewMemorySink(maxEvents int) *MemorySink {
+	if maxEvents <= 0 {
+		maxEvents = 10000
+	}
+	return &MemorySink{maxEvents: maxEvents}
+}
+
+// Write appends an event, dropping the oldest one when full
+func (s *MemorySink) Write(ctx context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.events) >= s.maxEvents {
+		s.events = s.events[1:]
+	}
+	s.events = append(s.events, event)
+
+	return nil
+}
+
+// Query returns matching events, newest first
+func (s *MemorySink) Query(ctx context.Context, filter Filter) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []Event
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if !filter.matches(s.events[i]) {
+			continue
+		}
+		events = append(events, s.events[i])
+		if filter.Limit > 0 && len(events) >= filter.Limit {
+			break
+		}
+	}
+
+	return events, nil
+}
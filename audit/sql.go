@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SQLSink stores events in an append-only SQL table. Queries use PostgreSQL
+// placeholder syntax.
+type SQLSink struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLSink creates a sink writing to table, creating it if needed
+func NewSQLSink(ctx context.Context, db *sql.DB, table string) (*SQLSink, error) {
+	if table == "" {
+		table = "audit_events"
+	}
+	s := &SQLSink{db: db, table: table}
+
+	schema := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id          TEXT PRIMARY KEY,
+		occurred_at TIMESTAMPTZ NOT NULL,
+		type        TEXT NOT NULL,
+		actor       TEXT NOT NULL DEFAULT '',
+		subject     TEXT NOT NULL DEFAULT '',
+		ip          TEXT NOT NULL DEFAULT '',
+		user_agent  TEXT NOT NULL DEFAULT '',
+		outcome     TEXT NOT NULL,
+		reason      TEXT NOT NULL DEFAULT '',
+		request_id  TEXT NOT NULL DEFAULT '',
+		metadata    TEXT NOT NULL DEFAULT '{}'
+	)`, table)
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("failed to create audit table: %w", err)
+	}
+
+	return s, nil
+}
+
+// Write inserts an event
+func (s *SQLSink) Write(ctx context.Context, event Event) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit metadata: %w", err)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s
+		(id, occurred_at, type, actor, subject, ip, user_agent, outcome, reason, request_id, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`, s.table)
+	_, err = s.db.ExecContext(ctx, query,
+		event.ID, event.Time, event.Type, event.Actor, event.Subject, event.IP,
+		event.UserAgent, event.Outcome, event.Reason, event.RequestID, string(metadata),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+
+	return nil
+}
+
+// Query returns matching events, newest first
+func (s *SQLSink) Query(ctx context.Context, filter Filter) ([]Event, error) {
+	var conditions []string
+	var args []any
+	where := func(column string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if filter.Type != "" {
+		where("type", filter.Type)
+	}
+	if filter.Actor != "" {
+		where("actor", filter.Actor)
+	}
+	if filter.Subject != "" {
+		where("subject", filter.Subject)
+	}
+	if filter.Outcome != "" {
+		where("outcome", filter.Outcome)
+	}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		conditions = append(conditions, fmt.Sprintf("occurred_at >= $%d", len(args)))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until)
+		conditions = append(conditions, fmt.Sprintf("occurred_at <= $%d", len(args)))
+	}
+
+	query := fmt.Sprintf(`SELECT id, occurred_at, type, actor, subject, ip, user_agent, outcome, reason, request_id, metadata
+		FROM %s`, s.table)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY occurred_at DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var metadata string
+		if err := rows.Scan(
+			&event.ID, &event.Time, &event.Type, &event.Actor, &event.Subject, &event.IP,
+			&event.UserAgent, &event.Outcome, &event.Reason, &event.RequestID, &metadata,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &event.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode audit metadata: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -7,29 +7,154 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math/big"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/logging"
+	"github.com/example/auth0-gqlgen-demo/metrics"
+	"github.com/example/auth0-gqlgen-demo/tracing"
 	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// jwksClient fetches JWKS documents; requests are traced and carry trace context
+var jwksClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: tracing.Transport(nil),
+}
+
+// Errors returned when a request fails authentication
+var (
+	ErrMissingHeader    = errors.New("access token required")
+	ErrInvalidHeader    = errors.New("invalid authorization header format")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrInvalidAudience  = errors.New("invalid audience")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrUnknownKID       = errors.New("unable to find appropriate key")
+	ErrTokenNotYetValid = errors.New("token not yet valid")
+	ErrTokenTooOld      = errors.New("token too old")
+	ErrMissingClaim     = errors.New("missing required claim")
+	ErrClientNotAllowed = errors.New("client not allowed")
+	ErrTokenRevoked     = errors.New("token revoked")
+	ErrInvalidTokenType = errors.New("invalid token type")
+)
+
+// Errors returned to resolvers when a caller lacks access
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// PermissionReadAudit allows querying the audit log
+const PermissionReadAudit = "read:audit"
+
+// PermissionReadAccounts allows listing every account
+const PermissionReadAccounts = "read:accounts"
+
+// PermissionReadMigrations allows watching Passage token exchanges
+const PermissionReadMigrations = "read:migrations"
+
+// PermissionRevokeTokens allows revoking access tokens before they expire
+const PermissionRevokeTokens = "revoke:tokens"
+
 // UserContext key for storing user info in context
 type contextKey string
 
 const UserContextKey contextKey = "user"
 
-// UserInfo contains the authenticated user's information
+// UserInfo contains the authenticated principal's information. For service
+// clients UserID is the token subject and the user fields are empty.
 type UserInfo struct {
-	UserID string
-	Email  string
+	UserID                string
+	Email                 string
+	EmailVerified         bool
+	Issuer                string
+	IssuedAt              time.Time
+	TokenID               string        // jti claim, if any
+	Audience              []string      // aud claim
+	Confirmation          string        // cnf.jkt: thumbprint of the DPoP key the token is bound to, if any
+	CertificateThumbprint string        // cnf.x5t#S256: thumbprint of the client certificate the token is bound to, if any
+	Kind                  PrincipalKind // zero value is treated as a user
+	ClientID              string        // OAuth client the token was issued to (azp)
+	OrgID                 string        // Auth0 organization the token was issued for (org_id), if any
+	Scopes                []string      // from the space-separated "scope" claim
+	Permissions           []string      // from the Auth0 RBAC "permissions" claim, plus registry grants for service clients
+}
+
+// HasPermission reports whether the token grants permission, either as an
+// RBAC permission or as a scope
+func (u *UserInfo) HasPermission(permission string) bool {
+	for _, p := range u.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	for _, s := range u.Scopes {
+		if s == permission {
+			return true
+		}
+	}
+	return false
 }
 
 // Auth0Config holds Auth0 configuration
 type Auth0Config struct {
 	Domain   string
 	Audience string
+	Audit    *audit.Logger  // records rejected requests (optional)
+	Clients  ClientRegistry // grants permissions to service clients (optional)
+
+	// TokenCookie names a cookie holding the access token, read when no
+	// Authorization header is sent (optional). Form posts never use it.
+	TokenCookie string
+
+	// AllowAnonymous lets requests without a token through with no
+	// principal. Requests with an invalid token are still rejected.
+	AllowAnonymous bool
+
+	// Leeway tolerates clock skew when checking exp, nbf and iat (default
+	// 30s). MaxTokenAge rejects tokens issued longer ago than it, and
+	// requires iat, when set.
+	Leeway      time.Duration
+	MaxTokenAge time.Duration
+
+	// RequiredClaims must be present in every token, in addition to exp,
+	// iss, aud and sub (optional)
+	RequiredClaims []string
+
+	// AllowedClients limits tokens to those issued to these OAuth clients,
+	// by azp or client_id (optional)
+	AllowedClients []string
+
+	// Revocations rejects tokens revoked before they expire (optional)
+	Revocations RevocationChecker
+
+	// TrustedIssuers verifies the access tokens of issuers other than the
+	// Auth0 tenant, such as the first-party issuer, with the keys they
+	// publish (optional)
+	TrustedIssuers []TrustedIssuer
+
+	// Introspection verifies tokens Auth0 didn't issue, opaque or JWT,
+	// through an RFC 7662 endpoint (optional)
+	Introspection *Introspector
+
+	// DPoP accepts DPoP-bound tokens and can require them (optional).
+	// Without it, tokens bound to a DPoP key are refused.
+	DPoP *DPoPVerifier
+
+	// MTLS authenticates service clients by their TLS client certificate
+	// and can require their tokens to be bound to it (optional)
+	MTLS *MTLSConfig
+}
+
+// RevocationChecker reports whether a token has been revoked, by its jti or
+// because every token of its subject issued before some time was
+type RevocationChecker interface {
+	IsRevoked(tokenID, subject string, issuedAt time.Time) bool
 }
 
 // JWKS represents the JSON Web Key Set
@@ -51,40 +176,160 @@ type JSONWebKey struct {
 func Middleware(config Auth0Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Extract token from Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			// Keep the verified client certificate for WebsocketInit, which
+			// checks certificate-bound tokens against it
+			cert := verifiedCertificate(r)
+			r = r.WithContext(withCertificate(r.Context(), cert))
+			spanCtx, span := tracing.Tracer().Start(r.Context(), "auth.Middleware")
+
+			// Extract token from the Authorization header or cookie
+			scheme, tokenString, err := tokenFromRequest(r, config)
+			if errors.Is(err, ErrMissingHeader) && cert != nil && config.MTLS != nil && config.MTLS.CertificatePrincipals && !config.DPoP.pathRequired(r) {
+				// The certificate itself identifies the service client
+				userInfo, err := authenticateCertificate(spanCtx, config, cert)
+				if err != nil {
+					tracing.EndSpan(span, err)
+					writeTokenError(w, config, scheme, err)
+					return
+				}
+				span.SetAttributes(
+					attribute.String("enduser.id", userInfo.UserID),
+					attribute.String("enduser.kind", string(userInfo.Kind)),
+				)
+				tracing.EndSpan(span, nil)
+
+				ctx := context.WithValue(r.Context(), UserContextKey, userInfo)
+				ctx = logging.WithUser(ctx, userInfo.UserID)
+				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
-
-			// Check Bearer prefix
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+			if errors.Is(err, ErrMissingHeader) && isWebSocketUpgrade(r) && !config.DPoP.pathRequired(r) {
+				// Browsers can't set headers on websockets; the token arrives
+				// in the connection_init payload and is checked by WebsocketInit.
+				// Websocket messages can't carry DPoP proofs.
+				tracing.EndSpan(span, nil)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if errors.Is(err, ErrMissingHeader) && config.AllowAnonymous && !(isWebSocketUpgrade(r) && config.DPoP.pathRequired(r)) {
+				// No principal is attached; @authenticated fields refuse to resolve
+				metrics.AuthRequests.WithLabelValues("anonymous").Inc()
+				tracing.EndSpan(span, nil)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err == nil && scheme == SchemeDPoP && config.DPoP == nil {
+				err = fmt.Errorf("%w: DPoP is not enabled", ErrInvalidHeader)
+			}
+			if err != nil {
+				metrics.AuthRequests.WithLabelValues(failureReason(err)).Inc()
+				tracing.EndSpan(span, err)
+				recordRejection(r.Context(), config, err)
+				if errors.Is(err, ErrMissingHeader) {
+					writeChallenges(w, http.StatusUnauthorized, "", missingTokenChallenges(r, config)...)
+				} else {
+					writeChallenge(w, http.StatusBadRequest, ChallengeInvalidRequest, "malformed Authorization header", "")
+				}
 				return
 			}
 
-			tokenString := parts[1]
+			// Verify the DPoP proof; its binding to the token is checked
+			// once the token is validated
+			var proof *dpopProof
+			if scheme == SchemeDPoP {
+				proof, err = config.DPoP.verifyProof(r, tokenString, leeway(config))
+				if err != nil {
+					metrics.AuthRequests.WithLabelValues(failureReason(err)).Inc()
+					slog.InfoContext(spanCtx, "token rejected", "reason", failureReason(err), "error", err)
+					tracing.EndSpan(span, err)
+					recordRejection(r.Context(), config, err)
+					writeChallenges(w, http.StatusUnauthorized, "the DPoP proof is invalid",
+						formatChallenge(SchemeDPoP, "error", ChallengeInvalidDPoPProof, "error_description", "the DPoP proof is invalid", "algs", config.DPoP.algorithms()))
+					return
+				}
+			}
 
 			// Validate token
-			userInfo, err := validateToken(tokenString, config)
+			userInfo, err := authenticate(spanCtx, config, tokenString, func(info *UserInfo) error {
+				if err := config.DPoP.checkBinding(r, proof, info); err != nil {
+					return err
+				}
+				return checkCertificateBinding(config, cert, info)
+			})
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
+				tracing.EndSpan(span, err)
+				writeTokenError(w, config, scheme, err)
 				return
 			}
+			span.SetAttributes(
+				attribute.String("enduser.id", userInfo.UserID),
+				attribute.String("enduser.kind", string(userInfo.Kind)),
+			)
+			tracing.EndSpan(span, nil)
 
 			// Add user info to context
 			ctx := context.WithValue(r.Context(), UserContextKey, userInfo)
+			ctx = logging.WithUser(ctx, userInfo.UserID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// Authenticate validates a bearer token and returns the principal it
+// represents, with the permissions registered for service clients added.
+// Rejections are counted, logged and audited.
+func Authenticate(ctx context.Context, config Auth0Config, tokenString string) (*UserInfo, error) {
+	return authenticate(ctx, config, tokenString, func(info *UserInfo) error {
+		if err := config.DPoP.checkBinding(nil, nil, info); err != nil {
+			return err
+		}
+		return checkCertificateBinding(config, certificateFromContext(ctx), info)
+	})
+}
+
+// authenticate is Authenticate with checkBinding deciding whether the
+// validated token may be used the way it was presented
+func authenticate(ctx context.Context, config Auth0Config, tokenString string, checkBinding func(*UserInfo) error) (*UserInfo, error) {
+	userInfo, err := verifyToken(ctx, tokenString, config)
+	if err == nil && config.Revocations != nil && config.Revocations.IsRevoked(userInfo.TokenID, userInfo.UserID, userInfo.IssuedAt) {
+		userInfo, err = nil, ErrTokenRevoked
+	}
+	if err == nil {
+		if bindingErr := checkBinding(userInfo); bindingErr != nil {
+			userInfo, err = nil, bindingErr
+		}
+	}
+	if err != nil {
+		metrics.AuthRequests.WithLabelValues(failureReason(err)).Inc()
+		slog.InfoContext(ctx, "token rejected", "reason", failureReason(err), "error", err)
+		recordRejection(ctx, config, err)
+		return nil, err
+	}
+	grantClientPermissions(ctx, config, userInfo)
+	metrics.AuthRequests.WithLabelValues("ok").Inc()
+
+	return userInfo, nil
+}
+
+// grantClientPermissions adds the permissions registered for a service
+// client to its principal
+func grantClientPermissions(ctx context.Context, config Auth0Config, userInfo *UserInfo) {
+	if userInfo.Kind != PrincipalService || config.Clients == nil {
+		return
+	}
+	granted, err := config.Clients.ClientPermissions(ctx, userInfo.ClientID)
+	if err != nil {
+		// Fall back to the token's own scopes rather than failing the request
+		slog.WarnContext(ctx, "failed to load service client permissions", "client_id", userInfo.ClientID, "error", err)
+	}
+	userInfo.Permissions = append(userInfo.Permissions, granted...)
+}
+
 // validateToken validates the JWT token and extracts user information
-func validateToken(tokenString string, config Auth0Config) (*UserInfo, error) {
-	// Parse token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+func validateToken(ctx context.Context, tokenString string, config Auth0Config) (*UserInfo, error) {
+	// Parse token, validating exp, nbf, iat, iss and aud
+	expectedIssuer := fmt.Sprintf("https://%s/", config.Domain)
+	token, err := newParser(config, expectedIssuer, auth0Methods).Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Verify signing method
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -97,7 +342,7 @@ func validateToken(tokenString string, config Auth0Config) (*UserInfo, error) {
 		}
 
 		// Fetch JWKS
-		jwks, err := fetchJWKS(config.Domain)
+		jwks, err := fetchJWKS(ctx, config.Domain)
 		if err != nil {
 			return nil, err
 		}
@@ -105,7 +350,7 @@ func validateToken(tokenString string, config Auth0Config) (*UserInfo, error) {
 		// Find the key
 		key := findKey(jwks, kid)
 		if key == nil {
-			return nil, errors.New("unable to find appropriate key")
+			return nil, ErrUnknownKID
 		}
 
 		// Convert to RSA public key
@@ -113,7 +358,7 @@ func validateToken(tokenString string, config Auth0Config) (*UserInfo, error) {
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, tokenError(err)
 	}
 
 	// Validate claims
@@ -121,75 +366,156 @@ func validateToken(tokenString string, config Auth0Config) (*UserInfo, error) {
 	if !ok || !token.Valid {
 		return nil, errors.New("invalid token claims")
 	}
+	if err := checkClaims(claims, config, time.Now()); err != nil {
+		return nil, err
+	}
 
-	// Verify audience
-	aud, ok := claims["aud"].(string)
+	return userInfoFromClaims(claims, config, expectedIssuer)
+}
+
+// userInfoFromClaims extracts the principal from validated claims, rejecting
+// clients that aren't allowed
+func userInfoFromClaims(claims jwt.MapClaims, config Auth0Config, issuer string) (*UserInfo, error) {
+	userID, ok := claims["sub"].(string)
 	if !ok {
-		// Try as array
-		if audArray, ok := claims["aud"].([]interface{}); ok {
-			found := false
-			for _, a := range audArray {
-				if audStr, ok := a.(string); ok && audStr == config.Audience {
-					found = true
-					break
-				}
-			}
-			if !found {
-				return nil, errors.New("invalid audience")
-			}
-		} else {
-			return nil, errors.New("audience claim not found")
-		}
-	} else if aud != config.Audience {
-		return nil, errors.New("invalid audience")
+		return nil, errors.New("sub claim not found")
 	}
 
-	// Verify issuer
-	expectedIssuer := fmt.Sprintf("https://%s/", config.Domain)
-	iss, ok := claims["iss"].(string)
-	if !ok || iss != expectedIssuer {
-		return nil, errors.New("invalid issuer")
+	email, _ := claims["email"].(string) // Email might not always be present
+	emailVerified, _ := claims["email_verified"].(bool)
+
+	var issuedAt time.Time
+	if iat, ok := claims["iat"].(float64); ok {
+		issuedAt = time.Unix(int64(iat), 0)
 	}
+	tokenID, _ := claims["jti"].(string)
 
-	// Verify expiration
-	exp, ok := claims["exp"].(float64)
-	if !ok {
-		return nil, errors.New("expiration claim not found")
+	var scopes []string
+	if scope, ok := claims["scope"].(string); ok {
+		scopes = strings.Fields(scope)
 	}
-	if time.Now().Unix() > int64(exp) {
-		return nil, errors.New("token expired")
+
+	var permissions []string
+	if perms, ok := claims["permissions"].([]interface{}); ok {
+		for _, p := range perms {
+			if permStr, ok := p.(string); ok {
+				permissions = append(permissions, permStr)
+			}
+		}
 	}
 
-	// Extract user info
-	userID, ok := claims["sub"].(string)
-	if !ok {
-		return nil, errors.New("sub claim not found")
+	kind, clientID := principalFromClaims(claims, userID)
+	if !clientAllowed(config, clientID) {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotAllowed, clientID)
 	}
+	orgID, _ := claims["org_id"].(string)
+	audience, _ := claims.GetAudience()
 
-	email, _ := claims["email"].(string) // Email might not always be present
+	var confirmation, certificateThumbprint string
+	if cnf, ok := claims["cnf"].(map[string]interface{}); ok {
+		confirmation, _ = cnf["jkt"].(string)
+		certificateThumbprint, _ = cnf["x5t#S256"].(string)
+	}
 
 	return &UserInfo{
-		UserID: userID,
-		Email:  email,
+		UserID:                userID,
+		Email:                 email,
+		EmailVerified:         emailVerified,
+		Issuer:                issuer,
+		IssuedAt:              issuedAt,
+		TokenID:               tokenID,
+		Audience:              audience,
+		Confirmation:          confirmation,
+		CertificateThumbprint: certificateThumbprint,
+		Kind:                  kind,
+		ClientID:              clientID,
+		OrgID:                 orgID,
+		Scopes:                scopes,
+		Permissions:           permissions,
 	}, nil
 }
 
+// recordRejection writes an audit event for a rejected request
+func recordRejection(ctx context.Context, config Auth0Config, err error) {
+	config.Audit.Record(ctx, audit.Event{
+		Type:    audit.TypeAuthRejected,
+		Outcome: audit.OutcomeFailure,
+		Reason:  failureReason(err),
+	})
+}
+
+// failureReason maps a validation error to the metrics outcome label
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrMissingHeader):
+		return "missing_header"
+	case errors.Is(err, ErrInvalidHeader):
+		return "bad_format"
+	case errors.Is(err, ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, ErrInvalidAudience):
+		return "bad_audience"
+	case errors.Is(err, ErrInvalidIssuer):
+		return "bad_issuer"
+	case errors.Is(err, ErrUnknownKID):
+		return "unknown_kid"
+	case errors.Is(err, ErrTokenNotYetValid):
+		return "not_yet_valid"
+	case errors.Is(err, ErrTokenTooOld):
+		return "too_old"
+	case errors.Is(err, ErrMissingClaim):
+		return "missing_claim"
+	case errors.Is(err, ErrClientNotAllowed):
+		return "client_not_allowed"
+	case errors.Is(err, ErrTokenRevoked):
+		return "revoked"
+	case errors.Is(err, ErrInvalidTokenType):
+		return "bad_token_type"
+	case errors.Is(err, ErrTokenInactive):
+		return "inactive"
+	case errors.Is(err, ErrIntrospectionFailed):
+		return "introspection_failed"
+	case errors.Is(err, ErrInvalidDPoPProof):
+		return "bad_dpop_proof"
+	case errors.Is(err, ErrDPoPRequired):
+		return "dpop_required"
+	case errors.Is(err, ErrDPoPBinding):
+		return "dpop_binding"
+	case errors.Is(err, ErrCertificateBinding):
+		return "certificate_binding"
+	default:
+		return "invalid_token"
+	}
+}
+
 // fetchJWKS fetches the JSON Web Key Set from Auth0
-func fetchJWKS(domain string) (*JWKS, error) {
+func fetchJWKS(ctx context.Context, domain string) (jwks *JWKS, err error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "auth.fetchJWKS")
+	defer func() {
+		metrics.ObserveJWKSFetch(start, err)
+		tracing.EndSpan(span, err)
+	}()
+
 	url := fmt.Sprintf("https://%s/.well-known/jwks.json", domain)
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := jwksClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var jwks JWKS
-	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+	jwks = &JWKS{}
+	if err := json.NewDecoder(resp.Body).Decode(jwks); err != nil {
 		return nil, err
 	}
 
-	return &jwks, nil
+	return jwks, nil
 }
 
 // findKey finds a key in JWKS by kid
@@ -227,13 +553,3 @@ func convertKey(key *JSONWebKey) (*rsa.PublicKey, error) {
 		E: e,
 	}, nil
 }
-
-// GetUserFromContext extracts user info from context
-func GetUserFromContext(ctx context.Context) (*UserInfo, error) {
-	user, ok := ctx.Value(UserContextKey).(*UserInfo)
-	if !ok {
-		return nil, errors.New("user not found in context")
-	}
-	return user, nil
-}
-
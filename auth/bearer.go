@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Authorization schemes accepted for access tokens
+const (
+	SchemeBearer = "Bearer"
+	SchemeDPoP   = "DPoP"
+)
+
+// Error codes of the WWW-Authenticate Bearer challenge (RFC 6750 section 3.1)
+// and the DPoP challenge (RFC 9449 section 7.1)
+const (
+	ChallengeInvalidRequest    = "invalid_request"
+	ChallengeInvalidToken      = "invalid_token"
+	ChallengeInsufficientScope = "insufficient_scope"
+	ChallengeInvalidDPoPProof  = "invalid_dpop_proof"
+)
+
+// b64token is the token syntax of RFC 6750 section 2.1
+var b64token = regexp.MustCompile(`^[A-Za-z0-9\-._~+/]+=*$`)
+
+// ParseAuthorization returns the token of an Authorization header value
+// using the Bearer scheme. The scheme is matched case-insensitively and
+// surrounding whitespace is ignored.
+func ParseAuthorization(value string) (string, error) {
+	scheme, token, err := parseCredentials(value)
+	if err != nil || scheme != SchemeBearer {
+		return "", ErrInvalidHeader
+	}
+	return token, nil
+}
+
+// parseCredentials returns the scheme, Bearer or DPoP, and the token of an
+// Authorization header value
+func parseCredentials(value string) (scheme, token string, err error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 || !b64token.MatchString(fields[1]) {
+		return "", "", ErrInvalidHeader
+	}
+	switch {
+	case strings.EqualFold(fields[0], SchemeBearer):
+		return SchemeBearer, fields[1], nil
+	case strings.EqualFold(fields[0], SchemeDPoP):
+		return SchemeDPoP, fields[1], nil
+	default:
+		return "", "", ErrInvalidHeader
+	}
+}
+
+// tokenFromRequest returns the scheme and access token of r from the
+// Authorization header or, when none is sent, the configured cookie, which
+// holds a Bearer token. It returns ErrMissingHeader when the request carries
+// no token at all.
+func tokenFromRequest(r *http.Request, config Auth0Config) (scheme, token string, err error) {
+	if values := r.Header.Values("Authorization"); len(values) > 0 {
+		if len(values) > 1 {
+			return "", "", ErrInvalidHeader
+		}
+		return parseCredentials(values[0])
+	}
+
+	if config.TokenCookie != "" && !isFormPost(r) {
+		if cookie, err := r.Cookie(config.TokenCookie); err == nil && cookie.Value != "" {
+			if !b64token.MatchString(cookie.Value) {
+				return "", "", ErrInvalidHeader
+			}
+			return SchemeBearer, cookie.Value, nil
+		}
+	}
+
+	return "", "", ErrMissingHeader
+}
+
+// isFormPost reports whether r is a form submission, which browsers send
+// cross-site without a CORS preflight. Cookie tokens are ignored on such
+// requests so another site can't make them on the user's behalf.
+func isFormPost(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded", "multipart/form-data", "text/plain", "":
+		return true
+	default:
+		return false
+	}
+}
+
+// writeChallenge responds with status and a Bearer WWW-Authenticate
+// challenge. code and description are omitted when code is empty, as for
+// requests that carry no credentials, and scope when it is empty.
+func writeChallenge(w http.ResponseWriter, status int, code, description, scope string) {
+	writeChallenges(w, status, description, formatChallenge(SchemeBearer, "error", code, "error_description", description, "scope", scope))
+}
+
+// writeChallenges responds with status and a WWW-Authenticate header for
+// each challenge. The body is message, or a generic one when it is empty, and
+// must be a fixed message rather than validation details.
+func writeChallenges(w http.ResponseWriter, status int, message string, challenges ...string) {
+	for _, challenge := range challenges {
+		w.Header().Add("WWW-Authenticate", challenge)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if message == "" {
+		message = "access token required"
+	}
+	http.Error(w, message, status)
+}
+
+// formatChallenge formats a challenge for scheme from name and value pairs,
+// leaving out empty values
+func formatChallenge(scheme string, params ...string) string {
+	challenge := scheme
+	separator := " "
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] == "" {
+			continue
+		}
+		challenge += separator + params[i] + `="` + params[i+1] + `"`
+		separator = ", "
+	}
+	return challenge
+}
+
+// RequirePermission guards a plain HTTP handler, rejecting principals that
+// lack permission with a 403 insufficient_scope challenge. It must run after
+// Middleware.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := GetPrincipalFromContext(r.Context())
+			if err != nil {
+				writeChallenge(w, http.StatusUnauthorized, "", "", "")
+				return
+			}
+			if !principal.HasPermission(permission) {
+				writeChallenge(w, http.StatusForbidden, ChallengeInsufficientScope, "the access token lacks a required permission", permission)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tokenErrorDescription returns the client-facing description of a token
+// rejection. Only expiry is distinguished so callers learn nothing about
+// how validation works.
+func tokenErrorDescription(err error) string {
+	if errors.Is(err, ErrTokenExpired) {
+		return "the access token expired"
+	}
+	if errors.Is(err, ErrDPoPRequired) {
+		return "the access token must be sent with a DPoP proof"
+	}
+	if errors.Is(err, ErrCertificateBinding) {
+		return "the access token is not bound to the client certificate presented"
+	}
+	return "the access token is invalid"
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultLeeway is the clock skew tolerated when Auth0Config.Leeway is unset
+const DefaultLeeway = 30 * time.Second
+
+// leeway returns the clock skew tolerance of config
+func leeway(config Auth0Config) time.Duration {
+	if config.Leeway <= 0 {
+		return DefaultLeeway
+	}
+	return config.Leeway
+}
+
+// auth0Methods are the algorithms Auth0 signs access tokens with
+var auth0Methods = []string{"RS256", "RS384", "RS512"}
+
+// newParser returns a JWT parser that accepts methods, requires exp, rejects
+// tokens used before nbf or iat, and checks iss and aud, all within the
+// configured leeway
+func newParser(config Auth0Config, issuer string, methods []string) *jwt.Parser {
+	return jwt.NewParser(
+		jwt.WithValidMethods(methods),
+		jwt.WithLeeway(leeway(config)),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(config.Audience),
+	)
+}
+
+// tokenError maps a parser error to the errors of this package so metrics
+// and audit events can tell rejections apart
+func tokenError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return fmt.Errorf("%w: %v", ErrTokenNotYetValid, err)
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrInvalidAudience
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrInvalidIssuer
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return fmt.Errorf("%w: %v", ErrMissingClaim, err)
+	default:
+		return err
+	}
+}
+
+// checkClaims enforces the claim requirements the parser doesn't: the
+// configured required claims and the maximum token age at now
+func checkClaims(claims jwt.MapClaims, config Auth0Config, now time.Time) error {
+	for _, name := range config.RequiredClaims {
+		if value, ok := claims[name]; !ok || value == nil || value == "" {
+			return fmt.Errorf("%w: %s", ErrMissingClaim, name)
+		}
+	}
+
+	if config.MaxTokenAge > 0 {
+		issuedAt, err := claims.GetIssuedAt()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrMissingClaim, err)
+		}
+		if issuedAt == nil {
+			return fmt.Errorf("%w: iat", ErrMissingClaim)
+		}
+		if now.Sub(issuedAt.Time) > config.MaxTokenAge+leeway(config) {
+			return ErrTokenTooOld
+		}
+	}
+
+	return nil
+}
+
+// clientAllowed reports whether tokens issued to clientID are accepted
+func clientAllowed(config Auth0Config, clientID string) bool {
+	return len(config.AllowedClients) == 0 || slices.Contains(config.AllowedClients, clientID)
+}
+
+// ParseList splits a comma or space separated setting such as
+// AUTH_REQUIRED_CLAIMS into its entries
+func ParseList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
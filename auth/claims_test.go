@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testAuth0 serves a JWKS for a locally generated key, standing in for an
+// Auth0 tenant
+type testAuth0 struct {
+	domain string
+	key    *rsa.PrivateKey
+}
+
+// newTestAuth0 starts a tenant and points the JWKS client at it until the
+// test ends
+func newTestAuth0(t *testing.T) *testAuth0 {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(JWKS{Keys: []JSONWebKey{{
+			Kty: "RSA",
+			Kid: "test-key",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(srv.Close)
+
+	client := jwksClient
+	jwksClient = srv.Client()
+	t.Cleanup(func() { jwksClient = client })
+
+	return &testAuth0{domain: strings.TrimPrefix(srv.URL, "https://"), key: key}
+}
+
+// issuer returns the iss claim of the tenant's tokens
+func (a *testAuth0) issuer() string {
+	return "https://" + a.domain + "/"
+}
+
+// sign returns a token with claims signed by the tenant's key
+func (a *testAuth0) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAuthenticateClaims(t *testing.T) {
+	tenant := newTestAuth0(t)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		claims  func(jwt.MapClaims)
+		config  func(*Auth0Config)
+		wantErr error // nil means the token is accepted
+	}{
+		{name: "valid"},
+		{
+			name:   "expired within leeway",
+			claims: func(c jwt.MapClaims) { c["exp"] = now.Add(-10 * time.Second).Unix() },
+		},
+		{
+			name:    "expired",
+			claims:  func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() },
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name:    "expired beyond custom leeway",
+			claims:  func(c jwt.MapClaims) { c["exp"] = now.Add(-3 * time.Minute).Unix() },
+			config:  func(c *Auth0Config) { c.Leeway = 2 * time.Minute },
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name:   "expired within custom leeway",
+			claims: func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() },
+			config: func(c *Auth0Config) { c.Leeway = 2 * time.Minute },
+		},
+		{
+			name:    "no exp",
+			claims:  func(c jwt.MapClaims) { delete(c, "exp") },
+			wantErr: ErrMissingClaim,
+		},
+		{
+			name:    "nbf in the future",
+			claims:  func(c jwt.MapClaims) { c["nbf"] = now.Add(time.Minute).Unix() },
+			wantErr: ErrTokenNotYetValid,
+		},
+		{
+			name:   "nbf within leeway",
+			claims: func(c jwt.MapClaims) { c["nbf"] = now.Add(10 * time.Second).Unix() },
+		},
+		{
+			name:    "iat in the future",
+			claims:  func(c jwt.MapClaims) { c["iat"] = now.Add(time.Minute).Unix() },
+			wantErr: ErrTokenNotYetValid,
+		},
+		{
+			name:   "iat within leeway",
+			claims: func(c jwt.MapClaims) { c["iat"] = now.Add(10 * time.Second).Unix() },
+		},
+		{
+			name:    "wrong audience",
+			claims:  func(c jwt.MapClaims) { c["aud"] = []string{"other", "another"} },
+			wantErr: ErrInvalidAudience,
+		},
+		{
+			name:   "audience in a list",
+			claims: func(c jwt.MapClaims) { c["aud"] = []string{"other", "https://api.example.com"} },
+		},
+		{
+			name:    "wrong issuer",
+			claims:  func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com/" },
+			wantErr: ErrInvalidIssuer,
+		},
+		{
+			name:   "younger than max age",
+			claims: func(c jwt.MapClaims) { c["iat"] = now.Add(-30 * time.Minute).Unix() },
+			config: func(c *Auth0Config) { c.MaxTokenAge = time.Hour },
+		},
+		{
+			name:    "older than max age",
+			claims:  func(c jwt.MapClaims) { c["iat"] = now.Add(-2 * time.Hour).Unix() },
+			config:  func(c *Auth0Config) { c.MaxTokenAge = time.Hour },
+			wantErr: ErrTokenTooOld,
+		},
+		{
+			name:    "max age without iat",
+			claims:  func(c jwt.MapClaims) { delete(c, "iat") },
+			config:  func(c *Auth0Config) { c.MaxTokenAge = time.Hour },
+			wantErr: ErrMissingClaim,
+		},
+		{
+			name:    "required claim missing",
+			config:  func(c *Auth0Config) { c.RequiredClaims = []string{"email"} },
+			wantErr: ErrMissingClaim,
+		},
+		{
+			name:    "required claim empty",
+			claims:  func(c jwt.MapClaims) { c["email"] = "" },
+			config:  func(c *Auth0Config) { c.RequiredClaims = []string{"email"} },
+			wantErr: ErrMissingClaim,
+		},
+		{
+			name:   "required claim present",
+			claims: func(c jwt.MapClaims) { c["email"] = "user@example.com" },
+			config: func(c *Auth0Config) { c.RequiredClaims = []string{"email"} },
+		},
+		{
+			name:   "azp allowed",
+			config: func(c *Auth0Config) { c.AllowedClients = ParseList("spa, mobile") },
+		},
+		{
+			name:    "azp not allowed",
+			config:  func(c *Auth0Config) { c.AllowedClients = []string{"mobile"} },
+			wantErr: ErrClientNotAllowed,
+		},
+		{
+			name:   "client_id allowed",
+			claims: func(c jwt.MapClaims) { delete(c, "azp"); c["client_id"] = "mobile" },
+			config: func(c *Auth0Config) { c.AllowedClients = ParseList("spa mobile") },
+		},
+		{
+			name:    "client_id not allowed",
+			claims:  func(c jwt.MapClaims) { delete(c, "azp"); c["client_id"] = "other" },
+			config:  func(c *Auth0Config) { c.AllowedClients = []string{"spa"} },
+			wantErr: ErrClientNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{
+				"iss": tenant.issuer(),
+				"sub": "auth0|user1",
+				"aud": "https://api.example.com",
+				"azp": "spa",
+				"iat": now.Unix(),
+				"exp": now.Add(time.Hour).Unix(),
+			}
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			config := Auth0Config{Domain: tenant.domain, Audience: "https://api.example.com"}
+			if tt.config != nil {
+				tt.config(&config)
+			}
+
+			user, err := Authenticate(context.Background(), config, tenant.sign(t, claims))
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Authenticate() error = %v, want nil", err)
+				}
+				if user.UserID != "auth0|user1" || user.Issuer != tenant.issuer() {
+					t.Errorf("Authenticate() = %q from %q, want auth0|user1 from %q", user.UserID, user.Issuer, tenant.issuer())
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRejectsUnknownKey(t *testing.T) {
+	tenant := newTestAuth0(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := &testAuth0{domain: tenant.domain, key: other}
+
+	token := forged.sign(t, jwt.MapClaims{
+		"iss": tenant.issuer(),
+		"sub": "auth0|user1",
+		"aud": "https://api.example.com",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	config := Auth0Config{Domain: tenant.domain, Audience: "https://api.example.com"}
+	if _, err := Authenticate(context.Background(), config, token); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Fatalf("Authenticate() error = %v, want %v", err, jwt.ErrTokenSignatureInvalid)
+	}
+}
@@ -0,0 +1,440 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Defaults for DPoPConfig
+const (
+	DefaultDPoPProofLifetime = time.Minute
+	DefaultDPoPReplayCache   = 100000
+)
+
+// DefaultDPoPAlgorithms are the proof signature algorithms accepted when
+// DPoPConfig.Algorithms is empty
+var DefaultDPoPAlgorithms = []string{"ES256", "ES384", "ES512", "PS256", "RS256", "EdDSA"}
+
+// dpopProofType is the typ header of a DPoP proof
+const dpopProofType = "dpop+jwt"
+
+// maxDPoPJTI bounds the length of a proof's jti
+const maxDPoPJTI = 256
+
+// Errors returned when a DPoP proof is rejected
+var (
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+	ErrDPoPRequired     = errors.New("DPoP proof required")
+	ErrDPoPBinding      = errors.New("DPoP proof does not match the token binding")
+)
+
+// DPoPConfig configures DPoP (RFC 9449) sender-constrained tokens. Tokens
+// bound to a key with a cnf.jkt claim always need a proof from that key;
+// Required, RequiredAudiences and RequiredPaths also refuse unbound Bearer
+// tokens.
+type DPoPConfig struct {
+	Required          bool     // every request must use DPoP
+	RequiredAudiences []string // tokens issued for any of these audiences must use DPoP
+	RequiredPaths     []string // requests to paths with any of these prefixes must use DPoP
+
+	Algorithms    []string      // proof signature algorithms (default DefaultDPoPAlgorithms)
+	ProofLifetime time.Duration // how long after its iat a proof is accepted (default 1m)
+	ReplayCache   int           // proof jti values remembered (default 100000)
+
+	// BaseURL is the public scheme and host the htu claim is checked
+	// against, for servers behind a proxy. By default it comes from the
+	// request, and from X-Forwarded-Proto when the request comes from one of
+	// TrustedProxies.
+	BaseURL        string
+	TrustedProxies []netip.Prefix
+}
+
+// DPoPVerifier checks DPoP proofs and their binding to access tokens. Proof
+// jti values are remembered in memory to refuse replays, so a proof replayed
+// to another instance is only caught by its short lifetime.
+type DPoPVerifier struct {
+	config DPoPConfig
+
+	mu    sync.Mutex
+	seen  map[string]time.Time // proof jti to when it can be forgotten
+	order []seenProof          // entries of seen, oldest first
+}
+
+// seenProof is a remembered proof jti
+type seenProof struct {
+	id      string
+	expires time.Time
+}
+
+// dpopProof is a verified proof, not yet checked for replay
+type dpopProof struct {
+	thumbprint string    // JWK SHA-256 thumbprint of the proof key (RFC 7638)
+	id         string    // jti
+	expires    time.Time // when the proof is no longer accepted
+}
+
+// dpopClaims are the claims of a DPoP proof
+type dpopClaims struct {
+	jwt.RegisteredClaims
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath"`
+}
+
+// NewDPoPVerifier creates a verifier for config
+func NewDPoPVerifier(config DPoPConfig) (*DPoPVerifier, error) {
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = DefaultDPoPAlgorithms
+	}
+	for _, alg := range config.Algorithms {
+		if strings.HasPrefix(alg, "HS") || alg == "none" {
+			return nil, fmt.Errorf("DPoP proofs must use an asymmetric algorithm, not %s", alg)
+		}
+		if jwt.GetSigningMethod(alg) == nil {
+			return nil, fmt.Errorf("unknown DPoP proof algorithm: %s", alg)
+		}
+	}
+	if config.ProofLifetime <= 0 {
+		config.ProofLifetime = DefaultDPoPProofLifetime
+	}
+	if config.ReplayCache <= 0 {
+		config.ReplayCache = DefaultDPoPReplayCache
+	}
+	if config.BaseURL != "" {
+		base, err := url.Parse(config.BaseURL)
+		if err != nil || base.Scheme == "" || base.Host == "" {
+			return nil, fmt.Errorf("invalid DPoP base URL: %q", config.BaseURL)
+		}
+	}
+
+	return &DPoPVerifier{config: config, seen: make(map[string]time.Time)}, nil
+}
+
+// algorithms returns the accepted proof algorithms as a challenge parameter
+func (d *DPoPVerifier) algorithms() string {
+	return strings.Join(d.config.Algorithms, " ")
+}
+
+// pathRequired reports whether requests to the path of r must use DPoP
+func (d *DPoPVerifier) pathRequired(r *http.Request) bool {
+	if d == nil {
+		return false
+	}
+	if d.config.Required {
+		return true
+	}
+	for _, prefix := range d.config.RequiredPaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// required reports whether the token of info must be sent with a proof. r
+// is nil for websocket connections, which are authenticated without one.
+func (d *DPoPVerifier) required(r *http.Request, info *UserInfo) bool {
+	if info.Confirmation != "" {
+		return true
+	}
+	if d == nil {
+		return false
+	}
+	if r == nil && d.config.Required || r != nil && d.pathRequired(r) {
+		return true
+	}
+	for _, audience := range info.Audience {
+		if slices.Contains(d.config.RequiredAudiences, audience) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyProof checks the DPoP header of r: a single proof JWT of type
+// dpop+jwt, signed with the public key in its jwk header by an accepted
+// algorithm, for the method and URL of r and the hash of accessToken, and
+// issued within the proof lifetime
+func (d *DPoPVerifier) verifyProof(r *http.Request, accessToken string, leeway time.Duration) (*dpopProof, error) {
+	values := r.Header.Values("DPoP")
+	if len(values) != 1 {
+		return nil, fmt.Errorf("%w: exactly one DPoP header is required", ErrInvalidDPoPProof)
+	}
+
+	var claims dpopClaims
+	var thumbprint string
+	parser := jwt.NewParser(jwt.WithValidMethods(d.config.Algorithms), jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(values[0], &claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != dpopProofType {
+			return nil, fmt.Errorf("typ must be %s", dpopProofType)
+		}
+		jwk, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("jwk header not found")
+		}
+		key, keyThumbprint, err := jwkPublicKey(jwk)
+		if err != nil {
+			return nil, err
+		}
+		thumbprint = keyThumbprint
+		return key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	if claims.ID == "" || len(claims.ID) > maxDPoPJTI {
+		return nil, fmt.Errorf("%w: invalid jti", ErrInvalidDPoPProof)
+	}
+	if claims.HTM != r.Method {
+		return nil, fmt.Errorf("%w: htm does not match the request method", ErrInvalidDPoPProof)
+	}
+	if normalizeHTU(claims.HTU) != normalizeHTU(d.requestURL(r)) {
+		return nil, fmt.Errorf("%w: htu does not match the request URL", ErrInvalidDPoPProof)
+	}
+	if claims.ATH != accessTokenHash(accessToken) {
+		return nil, fmt.Errorf("%w: ath does not match the access token", ErrInvalidDPoPProof)
+	}
+
+	if claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: iat is required", ErrInvalidDPoPProof)
+	}
+	now := time.Now()
+	issuedAt := claims.IssuedAt.Time
+	if issuedAt.After(now.Add(leeway)) {
+		return nil, fmt.Errorf("%w: iat is in the future", ErrInvalidDPoPProof)
+	}
+	expires := issuedAt.Add(d.config.ProofLifetime + leeway)
+	if !now.Before(expires) {
+		return nil, fmt.Errorf("%w: proof is too old", ErrInvalidDPoPProof)
+	}
+
+	return &dpopProof{thumbprint: thumbprint, id: claims.ID, expires: expires}, nil
+}
+
+// checkBinding checks that info, authenticated from a request sent with
+// proof, may be used that way. proof is nil for Bearer requests, which are
+// refused when DPoP is required. It is safe to call on a nil *DPoPVerifier,
+// which still refuses bound tokens sent without a proof.
+func (d *DPoPVerifier) checkBinding(r *http.Request, proof *dpopProof, info *UserInfo) error {
+	if proof == nil {
+		if d.required(r, info) {
+			return ErrDPoPRequired
+		}
+		return nil
+	}
+
+	if info.Confirmation == "" {
+		return fmt.Errorf("%w: the access token is not DPoP-bound", ErrDPoPBinding)
+	}
+	if info.Confirmation != proof.thumbprint {
+		return ErrDPoPBinding
+	}
+	// Only proofs for valid, bound tokens are remembered, so the cache can't
+	// be filled without one
+	if d.replayed(proof) {
+		return fmt.Errorf("%w: proof replayed", ErrInvalidDPoPProof)
+	}
+	return nil
+}
+
+// replayed records the jti of proof, reporting whether it was already used
+func (d *DPoPVerifier) replayed(proof *dpopProof) bool {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if expires, ok := d.seen[proof.id]; ok && now.Before(expires) {
+		return true
+	}
+	if len(d.seen) >= d.config.ReplayCache {
+		d.forget(now)
+	}
+	d.seen[proof.id] = proof.expires
+	d.order = append(d.order, seenProof{id: proof.id, expires: proof.expires})
+	return false
+}
+
+// forget removes expired proofs and, when the cache is still full, the
+// oldest ones. Their replay window is cut short, but refusing every proof
+// would let one client flooding proofs lock out all others. The caller
+// holds d.mu.
+func (d *DPoPVerifier) forget(now time.Time) {
+	kept := d.order[:0]
+	for _, entry := range d.order {
+		// Entries of a jti that was seen again are superseded
+		if expires, ok := d.seen[entry.id]; !ok || !expires.Equal(entry.expires) {
+			continue
+		}
+		if !now.Before(entry.expires) {
+			delete(d.seen, entry.id)
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	d.order = kept
+
+	for len(d.seen) >= d.config.ReplayCache {
+		delete(d.seen, d.order[0].id)
+		d.order = d.order[1:]
+	}
+}
+
+// requestURL returns the URL of r as the client addressed it
+func (d *DPoPVerifier) requestURL(r *http.Request) string {
+	if d.config.BaseURL != "" {
+		return strings.TrimSuffix(d.config.BaseURL, "/") + r.URL.Path
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" && audit.FromTrustedProxy(r, d.config.TrustedProxies) {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// normalizeHTU returns htu without its query and fragment, with the scheme
+// and host lowercased and a default port removed (RFC 9449 section 4.3)
+func normalizeHTU(htu string) string {
+	u, err := url.Parse(htu)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(scheme == "https" && port == "443") && !(scheme == "http" && port == "80") {
+		host += ":" + port
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return scheme + "://" + host + path
+}
+
+// accessTokenHash returns the ath claim value for token
+func accessTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// jwkPublicKey returns the public key of an EC, RSA or Ed25519 JWK and its
+// SHA-256 thumbprint (RFC 7638). Private keys are refused.
+func jwkPublicKey(jwk map[string]interface{}) (key interface{}, thumbprint string, err error) {
+	member := func(name string) string {
+		value, _ := jwk[name].(string)
+		return value
+	}
+	if _, ok := jwk["d"]; ok {
+		return nil, "", errors.New("jwk must not contain a private key")
+	}
+
+	// The thumbprint covers the required members only; encoding/json sorts
+	// map keys as RFC 7638 requires
+	var required map[string]string
+	switch member("kty") {
+	case "EC":
+		var curve elliptic.Curve
+		switch member("crv") {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, "", fmt.Errorf("unsupported EC curve: %s", member("crv"))
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(member("x"))
+		y, errY := base64.RawURLEncoding.DecodeString(member("y"))
+		if errX != nil || errY != nil {
+			return nil, "", errors.New("invalid EC coordinates")
+		}
+		public := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(public.X, public.Y) {
+			return nil, "", errors.New("EC point is not on the curve")
+		}
+		key = public
+		required = map[string]string{"crv": member("crv"), "kty": "EC", "x": member("x"), "y": member("y")}
+	case "RSA":
+		public, err := convertKey(&JSONWebKey{N: member("n"), E: member("e")})
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid RSA key: %w", err)
+		}
+		if public.N.BitLen() < 2048 || public.E < 3 {
+			return nil, "", errors.New("RSA key is too weak")
+		}
+		key = public
+		required = map[string]string{"e": member("e"), "kty": "RSA", "n": member("n")}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(member("x"))
+		if member("crv") != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, "", errors.New("unsupported OKP key")
+		}
+		key = ed25519.PublicKey(x)
+		required = map[string]string{"crv": "Ed25519", "kty": "OKP", "x": member("x")}
+	default:
+		return nil, "", fmt.Errorf("unsupported key type: %s", member("kty"))
+	}
+
+	canonical, err := json.Marshal(required)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return key, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// missingTokenChallenges returns the challenges sent to requests without a
+// token: Bearer unless DPoP is required for r, and DPoP when it is enabled
+func missingTokenChallenges(r *http.Request, config Auth0Config) []string {
+	var challenges []string
+	if !config.DPoP.pathRequired(r) {
+		challenges = append(challenges, SchemeBearer)
+	}
+	if config.DPoP != nil {
+		challenges = append(challenges, formatChallenge(SchemeDPoP, "algs", config.DPoP.algorithms()))
+	}
+	return challenges
+}
+
+// writeTokenError responds to a request whose token was refused with a
+// challenge for the scheme the client should use
+func writeTokenError(w http.ResponseWriter, config Auth0Config, scheme string, err error) {
+	description := tokenErrorDescription(err)
+	if scheme == SchemeDPoP || errors.Is(err, ErrDPoPRequired) {
+		code := ChallengeInvalidToken
+		if errors.Is(err, ErrInvalidDPoPProof) {
+			code = ChallengeInvalidDPoPProof
+			description = "the DPoP proof is invalid"
+		}
+		var algs string
+		if config.DPoP != nil {
+			algs = config.DPoP.algorithms()
+		}
+		writeChallenges(w, http.StatusUnauthorized, description,
+			formatChallenge(SchemeDPoP, "error", code, "error_description", description, "algs", algs))
+		return
+	}
+	writeChallenge(w, http.StatusUnauthorized, ChallengeInvalidToken, description, "")
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testDPoPKey is a client's DPoP key pair
+type testDPoPKey struct {
+	key        *ecdsa.PrivateKey
+	jwk        map[string]string
+	thumbprint string
+}
+
+func newTestDPoPKey(t *testing.T) *testDPoPKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+	canonical := `{"crv":"P-256","kty":"EC","x":"` + jwk["x"] + `","y":"` + jwk["y"] + `"}`
+	sum := sha256.Sum256([]byte(canonical))
+	return &testDPoPKey{key: key, jwk: jwk, thumbprint: base64.RawURLEncoding.EncodeToString(sum[:])}
+}
+
+// proof returns a proof signed by the key for a GET of
+// http://api.example.com/query with accessToken, changed by overrides
+func (k *testDPoPKey) proof(t *testing.T, accessToken string, overrides jwt.MapClaims) string {
+	t.Helper()
+	jti := make([]byte, 16)
+	rand.Read(jti)
+	claims := jwt.MapClaims{
+		"htm": http.MethodGet,
+		"htu": "http://api.example.com/query",
+		"ath": accessTokenHash(accessToken),
+		"iat": time.Now().Unix(),
+		"jti": base64.RawURLEncoding.EncodeToString(jti),
+	}
+	for name, value := range overrides {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = k.jwk
+	signed, err := token.SignedString(k.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// newDPoPServer returns a handler requiring tokens from tenant with DPoP
+// configured by dpopConfig, answering with the authenticated user ID
+func newDPoPServer(t *testing.T, tenant *testAuth0, dpopConfig DPoPConfig) http.Handler {
+	t.Helper()
+	verifier, err := NewDPoPVerifier(dpopConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Auth0Config{Domain: tenant.domain, Audience: "https://api.example.com", DPoP: verifier}
+	return Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, err := GetUserFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(info.UserID))
+	}))
+}
+
+// dpopRequest sends a DPoP request for the query endpoint to handler and
+// returns the status and the error of its challenge
+func dpopRequest(handler http.Handler, accessToken, proof string, prepare func(*http.Request)) (int, string) {
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/query", nil)
+	r.Header.Set("Authorization", "DPoP "+accessToken)
+	r.Header.Set("DPoP", proof)
+	if prepare != nil {
+		prepare(r)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	challenge := w.Header().Get("WWW-Authenticate")
+	if _, rest, ok := strings.Cut(challenge, `error="`); ok {
+		challenge, _, _ = strings.Cut(rest, `"`)
+	}
+	return w.Code, challenge
+}
+
+// boundToken returns a token from tenant bound to the key with thumbprint
+func boundToken(t *testing.T, tenant *testAuth0, thumbprint string) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"iss": tenant.issuer(),
+		"sub": "auth0|user1",
+		"aud": "https://api.example.com",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if thumbprint != "" {
+		claims["cnf"] = map[string]any{"jkt": thumbprint}
+	}
+	return tenant.sign(t, claims)
+}
+
+func TestDPoPProofs(t *testing.T) {
+	tenant := newTestAuth0(t)
+	key := newTestDPoPKey(t)
+	other := newTestDPoPKey(t)
+	token := boundToken(t, tenant, key.thumbprint)
+	handler := newDPoPServer(t, tenant, DPoPConfig{})
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		token     string
+		proof     string
+		prepare   func(*http.Request)
+		wantCode  int
+		wantError string
+	}{
+		{name: "valid", token: token, proof: key.proof(t, token, nil), wantCode: http.StatusOK},
+		{name: "iat within leeway", token: token, proof: key.proof(t, token, jwt.MapClaims{"iat": now.Add(10 * time.Second).Unix()}), wantCode: http.StatusOK},
+		{name: "htu with a query", token: token, proof: key.proof(t, token, jwt.MapClaims{"htu": "http://API.example.com:80/query?x=1"}), wantCode: http.StatusOK},
+		{name: "htm mismatch", token: token, proof: key.proof(t, token, jwt.MapClaims{"htm": http.MethodPost}), wantCode: http.StatusUnauthorized, wantError: ChallengeInvalidDPoPProof},
+		{name: "htu path mismatch", token: token, proof: key.proof(t, token, jwt.MapClaims{"htu": "http://api.example.com/other"}), wantCode: http.StatusUnauthorized, wantError: ChallengeInvalidDPoPProof},
+		{name: "htu scheme mismatch", token: token, proof: key.proof(t, token, jwt.MapClaims{"htu": "https://api.example.com/query"}), wantCode: http.StatusUnauthorized, wantError: ChallengeInvalidDPoPProof},
+		{name: "iat in the future", token: token, proof: key.proof(t, token, jwt.MapClaims{"iat": now.Add(2 * time.Minute).Unix()}), wantCode: http.StatusUnauthorized, wantError: ChallengeInvalidDPoPProof},
+		{name: "iat too old", token: token, proof: key.proof(t, token, jwt.MapClaims{"iat": now.Add(-5 * time.Minute).Unix()}), wantCode: http.StatusUnauthorized, wantError: ChallengeInvalidDPoPProof},
+		{name: "no jti", token: token, proof: key.proof(t, token, jwt.MapClaims{"jti": ""}), wantCode: http.StatusUnauthorized, wantError: ChallengeInvalidDPoPProof},
+		{name: "ath mismatch", token: token, proof: key.proof(t, token, jwt.MapClaims{"ath": accessTokenHash("another token")}), wantCode: http.StatusUnauthorized, wantError: ChallengeInvalidDPoPProof},
+		{name: "cnf.jkt of another key", token: token, proof: other.proof(t, token, nil), wantCode: http.StatusUnauthorized, wantError: ChallengeInvalidToken},
+		{name: "unbound token", token: boundToken(t, tenant, ""), wantCode: http.StatusUnauthorized, wantError: ChallengeInvalidToken},
+		{
+			name:  "two proofs",
+			token: token,
+			proof: key.proof(t, token, nil),
+			prepare: func(r *http.Request) {
+				r.Header.Add("DPoP", key.proof(t, token, nil))
+			},
+			wantCode:  http.StatusUnauthorized,
+			wantError: ChallengeInvalidDPoPProof,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof := tt.proof
+			if proof == "" {
+				proof = key.proof(t, tt.token, nil)
+			}
+			code, challenge := dpopRequest(handler, tt.token, proof, tt.prepare)
+			if code != tt.wantCode || challenge != tt.wantError {
+				t.Errorf("request = %d %q, want %d %q", code, challenge, tt.wantCode, tt.wantError)
+			}
+		})
+	}
+
+	// A bound token can't be sent as a Bearer token
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/query", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("bound token as Bearer = %d, want 401", w.Code)
+	}
+}
+
+func TestDPoPReplay(t *testing.T) {
+	tenant := newTestAuth0(t)
+	key := newTestDPoPKey(t)
+	token := boundToken(t, tenant, key.thumbprint)
+	handler := newDPoPServer(t, tenant, DPoPConfig{ReplayCache: 2})
+
+	proof := key.proof(t, token, nil)
+	if code, _ := dpopRequest(handler, token, proof, nil); code != http.StatusOK {
+		t.Fatalf("first use of a proof = %d, want 200", code)
+	}
+	if code, challenge := dpopRequest(handler, token, proof, nil); code != http.StatusUnauthorized || challenge != ChallengeInvalidDPoPProof {
+		t.Fatalf("replayed proof = %d %q, want 401 %q", code, challenge, ChallengeInvalidDPoPProof)
+	}
+
+	// A full cache forgets the oldest proofs instead of refusing new ones
+	var last string
+	for i := range 3 {
+		last = key.proof(t, token, nil)
+		if code, _ := dpopRequest(handler, token, last, nil); code != http.StatusOK {
+			t.Fatalf("proof %d with a full replay cache = %d, want 200", i, code)
+		}
+	}
+	if code, _ := dpopRequest(handler, token, last, nil); code != http.StatusUnauthorized {
+		t.Errorf("replay of the newest proof = %d, want 401", code)
+	}
+}
+
+func TestDPoPForwardedProto(t *testing.T) {
+	tenant := newTestAuth0(t)
+	key := newTestDPoPKey(t)
+	token := boundToken(t, tenant, key.thumbprint)
+	handler := newDPoPServer(t, tenant, DPoPConfig{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		wantCode   int
+	}{
+		{"from a trusted proxy", "10.1.2.3:4567", http.StatusOK},
+		{"from a client", "192.0.2.1:4567", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof := key.proof(t, token, jwt.MapClaims{"htu": "https://api.example.com/query"})
+			code, _ := dpopRequest(handler, token, proof, func(r *http.Request) {
+				r.RemoteAddr = tt.remoteAddr
+				r.Header.Set("X-Forwarded-Proto", "https")
+			})
+			if code != tt.wantCode {
+				t.Errorf("https proof with X-Forwarded-Proto = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	key := newTestDPoPKey(t)
+	jwk := make(map[string]interface{})
+	for name, value := range key.jwk {
+		jwk[name] = value
+	}
+	jwk["kid"] = "ignored"
+	if _, thumbprint, err := jwkPublicKey(jwk); err != nil || thumbprint != key.thumbprint {
+		t.Errorf("jwkPublicKey() thumbprint = %q, %v, want %q", thumbprint, err, key.thumbprint)
+	}
+
+	jwk["d"] = "private"
+	if _, _, err := jwkPublicKey(jwk); err == nil {
+		t.Error("jwkPublicKey() with a private key succeeded, want an error")
+	}
+	if _, _, err := jwkPublicKey(map[string]interface{}{"kty": "oct", "k": "c2VjcmV0"}); err == nil {
+		t.Error("jwkPublicKey() with a symmetric key succeeded, want an error")
+	}
+}
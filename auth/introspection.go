@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/metrics"
+	"github.com/example/auth0-gqlgen-demo/tracing"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Client authentication methods for the introspection endpoint (RFC 6749 section 2.3.1)
+const (
+	ClientSecretBasic = "client_secret_basic"
+	ClientSecretPost  = "client_secret_post"
+)
+
+// Defaults for IntrospectionConfig
+const (
+	DefaultIntrospectionCacheTTL         = time.Minute
+	DefaultIntrospectionNegativeCacheTTL = 30 * time.Second
+	DefaultIntrospectionCacheSize        = 10000
+	DefaultIntrospectionSubjectPrefix    = "introspection|"
+)
+
+// maxIntrospectionResponse bounds the size of an introspection response
+const maxIntrospectionResponse = 1 << 20
+
+// Errors returned by introspection
+var (
+	ErrTokenInactive       = errors.New("token inactive")
+	ErrIntrospectionFailed = errors.New("token introspection failed")
+)
+
+// IntrospectionConfig configures an RFC 7662 token introspection endpoint
+type IntrospectionConfig struct {
+	Endpoint     string
+	ClientID     string
+	ClientSecret string
+	AuthMethod   string // client_secret_basic (default) or client_secret_post
+
+	// Issuer must match the iss of every active token
+	Issuer string
+	// SubjectPrefix is prepended to the sub and client ID of introspected
+	// tokens, so they can't name an Auth0 user or a registered service client
+	// (default "introspection|")
+	SubjectPrefix string
+
+	CacheTTL         time.Duration // how long active results are reused, capped at the token's exp (default 1m)
+	NegativeCacheTTL time.Duration // how long inactive results are reused (default 30s)
+	CacheSize        int           // results kept (default 10000)
+}
+
+// Introspector verifies opaque tokens, and JWTs that Auth0 didn't issue,
+// through an RFC 7662 introspection endpoint. Results are cached by the
+// SHA-256 hash of the token; errors reaching the endpoint are not cached.
+type Introspector struct {
+	config IntrospectionConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]introspectionResult
+}
+
+// introspectionResult is a cached introspection outcome
+type introspectionResult struct {
+	claims  jwt.MapClaims // nil for inactive tokens
+	expires time.Time
+}
+
+// NewIntrospector creates an introspector for config
+func NewIntrospector(config IntrospectionConfig) (*Introspector, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid introspection endpoint: %q", config.Endpoint)
+	}
+	if config.Issuer == "" {
+		return nil, errors.New("introspection issuer is required")
+	}
+	switch config.AuthMethod {
+	case "":
+		config.AuthMethod = ClientSecretBasic
+	case ClientSecretBasic, ClientSecretPost:
+	default:
+		return nil, fmt.Errorf("unknown introspection client authentication method: %s", config.AuthMethod)
+	}
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = DefaultIntrospectionCacheTTL
+	}
+	if config.NegativeCacheTTL <= 0 {
+		config.NegativeCacheTTL = DefaultIntrospectionNegativeCacheTTL
+	}
+	if config.CacheSize <= 0 {
+		config.CacheSize = DefaultIntrospectionCacheSize
+	}
+	if config.SubjectPrefix == "" {
+		config.SubjectPrefix = DefaultIntrospectionSubjectPrefix
+	}
+
+	return &Introspector{
+		config: config,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: tracing.Transport(nil),
+		},
+		cache: make(map[string]introspectionResult),
+	}, nil
+}
+
+// Introspect returns the principal an active token represents, validating
+// the response against config like a JWT: iss, aud, exp, nbf and iat within
+// the leeway, and the required claims, token age and client allow-list. The
+// principal's user and client IDs carry the subject prefix.
+func (i *Introspector) Introspect(ctx context.Context, token string, config Auth0Config) (*UserInfo, error) {
+	key := tokenHash(token)
+	claims, cached := i.cached(key)
+	if !cached {
+		var err error
+		claims, err = i.introspect(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		i.store(key, claims)
+	}
+	if claims == nil {
+		return nil, ErrTokenInactive
+	}
+
+	if err := i.validate(claims, config); err != nil {
+		return nil, err
+	}
+
+	return userInfoFromClaims(i.namespaced(claims), config, i.config.Issuer)
+}
+
+// validate checks the time, audience and issuer claims of an introspection
+// response and the claim requirements of config
+func (i *Introspector) validate(claims jwt.MapClaims, config Auth0Config) error {
+	err := jwt.NewValidator(
+		jwt.WithLeeway(leeway(config)),
+		jwt.WithIssuedAt(),
+		jwt.WithIssuer(i.config.Issuer),
+		jwt.WithAudience(config.Audience),
+	).Validate(claims)
+	if err != nil {
+		return tokenError(err)
+	}
+	return checkClaims(claims, config, time.Now())
+}
+
+// namespaced returns a copy of claims with the subject prefix added to the
+// claims naming the user and client
+func (i *Introspector) namespaced(claims jwt.MapClaims) jwt.MapClaims {
+	copied := make(jwt.MapClaims, len(claims))
+	for name, value := range claims {
+		copied[name] = value
+	}
+	for _, name := range []string{"sub", "azp", "client_id"} {
+		if value, ok := copied[name].(string); ok && value != "" {
+			copied[name] = i.config.SubjectPrefix + value
+		}
+	}
+	return copied
+}
+
+// introspect calls the endpoint, returning the claims of an active token or
+// nil for an inactive one
+func (i *Introspector) introspect(ctx context.Context, token string) (claims jwt.MapClaims, err error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "auth.introspect")
+	defer func() {
+		metrics.ObserveIntrospection(start, err)
+		tracing.EndSpan(span, err)
+	}()
+
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	if i.config.AuthMethod == ClientSecretPost {
+		form.Set("client_id", i.config.ClientID)
+		form.Set("client_secret", i.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.config.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.config.AuthMethod == ClientSecretBasic {
+		// RFC 6749 section 2.3.1 form-encodes the credentials before Basic encoding
+		req.SetBasicAuth(url.QueryEscape(i.config.ClientID), url.QueryEscape(i.config.ClientSecret))
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: endpoint returned %s", ErrIntrospectionFailed, resp.Status)
+	}
+
+	var response jwt.MapClaims
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxIntrospectionResponse)).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%w: invalid response: %v", ErrIntrospectionFailed, err)
+	}
+	if active, _ := response["active"].(bool); !active {
+		return nil, nil
+	}
+
+	// Client credentials tokens have no user; name the principal the way
+	// Auth0 names service clients
+	if _, ok := response["sub"]; !ok {
+		if clientID, _ := response["client_id"].(string); clientID != "" {
+			response["sub"] = clientID + serviceSubjectSuffix
+		}
+	}
+	return response, nil
+}
+
+// cached returns the cached result for key, if it hasn't expired
+func (i *Introspector) cached(key string) (jwt.MapClaims, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	result, ok := i.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(result.expires) {
+		delete(i.cache, key)
+		return nil, false
+	}
+	return result.claims, true
+}
+
+// store caches claims for key, evicting expired results, then arbitrary
+// ones, when the cache is full
+func (i *Introspector) store(key string, claims jwt.MapClaims) {
+	now := time.Now()
+	expires := now.Add(i.config.NegativeCacheTTL)
+	if claims != nil {
+		expires = now.Add(i.config.CacheTTL)
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(expires) {
+			expires = exp.Time
+		}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if len(i.cache) >= i.config.CacheSize {
+		for k, result := range i.cache {
+			if !now.Before(result.expires) {
+				delete(i.cache, k)
+			}
+		}
+		for k := range i.cache {
+			if len(i.cache) < i.config.CacheSize {
+				break
+			}
+			delete(i.cache, k)
+		}
+	}
+	i.cache[key] = introspectionResult{claims: claims, expires: expires}
+}
+
+// verifyToken validates tokenString locally when Auth0 or a trusted issuer
+// issued it and through introspection otherwise, when an Introspector is
+// configured
+func verifyToken(ctx context.Context, tokenString string, config Auth0Config) (*UserInfo, error) {
+	issuer := unverifiedIssuer(tokenString)
+	if trusted := trustedIssuer(config, issuer); trusted != nil {
+		return validateTrustedToken(tokenString, config, trusted)
+	}
+	if config.Introspection != nil && issuer != fmt.Sprintf("https://%s/", config.Domain) {
+		return config.Introspection.Introspect(ctx, tokenString, config)
+	}
+	return validateToken(ctx, tokenString, config)
+}
+
+// unverifiedIssuer returns the iss claim of tokenString if it is a JWT, or
+// "". The signature is checked later by the validator the issuer selects.
+func unverifiedIssuer(tokenString string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return ""
+	}
+	issuer, _ := claims.GetIssuer()
+	return issuer
+}
+
+// tokenHash returns the cache key of token, so raw tokens aren't kept in memory
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testIntrospectionEndpoint answers introspection requests from responses,
+// keyed by token, and counts the requests it receives
+type testIntrospectionEndpoint struct {
+	url      string
+	requests atomic.Int32
+}
+
+func newTestIntrospectionEndpoint(t *testing.T, responses map[string]map[string]any) *testIntrospectionEndpoint {
+	t.Helper()
+	endpoint := &testIntrospectionEndpoint{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint.requests.Add(1)
+		if clientID, secret, ok := r.BasicAuth(); !ok || clientID != "api" || secret != "s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		response, ok := responses[r.PostFormValue("token")]
+		if !ok {
+			response = map[string]any{"active": false}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(srv.Close)
+	endpoint.url = srv.URL
+	return endpoint
+}
+
+// newTestIntrospector creates an introspector for endpoint trusting the
+// partner issuer
+func newTestIntrospector(t *testing.T, endpoint *testIntrospectionEndpoint) *Introspector {
+	t.Helper()
+	introspector, err := NewIntrospector(IntrospectionConfig{
+		Endpoint:     endpoint.url,
+		ClientID:     "api",
+		ClientSecret: "s3cret",
+		Issuer:       "https://partner.example.com/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return introspector
+}
+
+func TestIntrospection(t *testing.T) {
+	now := time.Now()
+	active := func(overrides map[string]any) map[string]any {
+		response := map[string]any{
+			"active": true,
+			"iss":    "https://partner.example.com/",
+			"aud":    "https://api.example.com",
+			"sub":    "user1",
+			"scope":  "read:accounts",
+			"iat":    now.Unix(),
+			"exp":    now.Add(time.Hour).Unix(),
+		}
+		for name, value := range overrides {
+			if value == nil {
+				delete(response, name)
+			} else {
+				response[name] = value
+			}
+		}
+		return response
+	}
+
+	endpoint := newTestIntrospectionEndpoint(t, map[string]map[string]any{
+		"active":           active(nil),
+		"auth0-subject":    active(map[string]any{"sub": "auth0|victim"}),
+		"service":          active(map[string]any{"sub": nil, "client_id": "partner-service"}),
+		"expired":          active(map[string]any{"exp": now.Add(-time.Hour).Unix()}),
+		"no-audience":      active(map[string]any{"aud": nil}),
+		"wrong-audience":   active(map[string]any{"aud": "https://other.example.com"}),
+		"no-issuer":        active(map[string]any{"iss": nil}),
+		"wrong-issuer":     active(map[string]any{"iss": "https://evil.example.com/"}),
+		"inactive-payload": {"active": false, "sub": "user1"},
+	})
+	config := Auth0Config{
+		Domain:        "tenant.example.com",
+		Audience:      "https://api.example.com",
+		Introspection: newTestIntrospector(t, endpoint),
+	}
+
+	tests := []struct {
+		token      string
+		wantUser   string
+		wantClient string
+		wantErr    error
+	}{
+		{token: "active", wantUser: "introspection|user1"},
+		{token: "auth0-subject", wantUser: "introspection|auth0|victim"},
+		{token: "service", wantUser: "introspection|partner-service@clients", wantClient: "introspection|partner-service"},
+		{token: "unknown", wantErr: ErrTokenInactive},
+		{token: "inactive-payload", wantErr: ErrTokenInactive},
+		{token: "expired", wantErr: ErrTokenExpired},
+		{token: "no-audience", wantErr: ErrMissingClaim},
+		{token: "wrong-audience", wantErr: ErrInvalidAudience},
+		{token: "no-issuer", wantErr: ErrMissingClaim},
+		{token: "wrong-issuer", wantErr: ErrInvalidIssuer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			user, err := Authenticate(context.Background(), config, tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v, want nil", err)
+			}
+			if user.UserID != tt.wantUser || user.ClientID != tt.wantClient {
+				t.Errorf("Authenticate() = user %q client %q, want user %q client %q", user.UserID, user.ClientID, tt.wantUser, tt.wantClient)
+			}
+			if user.Issuer != "https://partner.example.com/" {
+				t.Errorf("Issuer = %q, want the introspection issuer", user.Issuer)
+			}
+		})
+	}
+}
+
+func TestIntrospectionCachesResults(t *testing.T) {
+	now := time.Now()
+	endpoint := newTestIntrospectionEndpoint(t, map[string]map[string]any{
+		"active": {
+			"active": true,
+			"iss":    "https://partner.example.com/",
+			"aud":    "https://api.example.com",
+			"sub":    "user1",
+			"exp":    now.Add(time.Hour).Unix(),
+		},
+	})
+	config := Auth0Config{
+		Domain:        "tenant.example.com",
+		Audience:      "https://api.example.com",
+		Introspection: newTestIntrospector(t, endpoint),
+	}
+
+	for range 3 {
+		if _, err := Authenticate(context.Background(), config, "active"); err != nil {
+			t.Fatalf("Authenticate(active) error = %v", err)
+		}
+	}
+	if got := endpoint.requests.Load(); got != 1 {
+		t.Errorf("active token introspected %d times, want 1", got)
+	}
+
+	for range 3 {
+		if _, err := Authenticate(context.Background(), config, "revoked"); !errors.Is(err, ErrTokenInactive) {
+			t.Fatalf("Authenticate(revoked) error = %v, want %v", err, ErrTokenInactive)
+		}
+	}
+	if got := endpoint.requests.Load(); got != 2 {
+		t.Errorf("endpoint called %d times after an inactive token, want 2", got)
+	}
+}
+
+func TestIntrospectionDoesNotCacheFailures(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	config := Auth0Config{
+		Domain:        "tenant.example.com",
+		Audience:      "https://api.example.com",
+		Introspection: newTestIntrospector(t, &testIntrospectionEndpoint{url: srv.URL}),
+	}
+
+	for range 2 {
+		if _, err := Authenticate(context.Background(), config, "active"); !errors.Is(err, ErrIntrospectionFailed) {
+			t.Fatalf("Authenticate() error = %v, want %v", err, ErrIntrospectionFailed)
+		}
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("endpoint called %d times, want 2", got)
+	}
+}
+
+func TestNewIntrospectorRequiresIssuer(t *testing.T) {
+	_, err := NewIntrospector(IntrospectionConfig{Endpoint: "https://partner.example.com/introspect"})
+	if err == nil {
+		t.Fatal("NewIntrospector() without an issuer succeeded, want an error")
+	}
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/example/auth0-gqlgen-demo/metrics"
+)
+
+// ErrCertificateBinding is returned when a certificate-bound token is sent
+// without the client certificate it is bound to
+var ErrCertificateBinding = errors.New("client certificate does not match the token binding")
+
+// certificateContextKey stores the verified client certificate of a request
+const certificateContextKey contextKey = "client_certificate"
+
+// MTLSConfig configures mutual-TLS client authentication (RFC 8705). Tokens
+// bound to a certificate with a cnf.x5t#S256 claim always need that
+// certificate, whether or not MTLS is set.
+type MTLSConfig struct {
+	// CertificatePrincipals authenticates requests that present a verified
+	// client certificate and no token as the service client the certificate
+	// names: its first URI SAN, else its first DNS SAN, else its common name.
+	CertificatePrincipals bool
+
+	// BoundClients lists OAuth clients whose tokens must be bound to the
+	// client certificate presented with them
+	BoundClients []string
+}
+
+// ServerTLSConfig returns the TLS configuration of a server verifying client
+// certificates against the PEM bundle at clientCAFile. Clients may connect
+// without a certificate unless requireClientCert is set. With no bundle,
+// client certificates aren't requested.
+func ServerTLSConfig(clientCAFile string, requireClientCert bool) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		if requireClientCert {
+			return nil, errors.New("a client CA bundle is required to require client certificates")
+		}
+		return config, nil
+	}
+
+	bundle, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in client CA bundle %s", clientCAFile)
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if requireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// verifiedCertificate returns the client certificate of r if the TLS
+// handshake verified it against the client CA bundle, or nil
+func verifiedCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// withCertificate stores the verified client certificate of a request in
+// ctx, so websocket connections can check certificate-bound tokens
+func withCertificate(ctx context.Context, cert *x509.Certificate) context.Context {
+	if cert == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, certificateContextKey, cert)
+}
+
+// certificateFromContext returns the verified client certificate stored by
+// Middleware, or nil
+func certificateFromContext(ctx context.Context) *x509.Certificate {
+	cert, _ := ctx.Value(certificateContextKey).(*x509.Certificate)
+	return cert
+}
+
+// CertificateIdentity returns the client a certificate names: its first URI
+// SAN, such as a SPIFFE ID, else its first DNS SAN, else its common name
+func CertificateIdentity(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
+
+// CertificateThumbprint returns the x5t#S256 confirmation value of cert: the
+// base64url SHA-256 hash of its DER encoding
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// certificatePrincipal returns the service principal of a verified client
+// certificate presented without a token
+func certificatePrincipal(cert *x509.Certificate) *UserInfo {
+	clientID := CertificateIdentity(cert)
+	return &UserInfo{
+		UserID:                clientID + serviceSubjectSuffix,
+		Kind:                  PrincipalService,
+		ClientID:              clientID,
+		CertificateThumbprint: CertificateThumbprint(cert),
+	}
+}
+
+// checkCertificateBinding refuses tokens bound to a certificate other than
+// cert, which is nil when the request presented none, and tokens of
+// BoundClients that aren't bound to cert
+func checkCertificateBinding(config Auth0Config, cert *x509.Certificate, info *UserInfo) error {
+	bound := info.CertificateThumbprint
+	if bound == "" {
+		if config.MTLS != nil && slices.Contains(config.MTLS.BoundClients, info.ClientID) {
+			return fmt.Errorf("%w: tokens of %s must be certificate-bound", ErrCertificateBinding, info.ClientID)
+		}
+		return nil
+	}
+	if cert == nil {
+		return fmt.Errorf("%w: no client certificate presented", ErrCertificateBinding)
+	}
+	if subtle.ConstantTimeCompare([]byte(bound), []byte(CertificateThumbprint(cert))) != 1 {
+		return ErrCertificateBinding
+	}
+	return nil
+}
+
+// authenticateCertificate returns the service principal of a verified client
+// certificate presented without a token, with its registered permissions.
+// Rejections are counted, logged and audited.
+func authenticateCertificate(ctx context.Context, config Auth0Config, cert *x509.Certificate) (*UserInfo, error) {
+	userInfo := certificatePrincipal(cert)
+	if !clientAllowed(config, userInfo.ClientID) {
+		err := fmt.Errorf("%w: %s", ErrClientNotAllowed, userInfo.ClientID)
+		metrics.AuthRequests.WithLabelValues(failureReason(err)).Inc()
+		slog.InfoContext(ctx, "certificate rejected", "reason", failureReason(err), "error", err)
+		recordRejection(ctx, config, err)
+		return nil, err
+	}
+	grantClientPermissions(ctx, config, userInfo)
+	metrics.AuthRequests.WithLabelValues("certificate").Inc()
+
+	return userInfo, nil
+}
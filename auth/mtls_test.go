@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testCA issues client certificates for mTLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// bundle writes the CA certificate to a PEM file and returns its path
+func (ca *testCA) bundle(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "client-ca.pem")
+	if err := os.WriteFile(path, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue returns a client certificate for template's names signed by the CA
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// newMTLSServer starts a server verifying client certificates against ca and
+// answering with the client ID of the authenticated principal
+func newMTLSServer(t *testing.T, ca *testCA, config Auth0Config) *httptest.Server {
+	t.Helper()
+	tlsConfig, err := ServerTLSConfig(ca.bundle(t), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := GetPrincipalFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(principal.ClientID))
+	})))
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// mtlsClient returns a client of srv presenting certs
+func mtlsClient(srv *httptest.Server, certs ...tls.Certificate) *http.Client {
+	transport := srv.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = certs
+	return &http.Client{Transport: transport}
+}
+
+// get requests srv with an optional bearer token and returns the status and body
+func get(t *testing.T, client *http.Client, srv *httptest.Server, token string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := make([]byte, 512)
+	n, _ := resp.Body.Read(body)
+	return resp.StatusCode, string(body[:n])
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+
+	config, err := ServerTLSConfig(ca.bundle(t), true)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig() error = %v", err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert || config.ClientCAs == nil {
+		t.Errorf("ServerTLSConfig(required) ClientAuth = %v, want RequireAndVerifyClientCert with client CAs", config.ClientAuth)
+	}
+
+	if _, err := ServerTLSConfig("", true); err == nil {
+		t.Error("ServerTLSConfig() requiring certificates without a bundle succeeded, want an error")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0o600)
+	if _, err := ServerTLSConfig(empty, false); err == nil {
+		t.Error("ServerTLSConfig() with no certificates in the bundle succeeded, want an error")
+	}
+}
+
+func TestCertificatePrincipal(t *testing.T) {
+	ca := newTestCA(t)
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+
+	tests := []struct {
+		name     string
+		template *x509.Certificate
+		want     string
+	}{
+		{"uri san", &x509.Certificate{URIs: []*url.URL{spiffe}, DNSNames: []string{"billing.internal"}, Subject: pkix.Name{CommonName: "billing"}}, "spiffe://example.org/billing"},
+		{"dns san", &x509.Certificate{DNSNames: []string{"billing.internal"}, Subject: pkix.Name{CommonName: "billing"}}, "billing.internal"},
+		{"common name", &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}, "billing"},
+	}
+
+	srv := newMTLSServer(t, ca, Auth0Config{MTLS: &MTLSConfig{CertificatePrincipals: true}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := ca.issue(t, tt.template)
+			status, body := get(t, mtlsClient(srv, cert), srv, "")
+			if status != http.StatusOK || body != tt.want {
+				t.Fatalf("GET with certificate = %d %q, want 200 %q", status, body, tt.want)
+			}
+
+			principal := certificatePrincipal(cert.Leaf)
+			if principal.Kind != PrincipalService || principal.UserID != tt.want+serviceSubjectSuffix {
+				t.Errorf("certificatePrincipal() = %s %q, want service %q", principal.Kind, principal.UserID, tt.want+serviceSubjectSuffix)
+			}
+			if principal.CertificateThumbprint != CertificateThumbprint(cert.Leaf) {
+				t.Errorf("certificatePrincipal() thumbprint = %q, want %q", principal.CertificateThumbprint, CertificateThumbprint(cert.Leaf))
+			}
+		})
+	}
+
+	// A certificate from another CA fails the handshake
+	other := newTestCA(t).issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}})
+	if resp, err := mtlsClient(srv, other).Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Errorf("GET with an untrusted certificate = %d, want a handshake error", resp.StatusCode)
+	}
+
+	// Without a certificate or token there is no principal
+	if status, _ := get(t, mtlsClient(srv), srv, ""); status != http.StatusUnauthorized {
+		t.Errorf("GET without a certificate = %d, want 401", status)
+	}
+}
+
+func TestCertificateBoundToken(t *testing.T) {
+	tenant := newTestAuth0(t)
+	ca := newTestCA(t)
+	cert := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}})
+	otherCert := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "reporting"}})
+
+	token := func(thumbprint string) string {
+		claims := jwt.MapClaims{
+			"iss": tenant.issuer(),
+			"sub": "billing@clients",
+			"aud": "https://api.example.com",
+			"gty": "client-credentials",
+			"azp": "billing",
+			"iat": time.Now().Unix(),
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		if thumbprint != "" {
+			claims["cnf"] = map[string]any{"x5t#S256": thumbprint}
+		}
+		return tenant.sign(t, claims)
+	}
+	config := Auth0Config{
+		Domain:   tenant.domain,
+		Audience: "https://api.example.com",
+		MTLS:     &MTLSConfig{BoundClients: []string{"billing"}},
+	}
+	srv := newMTLSServer(t, ca, config)
+
+	tests := []struct {
+		name       string
+		certs      []tls.Certificate
+		token      string
+		wantStatus int
+	}{
+		{"bound to the presented certificate", []tls.Certificate{cert}, token(CertificateThumbprint(cert.Leaf)), http.StatusOK},
+		{"bound to another certificate", []tls.Certificate{otherCert}, token(CertificateThumbprint(cert.Leaf)), http.StatusUnauthorized},
+		{"bound without a certificate", nil, token(CertificateThumbprint(cert.Leaf)), http.StatusUnauthorized},
+		{"bound client with an unbound token", []tls.Certificate{cert}, token(""), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := get(t, mtlsClient(srv, tt.certs...), srv, tt.token)
+			if status != tt.wantStatus {
+				t.Fatalf("GET = %d %q, want %d", status, body, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCheckCertificateBinding(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}).Leaf
+	other := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "reporting"}}).Leaf
+	config := Auth0Config{MTLS: &MTLSConfig{BoundClients: []string{"billing"}}}
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		info    UserInfo
+		wantErr bool
+	}{
+		{"matching thumbprint", cert, UserInfo{ClientID: "billing", CertificateThumbprint: CertificateThumbprint(cert)}, false},
+		{"mismatched thumbprint", other, UserInfo{ClientID: "billing", CertificateThumbprint: CertificateThumbprint(cert)}, true},
+		{"bound token without certificate", nil, UserInfo{ClientID: "spa", CertificateThumbprint: CertificateThumbprint(cert)}, true},
+		{"unbound token of a bound client", cert, UserInfo{ClientID: "billing"}, true},
+		{"unbound token of another client", nil, UserInfo{ClientID: "spa"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCertificateBinding(config, tt.cert, &tt.info)
+			if tt.wantErr && !errors.Is(err, ErrCertificateBinding) {
+				t.Fatalf("checkCertificateBinding() error = %v, want %v", err, ErrCertificateBinding)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("checkCertificateBinding() error = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PrincipalKind distinguishes human users from machine-to-machine clients
+type PrincipalKind string
+
+// Kinds of principal
+const (
+	PrincipalUser    PrincipalKind = "user"
+	PrincipalService PrincipalKind = "service"
+)
+
+// PermissionManageClients allows registering service clients and granting
+// them permissions
+const PermissionManageClients = "manage:clients"
+
+// serviceSubjectSuffix is appended by Auth0 to the client ID to form the
+// subject of client-credentials tokens
+const serviceSubjectSuffix = "@clients"
+
+// ClientRegistry supplies permissions granted locally to service clients, on
+// top of the scopes in their tokens
+type ClientRegistry interface {
+	ClientPermissions(ctx context.Context, clientID string) ([]string, error)
+}
+
+// principalFromClaims determines whether a token was issued to a user or,
+// through the client-credentials grant, to a service client, and the OAuth
+// client it was issued to
+func principalFromClaims(claims jwt.MapClaims, subject string) (PrincipalKind, string) {
+	gty, _ := claims["gty"].(string)
+	clientID, _ := claims["azp"].(string)
+	if clientID == "" {
+		// RFC 9068 access tokens name the client in client_id
+		clientID, _ = claims["client_id"].(string)
+	}
+
+	if gty != "client-credentials" && !strings.HasSuffix(subject, serviceSubjectSuffix) {
+		return PrincipalUser, clientID
+	}
+	if clientID == "" {
+		clientID = strings.TrimSuffix(subject, serviceSubjectSuffix)
+	}
+	return PrincipalService, clientID
+}
+
+// GetPrincipalFromContext returns the authenticated caller, user or service
+func GetPrincipalFromContext(ctx context.Context) (*UserInfo, error) {
+	principal, ok := ctx.Value(UserContextKey).(*UserInfo)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return principal, nil
+}
+
+// GetUserFromContext returns the authenticated caller if it is a user.
+// Service clients have no user account and get ErrForbidden.
+func GetUserFromContext(ctx context.Context) (*UserInfo, error) {
+	principal, err := GetPrincipalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if principal.Kind == PrincipalService {
+		return nil, fmt.Errorf("%w: service clients cannot act as a user", ErrForbidden)
+	}
+	return principal, nil
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/example/auth0-gqlgen-demo/logging"
+	"github.com/example/auth0-gqlgen-demo/metrics"
+	"github.com/example/auth0-gqlgen-demo/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// WebsocketInit returns a gqlgen websocket InitFunc that authenticates the
+// connection with the "Authorization" entry of the connection_init payload,
+// formatted like the HTTP header. Connections whose upgrade request already
+// carried a valid Authorization header may omit it.
+func WebsocketInit(config Auth0Config) transport.WebsocketInitFunc {
+	return func(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+		authorization := payload.Authorization()
+		if authorization == "" {
+			if _, ok := ctx.Value(UserContextKey).(*UserInfo); ok {
+				return ctx, nil, nil
+			}
+			metrics.AuthRequests.WithLabelValues(failureReason(ErrMissingHeader)).Inc()
+			recordRejection(ctx, config, ErrMissingHeader)
+			return nil, nil, ErrUnauthenticated
+		}
+
+		spanCtx, span := tracing.Tracer().Start(ctx, "auth.WebsocketInit")
+
+		tokenString, err := ParseAuthorization(authorization)
+		if err != nil {
+			metrics.AuthRequests.WithLabelValues(failureReason(ErrInvalidHeader)).Inc()
+			tracing.EndSpan(span, ErrInvalidHeader)
+			recordRejection(ctx, config, ErrInvalidHeader)
+			return nil, nil, ErrInvalidHeader
+		}
+
+		userInfo, err := Authenticate(spanCtx, config, tokenString)
+		if err != nil {
+			tracing.EndSpan(span, err)
+			return nil, nil, ErrUnauthenticated
+		}
+		span.SetAttributes(
+			attribute.String("enduser.id", userInfo.UserID),
+			attribute.String("enduser.kind", string(userInfo.Kind)),
+		)
+		tracing.EndSpan(span, nil)
+
+		ctx = context.WithValue(ctx, UserContextKey, userInfo)
+		ctx = logging.WithUser(ctx, userInfo.UserID)
+		return ctx, nil, nil
+	}
+}
+
+// isWebSocketUpgrade reports whether r asks to switch to the websocket protocol
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
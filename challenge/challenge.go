@@ -0,0 +1,215 @@
+package challenge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Challenge names, returned to clients in the challengeName parameter
+const (
+	WebAuthnChallenge = "WEB_AUTHN_CHALLENGE"
+	EmailOTPChallenge = "EMAIL_OTP_CHALLENGE"
+)
+
+// DefaultMaxAttempts is the number of wrong answers after which a sign-in
+// fails
+const DefaultMaxAttempts = 3
+
+// nameParameter is the challenge parameter holding the challenge name
+const nameParameter = "challengeName"
+
+// User is the user signing in
+type User struct {
+	ID    string // empty when no account matches; the sign-in can't succeed
+	Email string
+}
+
+// Attempt is an answered challenge of a session
+type Attempt struct {
+	Name    string
+	Correct bool
+	State   string // Prompt.State of the challenge
+}
+
+// Decision is what happens after the answers so far
+type Decision struct {
+	Challenge   string // the next challenge, unless IssueTokens or Fail is set
+	IssueTokens bool
+	Fail        bool
+}
+
+// Prompt is a created challenge
+type Prompt struct {
+	Name    string
+	Public  map[string]string // sent to the client
+	Private map[string]string // kept by the server and passed to Verify
+	State   string            // kept in the session and passed to the next Create
+}
+
+// Method is a way of answering a challenge
+type Method interface {
+	// Name is the challenge name, e.g. WEB_AUTHN_CHALLENGE
+	Name() string
+	// Available reports whether user can answer the challenge
+	Available(ctx context.Context, user User) (bool, error)
+	// Create prepares a challenge for user. previous is the last attempt at
+	// this challenge when it is being retried, so its state can be reused.
+	Create(ctx context.Context, user User, previous *Attempt) (*Prompt, error)
+	// Verify checks an answer. Wrong answers return false, not an error.
+	Verify(ctx context.Context, user User, private map[string]string, answer string) (bool, error)
+}
+
+// Flow is the custom authentication state machine. Its steps are those of
+// the Cognito Define, Create and Verify Auth Challenge triggers: Define
+// decides what happens next from the session so far, Create prepares the
+// challenge Define chose, and Verify checks the answer to it.
+type Flow interface {
+	Define(ctx context.Context, user User, session []Attempt) (*Decision, error)
+	Create(ctx context.Context, user User, session []Attempt) (*Prompt, error)
+	Verify(ctx context.Context, user User, private map[string]string, answer string) (bool, error)
+}
+
+// Config holds the methods of a Machine
+type Config struct {
+	// Methods in order of preference. Every sign-in starts with the first,
+	// whether or not the user can answer it, so the first challenge doesn't
+	// reveal which accounts exist or how they sign in; it must not either,
+	// like passkey options without allowCredentials. A wrong answer moves on
+	// to the next one the user can answer. The last method is the fallback:
+	// it is asked when no other is available and for unknown users, so it
+	// must work for anyone, like email codes.
+	Methods     []Method
+	MaxAttempts int // wrong answers before the sign-in fails (default 3)
+}
+
+// Machine is the Flow over a list of challenge methods
+type Machine struct {
+	methods     []Method
+	maxAttempts int
+}
+
+// New creates a state machine
+func New(config Config) (*Machine, error) {
+	if len(config.Methods) == 0 {
+		return nil, errors.New("at least one challenge method is required")
+	}
+	seen := make(map[string]bool)
+	for _, method := range config.Methods {
+		if seen[method.Name()] {
+			return nil, fmt.Errorf("duplicate challenge method: %s", method.Name())
+		}
+		seen[method.Name()] = true
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	return &Machine{methods: config.Methods, maxAttempts: config.MaxAttempts}, nil
+}
+
+// Define issues tokens after a correct answer, fails after MaxAttempts wrong
+// ones or an answer to an unknown challenge, and otherwise picks the next
+// challenge
+func (m *Machine) Define(ctx context.Context, user User, session []Attempt) (*Decision, error) {
+	failures := 0
+	for _, attempt := range session {
+		if m.index(attempt.Name) < 0 {
+			return &Decision{Fail: true}, nil
+		}
+		if !attempt.Correct {
+			failures++
+		}
+	}
+	if n := len(session); n > 0 && session[n-1].Correct {
+		if user.ID == "" {
+			return &Decision{Fail: true}, nil
+		}
+		return &Decision{IssueTokens: true}, nil
+	}
+	if failures >= m.maxAttempts {
+		return &Decision{Fail: true}, nil
+	}
+
+	method, err := m.next(ctx, user, session)
+	if err != nil {
+		return nil, err
+	}
+	return &Decision{Challenge: method.Name()}, nil
+}
+
+// Create prepares the challenge Define picks for the session
+func (m *Machine) Create(ctx context.Context, user User, session []Attempt) (*Prompt, error) {
+	method, err := m.next(ctx, user, session)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *Attempt
+	if n := len(session); n > 0 && session[n-1].Name == method.Name() {
+		previous = &session[n-1]
+	}
+	prompt, err := method.Create(ctx, user, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt.Name = method.Name()
+	if prompt.Public == nil {
+		prompt.Public = make(map[string]string)
+	}
+	if prompt.Private == nil {
+		prompt.Private = make(map[string]string)
+	}
+	prompt.Public[nameParameter] = method.Name()
+	prompt.Private[nameParameter] = method.Name()
+	return prompt, nil
+}
+
+// Verify checks an answer with the method that created the challenge.
+// Answers for unknown users are always wrong.
+func (m *Machine) Verify(ctx context.Context, user User, private map[string]string, answer string) (bool, error) {
+	i := m.index(private[nameParameter])
+	if i < 0 || user.ID == "" {
+		return false, nil
+	}
+	return m.methods[i].Verify(ctx, user, private, answer)
+}
+
+// next returns the method to ask: the first one to start with, then the
+// next available one after a wrong answer, or the same one again when there
+// is none. Unknown users get the fallback after the first.
+func (m *Machine) next(ctx context.Context, user User, session []Attempt) (Method, error) {
+	n := len(session)
+	if n == 0 {
+		return m.methods[0], nil
+	}
+	fallback := m.methods[len(m.methods)-1]
+	if user.ID == "" {
+		return fallback, nil
+	}
+
+	last := m.index(session[n-1].Name)
+	if last < 0 {
+		return nil, fmt.Errorf("unknown challenge: %s", session[n-1].Name)
+	}
+	for _, method := range m.methods[last+1:] {
+		available, err := method.Available(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		if available {
+			return method, nil
+		}
+	}
+	return m.methods[last], nil
+}
+
+// index returns the position of the method called name, or -1
+func (m *Machine) index(name string) int {
+	for i, method := range m.methods {
+		if method.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,135 @@
+package challenge
+
+import (
+	"context"
+	"testing"
+)
+
+// testMethod is a challenge anyone in users can answer with answer
+type testMethod struct {
+	name   string
+	users  map[string]bool
+	answer string
+}
+
+func (m *testMethod) Name() string { return m.name }
+
+func (m *testMethod) Available(ctx context.Context, user User) (bool, error) {
+	return m.users[user.ID], nil
+}
+
+func (m *testMethod) Create(ctx context.Context, user User, previous *Attempt) (*Prompt, error) {
+	state := "1"
+	if previous != nil {
+		state = previous.State + "1"
+	}
+	return &Prompt{Public: map[string]string{"prompt": m.name}, State: state}, nil
+}
+
+func (m *testMethod) Verify(ctx context.Context, user User, private map[string]string, answer string) (bool, error) {
+	return answer == m.answer, nil
+}
+
+// newTestMachine creates a flow asking for a passkey, which only
+// auth0|passkey has, then an email code, which every known user has
+func newTestMachine(t *testing.T) *Machine {
+	t.Helper()
+	machine, err := New(Config{Methods: []Method{
+		&testMethod{name: WebAuthnChallenge, users: map[string]bool{"auth0|passkey": true}, answer: "assertion"},
+		&testMethod{name: EmailOTPChallenge, users: map[string]bool{"auth0|passkey": true, "auth0|email": true}, answer: "123456"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return machine
+}
+
+func TestMachineDefine(t *testing.T) {
+	machine := newTestMachine(t)
+	passkeyUser := User{ID: "auth0|passkey", Email: "passkey@example.com"}
+	emailUser := User{ID: "auth0|email", Email: "email@example.com"}
+	unknown := User{Email: "nobody@example.com"}
+
+	wrong := func(name string) Attempt { return Attempt{Name: name} }
+	right := func(name string) Attempt { return Attempt{Name: name, Correct: true} }
+
+	tests := []struct {
+		name    string
+		user    User
+		session []Attempt
+		want    Decision
+	}{
+		{"passkey user starts with a passkey", passkeyUser, nil, Decision{Challenge: WebAuthnChallenge}},
+		{"email user starts with a passkey", emailUser, nil, Decision{Challenge: WebAuthnChallenge}},
+		{"unknown user starts with a passkey", unknown, nil, Decision{Challenge: WebAuthnChallenge}},
+		{"passkey user falls back", passkeyUser, []Attempt{wrong(WebAuthnChallenge)}, Decision{Challenge: EmailOTPChallenge}},
+		{"email user falls back", emailUser, []Attempt{wrong(WebAuthnChallenge)}, Decision{Challenge: EmailOTPChallenge}},
+		{"unknown user falls back", unknown, []Attempt{wrong(WebAuthnChallenge)}, Decision{Challenge: EmailOTPChallenge}},
+		{"fallback is retried", emailUser, []Attempt{wrong(WebAuthnChallenge), wrong(EmailOTPChallenge)}, Decision{Challenge: EmailOTPChallenge}},
+		{"too many wrong answers", emailUser, []Attempt{wrong(WebAuthnChallenge), wrong(EmailOTPChallenge), wrong(EmailOTPChallenge)}, Decision{Fail: true}},
+		{"unknown user fails alike", unknown, []Attempt{wrong(WebAuthnChallenge), wrong(EmailOTPChallenge), wrong(EmailOTPChallenge)}, Decision{Fail: true}},
+		{"passkey answered", passkeyUser, []Attempt{right(WebAuthnChallenge)}, Decision{IssueTokens: true}},
+		{"code answered", emailUser, []Attempt{wrong(WebAuthnChallenge), right(EmailOTPChallenge)}, Decision{IssueTokens: true}},
+		{"unknown user answered", unknown, []Attempt{right(EmailOTPChallenge)}, Decision{Fail: true}},
+		{"unknown challenge", passkeyUser, []Attempt{right("SRP_A")}, Decision{Fail: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := machine.Define(context.Background(), tt.user, tt.session)
+			if err != nil {
+				t.Fatalf("Define() error = %v", err)
+			}
+			if *decision != tt.want {
+				t.Errorf("Define() = %+v, want %+v", *decision, tt.want)
+			}
+		})
+	}
+}
+
+func TestMachineCreateAndVerify(t *testing.T) {
+	ctx := context.Background()
+	machine := newTestMachine(t)
+	user := User{ID: "auth0|email", Email: "email@example.com"}
+
+	prompt, err := machine.Create(ctx, user, nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if prompt.Name != WebAuthnChallenge || prompt.Public[nameParameter] != WebAuthnChallenge || prompt.Private[nameParameter] != WebAuthnChallenge {
+		t.Errorf("Create() = %+v, want a %s prompt naming itself", prompt, WebAuthnChallenge)
+	}
+
+	// A retry of the same challenge is given the previous state
+	session := []Attempt{{Name: WebAuthnChallenge}, {Name: EmailOTPChallenge, State: "1"}}
+	prompt, err = machine.Create(ctx, user, session)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if prompt.Name != EmailOTPChallenge || prompt.State != "11" {
+		t.Errorf("Create() retry = %s state %q, want %s state %q", prompt.Name, prompt.State, EmailOTPChallenge, "11")
+	}
+
+	private := map[string]string{nameParameter: EmailOTPChallenge}
+	if correct, _ := machine.Verify(ctx, user, private, "123456"); !correct {
+		t.Error("Verify() of the right answer = false, want true")
+	}
+	if correct, _ := machine.Verify(ctx, user, private, "000000"); correct {
+		t.Error("Verify() of a wrong answer = true, want false")
+	}
+	if correct, _ := machine.Verify(ctx, User{Email: "nobody@example.com"}, private, "123456"); correct {
+		t.Error("Verify() for an unknown user = true, want false")
+	}
+	if correct, _ := machine.Verify(ctx, user, map[string]string{nameParameter: "SRP_A"}, "123456"); correct {
+		t.Error("Verify() of an unknown challenge = true, want false")
+	}
+}
+
+func TestNewRejectsDuplicateMethods(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Error("New() without methods succeeded, want an error")
+	}
+	method := &testMethod{name: EmailOTPChallenge}
+	if _, err := New(Config{Methods: []Method{method, method}}); err == nil {
+		t.Error("New() with a duplicate method succeeded, want an error")
+	}
+}
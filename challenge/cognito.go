@@ -0,0 +1,237 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Cognito trigger sources handled by Cognito.Handle
+const (
+	TriggerDefineAuthChallenge = "DefineAuthChallenge_Authentication"
+	TriggerCreateAuthChallenge = "CreateAuthChallenge_Authentication"
+	TriggerVerifyAuthChallenge = "VerifyAuthChallengeResponse_Authentication"
+)
+
+// customChallenge is the challenge name Cognito uses for custom challenges
+const customChallenge = "CUSTOM_CHALLENGE"
+
+// CognitoEventHeader holds the fields common to Cognito user pool trigger
+// events
+type CognitoEventHeader struct {
+	Version       string               `json:"version"`
+	TriggerSource string               `json:"triggerSource"`
+	Region        string               `json:"region"`
+	UserPoolID    string               `json:"userPoolId"`
+	UserName      string               `json:"userName"`
+	CallerContext CognitoCallerContext `json:"callerContext"`
+}
+
+// CognitoCallerContext identifies the client of a trigger event
+type CognitoCallerContext struct {
+	AWSSDKVersion string `json:"awsSdkVersion"`
+	ClientID      string `json:"clientId"`
+}
+
+// CognitoChallengeResult is an answered challenge in a trigger's session
+type CognitoChallengeResult struct {
+	ChallengeName     string `json:"challengeName"`
+	ChallengeResult   bool   `json:"challengeResult"`
+	ChallengeMetadata string `json:"challengeMetadata"`
+}
+
+// DefineAuthChallengeEvent is the Define Auth Challenge trigger event
+type DefineAuthChallengeEvent struct {
+	CognitoEventHeader
+	Request  DefineAuthChallengeRequest  `json:"request"`
+	Response DefineAuthChallengeResponse `json:"response"`
+}
+
+// DefineAuthChallengeRequest is the request of a Define Auth Challenge event
+type DefineAuthChallengeRequest struct {
+	UserAttributes map[string]string         `json:"userAttributes"`
+	Session        []*CognitoChallengeResult `json:"session"`
+	ClientMetadata map[string]string         `json:"clientMetadata,omitempty"`
+	UserNotFound   bool                      `json:"userNotFound"`
+}
+
+// DefineAuthChallengeResponse is the response of a Define Auth Challenge
+// event
+type DefineAuthChallengeResponse struct {
+	ChallengeName      string `json:"challengeName"`
+	IssueTokens        bool   `json:"issueTokens"`
+	FailAuthentication bool   `json:"failAuthentication"`
+}
+
+// CreateAuthChallengeEvent is the Create Auth Challenge trigger event
+type CreateAuthChallengeEvent struct {
+	CognitoEventHeader
+	Request  CreateAuthChallengeRequest  `json:"request"`
+	Response CreateAuthChallengeResponse `json:"response"`
+}
+
+// CreateAuthChallengeRequest is the request of a Create Auth Challenge event
+type CreateAuthChallengeRequest struct {
+	UserAttributes map[string]string         `json:"userAttributes"`
+	ChallengeName  string                    `json:"challengeName"`
+	Session        []*CognitoChallengeResult `json:"session"`
+	ClientMetadata map[string]string         `json:"clientMetadata,omitempty"`
+	UserNotFound   bool                      `json:"userNotFound"`
+}
+
+// CreateAuthChallengeResponse is the response of a Create Auth Challenge
+// event
+type CreateAuthChallengeResponse struct {
+	PublicChallengeParameters  map[string]string `json:"publicChallengeParameters"`
+	PrivateChallengeParameters map[string]string `json:"privateChallengeParameters"`
+	ChallengeMetadata          string            `json:"challengeMetadata"`
+}
+
+// VerifyAuthChallengeEvent is the Verify Auth Challenge Response trigger
+// event
+type VerifyAuthChallengeEvent struct {
+	CognitoEventHeader
+	Request  VerifyAuthChallengeRequest  `json:"request"`
+	Response VerifyAuthChallengeResponse `json:"response"`
+}
+
+// VerifyAuthChallengeRequest is the request of a Verify Auth Challenge
+// Response event
+type VerifyAuthChallengeRequest struct {
+	UserAttributes             map[string]string `json:"userAttributes"`
+	PrivateChallengeParameters map[string]string `json:"privateChallengeParameters"`
+	ChallengeAnswer            string            `json:"challengeAnswer"`
+	ClientMetadata             map[string]string `json:"clientMetadata,omitempty"`
+	UserNotFound               bool              `json:"userNotFound"`
+}
+
+// VerifyAuthChallengeResponse is the response of a Verify Auth Challenge
+// Response event
+type VerifyAuthChallengeResponse struct {
+	AnswerCorrect bool `json:"answerCorrect"`
+}
+
+// Cognito adapts a Flow to the Cognito custom authentication triggers. Its
+// trigger methods have the handler signature lambda.Start expects, and
+// Handle serves all three from one function.
+type Cognito struct {
+	flow Flow
+}
+
+// NewCognito creates the trigger handlers for flow. Users are identified by
+// their sub attribute, which must be the user ID their passkeys and account
+// are stored under.
+func NewCognito(flow Flow) *Cognito {
+	return &Cognito{flow: flow}
+}
+
+// DefineAuthChallenge handles the Define Auth Challenge trigger
+func (c *Cognito) DefineAuthChallenge(ctx context.Context, event DefineAuthChallengeEvent) (DefineAuthChallengeEvent, error) {
+	decision, err := c.flow.Define(ctx, cognitoUser(event.UserName, event.Request.UserAttributes, event.Request.UserNotFound), cognitoSession(event.Request.Session))
+	if err != nil {
+		return event, err
+	}
+	event.Response = DefineAuthChallengeResponse{
+		IssueTokens:        decision.IssueTokens,
+		FailAuthentication: decision.Fail,
+	}
+	if !decision.IssueTokens && !decision.Fail {
+		event.Response.ChallengeName = customChallenge
+	}
+	return event, nil
+}
+
+// CreateAuthChallenge handles the Create Auth Challenge trigger. The
+// challenge name and state are kept in the challenge metadata, which
+// Cognito passes back in later sessions.
+func (c *Cognito) CreateAuthChallenge(ctx context.Context, event CreateAuthChallengeEvent) (CreateAuthChallengeEvent, error) {
+	prompt, err := c.flow.Create(ctx, cognitoUser(event.UserName, event.Request.UserAttributes, event.Request.UserNotFound), cognitoSession(event.Request.Session))
+	if err != nil {
+		return event, err
+	}
+	metadata := prompt.Name
+	if prompt.State != "" {
+		metadata += ":" + prompt.State
+	}
+	event.Response = CreateAuthChallengeResponse{
+		PublicChallengeParameters:  prompt.Public,
+		PrivateChallengeParameters: prompt.Private,
+		ChallengeMetadata:          metadata,
+	}
+	return event, nil
+}
+
+// VerifyAuthChallenge handles the Verify Auth Challenge Response trigger
+func (c *Cognito) VerifyAuthChallenge(ctx context.Context, event VerifyAuthChallengeEvent) (VerifyAuthChallengeEvent, error) {
+	correct, err := c.flow.Verify(ctx, cognitoUser(event.UserName, event.Request.UserAttributes, event.Request.UserNotFound),
+		event.Request.PrivateChallengeParameters, event.Request.ChallengeAnswer)
+	if err != nil {
+		return event, err
+	}
+	event.Response = VerifyAuthChallengeResponse{AnswerCorrect: correct}
+	return event, nil
+}
+
+// Handle dispatches a raw trigger event on its triggerSource and returns the
+// event with its response filled in
+func (c *Cognito) Handle(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+	var header CognitoEventHeader
+	if err := json.Unmarshal(payload, &header); err != nil {
+		return nil, fmt.Errorf("invalid trigger event: %w", err)
+	}
+
+	var result any
+	var err error
+	switch header.TriggerSource {
+	case TriggerDefineAuthChallenge:
+		var event DefineAuthChallengeEvent
+		if err = json.Unmarshal(payload, &event); err == nil {
+			result, err = c.DefineAuthChallenge(ctx, event)
+		}
+	case TriggerCreateAuthChallenge:
+		var event CreateAuthChallengeEvent
+		if err = json.Unmarshal(payload, &event); err == nil {
+			result, err = c.CreateAuthChallenge(ctx, event)
+		}
+	case TriggerVerifyAuthChallenge:
+		var event VerifyAuthChallengeEvent
+		if err = json.Unmarshal(payload, &event); err == nil {
+			result, err = c.VerifyAuthChallenge(ctx, event)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported trigger source: %q", header.TriggerSource)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+// cognitoUser returns the user of a trigger event. An unknown user has no
+// attributes, so their address is the name they signed in with, and they
+// get the same challenges as a user with that address would.
+func cognitoUser(userName string, attributes map[string]string, notFound bool) User {
+	if notFound {
+		return User{Email: userName}
+	}
+	return User{ID: attributes["sub"], Email: attributes["email"]}
+}
+
+// cognitoSession converts a trigger session. Custom challenges are named by
+// their metadata, "<name>[:<state>]"; other challenges, such as SRP_A, keep
+// their Cognito name, which fails the sign-in.
+func cognitoSession(results []*CognitoChallengeResult) []Attempt {
+	session := make([]Attempt, 0, len(results))
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		attempt := Attempt{Name: result.ChallengeName, Correct: result.ChallengeResult}
+		if result.ChallengeName == customChallenge {
+			attempt.Name, attempt.State, _ = strings.Cut(result.ChallengeMetadata, ":")
+		}
+		session = append(session, attempt)
+	}
+	return session
+}
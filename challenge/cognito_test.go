@@ -0,0 +1,207 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// handle passes a trigger event to the adapter and decodes the response
+// part of the result
+func handle(t *testing.T, cognito *Cognito, event string, response any) {
+	t.Helper()
+	result, err := cognito.Handle(context.Background(), json.RawMessage(event))
+	if err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+	var decoded struct {
+		Response json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(result, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(decoded.Response, response); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const testUserAttributes = `{"sub": "auth0|email", "email": "email@example.com"}`
+
+func TestCognitoDefineAuthChallenge(t *testing.T) {
+	cognito := NewCognito(newTestMachine(t))
+
+	tests := []struct {
+		name    string
+		session string
+		found   bool
+		want    DefineAuthChallengeResponse
+	}{
+		{"first challenge", `[]`, true, DefineAuthChallengeResponse{ChallengeName: customChallenge}},
+		{"first challenge of an unknown user", `[]`, false, DefineAuthChallengeResponse{ChallengeName: customChallenge}},
+		{"after a wrong answer", `[{"challengeName": "CUSTOM_CHALLENGE", "challengeResult": false, "challengeMetadata": "WEB_AUTHN_CHALLENGE"}]`, true, DefineAuthChallengeResponse{ChallengeName: customChallenge}},
+		{"after a right answer", `[{"challengeName": "CUSTOM_CHALLENGE", "challengeResult": false, "challengeMetadata": "WEB_AUTHN_CHALLENGE"},
+			{"challengeName": "CUSTOM_CHALLENGE", "challengeResult": true, "challengeMetadata": "EMAIL_OTP_CHALLENGE:hash.123"}]`, true, DefineAuthChallengeResponse{IssueTokens: true}},
+		{"right answer of an unknown user", `[{"challengeName": "CUSTOM_CHALLENGE", "challengeResult": true, "challengeMetadata": "EMAIL_OTP_CHALLENGE"}]`, false, DefineAuthChallengeResponse{FailAuthentication: true}},
+		{"password challenge", `[{"challengeName": "SRP_A", "challengeResult": true, "challengeMetadata": ""}]`, true, DefineAuthChallengeResponse{FailAuthentication: true}},
+		{"too many wrong answers", `[{"challengeName": "CUSTOM_CHALLENGE", "challengeResult": false, "challengeMetadata": "WEB_AUTHN_CHALLENGE"},
+			{"challengeName": "CUSTOM_CHALLENGE", "challengeResult": false, "challengeMetadata": "EMAIL_OTP_CHALLENGE"},
+			{"challengeName": "CUSTOM_CHALLENGE", "challengeResult": false, "challengeMetadata": "EMAIL_OTP_CHALLENGE"}]`, true, DefineAuthChallengeResponse{FailAuthentication: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notFound := "false"
+			if !tt.found {
+				notFound = "true"
+			}
+			event := `{
+				"version": "1",
+				"triggerSource": "DefineAuthChallenge_Authentication",
+				"region": "us-east-1",
+				"userPoolId": "us-east-1_example",
+				"userName": "email@example.com",
+				"callerContext": {"awsSdkVersion": "aws-sdk-js-3", "clientId": "client"},
+				"request": {"userAttributes": ` + testUserAttributes + `, "session": ` + tt.session + `, "userNotFound": ` + notFound + `},
+				"response": {}
+			}`
+			var response DefineAuthChallengeResponse
+			handle(t, cognito, event, &response)
+			if response != tt.want {
+				t.Errorf("DefineAuthChallenge response = %+v, want %+v", response, tt.want)
+			}
+		})
+	}
+}
+
+func TestCognitoCreateAuthChallenge(t *testing.T) {
+	cognito := NewCognito(newTestMachine(t))
+
+	create := func(session string) CreateAuthChallengeResponse {
+		t.Helper()
+		var response CreateAuthChallengeResponse
+		handle(t, cognito, `{
+			"version": "1",
+			"triggerSource": "CreateAuthChallenge_Authentication",
+			"userName": "email@example.com",
+			"request": {"userAttributes": `+testUserAttributes+`, "challengeName": "CUSTOM_CHALLENGE", "session": `+session+`},
+			"response": {}
+		}`, &response)
+		return response
+	}
+
+	response := create(`[]`)
+	if response.ChallengeMetadata != WebAuthnChallenge+":1" || response.PublicChallengeParameters[nameParameter] != WebAuthnChallenge {
+		t.Errorf("first challenge = %+v, want %s", response, WebAuthnChallenge)
+	}
+
+	// The metadata of earlier challenges names them and carries their state
+	response = create(`[{"challengeName": "CUSTOM_CHALLENGE", "challengeResult": false, "challengeMetadata": "WEB_AUTHN_CHALLENGE:1"},
+		{"challengeName": "CUSTOM_CHALLENGE", "challengeResult": false, "challengeMetadata": "EMAIL_OTP_CHALLENGE:1"}]`)
+	if response.ChallengeMetadata != EmailOTPChallenge+":11" || response.PrivateChallengeParameters[nameParameter] != EmailOTPChallenge {
+		t.Errorf("retried challenge = %+v, want %s with the previous state", response, EmailOTPChallenge)
+	}
+}
+
+func TestCognitoVerifyAuthChallenge(t *testing.T) {
+	cognito := NewCognito(newTestMachine(t))
+
+	tests := []struct {
+		name     string
+		answer   string
+		notFound bool
+		want     bool
+	}{
+		{"right answer", "123456", false, true},
+		{"wrong answer", "000000", false, false},
+		{"unknown user", "123456", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, _ := json.Marshal(map[string]any{
+				"version":       "1",
+				"triggerSource": TriggerVerifyAuthChallenge,
+				"userName":      "email@example.com",
+				"request": map[string]any{
+					"userAttributes":             json.RawMessage(testUserAttributes),
+					"privateChallengeParameters": map[string]string{nameParameter: EmailOTPChallenge},
+					"challengeAnswer":            tt.answer,
+					"userNotFound":               tt.notFound,
+				},
+				"response": map[string]any{},
+			})
+			var response VerifyAuthChallengeResponse
+			handle(t, cognito, string(event), &response)
+			if response.AnswerCorrect != tt.want {
+				t.Errorf("answerCorrect = %v, want %v", response.AnswerCorrect, tt.want)
+			}
+		})
+	}
+}
+
+func TestCognitoHandleRejectsOtherTriggers(t *testing.T) {
+	cognito := NewCognito(newTestMachine(t))
+	for _, event := range []string{`{"triggerSource": "PreSignUp_SignUp"}`, `not json`} {
+		if _, err := cognito.Handle(context.Background(), json.RawMessage(event)); err == nil {
+			t.Errorf("Handle(%s) succeeded, want an error", event)
+		}
+	}
+}
+
+func TestCognitoUnknownUserLooksLikeAUser(t *testing.T) {
+	sessions, codes := newTestSessions(t, SessionsConfig{})
+	cognito := NewCognito(sessions.flow)
+
+	create := func(t *testing.T, userName, attributes string, notFound bool, session string) CreateAuthChallengeResponse {
+		t.Helper()
+		event, _ := json.Marshal(map[string]any{
+			"version":       "1",
+			"triggerSource": TriggerCreateAuthChallenge,
+			"userName":      userName,
+			"request": map[string]any{
+				"userAttributes": json.RawMessage(attributes),
+				"challengeName":  customChallenge,
+				"session":        json.RawMessage(session),
+				"userNotFound":   notFound,
+			},
+			"response": map[string]any{},
+		})
+		var response CreateAuthChallengeResponse
+		handle(t, cognito, string(event), &response)
+		return response
+	}
+	keys := func(parameters map[string]string) []string {
+		names := make([]string, 0, len(parameters))
+		for name := range parameters {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	fellBack := `[{"challengeName": "CUSTOM_CHALLENGE", "challengeResult": false, "challengeMetadata": "WEB_AUTHN_CHALLENGE"}]`
+	for _, session := range []string{`[]`, fellBack} {
+		user := create(t, "email@example.com", `{"sub": "auth0|email", "email": "email@example.com"}`, false, session)
+		for _, userName := range []string{"nobody@example.com", "not an address"} {
+			t.Run(userName, func(t *testing.T) {
+				unknown := create(t, userName, `{}`, true, session)
+				want, _, _ := strings.Cut(user.ChallengeMetadata, ":")
+				got, _, _ := strings.Cut(unknown.ChallengeMetadata, ":")
+				if got != want {
+					t.Errorf("challenge = %s, want %s like a user's", got, want)
+				}
+				if !slices.Equal(keys(unknown.PublicChallengeParameters), keys(user.PublicChallengeParameters)) ||
+					!slices.Equal(keys(unknown.PrivateChallengeParameters), keys(user.PrivateChallengeParameters)) {
+					t.Errorf("parameters = %+v, want the same as a user's %+v", unknown, user)
+				}
+			})
+		}
+	}
+
+	if codes.code("email@example.com") == "" {
+		t.Error("no code was mailed to the user")
+	}
+	if codes.code("nobody@example.com") != "" {
+		t.Error("a code was mailed to an unknown address")
+	}
+}
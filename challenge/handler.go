@@ -0,0 +1,103 @@
+package challenge
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/example/auth0-gqlgen-demo/emailotp"
+	"github.com/example/auth0-gqlgen-demo/webauthn"
+)
+
+// Paths the sign-in endpoints are served on, like Cognito's InitiateAuth
+// and RespondToAuthChallenge
+const (
+	InitiatePath = "/auth/initiate"
+	RespondPath  = "/auth/respond"
+)
+
+// maxRequestBody bounds the size of a request body, which may carry a
+// passkey assertion
+const maxRequestBody = 64 << 10
+
+// InitiateHandler serves POST requests of {"email"} and returns the first
+// challenge
+func (s *Sessions) InitiateHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody)).Decode(&request); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+
+		step, err := s.Initiate(r.Context(), request.Email)
+		s.respond(w, r, step, err)
+	})
+}
+
+// RespondHandler serves POST requests of {"session", "answer"} and returns
+// the next challenge or the signed-in user and their tokens. Failed sign-ins
+// get a generic 401.
+func (s *Sessions) RespondHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			Session string `json:"session"`
+			Answer  string `json:"answer"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody)).Decode(&request); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+
+		step, err := s.Respond(r.Context(), request.Session, request.Answer)
+		s.respond(w, r, step, err)
+	})
+}
+
+// respond writes a step or the error that ended the sign-in
+func (s *Sessions) respond(w http.ResponseWriter, r *http.Request, step *Step, err error) {
+	var throttled *emailotp.ThrottledError
+	switch {
+	case err == nil:
+		respondJSON(w, http.StatusOK, step)
+	case errors.Is(err, ErrNotAuthorized), errors.Is(err, ErrUnknownSession):
+		slog.InfoContext(r.Context(), "challenge sign-in failed", "error", err)
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "not_authorized"})
+	case errors.Is(err, emailotp.ErrInvalidEmail):
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_email"})
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(throttled.Seconds()))
+		respondJSON(w, http.StatusTooManyRequests, map[string]string{"error": "slow_down"})
+	case errors.Is(err, webauthn.ErrTooManyChallenges), errors.Is(err, ErrTooManySessions):
+		slog.WarnContext(r.Context(), "challenge sign-in refused", "error", err)
+		respondJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "temporarily_unavailable"})
+	default:
+		slog.ErrorContext(r.Context(), "challenge sign-in error", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// respondJSON writes a JSON response
+func respondJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
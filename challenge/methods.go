@@ -0,0 +1,130 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/emailotp"
+	"github.com/example/auth0-gqlgen-demo/webauthn"
+)
+
+// passkeyMethod answers WEB_AUTHN_CHALLENGE with a passkey
+type passkeyMethod struct {
+	passkeys *webauthn.Service
+}
+
+// PasskeyMethod asks users to sign in with a passkey. The options public
+// parameter holds the request options (JSON) for the authenticator, and the
+// answer is its AuthenticationResponseJSON. The options are the same for
+// everyone, with no allowCredentials, so the authenticator offers its
+// discoverable passkeys; the one used must belong to the user.
+func PasskeyMethod(passkeys *webauthn.Service) Method {
+	return &passkeyMethod{passkeys: passkeys}
+}
+
+func (m *passkeyMethod) Name() string { return WebAuthnChallenge }
+
+func (m *passkeyMethod) Available(ctx context.Context, user User) (bool, error) {
+	return len(m.passkeys.ListPasskeys(ctx, user.ID)) > 0, nil
+}
+
+func (m *passkeyMethod) Create(ctx context.Context, user User, previous *Attempt) (*Prompt, error) {
+	options, err := m.passkeys.LoginOptions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(time.Duration(options.Timeout) * time.Millisecond)
+	return &Prompt{
+		Public: map[string]string{"options": string(encoded)},
+		Private: map[string]string{
+			"challenge": options.Challenge,
+			"expiresAt": strconv.FormatInt(expiresAt.Unix(), 10),
+		},
+	}, nil
+}
+
+func (m *passkeyMethod) Verify(ctx context.Context, user User, private map[string]string, answer string) (bool, error) {
+	expiresAt, err := strconv.ParseInt(private["expiresAt"], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false, nil
+	}
+	var response webauthn.AssertionResponse
+	if err := json.Unmarshal([]byte(answer), &response); err != nil {
+		return false, nil
+	}
+	if _, err := m.passkeys.VerifyLogin(ctx, user.ID, private["challenge"], response); err != nil {
+		if webauthn.FailureReason(err) == "error" {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// emailCodeMethod answers EMAIL_OTP_CHALLENGE with a mailed code
+type emailCodeMethod struct {
+	codes *emailotp.Service
+}
+
+// EmailCodeMethod mails a code to the user's address; the answer is the
+// code. A retry after a wrong answer reuses the code until it expires. The
+// expiresAt public parameter is when it does.
+func EmailCodeMethod(codes *emailotp.Service) Method {
+	return &emailCodeMethod{codes: codes}
+}
+
+func (m *emailCodeMethod) Name() string { return EmailOTPChallenge }
+
+func (m *emailCodeMethod) Available(ctx context.Context, user User) (bool, error) {
+	return user.Email != "", nil
+}
+
+func (m *emailCodeMethod) Create(ctx context.Context, user User, previous *Attempt) (*Prompt, error) {
+	var sent *emailotp.Code
+	if previous != nil {
+		if code, ok := parseCode(previous.State); ok && time.Now().Before(code.ExpiresAt) {
+			sent = code
+		}
+	}
+	if sent == nil {
+		var err error
+		if sent, err = m.codes.Send(ctx, user.ID, user.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	expiresAt := strconv.FormatInt(sent.ExpiresAt.Unix(), 10)
+	return &Prompt{
+		Public:  map[string]string{"expiresAt": sent.ExpiresAt.UTC().Format(time.RFC3339)},
+		Private: map[string]string{"codeHash": sent.Hash, "expiresAt": expiresAt},
+		State:   sent.Hash + "." + expiresAt,
+	}, nil
+}
+
+func (m *emailCodeMethod) Verify(ctx context.Context, user User, private map[string]string, answer string) (bool, error) {
+	code, ok := parseCode(private["codeHash"] + "." + private["expiresAt"])
+	if !ok {
+		return false, nil
+	}
+	return m.codes.CheckCode(user.Email, strings.TrimSpace(answer), *code, time.Now()) == nil, nil
+}
+
+// parseCode decodes a code kept as "<hash>.<expiry>"
+func parseCode(state string) (*emailotp.Code, bool) {
+	hash, expiry, ok := strings.Cut(state, ".")
+	if !ok {
+		return nil, false
+	}
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &emailotp.Code{Hash: hash, ExpiresAt: time.Unix(seconds, 0)}, true
+}
@@ -0,0 +1,220 @@
+package challenge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/issuer"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+// Defaults for SessionsConfig
+const (
+	DefaultSessionTTL  = 3 * time.Minute
+	DefaultMaxSessions = 10000
+)
+
+// Errors returned by Sessions
+var (
+	ErrUnknownSession  = errors.New("unknown or expired sign-in session")
+	ErrNotAuthorized   = errors.New("sign-in failed")
+	ErrTooManySessions = errors.New("too many sign-in sessions in progress")
+)
+
+// AccountStore finds the user signing in
+type AccountStore interface {
+	GetAccountByVerifiedEmail(ctx context.Context, email string) (*model.Account, error)
+}
+
+// methodReferences are the amr values (RFC 8176) of the challenges
+var methodReferences = map[string]string{
+	WebAuthnChallenge: "pop",
+	EmailOTPChallenge: "otp",
+}
+
+// SessionsConfig holds session limits and the token issuer
+type SessionsConfig struct {
+	TTL         time.Duration  // time allowed to answer each challenge (default 3m)
+	MaxSessions int            // sessions kept at once (default 10000)
+	Issuer      *issuer.Issuer // mints tokens once a user is signed in (optional)
+}
+
+// Sessions runs a Flow in-process the way Cognito runs the triggers: it
+// calls Define, Create and Verify in turn and keeps the session and private
+// challenge parameters between the client's requests
+type Sessions struct {
+	flow     Flow
+	accounts AccountStore
+	auditLog *audit.Logger
+	config   SessionsConfig
+
+	mu       sync.Mutex
+	sessions map[string]*session // key is the session ID
+}
+
+// session is a sign-in waiting for an answer
+type session struct {
+	user      User
+	attempts  []Attempt
+	prompt    *Prompt
+	expiresAt time.Time
+}
+
+// Step is the response to the client: the next challenge, or the user and,
+// with an issuer, their tokens once signed in
+type Step struct {
+	Session    string            `json:"session,omitempty"`
+	Challenge  string            `json:"challengeName,omitempty"`
+	Parameters map[string]string `json:"challengeParameters,omitempty"`
+	UserID     string            `json:"userId,omitempty"`
+	Tokens     *issuer.Tokens    `json:"tokens,omitempty"`
+}
+
+// NewSessions creates an in-process runner for flow
+func NewSessions(flow Flow, accounts AccountStore, auditLog *audit.Logger, config SessionsConfig) *Sessions {
+	if config.TTL <= 0 {
+		config.TTL = DefaultSessionTTL
+	}
+	if config.MaxSessions <= 0 {
+		config.MaxSessions = DefaultMaxSessions
+	}
+	return &Sessions{
+		flow:     flow,
+		accounts: accounts,
+		auditLog: auditLog,
+		config:   config,
+		sessions: make(map[string]*session),
+	}
+}
+
+// Initiate starts signing in the account that verified email and returns
+// its first challenge. Every address gets the same one, and unknown or
+// unverified addresses get challenges that can't be answered, so the
+// response doesn't reveal whether an account exists.
+func (s *Sessions) Initiate(ctx context.Context, email string) (*Step, error) {
+	user := User{Email: email}
+	account, err := s.accounts.GetAccountByVerifiedEmail(ctx, email)
+	switch {
+	case err == nil:
+		user.ID = account.UserID
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, err
+	}
+	return s.advance(ctx, &session{user: user})
+}
+
+// Respond answers the current challenge of a session. The session ID
+// changes with every step, so each challenge is answered once.
+func (s *Sessions) Respond(ctx context.Context, sessionID, answer string) (*Step, error) {
+	s.mu.Lock()
+	sess, ok := s.sessions[sessionID]
+	delete(s.sessions, sessionID)
+	s.mu.Unlock()
+	if !ok || time.Now().After(sess.expiresAt) {
+		return nil, ErrUnknownSession
+	}
+
+	correct, err := s.flow.Verify(ctx, sess.user, sess.prompt.Private, answer)
+	if err != nil {
+		return nil, err
+	}
+	sess.attempts = append(sess.attempts, Attempt{Name: sess.prompt.Name, Correct: correct, State: sess.prompt.State})
+	return s.advance(ctx, sess)
+}
+
+// advance asks the flow what happens next and either finishes the sign-in
+// or creates and remembers the next challenge
+func (s *Sessions) advance(ctx context.Context, sess *session) (*Step, error) {
+	decision, err := s.flow.Define(ctx, sess.user, sess.attempts)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case decision.Fail:
+		s.record(ctx, sess, ErrNotAuthorized)
+		return nil, ErrNotAuthorized
+	case decision.IssueTokens:
+		step := &Step{UserID: sess.user.ID}
+		if s.config.Issuer != nil {
+			var amr []string
+			if reference, ok := methodReferences[sess.attempts[len(sess.attempts)-1].Name]; ok {
+				amr = []string{reference}
+			}
+			if step.Tokens, err = s.config.Issuer.Issue(ctx, sess.user.ID, amr); err != nil {
+				return nil, err
+			}
+		}
+		s.record(ctx, sess, nil)
+		return step, nil
+	}
+
+	prompt, err := s.flow.Create(ctx, sess.user, sess.attempts)
+	if err != nil {
+		return nil, err
+	}
+	sess.prompt = prompt
+	sess.expiresAt = time.Now().Add(s.config.TTL)
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.evict() {
+		return nil, ErrTooManySessions
+	}
+	s.sessions[id] = sess
+
+	return &Step{Session: id, Challenge: prompt.Name, Parameters: prompt.Public}, nil
+}
+
+// evict removes expired sessions when too many are kept and reports whether
+// there is room for another. Sessions in progress are kept, so a flood of
+// sign-ins can't end others'. The caller holds s.mu.
+func (s *Sessions) evict() bool {
+	if len(s.sessions) < s.config.MaxSessions {
+		return true
+	}
+	now := time.Now()
+	for id, sess := range s.sessions {
+		if now.After(sess.expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+	return len(s.sessions) < s.config.MaxSessions
+}
+
+// record writes an audit event for a finished sign-in
+func (s *Sessions) record(ctx context.Context, sess *session, err error) {
+	event := audit.Event{
+		Type:    audit.TypeChallengeLogin,
+		Actor:   sess.user.ID,
+		Subject: sess.user.ID,
+		Outcome: audit.OutcomeSuccess,
+	}
+	if n := len(sess.attempts); n > 0 {
+		event.Metadata = map[string]string{"challenge": sess.attempts[n-1].Name}
+	}
+	if err != nil {
+		event.Outcome = audit.OutcomeFailure
+		event.Reason = "not_authorized"
+	}
+	s.auditLog.Record(ctx, event)
+}
+
+// newSessionID returns a random session ID
+func newSessionID() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
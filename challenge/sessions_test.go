@@ -0,0 +1,157 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/example/auth0-gqlgen-demo/emailotp"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/mail"
+	"github.com/example/auth0-gqlgen-demo/store"
+	"github.com/example/auth0-gqlgen-demo/webauthn"
+)
+
+var codePattern = regexp.MustCompile(`\d{6}`)
+
+// testCodes reads the codes mailed by an email code service
+type testCodes struct {
+	service *emailotp.Service
+	mailer  *mail.MemoryMailer
+}
+
+// code returns the code last mailed to email, or "" if none was
+func (c *testCodes) code(email string) string {
+	c.service.Wait()
+	messages := c.mailer.Messages(email)
+	if len(messages) == 0 {
+		return ""
+	}
+	return codePattern.FindString(messages[len(messages)-1].Body)
+}
+
+// newTestSessions runs the passkey and email code flow over a store with a
+// passkey user and a user without passkeys, both with verified addresses,
+// and a user whose address isn't verified
+func newTestSessions(t *testing.T, config SessionsConfig) (*Sessions, *testCodes) {
+	t.Helper()
+	ctx := context.Background()
+	accounts := store.NewMemoryStore()
+	for _, account := range []struct{ id, email string }{{"auth0|passkey", "passkey@example.com"}, {"auth0|email", "email@example.com"}} {
+		if _, err := accounts.CreateAccount(ctx, account.id, account.email); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := accounts.UpdateEmail(ctx, account.id, account.email); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := accounts.CreateAccount(ctx, "auth0|unverified", "unverified@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := accounts.AddPasskey(ctx, model.Passkey{ID: "credential", UserID: "auth0|passkey", Name: "Phone"}); err != nil {
+		t.Fatal(err)
+	}
+
+	passkeys, err := webauthn.NewService(accounts, nil, webauthn.Config{RPID: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailer := mail.NewMemoryMailer()
+	codes := emailotp.NewService(accounts, mailer, nil, emailotp.Config{})
+	flow, err := New(Config{Methods: []Method{PasskeyMethod(passkeys), EmailCodeMethod(codes)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSessions(flow, accounts, nil, config), &testCodes{service: codes, mailer: mailer}
+}
+
+func TestInitiateDoesNotRevealAccounts(t *testing.T) {
+	ctx := context.Background()
+	sessions, codes := newTestSessions(t, SessionsConfig{})
+
+	for _, email := range []string{"passkey@example.com", "email@example.com", "unverified@example.com", "nobody@example.com"} {
+		t.Run(email, func(t *testing.T) {
+			step, err := sessions.Initiate(ctx, email)
+			if err != nil {
+				t.Fatalf("Initiate() error = %v", err)
+			}
+			if step.Challenge != WebAuthnChallenge {
+				t.Fatalf("first challenge = %s, want %s", step.Challenge, WebAuthnChallenge)
+			}
+			var options webauthn.RequestOptions
+			if err := json.Unmarshal([]byte(step.Parameters["options"]), &options); err != nil {
+				t.Fatal(err)
+			}
+			if options.AllowCredentials == nil || len(options.AllowCredentials) != 0 {
+				t.Errorf("allowCredentials = %v, want an empty list", options.AllowCredentials)
+			}
+
+			// Declining the passkey moves everyone on to a code
+			step, err = sessions.Respond(ctx, step.Session, "")
+			if err != nil {
+				t.Fatalf("Respond() error = %v", err)
+			}
+			if step.Challenge != EmailOTPChallenge || step.Parameters["expiresAt"] == "" {
+				t.Fatalf("second challenge = %s %v, want %s with expiresAt", step.Challenge, step.Parameters, EmailOTPChallenge)
+			}
+		})
+	}
+
+	if codes.code("email@example.com") == "" {
+		t.Error("no code was mailed to a verified address")
+	}
+	for _, email := range []string{"unverified@example.com", "nobody@example.com"} {
+		if codes.code(email) != "" {
+			t.Errorf("a code was mailed to %s", email)
+		}
+	}
+}
+
+func TestSignInWithEmailCode(t *testing.T) {
+	ctx := context.Background()
+	sessions, codes := newTestSessions(t, SessionsConfig{})
+
+	step, err := sessions.Initiate(ctx, "email@example.com")
+	if err != nil {
+		t.Fatalf("Initiate() error = %v", err)
+	}
+	if step, err = sessions.Respond(ctx, step.Session, ""); err != nil {
+		t.Fatalf("Respond() declining the passkey error = %v", err)
+	}
+	session := step.Session
+	if step, err = sessions.Respond(ctx, session, codes.code("email@example.com")); err != nil {
+		t.Fatalf("Respond() with the code error = %v", err)
+	}
+	if step.UserID != "auth0|email" {
+		t.Errorf("signed-in user = %q, want auth0|email", step.UserID)
+	}
+
+	// Each session answers once
+	if _, err := sessions.Respond(ctx, session, codes.code("email@example.com")); !errors.Is(err, ErrUnknownSession) {
+		t.Errorf("Respond() to a used session error = %v, want %v", err, ErrUnknownSession)
+	}
+}
+
+func TestSessionsAreNotEvicted(t *testing.T) {
+	ctx := context.Background()
+	sessions, _ := newTestSessions(t, SessionsConfig{MaxSessions: 2})
+
+	var first *Step
+	for i := range 2 {
+		step, err := sessions.Initiate(ctx, "passkey@example.com")
+		if err != nil {
+			t.Fatalf("Initiate() error = %v", err)
+		}
+		if i == 0 {
+			first = step
+		}
+	}
+	if _, err := sessions.Initiate(ctx, "passkey@example.com"); !errors.Is(err, ErrTooManySessions) {
+		t.Fatalf("Initiate() with every session in use error = %v, want %v", err, ErrTooManySessions)
+	}
+	if _, err := sessions.Respond(ctx, first.Session, ""); err != nil {
+		t.Errorf("Respond() to an earlier session error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,218 @@
+package emailchange
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/mail"
+)
+
+// Defaults for pending email changes
+const (
+	DefaultCodeTTL        = 15 * time.Minute
+	DefaultMaxAttempts    = 5
+	DefaultResendInterval = time.Minute
+	DefaultMaxSends       = 5
+	DefaultSendWindow     = time.Hour
+)
+
+// Errors returned when confirming a change
+var (
+	ErrNoPendingChange = errors.New("no pending email change")
+	ErrInvalidCode     = errors.New("invalid confirmation code")
+	ErrCodeExpired     = errors.New("confirmation code expired")
+	ErrTooManyAttempts = errors.New("too many confirmation attempts")
+	ErrThrottled       = errors.New("too many confirmation codes requested")
+)
+
+// IdentityProvider updates the email address held by the identity provider
+type IdentityProvider interface {
+	UpdateUserEmail(ctx context.Context, userID, email string) error
+}
+
+// Pending is an email change awaiting confirmation
+type Pending struct {
+	Email     string
+	ExpiresAt time.Time
+}
+
+type pendingChange struct {
+	email     string
+	codeHash  string
+	expiresAt time.Time
+	attempts  int
+}
+
+// Service issues and verifies one-time codes proving ownership of a new
+// email address
+type Service struct {
+	mailer         mail.Mailer
+	idp            IdentityProvider
+	codeTTL        time.Duration
+	maxAttempts    int
+	resendInterval time.Duration
+	maxSends       int
+	sendWindow     time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pendingChange // key is userID
+	sends   map[string][]time.Time    // codes sent per userID within sendWindow, oldest first
+}
+
+// NewService creates an email change service. idp may be nil, in which case
+// only the local account is updated.
+func NewService(mailer mail.Mailer, idp IdentityProvider) *Service {
+	return &Service{
+		mailer:         mailer,
+		idp:            idp,
+		codeTTL:        DefaultCodeTTL,
+		maxAttempts:    DefaultMaxAttempts,
+		resendInterval: DefaultResendInterval,
+		maxSends:       DefaultMaxSends,
+		sendWindow:     DefaultSendWindow,
+		pending:        make(map[string]*pendingChange),
+		sends:          make(map[string][]time.Time),
+	}
+}
+
+// Request starts a change to newEmail for userID and mails a confirmation
+// code to the new address. A new request replaces any pending one; codes
+// resent to the same address share its wrong attempts. A user is sent at
+// most one code per resend interval and a few per hour, beyond which
+// ErrThrottled is returned.
+func (s *Service) Request(ctx context.Context, userID, newEmail string) (*Pending, error) {
+	code, err := generateCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	if err := s.reserve(userID, now); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	change := &pendingChange{
+		email:     newEmail,
+		codeHash:  hashCode(userID, code),
+		expiresAt: now.Add(s.codeTTL),
+	}
+	if previous, ok := s.pending[userID]; ok && strings.EqualFold(previous.email, newEmail) && now.Before(previous.expiresAt) {
+		change.attempts = previous.attempts
+	}
+	s.mu.Unlock()
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Your confirmation code is %s.\n\nIt expires in %d minutes. If you did not request this change, you can ignore this message.",
+			code, int(s.codeTTL.Minutes())),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send confirmation code: %w", err)
+	}
+
+	s.mu.Lock()
+	s.pending[userID] = change
+	s.mu.Unlock()
+
+	return &Pending{Email: newEmail, ExpiresAt: change.expiresAt}, nil
+}
+
+// Confirm checks code against the pending change for userID and, when it
+// matches, updates the identity provider. It returns the confirmed address;
+// the caller is responsible for updating the local account.
+func (s *Service) Confirm(ctx context.Context, userID, code string) (string, error) {
+	s.mu.Lock()
+	change, ok := s.pending[userID]
+	if !ok {
+		s.mu.Unlock()
+		return "", ErrNoPendingChange
+	}
+	if time.Now().After(change.expiresAt) {
+		delete(s.pending, userID)
+		s.mu.Unlock()
+		return "", ErrCodeExpired
+	}
+	if change.attempts >= s.maxAttempts {
+		delete(s.pending, userID)
+		s.mu.Unlock()
+		return "", ErrTooManyAttempts
+	}
+	change.attempts++
+	if subtle.ConstantTimeCompare([]byte(change.codeHash), []byte(hashCode(userID, code))) != 1 {
+		s.mu.Unlock()
+		return "", ErrInvalidCode
+	}
+	email := change.email
+	s.mu.Unlock()
+
+	// Keep the pending change if the provider update fails so the user can retry
+	if s.idp != nil {
+		if err := s.idp.UpdateUserEmail(ctx, userID, email); err != nil {
+			return "", fmt.Errorf("failed to update identity provider: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.pending, userID)
+	s.mu.Unlock()
+
+	return email, nil
+}
+
+// reserve records a code sent to userID at now, or returns ErrThrottled when
+// one can't be sent yet. Sends are pruned here, and users whose sends have
+// all expired are forgotten. The caller holds s.mu.
+func (s *Service) reserve(userID string, now time.Time) error {
+	for id, sent := range s.sends {
+		i := 0
+		for i < len(sent) && now.Sub(sent[i]) >= s.sendWindow {
+			i++
+		}
+		if i == len(sent) {
+			delete(s.sends, id)
+		} else {
+			s.sends[id] = sent[i:]
+		}
+	}
+
+	sent := s.sends[userID]
+	var wait time.Duration
+	if n := len(sent); n > 0 {
+		wait = sent[n-1].Add(s.resendInterval).Sub(now)
+	}
+	if len(sent) >= s.maxSends {
+		wait = max(wait, sent[0].Add(s.sendWindow).Sub(now))
+	}
+	if wait > 0 {
+		return fmt.Errorf("%w, retry in %ds", ErrThrottled, int(math.Ceil(wait.Seconds())))
+	}
+	s.sends[userID] = append(sent, now)
+	return nil
+}
+
+// generateCode returns a random 6-digit code
+func generateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashCode binds a code to the user it was issued for so only hashes are kept
+func hashCode(userID, code string) string {
+	sum := sha256.Sum256([]byte(userID + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,514 @@
+package emailotp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	netmail "net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/mail"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+// Defaults for Config
+const (
+	DefaultCodeTTL        = 10 * time.Minute
+	DefaultMaxAttempts    = 5
+	DefaultResendInterval = 30 * time.Second
+	DefaultMaxSends       = 5
+	DefaultSendWindow     = time.Hour
+	DefaultMaxChallenges  = 10000
+)
+
+// Errors returned by the service
+var (
+	ErrInvalidEmail    = errors.New("invalid email address")
+	ErrThrottled       = errors.New("too many sign-in codes requested")
+	ErrNoChallenge     = errors.New("no pending sign-in code")
+	ErrInvalidCode     = errors.New("invalid sign-in code")
+	ErrCodeExpired     = errors.New("sign-in code expired")
+	ErrTooManyAttempts = errors.New("too many sign-in attempts")
+)
+
+// errUnknownAccount is audited when a code is requested for an address no
+// account has; the caller isn't told
+var errUnknownAccount = errors.New("no account has the address")
+
+// ThrottledError is returned when a code is requested before another may be
+// sent to the address
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry in %ds", ErrThrottled, e.Seconds())
+}
+
+// Seconds returns RetryAfter in whole seconds, rounded up, for a
+// Retry-After header
+func (e *ThrottledError) Seconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// Unwrap lets errors.Is match ErrThrottled
+func (e *ThrottledError) Unwrap() error {
+	return ErrThrottled
+}
+
+// AccountStore finds the accounts codes are sent for
+type AccountStore interface {
+	GetAccountByUserID(ctx context.Context, userID string) (*model.Account, error)
+	GetAccountByVerifiedEmail(ctx context.Context, email string) (*model.Account, error)
+}
+
+// Config holds the code lifetime and throttling limits
+type Config struct {
+	CodeTTL        time.Duration // lifetime of a code (default 10m)
+	MaxAttempts    int           // wrong codes allowed to an address per SendWindow, across resends (default 5)
+	ResendInterval time.Duration // minimum time between codes to one address (default 30s)
+	MaxSends       int           // codes sent to one address per SendWindow (default 5)
+	SendWindow     time.Duration // default 1h
+	MaxChallenges  int           // addresses tracked at once (default 10000)
+	// Secret keys the code hashes. Codes hashed by one instance can only be
+	// checked by instances with the same secret; random per process when
+	// empty.
+	Secret []byte
+}
+
+// Service signs users in with one-time codes mailed to their account's
+// address
+type Service struct {
+	accounts AccountStore
+	mailer   mail.Mailer
+	auditLog *audit.Logger
+	config   Config
+
+	mu         sync.Mutex
+	challenges map[string]*challenge // key is the lowercased address
+
+	delivering sync.WaitGroup // codes being mailed in the background
+}
+
+// challenge is the code state of one address. It outlives its code so
+// sends and wrong guesses keep counting towards the limits.
+type challenge struct {
+	userID    string // empty when no account has the address; no code is mailed
+	codeHash  string
+	expiresAt time.Time   // zero once the code is used or discarded
+	attempts  int         // wrong guesses since the address was last quiet for SendWindow
+	sends     []time.Time // within SendWindow, oldest first
+}
+
+// Challenge is a sign-in code awaiting verification
+type Challenge struct {
+	ExpiresAt time.Time
+	ResendAt  time.Time
+}
+
+// Code is a sign-in code mailed by Send. Only its hash is returned.
+type Code struct {
+	Hash      string
+	ExpiresAt time.Time
+}
+
+// Verification is a verified sign-in
+type Verification struct {
+	UserID string
+	Email  string
+}
+
+// NewService creates an email code service. auditLog may be nil.
+func NewService(accounts AccountStore, mailer mail.Mailer, auditLog *audit.Logger, config Config) *Service {
+	if config.CodeTTL <= 0 {
+		config.CodeTTL = DefaultCodeTTL
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	if config.ResendInterval <= 0 {
+		config.ResendInterval = DefaultResendInterval
+	}
+	if config.MaxSends <= 0 {
+		config.MaxSends = DefaultMaxSends
+	}
+	if config.SendWindow <= 0 {
+		config.SendWindow = DefaultSendWindow
+	}
+	if config.MaxChallenges <= 0 {
+		config.MaxChallenges = DefaultMaxChallenges
+	}
+	if len(config.Secret) == 0 {
+		// Pending codes then stop working on restart, like a lost email
+		config.Secret = make([]byte, 32)
+		rand.Read(config.Secret)
+	}
+
+	return &Service{
+		accounts:   accounts,
+		mailer:     mailer,
+		auditLog:   auditLog,
+		config:     config,
+		challenges: make(map[string]*challenge),
+	}
+}
+
+// Start mails a sign-in code to email, replacing any earlier code for it.
+// Wrong guesses at the earlier code still count. The result, and how long
+// it takes, is the same whether or not an account has the address, so
+// callers can't use it to find accounts; only an account that verified the
+// address gets a code.
+func (s *Service) Start(ctx context.Context, email string) (*Challenge, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	var userID string
+	account, err := s.accounts.GetAccountByVerifiedEmail(ctx, email)
+	switch {
+	case err == nil:
+		userID = account.UserID
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, err
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	key := strings.ToLower(email)
+
+	s.mu.Lock()
+	c, err := s.reserve(key, now)
+	if err != nil {
+		s.mu.Unlock()
+		s.record(ctx, audit.TypeEmailOTPSent, userID, err)
+		return nil, err
+	}
+	c.userID = userID
+	c.codeHash = ""
+	if userID != "" {
+		c.codeHash = s.hashCode(key, code)
+	}
+	c.expiresAt = now.Add(s.config.CodeTTL)
+	s.mu.Unlock()
+
+	if userID == "" {
+		s.record(ctx, audit.TypeEmailOTPSent, "", errUnknownAccount)
+	} else {
+		s.deliverLater(ctx, userID, email, code)
+	}
+	return &Challenge{ExpiresAt: now.Add(s.config.CodeTTL), ResendAt: now.Add(s.config.ResendInterval)}, nil
+}
+
+// Send mails a new code to email for userID like Start, but returns it
+// hashed instead of remembering it. It is for callers that keep their own
+// state, such as the challenge flow, and check answers with CheckCode.
+// Resend throttling applies; limiting wrong answers is up to the caller.
+// With an empty userID nothing is mailed and the code matches no answer,
+// and the call takes as long as when a code is mailed. An unknown user's
+// address may be whatever they signed in with, so it isn't checked.
+func (s *Service) Send(ctx context.Context, userID, email string) (*Code, error) {
+	if normalized, err := normalizeEmail(email); err == nil {
+		email = normalized
+	} else if userID != "" {
+		return nil, err
+	}
+	code, err := generateCode()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	key := strings.ToLower(email)
+
+	s.mu.Lock()
+	_, err = s.reserve(key, now)
+	s.mu.Unlock()
+	if err != nil {
+		s.record(ctx, audit.TypeEmailOTPSent, userID, err)
+		return nil, err
+	}
+
+	sent := &Code{ExpiresAt: now.Add(s.config.CodeTTL)}
+	if userID == "" {
+		s.record(ctx, audit.TypeEmailOTPSent, "", errUnknownAccount)
+		return sent, nil
+	}
+	s.deliverLater(ctx, userID, email, code)
+	sent.Hash = s.hashCode(key, code)
+	return sent, nil
+}
+
+// CheckCode checks code against sent, which Send returned for email
+func (s *Service) CheckCode(email, code string, sent Code, now time.Time) error {
+	if now.After(sent.ExpiresAt) {
+		return ErrCodeExpired
+	}
+	if sent.Hash == "" || subtle.ConstantTimeCompare([]byte(sent.Hash), []byte(s.hashCode(strings.ToLower(strings.TrimSpace(email)), code))) != 1 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// Verify checks code against the pending code for email. A code can be used
+// once. After MaxAttempts wrong guesses at the codes sent to the address
+// within SendWindow, the code is discarded and no new one is sent until
+// the window has passed.
+func (s *Service) Verify(ctx context.Context, email, code string) (verification *Verification, err error) {
+	var userID string
+	defer func() {
+		if err != nil {
+			s.record(ctx, audit.TypeEmailOTPLogin, userID, err)
+		}
+	}()
+
+	email, err = normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.ToLower(email)
+
+	s.mu.Lock()
+	c, ok := s.challenges[key]
+	if !ok || c.expiresAt.IsZero() {
+		s.mu.Unlock()
+		return nil, ErrNoChallenge
+	}
+	userID = c.userID
+	if time.Now().After(c.expiresAt) {
+		c.discard()
+		s.mu.Unlock()
+		return nil, ErrCodeExpired
+	}
+	if c.attempts >= s.config.MaxAttempts {
+		c.discard()
+		s.mu.Unlock()
+		return nil, ErrTooManyAttempts
+	}
+	c.attempts++
+	// Addresses without an account have no hash, so every code is wrong
+	if subtle.ConstantTimeCompare([]byte(c.codeHash), []byte(s.hashCode(key, code))) != 1 {
+		s.mu.Unlock()
+		return nil, ErrInvalidCode
+	}
+	c.discard()
+	c.attempts = 0
+	s.mu.Unlock()
+
+	// The address may have moved to another account since the code was sent
+	account, err := s.accounts.GetAccountByUserID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && (!account.EmailVerified || !strings.EqualFold(account.Email, email))) {
+		return nil, ErrNoChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, audit.TypeEmailOTPLogin, userID, nil)
+	return &Verification{UserID: userID, Email: account.Email}, nil
+}
+
+// reserve records a send to the address key, or returns a ThrottledError
+// when one can't be sent yet, including when too many addresses are
+// tracked to start on another. The caller holds s.mu.
+func (s *Service) reserve(key string, now time.Time) (*challenge, error) {
+	c, ok := s.challenges[key]
+	if !ok {
+		if retryAfter := s.evict(now); retryAfter > 0 {
+			return nil, &ThrottledError{RetryAfter: retryAfter}
+		}
+		c = &challenge{}
+		s.challenges[key] = c
+	}
+	c.pruneSends(now, s.config.SendWindow)
+	if len(c.sends) == 0 {
+		// The address was quiet for a whole window
+		c.attempts = 0
+	}
+	if retryAfter := s.retryAfter(c, now); retryAfter > 0 {
+		return nil, &ThrottledError{RetryAfter: retryAfter}
+	}
+	c.sends = append(c.sends, now)
+	return c, nil
+}
+
+// deliverLater mails code to email in the background. The caller answers
+// before the mailer is done, so the answer takes as long whether or not an
+// account has the address, and a failure to mail, which only account
+// holders could cause, is logged and audited rather than returned.
+func (s *Service) deliverLater(ctx context.Context, userID, email, code string) {
+	ctx = context.WithoutCancel(ctx)
+	s.delivering.Add(1)
+	go func() {
+		defer s.delivering.Done()
+		if err := s.deliver(ctx, userID, email, code); err != nil {
+			slog.ErrorContext(ctx, "failed to mail sign-in code", "error", err)
+		}
+	}()
+}
+
+// Wait blocks until the codes being mailed have been handed to the mailer,
+// e.g. before the server exits
+func (s *Service) Wait() {
+	s.delivering.Wait()
+}
+
+// deliver mails code to email and audits the send
+func (s *Service) deliver(ctx context.Context, userID, email, code string) error {
+	err := s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Your sign-in code",
+		Body: fmt.Sprintf("Your sign-in code is %s.\n\nIt expires in %d minutes. If you did not try to sign in, you can ignore this message.",
+			code, int(s.config.CodeTTL.Minutes())),
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to send sign-in code: %w", err)
+		s.record(ctx, audit.TypeEmailOTPSent, userID, err)
+		return err
+	}
+	s.record(ctx, audit.TypeEmailOTPSent, userID, nil)
+	return nil
+}
+
+// retryAfter returns how long c must wait before another code is sent, or
+// zero when one can be sent now
+func (s *Service) retryAfter(c *challenge, now time.Time) time.Duration {
+	var wait time.Duration
+	if n := len(c.sends); n > 0 {
+		wait = c.sends[n-1].Add(s.config.ResendInterval).Sub(now)
+	}
+	if len(c.sends) >= s.config.MaxSends {
+		if windowWait := c.sends[0].Add(s.config.SendWindow).Sub(now); windowWait > wait {
+			wait = windowWait
+		}
+	}
+	if n := len(c.sends); n > 0 && c.attempts >= s.config.MaxAttempts {
+		// Out of guesses: a new code would only allow more
+		wait = max(wait, c.sends[n-1].Add(s.config.SendWindow).Sub(now))
+	}
+	return max(wait, 0)
+}
+
+// evict removes challenges with no live code and no sends in the window
+// when too many are tracked. Others still throttle their address, so they
+// are kept; if none can go, evict returns how long until one can. The
+// caller holds s.mu.
+func (s *Service) evict(now time.Time) time.Duration {
+	if len(s.challenges) < s.config.MaxChallenges {
+		return 0
+	}
+	var wait time.Duration
+	for key, c := range s.challenges {
+		c.pruneSends(now, s.config.SendWindow)
+		if len(c.sends) == 0 && (c.expiresAt.IsZero() || now.After(c.expiresAt)) {
+			delete(s.challenges, key)
+			continue
+		}
+		free := c.expiresAt.Sub(now)
+		if n := len(c.sends); n > 0 {
+			free = max(free, c.sends[n-1].Add(s.config.SendWindow).Sub(now))
+		}
+		if wait == 0 || free < wait {
+			wait = free
+		}
+	}
+	if len(s.challenges) < s.config.MaxChallenges {
+		return 0
+	}
+	return max(wait, time.Second)
+}
+
+// pruneSends forgets sends older than window
+func (c *challenge) pruneSends(now time.Time, window time.Duration) {
+	i := 0
+	for i < len(c.sends) && now.Sub(c.sends[i]) >= window {
+		i++
+	}
+	c.sends = c.sends[i:]
+}
+
+// discard invalidates the pending code
+func (c *challenge) discard() {
+	c.codeHash = ""
+	c.expiresAt = time.Time{}
+}
+
+// record writes an audit event for a code being sent or checked
+func (s *Service) record(ctx context.Context, eventType, userID string, err error) {
+	event := audit.Event{
+		Type:    eventType,
+		Actor:   userID,
+		Subject: userID,
+		Outcome: audit.OutcomeSuccess,
+	}
+	if err != nil {
+		event.Outcome = audit.OutcomeFailure
+		event.Reason = FailureReason(err)
+	}
+	s.auditLog.Record(ctx, event)
+}
+
+// FailureReason maps a service error to a short label for logs and audit
+// events
+func FailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidEmail):
+		return "invalid_email"
+	case errors.Is(err, ErrThrottled):
+		return "throttled"
+	case errors.Is(err, ErrNoChallenge):
+		return "no_challenge"
+	case errors.Is(err, ErrInvalidCode):
+		return "invalid_code"
+	case errors.Is(err, ErrCodeExpired):
+		return "code_expired"
+	case errors.Is(err, ErrTooManyAttempts):
+		return "too_many_attempts"
+	case errors.Is(err, errUnknownAccount):
+		return "unknown_account"
+	default:
+		return "error"
+	}
+}
+
+// normalizeEmail checks that email is a bare address and trims it
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := netmail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > 254 {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// generateCode returns a random 6-digit code
+func generateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashCode binds a code to the address it was sent to so only hashes are
+// kept. It is keyed so a hash that leaves the service, in challenge state or
+// trigger parameters, can't be brute-forced over the million codes.
+func (s *Service) hashCode(email, code string) string {
+	mac := hmac.New(sha256.New, s.config.Secret)
+	mac.Write([]byte(email + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
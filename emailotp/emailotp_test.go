@@ -0,0 +1,286 @@
+package emailotp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/mail"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+var codePattern = regexp.MustCompile(`\d{6}`)
+
+// newTestService creates a service with an account that verified each
+// address
+func newTestService(t *testing.T, config Config, emails ...string) (*Service, *mail.MemoryMailer) {
+	t.Helper()
+	ctx := context.Background()
+	accounts := store.NewMemoryStore()
+	for i, email := range emails {
+		userID := fmt.Sprintf("auth0|user%d", i+1)
+		if _, err := accounts.CreateAccount(ctx, userID, email); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := accounts.UpdateEmail(ctx, userID, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mailer := mail.NewMemoryMailer()
+	return NewService(accounts, mailer, nil, config), mailer
+}
+
+// lastCode returns the code last mailed to email, or "" if none was
+func lastCode(s *Service, mailer *mail.MemoryMailer, email string) string {
+	s.Wait()
+	messages := mailer.Messages(email)
+	if len(messages) == 0 {
+		return ""
+	}
+	return codePattern.FindString(messages[len(messages)-1].Body)
+}
+
+// passWindow moves the sends to email back by a SendWindow, as if it had
+// passed
+func passWindow(s *Service, email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.challenges[email]
+	for i := range c.sends {
+		c.sends[i] = c.sends[i].Add(-s.config.SendWindow)
+	}
+}
+
+func TestCodeHashIsKeyed(t *testing.T) {
+	ctx := context.Background()
+	s, mailer := newTestService(t, Config{Secret: []byte("secret-a")}, "user@example.com")
+
+	sent, err := s.Send(ctx, "auth0|user1", "user@example.com")
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	code := lastCode(s, mailer, "user@example.com")
+	unkeyed := sha256.Sum256([]byte("user@example.com:" + code))
+	if sent.Hash == hex.EncodeToString(unkeyed[:]) {
+		t.Fatal("Send() returned an unkeyed hash of the code")
+	}
+
+	if err := s.CheckCode("user@example.com", code, *sent, time.Now()); err != nil {
+		t.Errorf("CheckCode() error = %v, want nil", err)
+	}
+	other, _ := newTestService(t, Config{Secret: []byte("secret-b")})
+	if err := other.CheckCode("user@example.com", code, *sent, time.Now()); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("CheckCode() with another secret error = %v, want %v", err, ErrInvalidCode)
+	}
+}
+
+func TestSignIn(t *testing.T) {
+	ctx := context.Background()
+	s, mailer := newTestService(t, Config{}, "user@example.com")
+
+	if _, err := s.Start(ctx, "User@Example.com"); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	code := lastCode(s, mailer, "user@example.com")
+	verification, err := s.Verify(ctx, "user@example.com", code)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if verification.UserID != "auth0|user1" || verification.Email != "user@example.com" {
+		t.Errorf("Verify() = %+v, want auth0|user1", verification)
+	}
+
+	// A code can be used once
+	if _, err := s.Verify(ctx, "user@example.com", code); !errors.Is(err, ErrNoChallenge) {
+		t.Errorf("Verify() of a used code error = %v, want %v", err, ErrNoChallenge)
+	}
+}
+
+func TestUnverifiedAndUnknownAddresses(t *testing.T) {
+	ctx := context.Background()
+	s, mailer := newTestService(t, Config{}, "verified@example.com")
+	if _, err := s.accounts.(*store.MemoryStore).CreateAccount(ctx, "auth0|unverified", "unverified@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, email := range []string{"unverified@example.com", "nobody@example.com"} {
+		challenge, err := s.Start(ctx, email)
+		if err != nil || challenge.ExpiresAt.IsZero() || challenge.ResendAt.IsZero() {
+			t.Errorf("Start(%s) = %+v, %v, want a challenge like any other", email, challenge, err)
+		}
+		if code := lastCode(s, mailer, email); code != "" {
+			t.Errorf("a code was mailed to %s", email)
+		}
+		if _, err := s.Verify(ctx, email, "000000"); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("Verify(%s) error = %v, want %v", email, err, ErrInvalidCode)
+		}
+	}
+}
+
+func TestAddressMovedAfterSend(t *testing.T) {
+	ctx := context.Background()
+	s, mailer := newTestService(t, Config{}, "user@example.com")
+
+	if _, err := s.Start(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if _, err := s.accounts.(*store.MemoryStore).UpdateEmail(ctx, "auth0|user1", "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Verify(ctx, "user@example.com", lastCode(s, mailer, "user@example.com")); !errors.Is(err, ErrNoChallenge) {
+		t.Errorf("Verify() after the address moved error = %v, want %v", err, ErrNoChallenge)
+	}
+}
+
+// blockingMailer holds every message until release is closed
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg mail.Message) error {
+	<-m.release
+	return nil
+}
+
+func TestStartDoesNotWaitForTheMailer(t *testing.T) {
+	ctx := context.Background()
+	accounts := store.NewMemoryStore()
+	accounts.CreateAccount(ctx, "auth0|user1", "user@example.com")
+	accounts.UpdateEmail(ctx, "auth0|user1", "user@example.com")
+	mailer := &blockingMailer{release: make(chan struct{})}
+	s := NewService(accounts, mailer, nil, Config{})
+
+	// A known address answers as soon as an unknown one
+	done := make(chan error)
+	go func() {
+		_, err := s.Start(ctx, "user@example.com")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() waited for the mailer")
+	}
+	close(mailer.release)
+	s.Wait()
+}
+
+func TestCodeExpires(t *testing.T) {
+	ctx := context.Background()
+	s, mailer := newTestService(t, Config{}, "user@example.com")
+
+	if _, err := s.Start(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	s.mu.Lock()
+	s.challenges["user@example.com"].expiresAt = time.Now().Add(-time.Second)
+	s.mu.Unlock()
+	if _, err := s.Verify(ctx, "user@example.com", lastCode(s, mailer, "user@example.com")); !errors.Is(err, ErrCodeExpired) {
+		t.Errorf("Verify() of an expired code error = %v, want %v", err, ErrCodeExpired)
+	}
+}
+
+func TestAttemptsCountAcrossResends(t *testing.T) {
+	ctx := context.Background()
+	s, mailer := newTestService(t, Config{MaxAttempts: 3, ResendInterval: time.Nanosecond}, "user@example.com")
+
+	s.Start(ctx, "user@example.com")
+	for range 2 {
+		if _, err := s.Verify(ctx, "user@example.com", "000000"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("Verify() of a wrong code error = %v, want %v", err, ErrInvalidCode)
+		}
+	}
+
+	// A new code doesn't bring new guesses
+	if _, err := s.Start(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Start() resending error = %v", err)
+	}
+	if _, err := s.Verify(ctx, "user@example.com", "000000"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("Verify() of a wrong code error = %v, want %v", err, ErrInvalidCode)
+	}
+	code := lastCode(s, mailer, "user@example.com")
+	if _, err := s.Verify(ctx, "user@example.com", code); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Verify() after the last guess error = %v, want %v", err, ErrTooManyAttempts)
+	}
+	_, err := s.Start(ctx, "user@example.com")
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || throttled.RetryAfter < time.Hour-time.Minute {
+		t.Fatalf("Start() out of guesses error = %v, want a ThrottledError for the window", err)
+	}
+
+	// Once the window has passed the address starts afresh
+	passWindow(s, "user@example.com")
+	if _, err := s.Start(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Start() after the window error = %v", err)
+	}
+	if _, err := s.Verify(ctx, "user@example.com", lastCode(s, mailer, "user@example.com")); err != nil {
+		t.Errorf("Verify() after the window error = %v, want nil", err)
+	}
+}
+
+func TestResendThrottling(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, Config{ResendInterval: time.Minute, MaxSends: 2}, "user@example.com")
+
+	if _, err := s.Start(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	_, err := s.Start(ctx, "user@example.com")
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || throttled.RetryAfter > time.Minute || throttled.Seconds() < 59 {
+		t.Fatalf("Start() within the resend interval error = %v, want to retry in a minute", err)
+	}
+
+	// Past the interval a second code goes out, then the hourly limit holds
+	s.mu.Lock()
+	s.challenges["user@example.com"].sends[0] = time.Now().Add(-2 * time.Minute)
+	s.mu.Unlock()
+	if _, err := s.Start(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Start() after the resend interval error = %v", err)
+	}
+	s.mu.Lock()
+	s.challenges["user@example.com"].sends[1] = time.Now().Add(-2 * time.Minute)
+	s.mu.Unlock()
+	if _, err := s.Start(ctx, "user@example.com"); !errors.As(err, &throttled) || throttled.RetryAfter < 50*time.Minute {
+		t.Errorf("Start() past MaxSends error = %v, want to retry when the oldest send leaves the window", err)
+	}
+
+	// Unknown addresses are throttled alike
+	s.Start(ctx, "nobody@example.com")
+	if _, err := s.Start(ctx, "nobody@example.com"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("Start() resending to an unknown address error = %v, want %v", err, ErrThrottled)
+	}
+}
+
+func TestFullTableRefusesNewAddresses(t *testing.T) {
+	ctx := context.Background()
+	s, mailer := newTestService(t, Config{MaxChallenges: 2}, "a@example.com", "b@example.com", "c@example.com")
+
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if _, err := s.Start(ctx, email); err != nil {
+			t.Fatalf("Start(%s) error = %v", email, err)
+		}
+	}
+
+	_, err := s.Start(ctx, "c@example.com")
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || throttled.RetryAfter <= 0 {
+		t.Fatalf("Start() with a full table error = %v, want a ThrottledError with a retry time", err)
+	}
+
+	// The tracked addresses keep their codes and their limits
+	if _, err := s.Verify(ctx, "a@example.com", lastCode(s, mailer, "a@example.com")); err != nil {
+		t.Errorf("Verify() of a tracked address error = %v, want nil", err)
+	}
+	if _, err := s.Start(ctx, "b@example.com"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("Start() resending to a tracked address error = %v, want %v", err, ErrThrottled)
+	}
+}
@@ -0,0 +1,118 @@
+package emailotp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Paths the sign-in endpoints are served on
+const (
+	StartPath  = "/email-otp/start"
+	VerifyPath = "/email-otp/verify"
+)
+
+// maxRequestBody bounds the size of a request body
+const maxRequestBody = 4 << 10
+
+// StartResult is the body returned when a code is requested
+type StartResult struct {
+	ExpiresAt string `json:"expiresAt"`
+	ResendAt  string `json:"resendAt"`
+}
+
+// LoginResult is the body returned for a successful sign-in
+type LoginResult struct {
+	UserID string `json:"userId"`
+	Email  string `json:"email"`
+}
+
+// StartHandler serves POST requests of {"email"} and mails a code to the
+// address. Requests made too soon after the last one get a 429 with a
+// Retry-After header.
+func (s *Service) StartHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody)).Decode(&request); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+
+		challenge, err := s.Start(r.Context(), request.Email)
+		var throttled *ThrottledError
+		switch {
+		case errors.Is(err, ErrInvalidEmail):
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_email"})
+			return
+		case errors.As(err, &throttled):
+			w.Header().Set("Retry-After", strconv.Itoa(throttled.Seconds()))
+			respondJSON(w, http.StatusTooManyRequests, map[string]string{"error": "slow_down"})
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "failed to send sign-in code", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		respondJSON(w, http.StatusAccepted, StartResult{
+			ExpiresAt: challenge.ExpiresAt.Format(time.RFC3339),
+			ResendAt:  challenge.ResendAt.Format(time.RFC3339),
+		})
+	})
+}
+
+// VerifyHandler serves POST requests of {"email", "code"} and returns the
+// user the address belongs to. Failures get a generic 401; the reason is
+// logged and audited.
+func (s *Service) VerifyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			Email string `json:"email"`
+			Code  string `json:"code"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody)).Decode(&request); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+
+		verification, err := s.Verify(r.Context(), request.Email, request.Code)
+		if err != nil {
+			slog.InfoContext(r.Context(), "email code sign-in failed", "reason", FailureReason(err), "error", err)
+			status := http.StatusUnauthorized
+			if FailureReason(err) == "error" {
+				// Not a verification failure, e.g. the store is unavailable
+				status = http.StatusInternalServerError
+			}
+			respondJSON(w, status, map[string]string{"error": "login_failed"})
+			return
+		}
+
+		respondJSON(w, http.StatusOK, LoginResult{UserID: verification.UserID, Email: verification.Email})
+	})
+}
+
+// respondJSON writes a JSON response
+func respondJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,40 @@
+package events
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+)
+
+// Broker names accepted in Config.Broker
+const (
+	BrokerMemory   = "memory"
+	BrokerPostgres = "postgres"
+)
+
+// Config holds event bus configuration
+type Config struct {
+	Broker      string // memory (default) or postgres
+	DatabaseURL string // PostgreSQL connection string for the postgres broker
+	Channel     string // notification channel for the postgres broker (default graphql_events)
+}
+
+// Open creates an event bus backed by the configured broker
+func Open(config Config) (*Bus, error) {
+	switch config.Broker {
+	case "", BrokerMemory:
+		return NewBus(NewMemoryBroker()), nil
+	case BrokerPostgres:
+		if config.DatabaseURL == "" {
+			return nil, fmt.Errorf("database URL is required for the postgres event broker")
+		}
+		db, err := sql.Open("pgx", config.DatabaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open event database: %w", err)
+		}
+		return NewBus(NewPostgresBroker(db, config.DatabaseURL, config.Channel)), nil
+	default:
+		return nil, fmt.Errorf("unknown event broker: %s", config.Broker)
+	}
+}
@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is the number of messages a subscriber can fall behind by
+// before further messages to it are dropped
+const subscriberBuffer = 16
+
+// TopicMigration carries MigrationEvent payloads
+const TopicMigration = "migration"
+
+// AccountTopic is the topic carrying AccountUpdated payloads for userID
+func AccountTopic(userID string) string {
+	return "account:" + userID
+}
+
+// AccountUpdated is published when an account changes. Subscribers reload
+// the account, so the payload only identifies it.
+type AccountUpdated struct {
+	UserID string `json:"userId"`
+}
+
+// MigrationEvent is published for every Passage token exchange
+type MigrationEvent struct {
+	Time          time.Time `json:"time"`
+	Outcome       string    `json:"outcome"`
+	PassageUserID string    `json:"passageUserId,omitempty"`
+	Auth0UserID   string    `json:"auth0UserId,omitempty"`
+}
+
+// Message is a payload published on a topic
+type Message struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Broker carries messages between the instances of the server. Every
+// message published through any instance is delivered to the handler passed
+// to Receive on every instance, including the publishing one.
+type Broker interface {
+	Publish(ctx context.Context, msg Message) error
+	// Receive calls handle for each message until ctx is done
+	Receive(ctx context.Context, handle func(Message)) error
+}
+
+// Bus fans messages out to the subscribers of this instance
+type Bus struct {
+	broker Broker
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan json.RawMessage]struct{}
+}
+
+// NewBus creates a bus on top of broker. Run must be started to deliver messages.
+func NewBus(broker Broker) *Bus {
+	return &Bus{
+		broker:      broker,
+		subscribers: make(map[string]map[chan json.RawMessage]struct{}),
+	}
+}
+
+// Run delivers messages from the broker to local subscribers until ctx is done
+func (b *Bus) Run(ctx context.Context) error {
+	return b.broker.Receive(ctx, b.dispatch)
+}
+
+// Publish sends payload, encoded as JSON, to the subscribers of topic on every
+// instance. It is safe to call on a nil *Bus, which drops the message.
+func (b *Bus) Publish(ctx context.Context, topic string, payload any) error {
+	if b == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if err := b.broker.Publish(ctx, Message{Topic: topic, Payload: data}); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving the payloads published on topic. The
+// channel is closed once ctx is done.
+func (b *Bus) Subscribe(ctx context.Context, topic string) <-chan json.RawMessage {
+	ch := make(chan json.RawMessage, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = make(map[chan json.RawMessage]struct{})
+	}
+	b.subscribers[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers[topic], ch)
+		if len(b.subscribers[topic]) == 0 {
+			delete(b.subscribers, topic)
+		}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// dispatch hands msg to the local subscribers of its topic without blocking
+func (b *Bus) dispatch(msg Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[msg.Topic] {
+		select {
+		case ch <- msg.Payload:
+		default:
+			slog.Warn("dropped event for slow subscriber", "topic", msg.Topic)
+		}
+	}
+}
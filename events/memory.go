@@ -0,0 +1,46 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBroker delivers messages within a single process
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	handlers map[int]func(Message)
+	nextID   int
+}
+
+// NewMemoryBroker creates an in-process broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{handlers: make(map[int]func(Message))}
+}
+
+// Publish delivers msg to every running Receive call
+func (b *MemoryBroker) Publish(ctx context.Context, msg Message) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handle := range b.handlers {
+		handle(msg)
+	}
+	return nil
+}
+
+// Receive calls handle for each published message until ctx is done
+func (b *MemoryBroker) Receive(ctx context.Context, handle func(Message)) error {
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = handle
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.handlers, id)
+	b.mu.Unlock()
+
+	return ctx.Err()
+}
@@ -0,0 +1,94 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultChannel is the PostgreSQL notification channel used by PostgresBroker
+const DefaultChannel = "graphql_events"
+
+// maxReconnectDelay caps the wait between attempts to re-establish LISTEN
+const maxReconnectDelay = 30 * time.Second
+
+// PostgresBroker fans messages out across instances with PostgreSQL
+// LISTEN/NOTIFY. Notifications sent while an instance is reconnecting are
+// not redelivered to it, and payloads are limited to about 8000 bytes.
+type PostgresBroker struct {
+	db          *sql.DB
+	databaseURL string
+	channel     string
+}
+
+// NewPostgresBroker creates a broker publishing through db and listening on a
+// dedicated connection to databaseURL
+func NewPostgresBroker(db *sql.DB, databaseURL, channel string) *PostgresBroker {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	return &PostgresBroker{db: db, databaseURL: databaseURL, channel: channel}
+}
+
+// Publish sends msg as a notification on the broker's channel
+func (b *PostgresBroker) Publish(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, b.channel, string(data))
+	return err
+}
+
+// Receive listens on the broker's channel and calls handle for each
+// notification until ctx is done, reconnecting after connection failures
+func (b *PostgresBroker) Receive(ctx context.Context, handle func(Message)) error {
+	delay := time.Second
+	for {
+		err := b.listen(ctx, handle, func() { delay = time.Second })
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		slog.WarnContext(ctx, "event listener disconnected", "error", err, "retry_in", delay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// listen runs a single LISTEN session, calling connected once it is established
+func (b *PostgresBroker) listen(ctx context.Context, handle func(Message), connected func()) error {
+	conn, err := pgx.Connect(ctx, b.databaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{b.channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	connected()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var msg Message
+		if err := json.Unmarshal([]byte(notification.Payload), &msg); err != nil {
+			slog.WarnContext(ctx, "ignored malformed event notification", "error", err)
+			continue
+		}
+		handle(msg)
+	}
+}
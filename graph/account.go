@@ -0,0 +1,121 @@
+package graph
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/auth"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+// syncEmail updates the stored email when the token carries a verified email
+// that differs from it and was issued after the stored email last changed.
+// This picks up changes made directly in the identity provider and replaces
+// placeholder addresses. A verified claim for the stored email marks it
+// verified. Accounts scheduled for deletion are left alone. Failures are
+// logged and the account returned as is.
+func (r *Resolver) syncEmail(ctx context.Context, user *auth.UserInfo, account *model.Account) *model.Account {
+	if account.DeletionScheduledAt != nil {
+		return account
+	}
+	if !user.EmailVerified || user.Email == "" {
+		return account
+	}
+	if strings.EqualFold(user.Email, account.Email) {
+		if account.EmailVerified {
+			return account
+		}
+		updated, err := r.Store.UpdateEmail(ctx, user.UserID, account.Email)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to mark account email verified", "error", err)
+			return account
+		}
+		return updated
+	}
+	if !user.IssuedAt.After(account.EmailUpdatedAt) {
+		return account
+	}
+
+	updated, err := r.Store.UpdateEmail(ctx, user.UserID, user.Email)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to sync account email from token", "error", err)
+		return account
+	}
+
+	r.Audit.Record(ctx, audit.Event{
+		Type:    audit.TypeAccountEmailChanged,
+		Actor:   user.UserID,
+		Subject: account.ID,
+		Outcome: audit.OutcomeSuccess,
+		Reason:  "token_sync",
+	})
+	r.publishAccountUpdated(ctx, user.UserID)
+
+	return updated
+}
+
+// accountSource reports where a new account for userID comes from: accounts
+// of users migrated from Passage are tagged PASSAGE
+func (r *Resolver) accountSource(userID string) model.AccountSource {
+	if r.Migrations != nil {
+		if _, ok := r.Migrations.GetMigrationStatusByAuth0UserID(userID); ok {
+			return model.AccountSourcePassage
+		}
+	}
+	return model.AccountSourceAuth0
+}
+
+// toAccountFilter converts the GraphQL filter input into a store filter
+func toAccountFilter(filter *model.AccountFilter) (store.AccountFilter, error) {
+	var result store.AccountFilter
+	if filter == nil {
+		return result, nil
+	}
+
+	verr := &ValidationError{}
+	result.EmailPrefix = deref(filter.EmailPrefix)
+	if filter.Source != nil {
+		result.Source = *filter.Source
+	}
+	if filter.CreatedAfter != nil {
+		createdAfter, err := time.Parse(time.RFC3339, *filter.CreatedAfter)
+		if err != nil {
+			verr.add("createdAfter", "must be an RFC 3339 timestamp")
+		}
+		result.CreatedAfter = createdAfter
+	}
+	if filter.CreatedBefore != nil {
+		createdBefore, err := time.Parse(time.RFC3339, *filter.CreatedBefore)
+		if err != nil {
+			verr.add("createdBefore", "must be an RFC 3339 timestamp")
+		}
+		result.CreatedBefore = createdBefore
+	}
+
+	return result, verr.orNil()
+}
+
+// toAccountConnection converts a page of accounts into a Relay connection
+func toAccountConnection(page *store.Page[*model.Account]) *model.AccountConnection {
+	connection := &model.AccountConnection{
+		Edges: make([]*model.AccountEdge, len(page.Edges)),
+		PageInfo: &model.PageInfo{
+			HasNextPage:     page.HasNextPage,
+			HasPreviousPage: page.HasPreviousPage,
+		},
+		TotalCount: page.TotalCount,
+	}
+	for i, edge := range page.Edges {
+		connection.Edges[i] = &model.AccountEdge{Cursor: edge.Cursor, Node: edge.Node}
+	}
+	if len(page.Edges) > 0 {
+		connection.PageInfo.StartCursor = &page.Edges[0].Cursor
+		connection.PageInfo.EndCursor = &page.Edges[len(page.Edges)-1].Cursor
+	}
+
+	return connection
+}
@@ -0,0 +1,87 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// toAuditFilter converts the GraphQL filter input into an audit query filter
+func toAuditFilter(filter *model.AuditEventFilter, limit *int) (audit.Filter, error) {
+	var result audit.Filter
+	if limit != nil {
+		result.Limit = *limit
+	}
+	if filter == nil {
+		return result, nil
+	}
+
+	result.Type = deref(filter.Type)
+	result.Actor = deref(filter.Actor)
+	result.Subject = deref(filter.Subject)
+	result.Outcome = deref(filter.Outcome)
+
+	if filter.Since != nil {
+		since, err := time.Parse(time.RFC3339, *filter.Since)
+		if err != nil {
+			return result, fmt.Errorf("%w: since must be an RFC 3339 timestamp", ErrInvalidInput)
+		}
+		result.Since = since
+	}
+	if filter.Until != nil {
+		until, err := time.Parse(time.RFC3339, *filter.Until)
+		if err != nil {
+			return result, fmt.Errorf("%w: until must be an RFC 3339 timestamp", ErrInvalidInput)
+		}
+		result.Until = until
+	}
+
+	return result, nil
+}
+
+// toModelAuditEvent converts an audit event into its GraphQL representation
+func toModelAuditEvent(event audit.Event) *model.AuditEvent {
+	keys := make([]string, 0, len(event.Metadata))
+	for key := range event.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	metadata := make([]*model.AuditMetadata, len(keys))
+	for i, key := range keys {
+		metadata[i] = &model.AuditMetadata{Key: key, Value: event.Metadata[key]}
+	}
+
+	return &model.AuditEvent{
+		ID:        event.ID,
+		Time:      event.Time.Format(time.RFC3339),
+		Type:      event.Type,
+		Actor:     optional(event.Actor),
+		Subject:   optional(event.Subject),
+		IP:        optional(event.IP),
+		UserAgent: optional(event.UserAgent),
+		Outcome:   event.Outcome,
+		Reason:    optional(event.Reason),
+		RequestID: optional(event.RequestID),
+		Metadata:  metadata,
+	}
+}
+
+// deref returns the string s points to, or "" for nil
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// optional returns a pointer to s, or nil for ""
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
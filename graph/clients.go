@@ -0,0 +1,32 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/auth"
+)
+
+// requirePermission returns the caller, user or service client, if it holds permission
+func requirePermission(ctx context.Context, permission string) (*auth.UserInfo, error) {
+	principal, err := auth.GetPrincipalFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !principal.HasPermission(permission) {
+		return nil, fmt.Errorf("%w: %s permission required", auth.ErrForbidden, permission)
+	}
+	return principal, nil
+}
+
+// recordClientChange audits an administrative change to a service client
+func (r *Resolver) recordClientChange(ctx context.Context, actor *auth.UserInfo, clientID, reason string) {
+	r.Audit.Record(ctx, audit.Event{
+		Type:    audit.TypeAdminAction,
+		Actor:   actor.UserID,
+		Subject: clientID,
+		Outcome: audit.OutcomeSuccess,
+		Reason:  reason,
+	})
+}
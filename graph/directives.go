@@ -0,0 +1,25 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/example/auth0-gqlgen-demo/auth"
+)
+
+// Directives returns the implementations of the schema directives
+func Directives() DirectiveRoot {
+	return DirectiveRoot{
+		Authenticated: Authenticated,
+	}
+}
+
+// Authenticated implements @authenticated: the field only resolves for
+// callers that presented a valid access token, users and service clients
+// alike. Resolvers still check the kind of caller and its permissions.
+func Authenticated(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
+	if _, err := auth.GetPrincipalFromContext(ctx); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
@@ -0,0 +1,121 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/example/auth0-gqlgen-demo/auth"
+	"github.com/example/auth0-gqlgen-demo/emailchange"
+	"github.com/example/auth0-gqlgen-demo/revocation"
+	"github.com/example/auth0-gqlgen-demo/store"
+	"github.com/example/auth0-gqlgen-demo/webauthn"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Error codes returned to clients in extensions.code
+const (
+	CodeUnauthenticated = "UNAUTHENTICATED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeNotFound        = "NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+	CodeBadUserInput    = "BAD_USER_INPUT"
+	CodeInternal        = "INTERNAL"
+)
+
+// ErrInvalidInput is returned by resolvers when arguments fail validation
+var ErrInvalidInput = errors.New("invalid input")
+
+// internalMessage is shown to clients in place of unexpected errors
+const internalMessage = "internal server error"
+
+// errorCodes maps sentinel errors to client-facing codes, checked in order
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{auth.ErrUnauthenticated, CodeUnauthenticated},
+	{auth.ErrForbidden, CodeForbidden},
+	{store.ErrNotFound, CodeNotFound},
+	{store.ErrConflict, CodeConflict},
+	{store.ErrPendingDeletion, CodeConflict},
+	{store.ErrClientNotFound, CodeNotFound},
+	{store.ErrClientConflict, CodeConflict},
+	{store.ErrOrgNotFound, CodeNotFound},
+	{store.ErrOrgConflict, CodeConflict},
+	{store.ErrMembershipNotFound, CodeNotFound},
+	{store.ErrAlreadyMember, CodeConflict},
+	{store.ErrLastOwner, CodeConflict},
+	{store.ErrInvitationNotFound, CodeNotFound},
+	{store.ErrInvitationExpired, CodeBadUserInput},
+	{store.ErrInvalidCursor, CodeBadUserInput},
+	{store.ErrInvalidPage, CodeBadUserInput},
+	{ErrInvalidInput, CodeBadUserInput},
+	{emailchange.ErrNoPendingChange, CodeNotFound},
+	{emailchange.ErrInvalidCode, CodeBadUserInput},
+	{emailchange.ErrCodeExpired, CodeBadUserInput},
+	{emailchange.ErrTooManyAttempts, CodeBadUserInput},
+	{emailchange.ErrThrottled, CodeBadUserInput},
+	{revocation.ErrInvalidEntry, CodeBadUserInput},
+	{store.ErrPasskeyNotFound, CodeNotFound},
+	{webauthn.ErrCredentialExists, CodeConflict},
+	{webauthn.ErrInvalidResponse, CodeBadUserInput},
+	{webauthn.ErrUnknownChallenge, CodeBadUserInput},
+	{webauthn.ErrOriginMismatch, CodeBadUserInput},
+	{webauthn.ErrUserVerification, CodeBadUserInput},
+	{webauthn.ErrInvalidAttestation, CodeBadUserInput},
+}
+
+// ErrorPresenter maps resolver errors to GraphQL errors with an
+// extensions.code. Errors that don't match a known sentinel are logged and
+// replaced with a generic INTERNAL error so internal details never reach
+// the client.
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	var gqlErr *gqlerror.Error
+	if errors.As(err, &gqlErr) {
+		// Errors raised by gqlgen itself (argument coercion, directives) are
+		// already meant for the client
+		if gqlErr.Err == nil {
+			return gqlErr
+		}
+		// gqlgen wraps resolver errors with their path; present the cause
+		err = gqlErr.Err
+	}
+
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		gqlErr := withCode(ctx, err.Error(), CodeBadUserInput)
+		gqlErr.Extensions["fields"] = verr.Fields
+		return gqlErr
+	}
+
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			return withCode(ctx, err.Error(), known.code)
+		}
+	}
+
+	slog.ErrorContext(ctx, "graphql resolver error", "path", graphql.GetPath(ctx).String(), "error", err)
+	return withCode(ctx, internalMessage, CodeInternal)
+}
+
+// Recover logs a resolver panic with its stack trace and returns an INTERNAL error
+func Recover(ctx context.Context, p any) error {
+	slog.ErrorContext(ctx, "graphql resolver panic",
+		"panic", fmt.Sprint(p),
+		"stack", string(debug.Stack()),
+	)
+	return withCode(ctx, internalMessage, CodeInternal)
+}
+
+// withCode builds a GraphQL error at the current path with extensions.code set
+func withCode(ctx context.Context, message, code string) *gqlerror.Error {
+	return &gqlerror.Error{
+		Message:    message,
+		Path:       graphql.GetPath(ctx),
+		Extensions: map[string]interface{}{"code": code},
+	}
+}
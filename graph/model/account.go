@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// Account is a user's account record. Fields without a json name are
+// internal bookkeeping and are not exposed through GraphQL.
+type Account struct {
+	ID          string  `json:"id"`
+	Email       string  `json:"email"`
+	UserID      string  `json:"userId"`
+	DisplayName *string `json:"displayName,omitempty"`
+	AvatarURL   *string `json:"avatarUrl,omitempty"`
+	// BCP 47 language tag, e.g. en-US
+	Locale *string `json:"locale,omitempty"`
+	// IANA time zone name, e.g. Europe/Berlin
+	Timezone            *string `json:"timezone,omitempty"`
+	MarketingEmailOptIn bool    `json:"marketingEmailOptIn"`
+	MarketingPushOptIn  bool    `json:"marketingPushOptIn"`
+	// Whether the user signed up through Auth0 or was migrated from Passage
+	Source    AccountSource `json:"source"`
+	CreatedAt string        `json:"createdAt"`
+	UpdatedAt string        `json:"updatedAt"`
+
+	// EmailUpdatedAt is when Email last changed, used to decide whether a
+	// token's email claim is newer than the stored one
+	EmailUpdatedAt time.Time `json:"-"`
+	// EmailVerified is whether Email is known to be the user's, from a
+	// verified token claim or a confirmation code. Only verified addresses
+	// can be used to sign in.
+	EmailVerified bool `json:"-"`
+	// DeletionScheduledAt is when the account will be purged, or nil if no
+	// deletion was requested
+	DeletionScheduledAt *time.Time `json:"-"`
+}
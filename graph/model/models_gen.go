@@ -2,15 +2,351 @@
 
 package model
 
-type Account struct {
-	ID        string `json:"id"`
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type AccountConnection struct {
+	Edges    []*AccountEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+	// Accounts matching the filter across all pages.
+	TotalCount int `json:"totalCount"`
+}
+
+type AccountEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Account `json:"node"`
+}
+
+type AccountFilter struct {
+	// Case-insensitive prefix of the email address
+	EmailPrefix *string `json:"emailPrefix,omitempty"`
+	// RFC 3339 timestamp, inclusive
+	CreatedAfter *string `json:"createdAfter,omitempty"`
+	// RFC 3339 timestamp, exclusive
+	CreatedBefore *string        `json:"createdBefore,omitempty"`
+	Source        *AccountSource `json:"source,omitempty"`
+}
+
+type AuditEvent struct {
+	ID        string           `json:"id"`
+	Time      string           `json:"time"`
+	Type      string           `json:"type"`
+	Actor     *string          `json:"actor,omitempty"`
+	Subject   *string          `json:"subject,omitempty"`
+	IP        *string          `json:"ip,omitempty"`
+	UserAgent *string          `json:"userAgent,omitempty"`
+	Outcome   string           `json:"outcome"`
+	Reason    *string          `json:"reason,omitempty"`
+	RequestID *string          `json:"requestId,omitempty"`
+	Metadata  []*AuditMetadata `json:"metadata"`
+}
+
+type AuditEventFilter struct {
+	Type    *string `json:"type,omitempty"`
+	Actor   *string `json:"actor,omitempty"`
+	Subject *string `json:"subject,omitempty"`
+	Outcome *string `json:"outcome,omitempty"`
+	// RFC 3339 timestamp
+	Since *string `json:"since,omitempty"`
+	// RFC 3339 timestamp
+	Until *string `json:"until,omitempty"`
+}
+
+type AuditMetadata struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// A machine-to-machine caller authenticated with the client-credentials grant.
+type ClientPrincipal struct {
+	ClientID string   `json:"clientId"`
+	Issuer   string   `json:"issuer"`
+	Scopes   []string `json:"scopes"`
+	// Permissions from the token plus those granted by the registration.
+	Permissions []string `json:"permissions"`
+	// The local registration, or null if the client is not registered.
+	Registration *ServiceClient `json:"registration,omitempty"`
+}
+
+type CreateOrganizationInput struct {
+	// 1 to 64 characters
+	Name string `json:"name"`
+	// Links the workspace to an Auth0 organization so tokens carrying its org_id are scoped to it.
+	Auth0OrgID *string `json:"auth0OrgId,omitempty"`
+}
+
+type DataExport struct {
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+type EmailChangeRequest struct {
 	Email     string `json:"email"`
-	UserID    string `json:"userId"`
-	CreatedAt string `json:"createdAt"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+type LinkedIdentity struct {
+	// Identity provider, e.g. auth0, google-oauth2 or passage.
+	Provider string `json:"provider"`
+	UserID   string `json:"userId"`
+}
+
+type MigrationEvent struct {
+	// RFC 3339 timestamp
+	Time string `json:"time"`
+	// Exchange outcome, e.g. migrated, already_migrated or invalid_passage_token.
+	Outcome       string  `json:"outcome"`
+	PassageUserID *string `json:"passageUserId,omitempty"`
+	Auth0UserID   *string `json:"auth0UserId,omitempty"`
+}
+
+type MigrationState struct {
+	PassageUserID string `json:"passageUserId"`
+	MigratedAt    string `json:"migratedAt"`
+	LastExchange  string `json:"lastExchange"`
 }
 
 type Mutation struct {
 }
 
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
+}
+
+type PasskeyRegistration struct {
+	// PublicKeyCredentialCreationOptionsJSON to pass to the authenticator
+	Options string `json:"options"`
+	// RFC 3339 timestamp after which the options can no longer be answered
+	ExpiresAt string `json:"expiresAt"`
+}
+
 type Query struct {
 }
+
+type RegisterServiceClientInput struct {
+	ClientID string `json:"clientId"`
+	// 1 to 64 characters
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// A service client registered with this API.
+type ServiceClient struct {
+	// The OAuth client ID (azp claim).
+	ClientID string `json:"clientId"`
+	Name     string `json:"name"`
+	// Permissions granted in addition to the scopes in the client's tokens.
+	Permissions []string `json:"permissions"`
+	CreatedAt   string   `json:"createdAt"`
+	UpdatedAt   string   `json:"updatedAt"`
+}
+
+type Subscription struct {
+}
+
+type TokenRevocation struct {
+	Kind TokenRevocationKind `json:"kind"`
+	// The revoked jti or subject.
+	Key          string  `json:"key"`
+	IssuedBefore *string `json:"issuedBefore,omitempty"`
+	// When every token the revocation covers has expired and it is forgotten.
+	ExpiresAt string  `json:"expiresAt"`
+	Reason    *string `json:"reason,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+}
+
+type UpdateAccountInput struct {
+	// 1 to 64 characters
+	DisplayName *string `json:"displayName,omitempty"`
+	// https URL, at most 2048 characters
+	AvatarURL *string `json:"avatarUrl,omitempty"`
+	// BCP 47 language tag, e.g. en-US
+	Locale *string `json:"locale,omitempty"`
+	// IANA time zone name, e.g. Europe/Berlin
+	Timezone            *string `json:"timezone,omitempty"`
+	MarketingEmailOptIn *bool   `json:"marketingEmailOptIn,omitempty"`
+	MarketingPushOptIn  *bool   `json:"marketingPushOptIn,omitempty"`
+}
+
+type UpdateServiceClientInput struct {
+	// 1 to 64 characters
+	Name *string `json:"name,omitempty"`
+	// Replaces the granted permissions.
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+type AccountSource string
+
+const (
+	AccountSourceAuth0   AccountSource = "AUTH0"
+	AccountSourcePassage AccountSource = "PASSAGE"
+)
+
+var AllAccountSource = []AccountSource{
+	AccountSourceAuth0,
+	AccountSourcePassage,
+}
+
+func (e AccountSource) IsValid() bool {
+	switch e {
+	case AccountSourceAuth0, AccountSourcePassage:
+		return true
+	}
+	return false
+}
+
+func (e AccountSource) String() string {
+	return string(e)
+}
+
+func (e *AccountSource) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AccountSource(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AccountSource", str)
+	}
+	return nil
+}
+
+func (e AccountSource) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *AccountSource) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e AccountSource) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type OrgRole string
+
+const (
+	OrgRoleOwner  OrgRole = "OWNER"
+	OrgRoleAdmin  OrgRole = "ADMIN"
+	OrgRoleMember OrgRole = "MEMBER"
+)
+
+var AllOrgRole = []OrgRole{
+	OrgRoleOwner,
+	OrgRoleAdmin,
+	OrgRoleMember,
+}
+
+func (e OrgRole) IsValid() bool {
+	switch e {
+	case OrgRoleOwner, OrgRoleAdmin, OrgRoleMember:
+		return true
+	}
+	return false
+}
+
+func (e OrgRole) String() string {
+	return string(e)
+}
+
+func (e *OrgRole) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrgRole(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrgRole", str)
+	}
+	return nil
+}
+
+func (e OrgRole) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *OrgRole) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e OrgRole) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type TokenRevocationKind string
+
+const (
+	// A single token, by jti.
+	TokenRevocationKindToken TokenRevocationKind = "TOKEN"
+	// Every token of a subject issued before issuedBefore.
+	TokenRevocationKindSubject TokenRevocationKind = "SUBJECT"
+)
+
+var AllTokenRevocationKind = []TokenRevocationKind{
+	TokenRevocationKindToken,
+	TokenRevocationKindSubject,
+}
+
+func (e TokenRevocationKind) IsValid() bool {
+	switch e {
+	case TokenRevocationKindToken, TokenRevocationKindSubject:
+		return true
+	}
+	return false
+}
+
+func (e TokenRevocationKind) String() string {
+	return string(e)
+}
+
+func (e *TokenRevocationKind) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TokenRevocationKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TokenRevocationKind", str)
+	}
+	return nil
+}
+
+func (e TokenRevocationKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *TokenRevocationKind) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e TokenRevocationKind) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
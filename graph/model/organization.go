@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Organization is a team workspace that accounts join through memberships
+type Organization struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Auth0 organization (org_id claim) this workspace is linked to, if any
+	Auth0OrgID *string `json:"auth0OrgId,omitempty"`
+	CreatedAt  string  `json:"createdAt"`
+}
+
+// Membership places a user in an organization with a role
+type Membership struct {
+	OrgID    string  `json:"-"`
+	UserID   string  `json:"userId"`
+	Role     OrgRole `json:"role"`
+	JoinedAt string  `json:"joinedAt"`
+}
+
+// Invitation offers membership of an organization to an email address. The
+// invitation token itself is only ever mailed, never stored or returned.
+type Invitation struct {
+	ID        string  `json:"id"`
+	OrgID     string  `json:"-"`
+	Email     string  `json:"email"`
+	Role      OrgRole `json:"role"`
+	InvitedBy string  `json:"invitedBy"`
+	CreatedAt string  `json:"createdAt"`
+	ExpiresAt string  `json:"expiresAt"`
+
+	// ExpiresAtTime is ExpiresAt for comparisons
+	ExpiresAtTime time.Time `json:"-"`
+}
@@ -0,0 +1,27 @@
+package model
+
+// Passkey is a WebAuthn credential registered to an account. Fields without
+// a json name are used to verify assertions and are not exposed through
+// GraphQL.
+type Passkey struct {
+	// Base64url credential ID
+	ID     string `json:"id"`
+	UserID string `json:"-"`
+	Name   string `json:"name"`
+	// Authenticator model (AAGUID), all zeros when the authenticator withholds it
+	Aaguid string `json:"aaguid"`
+	// Attestation statement format: none, packed or apple
+	AttestationFormat string   `json:"attestationFormat"`
+	Transports        []string `json:"transports"`
+	// Whether the passkey is synced, e.g. through iCloud Keychain
+	BackedUp   bool    `json:"backedUp"`
+	CreatedAt  string  `json:"createdAt"`
+	LastUsedAt *string `json:"lastUsedAt,omitempty"`
+
+	// PublicKey is the credential public key as a COSE_Key
+	PublicKey []byte `json:"-"`
+	// SignCount is the last signature counter reported by the authenticator
+	SignCount uint32 `json:"-"`
+	// BackupEligible is whether the credential may be synced
+	BackupEligible bool `json:"-"`
+}
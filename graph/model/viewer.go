@@ -0,0 +1,12 @@
+package model
+
+// Viewer is the authenticated identity. Identities, migration state and the
+// account are resolved on demand from UserID.
+type Viewer struct {
+	UserID      string   `json:"userId"`
+	Email       *string  `json:"email,omitempty"`
+	Issuer      string   `json:"issuer"`
+	Scopes      []string `json:"scopes"`
+	Permissions []string `json:"permissions"`
+	OrgID       *string  `json:"orgId,omitempty"`
+}
@@ -1,12 +1,34 @@
 package graph
 
-import "github.com/example/auth0-gqlgen-demo/store"
+import (
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/emailchange"
+	"github.com/example/auth0-gqlgen-demo/events"
+	"github.com/example/auth0-gqlgen-demo/migration"
+	"github.com/example/auth0-gqlgen-demo/orgs"
+	"github.com/example/auth0-gqlgen-demo/privacy"
+	"github.com/example/auth0-gqlgen-demo/revocation"
+	"github.com/example/auth0-gqlgen-demo/store"
+	"github.com/example/auth0-gqlgen-demo/webauthn"
+)
 
 // This file will not be regenerated automatically.
 //
 // It serves as dependency injection for your app, add any dependencies you require here.
 
-type Resolver struct{
-	Store *store.MemoryStore
+type Resolver struct {
+	Store       store.Store
+	Audit       *audit.Logger
+	Migrations  MigrationLookup      // optional, nil when migration is disabled
+	EmailChange *emailchange.Service // optional, nil disables email changes
+	Privacy     *privacy.Service     // optional, nil disables account deletion and data export
+	Orgs        *orgs.Service        // optional, nil disables organizations
+	Events      *events.Bus          // optional, nil disables subscriptions
+	Revocations *revocation.List     // optional, nil disables token revocation
+	Passkeys    *webauthn.Service    // optional, nil disables passkey registration
 }
 
+// MigrationLookup finds Passage migration records by Auth0 user ID
+type MigrationLookup interface {
+	GetMigrationStatusByAuth0UserID(auth0UserID string) (*migration.MigrationRecord, bool)
+}
@@ -0,0 +1,40 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/auth"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/revocation"
+)
+
+// recordRevocation audits a revocation made by an administrator
+func (r *Resolver) recordRevocation(ctx context.Context, actor *auth.UserInfo, entry *revocation.Entry) {
+	r.Audit.Record(ctx, audit.Event{
+		Type:     audit.TypeTokenRevoked,
+		Actor:    actor.UserID,
+		Subject:  entry.Key,
+		Outcome:  audit.OutcomeSuccess,
+		Reason:   entry.Reason,
+		Metadata: map[string]string{"kind": entry.Kind},
+	})
+}
+
+// toModelTokenRevocation converts a denylist entry into its GraphQL representation
+func toModelTokenRevocation(entry *revocation.Entry) *model.TokenRevocation {
+	revoked := &model.TokenRevocation{
+		Kind:      model.TokenRevocationKindToken,
+		Key:       entry.Key,
+		ExpiresAt: entry.ExpiresAt.Format(time.RFC3339),
+		Reason:    optional(entry.Reason),
+		CreatedAt: entry.CreatedAt.Format(time.RFC3339),
+	}
+	if entry.Kind == revocation.KindSubject {
+		issuedBefore := entry.IssuedBefore.Format(time.RFC3339)
+		revoked.Kind = model.TokenRevocationKindSubject
+		revoked.IssuedBefore = &issuedBefore
+	}
+	return revoked
+}
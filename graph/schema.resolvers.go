@@ -6,57 +6,832 @@ package graph
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/example/auth0-gqlgen-demo/audit"
 	"github.com/example/auth0-gqlgen-demo/auth"
 	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/store"
+	"github.com/example/auth0-gqlgen-demo/webauthn"
 )
 
+// DeletionScheduledAt is the resolver for the deletionScheduledAt field.
+func (r *accountResolver) DeletionScheduledAt(ctx context.Context, obj *model.Account) (*string, error) {
+	if obj.DeletionScheduledAt == nil {
+		return nil, nil
+	}
+	scheduledAt := obj.DeletionScheduledAt.Format(time.RFC3339)
+	return &scheduledAt, nil
+}
+
+// Organization is the resolver for the organization field.
+func (r *invitationResolver) Organization(ctx context.Context, obj *model.Invitation) (*model.Organization, error) {
+	return r.Store.GetOrganization(ctx, obj.OrgID)
+}
+
+// Organization is the resolver for the organization field.
+func (r *membershipResolver) Organization(ctx context.Context, obj *model.Membership) (*model.Organization, error) {
+	return r.Store.GetOrganization(ctx, obj.OrgID)
+}
+
 // CreateAccountIfNotExists is the resolver for the createAccountIfNotExists field.
 func (r *mutationResolver) CreateAccountIfNotExists(ctx context.Context) (*model.Account, error) {
 	// Get authenticated user from context
 	user, err := auth.GetUserFromContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("authentication required: %w", err)
+		return nil, err
+	}
+
+	// Create or retrieve account; service clients were rejected above, so
+	// the token's email (which may be empty) belongs to a person
+	account, created, err := r.Store.CreateAccountIfNotExists(ctx, user.UserID, user.Email, user.EmailVerified, r.accountSource(user.UserID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account: %w", err)
+	}
+
+	if created {
+		r.Audit.Record(ctx, audit.Event{
+			Type:    audit.TypeAccountCreated,
+			Actor:   user.UserID,
+			Subject: account.ID,
+			Outcome: audit.OutcomeSuccess,
+		})
+		return account, nil
+	}
+
+	return r.syncEmail(ctx, user, account), nil
+}
+
+// UpdateAccount is the resolver for the updateAccount field.
+func (r *mutationResolver) UpdateAccount(ctx context.Context, input model.UpdateAccountInput) (*model.Account, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// Use email from token, or use userID if email is empty (for M2M tokens)
-	email := user.Email
-	if email == "" {
-		email = user.UserID + "@client.local"
+	update, err := validateAccountUpdate(input)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create or retrieve account
-	account, err := r.Store.CreateAccountIfNotExists(user.UserID, email)
+	account, err := r.Store.UpdateAccount(ctx, user.UserID, update)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create account: %w", err)
+		return nil, err
 	}
+	r.publishAccountUpdated(ctx, user.UserID)
 
 	return account, nil
 }
 
+// RequestEmailChange is the resolver for the requestEmailChange field.
+func (r *mutationResolver) RequestEmailChange(ctx context.Context, newEmail string) (*model.EmailChangeRequest, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.EmailChange == nil {
+		return nil, errors.New("email change is not configured")
+	}
+
+	email, err := validateEmail("newEmail", newEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := r.Store.GetAccountByUserID(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if account.DeletionScheduledAt != nil {
+		return nil, store.ErrPendingDeletion
+	}
+	if strings.EqualFold(account.Email, email) {
+		return nil, fmt.Errorf("%w: newEmail is already the account email", ErrInvalidInput)
+	}
+
+	pending, err := r.EmailChange.Request(ctx, user.UserID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.EmailChangeRequest{
+		Email:     pending.Email,
+		ExpiresAt: pending.ExpiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// ConfirmEmailChange is the resolver for the confirmEmailChange field.
+func (r *mutationResolver) ConfirmEmailChange(ctx context.Context, code string) (*model.Account, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.EmailChange == nil {
+		return nil, errors.New("email change is not configured")
+	}
+
+	email, err := r.EmailChange.Confirm(ctx, user.UserID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := r.Store.UpdateEmail(ctx, user.UserID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Audit.Record(ctx, audit.Event{
+		Type:    audit.TypeAccountEmailChanged,
+		Actor:   user.UserID,
+		Subject: account.ID,
+		Outcome: audit.OutcomeSuccess,
+		Reason:  "confirmed",
+	})
+	r.publishAccountUpdated(ctx, user.UserID)
+
+	return account, nil
+}
+
+// DeleteMyAccount is the resolver for the deleteMyAccount field.
+func (r *mutationResolver) DeleteMyAccount(ctx context.Context) (*model.Account, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Privacy == nil {
+		return nil, errors.New("account deletion is not configured")
+	}
+
+	account, err := r.Privacy.ScheduleDeletion(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	r.publishAccountUpdated(ctx, user.UserID)
+
+	return account, nil
+}
+
+// CancelAccountDeletion is the resolver for the cancelAccountDeletion field.
+func (r *mutationResolver) CancelAccountDeletion(ctx context.Context) (*model.Account, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Privacy == nil {
+		return nil, errors.New("account deletion is not configured")
+	}
+
+	account, err := r.Privacy.CancelDeletion(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	r.publishAccountUpdated(ctx, user.UserID)
+
+	return account, nil
+}
+
+// ExportMyData is the resolver for the exportMyData field.
+func (r *mutationResolver) ExportMyData(ctx context.Context) (*model.DataExport, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Privacy == nil {
+		return nil, errors.New("data export is not configured")
+	}
+
+	url, expiresAt := r.Privacy.ExportURL(ctx, user.UserID)
+
+	return &model.DataExport{
+		URL:       url,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// CreateOrganization is the resolver for the createOrganization field.
+func (r *mutationResolver) CreateOrganization(ctx context.Context, input model.CreateOrganizationInput) (*model.Organization, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Orgs == nil {
+		return nil, errors.New("organizations are not configured")
+	}
+
+	name, auth0OrgID, err := validateCreateOrganization(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Orgs.Create(ctx, user, name, auth0OrgID)
+}
+
+// InviteToOrganization is the resolver for the inviteToOrganization field.
+func (r *mutationResolver) InviteToOrganization(ctx context.Context, orgID string, email string, role model.OrgRole) (*model.Invitation, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Orgs == nil {
+		return nil, errors.New("organizations are not configured")
+	}
+
+	email, err = validateEmail("email", email)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Orgs.Invite(ctx, user, orgID, email, role)
+}
+
+// AcceptInvitation is the resolver for the acceptInvitation field.
+func (r *mutationResolver) AcceptInvitation(ctx context.Context, token string) (*model.Membership, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Orgs == nil {
+		return nil, errors.New("organizations are not configured")
+	}
+
+	return r.Orgs.Accept(ctx, user, token)
+}
+
+// ChangeMemberRole is the resolver for the changeMemberRole field.
+func (r *mutationResolver) ChangeMemberRole(ctx context.Context, orgID string, userID string, role model.OrgRole) (*model.Membership, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Orgs == nil {
+		return nil, errors.New("organizations are not configured")
+	}
+
+	return r.Orgs.ChangeRole(ctx, user, orgID, userID, role)
+}
+
+// RegisterServiceClient is the resolver for the registerServiceClient field.
+func (r *mutationResolver) RegisterServiceClient(ctx context.Context, input model.RegisterServiceClientInput) (*model.ServiceClient, error) {
+	admin, err := requirePermission(ctx, auth.PermissionManageClients)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.ClientID == "" {
+		return nil, fmt.Errorf("%w: clientId must not be empty", ErrInvalidInput)
+	}
+	name, permissions, err := validateServiceClient(&input.Name, input.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := r.Store.RegisterServiceClient(ctx, input.ClientID, *name, permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	r.recordClientChange(ctx, admin, client.ClientID, "service_client_registered")
+
+	return client, nil
+}
+
+// UpdateServiceClient is the resolver for the updateServiceClient field.
+func (r *mutationResolver) UpdateServiceClient(ctx context.Context, clientID string, input model.UpdateServiceClientInput) (*model.ServiceClient, error) {
+	admin, err := requirePermission(ctx, auth.PermissionManageClients)
+	if err != nil {
+		return nil, err
+	}
+
+	name, permissions, err := validateServiceClient(input.Name, input.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := r.Store.UpdateServiceClient(ctx, clientID, store.ServiceClientUpdate{
+		Name:        name,
+		Permissions: permissions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.recordClientChange(ctx, admin, client.ClientID, "service_client_updated")
+
+	return client, nil
+}
+
+// RemoveServiceClient is the resolver for the removeServiceClient field.
+func (r *mutationResolver) RemoveServiceClient(ctx context.Context, clientID string) (bool, error) {
+	admin, err := requirePermission(ctx, auth.PermissionManageClients)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.Store.DeleteServiceClient(ctx, clientID); err != nil {
+		return false, err
+	}
+
+	r.recordClientChange(ctx, admin, clientID, "service_client_removed")
+
+	return true, nil
+}
+
+// RevokeToken is the resolver for the revokeToken field.
+func (r *mutationResolver) RevokeToken(ctx context.Context, jti string, expiresAt *string, reason *string) (*model.TokenRevocation, error) {
+	admin, err := requirePermission(ctx, auth.PermissionRevokeTokens)
+	if err != nil {
+		return nil, err
+	}
+	if r.Revocations == nil {
+		return nil, errors.New("token revocation is not configured")
+	}
+
+	var expires time.Time
+	if expiresAt != nil {
+		expires, err = time.Parse(time.RFC3339, *expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: expiresAt must be an RFC 3339 timestamp", ErrInvalidInput)
+		}
+	}
+
+	entry, err := r.Revocations.RevokeToken(ctx, jti, expires, deref(reason))
+	if err != nil {
+		return nil, err
+	}
+
+	r.recordRevocation(ctx, admin, entry)
+
+	return toModelTokenRevocation(entry), nil
+}
+
+// RevokeSubjectTokens is the resolver for the revokeSubjectTokens field.
+func (r *mutationResolver) RevokeSubjectTokens(ctx context.Context, subject string, reason *string) (*model.TokenRevocation, error) {
+	admin, err := requirePermission(ctx, auth.PermissionRevokeTokens)
+	if err != nil {
+		return nil, err
+	}
+	if r.Revocations == nil {
+		return nil, errors.New("token revocation is not configured")
+	}
+
+	entry, err := r.Revocations.RevokeSubject(ctx, subject, time.Now(), deref(reason))
+	if err != nil {
+		return nil, err
+	}
+
+	r.recordRevocation(ctx, admin, entry)
+
+	return toModelTokenRevocation(entry), nil
+}
+
+// BeginPasskeyRegistration is the resolver for the beginPasskeyRegistration field.
+func (r *mutationResolver) BeginPasskeyRegistration(ctx context.Context) (*model.PasskeyRegistration, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Passkeys == nil {
+		return nil, errors.New("passkeys are not configured")
+	}
+
+	// Passkeys are stored against the account, which must exist
+	account, err := r.Store.GetAccountByUserID(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if account.DeletionScheduledAt != nil {
+		return nil, store.ErrPendingDeletion
+	}
+
+	displayName := account.Email
+	if account.DisplayName != nil {
+		displayName = *account.DisplayName
+	}
+	options, err := r.Passkeys.BeginRegistration(ctx, user.UserID, account.Email, displayName)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.PasskeyRegistration{
+		Options:   string(encoded),
+		ExpiresAt: time.Now().Add(time.Duration(options.Timeout) * time.Millisecond).Format(time.RFC3339),
+	}, nil
+}
+
+// FinishPasskeyRegistration is the resolver for the finishPasskeyRegistration field.
+func (r *mutationResolver) FinishPasskeyRegistration(ctx context.Context, response string, name *string) (*model.Passkey, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Passkeys == nil {
+		return nil, errors.New("passkeys are not configured")
+	}
+
+	passkeyName, err := validatePasskeyName(name)
+	if err != nil {
+		return nil, err
+	}
+	registration, err := webauthn.DecodeRegistrationResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Passkeys.FinishRegistration(ctx, user.UserID, passkeyName, registration)
+}
+
+// DeletePasskey is the resolver for the deletePasskey field.
+func (r *mutationResolver) DeletePasskey(ctx context.Context, id string) (bool, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if r.Passkeys == nil {
+		return false, errors.New("passkeys are not configured")
+	}
+
+	if err := r.Passkeys.DeletePasskey(ctx, user.UserID, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ViewerRole is the resolver for the viewerRole field.
+func (r *organizationResolver) ViewerRole(ctx context.Context, obj *model.Organization) (model.OrgRole, error) {
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	membership, err := r.Orgs.Authorize(ctx, user, obj.ID, model.OrgRoleMember)
+	if err != nil {
+		return "", err
+	}
+
+	return membership.Role, nil
+}
+
+// Members is the resolver for the members field.
+func (r *organizationResolver) Members(ctx context.Context, obj *model.Organization) ([]*model.Membership, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Orgs.Members(ctx, user, obj.ID)
+}
+
+// Invitations is the resolver for the invitations field.
+func (r *organizationResolver) Invitations(ctx context.Context, obj *model.Organization) ([]*model.Invitation, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Orgs.Invitations(ctx, user, obj.ID)
+}
+
 // GetAccount is the resolver for the getAccount field.
 func (r *queryResolver) GetAccount(ctx context.Context) (*model.Account, error) {
 	// Get authenticated user from context
 	user, err := auth.GetUserFromContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("authentication required: %w", err)
+		return nil, err
+	}
+
+	// Retrieve account; a missing account is returned as null
+	account, err := r.Store.GetAccountByUserID(ctx, user.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.syncEmail(ctx, user, account), nil
+}
+
+// Accounts is the resolver for the accounts field.
+func (r *queryResolver) Accounts(ctx context.Context, first *int, after *string, last *int, before *string, filter *model.AccountFilter) (*model.AccountConnection, error) {
+	// Users and service clients alike may list accounts
+	if _, err := requirePermission(ctx, auth.PermissionReadAccounts); err != nil {
+		return nil, err
+	}
+
+	accountFilter, err := toAccountFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := r.Store.ListAccounts(ctx, accountFilter, store.PageRequest{
+		First:  first,
+		After:  after,
+		Last:   last,
+		Before: before,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toAccountConnection(page), nil
+}
+
+// Viewer is the resolver for the viewer field.
+func (r *queryResolver) Viewer(ctx context.Context) (*model.Viewer, error) {
+	// Anonymous requests have no viewer
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, nil
+	}
+
+	return &model.Viewer{
+		UserID:      user.UserID,
+		Email:       optional(user.Email),
+		Issuer:      user.Issuer,
+		Scopes:      nonNil(user.Scopes),
+		Permissions: nonNil(user.Permissions),
+		OrgID:       optional(user.OrgID),
+	}, nil
+}
+
+// CurrentClient is the resolver for the currentClient field.
+func (r *queryResolver) CurrentClient(ctx context.Context) (*model.ClientPrincipal, error) {
+	// Only client-credentials tokens have a current client
+	principal, err := auth.GetPrincipalFromContext(ctx)
+	if err != nil || principal.Kind != auth.PrincipalService {
+		return nil, nil
+	}
+
+	registration, err := r.Store.GetServiceClient(ctx, principal.ClientID)
+	if errors.Is(err, store.ErrClientNotFound) {
+		registration = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &model.ClientPrincipal{
+		ClientID:     principal.ClientID,
+		Issuer:       principal.Issuer,
+		Scopes:       nonNil(principal.Scopes),
+		Permissions:  nonNil(principal.Permissions),
+		Registration: registration,
+	}, nil
+}
+
+// ServiceClients is the resolver for the serviceClients field.
+func (r *queryResolver) ServiceClients(ctx context.Context) ([]*model.ServiceClient, error) {
+	if _, err := requirePermission(ctx, auth.PermissionManageClients); err != nil {
+		return nil, err
+	}
+
+	return r.Store.ListServiceClients(ctx), nil
+}
+
+// ServiceClient is the resolver for the serviceClient field.
+func (r *queryResolver) ServiceClient(ctx context.Context, clientID string) (*model.ServiceClient, error) {
+	if _, err := requirePermission(ctx, auth.PermissionManageClients); err != nil {
+		return nil, err
+	}
+
+	client, err := r.Store.GetServiceClient(ctx, clientID)
+	if errors.Is(err, store.ErrClientNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Organizations is the resolver for the organizations field.
+func (r *queryResolver) Organizations(ctx context.Context) ([]*model.Organization, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// Retrieve account
-	account, err := r.Store.GetAccountByUserID(user.UserID)
+	if r.Orgs == nil {
+		return []*model.Organization{}, nil
+	}
+
+	return r.Orgs.Organizations(ctx, user)
+}
+
+// Organization is the resolver for the organization field.
+func (r *queryResolver) Organization(ctx context.Context, id string) (*model.Organization, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Orgs == nil {
+		return nil, nil
+	}
+
+	// Organizations the caller can't see are reported as missing
+	_, err = r.Orgs.Authorize(ctx, user, id, model.OrgRoleMember)
+	if errors.Is(err, store.ErrOrgNotFound) || errors.Is(err, auth.ErrForbidden) {
+		return nil, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("account not found: %w", err)
+		return nil, err
+	}
+
+	return r.Store.GetOrganization(ctx, id)
+}
+
+// AuditEvents is the resolver for the auditEvents field.
+func (r *queryResolver) AuditEvents(ctx context.Context, filter *model.AuditEventFilter, limit *int) ([]*model.AuditEvent, error) {
+	// Users and service clients alike may read the audit log
+	user, err := requirePermission(ctx, auth.PermissionReadAudit)
+	if err != nil {
+		return nil, err
+	}
+
+	auditFilter, err := toAuditFilter(filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Audit.Record(ctx, audit.Event{
+		Type:    audit.TypeAdminAction,
+		Actor:   user.UserID,
+		Outcome: audit.OutcomeSuccess,
+		Reason:  "audit_query",
+	})
+
+	events, err := r.Audit.Query(ctx, auditFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+
+	result := make([]*model.AuditEvent, len(events))
+	for i, event := range events {
+		result[i] = toModelAuditEvent(event)
+	}
+
+	return result, nil
+}
+
+// AccountUpdated is the resolver for the accountUpdated field.
+func (r *subscriptionResolver) AccountUpdated(ctx context.Context) (<-chan *model.Account, error) {
+	// Get authenticated user from context
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Events == nil {
+		return nil, errors.New("subscriptions are not configured")
+	}
+
+	return r.streamAccount(ctx, user.UserID), nil
+}
+
+// MigrationEvents is the resolver for the migrationEvents field.
+func (r *subscriptionResolver) MigrationEvents(ctx context.Context) (<-chan *model.MigrationEvent, error) {
+	// Users and service clients alike may watch migrations
+	if _, err := requirePermission(ctx, auth.PermissionReadMigrations); err != nil {
+		return nil, err
+	}
+
+	if r.Events == nil {
+		return nil, errors.New("subscriptions are not configured")
+	}
+
+	return r.streamMigrationEvents(ctx), nil
+}
+
+// Identities is the resolver for the identities field.
+func (r *viewerResolver) Identities(ctx context.Context, obj *model.Viewer) ([]*model.LinkedIdentity, error) {
+	// The token subject is "<provider>|<id>", e.g. "auth0|123" or "google-oauth2|456"
+	identities := []*model.LinkedIdentity{subjectIdentity(obj.UserID)}
+
+	if r.Migrations != nil {
+		if record, ok := r.Migrations.GetMigrationStatusByAuth0UserID(obj.UserID); ok {
+			identities = append(identities, &model.LinkedIdentity{
+				Provider: "passage",
+				UserID:   record.PassageUserID,
+			})
+		}
+	}
+
+	return identities, nil
+}
+
+// Migration is the resolver for the migration field.
+func (r *viewerResolver) Migration(ctx context.Context, obj *model.Viewer) (*model.MigrationState, error) {
+	if r.Migrations == nil {
+		return nil, nil
+	}
+
+	record, ok := r.Migrations.GetMigrationStatusByAuth0UserID(obj.UserID)
+	if !ok {
+		return nil, nil
+	}
+
+	return &model.MigrationState{
+		PassageUserID: record.PassageUserID,
+		MigratedAt:    record.MigratedAt.Format(time.RFC3339),
+		LastExchange:  record.LastExchange.Format(time.RFC3339),
+	}, nil
+}
+
+// Account is the resolver for the account field.
+func (r *viewerResolver) Account(ctx context.Context, obj *model.Viewer) (*model.Account, error) {
+	// A missing account is the normal state before the first
+	// createAccountIfNotExists call, not an error
+	account, err := r.Store.GetAccountByUserID(ctx, obj.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user, err := auth.GetUserFromContext(ctx); err == nil {
+		account = r.syncEmail(ctx, user, account)
 	}
 
 	return account, nil
 }
 
+// Passkeys is the resolver for the passkeys field.
+func (r *viewerResolver) Passkeys(ctx context.Context, obj *model.Viewer) ([]*model.Passkey, error) {
+	// r.Passkeys is this method; the service is on the embedded Resolver
+	if r.Resolver.Passkeys == nil {
+		return []*model.Passkey{}, nil
+	}
+	return r.Resolver.Passkeys.ListPasskeys(ctx, obj.UserID), nil
+}
+
+// Account returns AccountResolver implementation.
+func (r *Resolver) Account() AccountResolver { return &accountResolver{r} }
+
+// Invitation returns InvitationResolver implementation.
+func (r *Resolver) Invitation() InvitationResolver { return &invitationResolver{r} }
+
+// Membership returns MembershipResolver implementation.
+func (r *Resolver) Membership() MembershipResolver { return &membershipResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
+// Organization returns OrganizationResolver implementation.
+func (r *Resolver) Organization() OrganizationResolver { return &organizationResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
+// Subscription returns SubscriptionResolver implementation.
+func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
+
+// Viewer returns ViewerResolver implementation.
+func (r *Resolver) Viewer() ViewerResolver { return &viewerResolver{r} }
+
+type accountResolver struct{ *Resolver }
+type invitationResolver struct{ *Resolver }
+type membershipResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type organizationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
+type viewerResolver struct{ *Resolver }
@@ -0,0 +1,87 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/events"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+// publishAccountUpdated notifies accountUpdated subscribers that the account
+// of userID changed. Failures are logged; the change itself has succeeded.
+func (r *Resolver) publishAccountUpdated(ctx context.Context, userID string) {
+	if err := r.Events.Publish(ctx, events.AccountTopic(userID), events.AccountUpdated{UserID: userID}); err != nil {
+		slog.WarnContext(ctx, "failed to publish account update", "error", err)
+	}
+}
+
+// streamAccount sends the account of userID each time it changes, until ctx
+// is done or the account is purged
+func (r *Resolver) streamAccount(ctx context.Context, userID string) <-chan *model.Account {
+	messages := r.Events.Subscribe(ctx, events.AccountTopic(userID))
+	out := make(chan *model.Account, 1)
+
+	go func() {
+		defer close(out)
+		for range messages {
+			// Reload rather than trusting the payload so every instance
+			// sends the stored state
+			account, err := r.Store.GetAccountByUserID(ctx, userID)
+			if errors.Is(err, store.ErrNotFound) {
+				return
+			}
+			if err != nil {
+				slog.WarnContext(ctx, "failed to load updated account", "error", err)
+				continue
+			}
+
+			select {
+			case out <- account:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// streamMigrationEvents sends Passage token exchanges until ctx is done
+func (r *Resolver) streamMigrationEvents(ctx context.Context) <-chan *model.MigrationEvent {
+	messages := r.Events.Subscribe(ctx, events.TopicMigration)
+	out := make(chan *model.MigrationEvent, 1)
+
+	go func() {
+		defer close(out)
+		for payload := range messages {
+			var event events.MigrationEvent
+			if err := json.Unmarshal(payload, &event); err != nil {
+				slog.WarnContext(ctx, "ignored malformed migration event", "error", err)
+				continue
+			}
+
+			select {
+			case out <- toModelMigrationEvent(event):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// toModelMigrationEvent converts a migration event into its GraphQL representation
+func toModelMigrationEvent(event events.MigrationEvent) *model.MigrationEvent {
+	return &model.MigrationEvent{
+		Time:          event.Time.Format(time.RFC3339),
+		Outcome:       event.Outcome,
+		PassageUserID: optional(event.PassageUserID),
+		Auth0UserID:   optional(event.Auth0UserID),
+	}
+}
@@ -0,0 +1,262 @@
+package graph
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	_ "time/tzdata" // embed the IANA database so timezone validation works everywhere
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/store"
+	"golang.org/x/text/language"
+)
+
+// Profile field limits
+const (
+	maxDisplayNameLength = 64
+	maxAvatarURLLength   = 2048
+)
+
+// Service client field limits
+const (
+	maxClientNameLength = 64
+	maxPermissionLength = 128
+	maxPermissions      = 100
+)
+
+// Organization field limits
+const (
+	maxOrgNameLength    = 64
+	maxAuth0OrgIDLength = 64
+)
+
+// maxPasskeyNameLength limits passkey names
+const maxPasskeyNameLength = 64
+
+// FieldError describes why a single input field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every rejected field of an input object
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Field + ": " + f.Message
+	}
+	return "invalid input: " + strings.Join(messages, "; ")
+}
+
+// Unwrap lets errors.Is match ErrInvalidInput
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidInput
+}
+
+// add records a rejected field
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// orNil returns e if any field was rejected
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// validateAccountUpdate checks an updateAccount input and returns the
+// normalized update to store
+func validateAccountUpdate(input model.UpdateAccountInput) (store.AccountUpdate, error) {
+	verr := &ValidationError{}
+	update := store.AccountUpdate{
+		MarketingEmailOptIn: input.MarketingEmailOptIn,
+		MarketingPushOptIn:  input.MarketingPushOptIn,
+	}
+
+	if input.DisplayName != nil {
+		name := strings.TrimSpace(*input.DisplayName)
+		switch {
+		case utf8.RuneCountInString(name) > maxDisplayNameLength:
+			verr.add("displayName", "must be at most %d characters", maxDisplayNameLength)
+		case strings.IndexFunc(name, unicode.IsControl) >= 0:
+			verr.add("displayName", "must not contain control characters")
+		default:
+			update.DisplayName = &name
+		}
+	}
+
+	if input.AvatarURL != nil {
+		avatarURL := strings.TrimSpace(*input.AvatarURL)
+		if avatarURL == "" {
+			update.AvatarURL = &avatarURL
+		} else if msg := checkAvatarURL(avatarURL); msg != "" {
+			verr.add("avatarUrl", "%s", msg)
+		} else {
+			update.AvatarURL = &avatarURL
+		}
+	}
+
+	if input.Locale != nil {
+		if *input.Locale == "" {
+			update.Locale = input.Locale
+		} else if tag, err := language.Parse(*input.Locale); err != nil {
+			verr.add("locale", "must be a valid BCP 47 language tag")
+		} else {
+			locale := tag.String()
+			update.Locale = &locale
+		}
+	}
+
+	if input.Timezone != nil {
+		if *input.Timezone == "" {
+			update.Timezone = input.Timezone
+		} else if msg := checkTimezone(*input.Timezone); msg != "" {
+			verr.add("timezone", "%s", msg)
+		} else {
+			update.Timezone = input.Timezone
+		}
+	}
+
+	return update, verr.orNil()
+}
+
+// validateServiceClient checks a service client name and permission list and
+// returns them normalized. Either may be nil when not being set.
+func validateServiceClient(name *string, permissions []string) (*string, []string, error) {
+	verr := &ValidationError{}
+
+	if name != nil {
+		trimmed := strings.TrimSpace(*name)
+		switch {
+		case trimmed == "":
+			verr.add("name", "must not be empty")
+		case utf8.RuneCountInString(trimmed) > maxClientNameLength:
+			verr.add("name", "must be at most %d characters", maxClientNameLength)
+		case strings.IndexFunc(trimmed, unicode.IsControl) >= 0:
+			verr.add("name", "must not contain control characters")
+		default:
+			name = &trimmed
+		}
+	}
+
+	if permissions != nil {
+		if len(permissions) > maxPermissions {
+			verr.add("permissions", "must contain at most %d entries", maxPermissions)
+		}
+		seen := make(map[string]bool, len(permissions))
+		unique := make([]string, 0, len(permissions))
+		for _, p := range permissions {
+			if p == "" || len(p) > maxPermissionLength || strings.IndexFunc(p, unicode.IsSpace) >= 0 {
+				verr.add("permissions", "%q must be 1 to %d characters without whitespace", p, maxPermissionLength)
+				continue
+			}
+			if !seen[p] {
+				seen[p] = true
+				unique = append(unique, p)
+			}
+		}
+		permissions = unique
+	}
+
+	return name, permissions, verr.orNil()
+}
+
+// validateCreateOrganization checks a createOrganization input and returns
+// the normalized name and Auth0 organization ID
+func validateCreateOrganization(input model.CreateOrganizationInput) (string, *string, error) {
+	verr := &ValidationError{}
+
+	name := strings.TrimSpace(input.Name)
+	switch {
+	case name == "":
+		verr.add("name", "must not be empty")
+	case utf8.RuneCountInString(name) > maxOrgNameLength:
+		verr.add("name", "must be at most %d characters", maxOrgNameLength)
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		verr.add("name", "must not contain control characters")
+	}
+
+	auth0OrgID := input.Auth0OrgID
+	if auth0OrgID != nil {
+		// Auth0 organization IDs look like org_XXXXXXXXXXXXXXXX
+		id := strings.TrimSpace(*auth0OrgID)
+		if !strings.HasPrefix(id, "org_") || len(id) > maxAuth0OrgIDLength || strings.IndexFunc(id, unicode.IsSpace) >= 0 {
+			verr.add("auth0OrgId", "must be an Auth0 organization ID (org_...)")
+		}
+		auth0OrgID = &id
+	}
+
+	return name, auth0OrgID, verr.orNil()
+}
+
+// validatePasskeyName checks an optional passkey name and returns it
+// trimmed, or "" when not given
+func validatePasskeyName(name *string) (string, error) {
+	if name == nil {
+		return "", nil
+	}
+	verr := &ValidationError{}
+	trimmed := strings.TrimSpace(*name)
+	switch {
+	case utf8.RuneCountInString(trimmed) > maxPasskeyNameLength:
+		verr.add("name", "must be at most %d characters", maxPasskeyNameLength)
+	case strings.IndexFunc(trimmed, unicode.IsControl) >= 0:
+		verr.add("name", "must not contain control characters")
+	}
+	return trimmed, verr.orNil()
+}
+
+// checkAvatarURL returns why rawURL is not an acceptable avatar URL, or ""
+func checkAvatarURL(rawURL string) string {
+	if len(rawURL) > maxAvatarURLLength {
+		return fmt.Sprintf("must be at most %d characters", maxAvatarURLLength)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "must be an absolute URL"
+	}
+	if u.Scheme != "https" {
+		return "must use the https scheme"
+	}
+	if u.User != nil {
+		return "must not contain credentials"
+	}
+	return ""
+}
+
+// checkTimezone returns why name is not an IANA time zone, or ""
+func checkTimezone(name string) string {
+	// LoadLocation also accepts "Local" and "UTC"; only the former depends on the server
+	if name == "Local" {
+		return "must be an IANA time zone name"
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return "must be an IANA time zone name"
+	}
+	return ""
+}
+
+// validateEmail checks that value is a bare email address and returns it
+// with the domain lowercased
+func validateEmail(field, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value || len(value) > 254 {
+		verr := &ValidationError{}
+		verr.add(field, "must be a valid email address")
+		return "", verr
+	}
+
+	local, domain, _ := strings.Cut(value, "@")
+	return local + "@" + strings.ToLower(domain), nil
+}
@@ -0,0 +1,24 @@
+package graph
+
+import (
+	"strings"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// subjectIdentity splits an Auth0 subject ("<provider>|<id>") into a linked identity
+func subjectIdentity(subject string) *model.LinkedIdentity {
+	provider, userID, found := strings.Cut(subject, "|")
+	if !found {
+		return &model.LinkedIdentity{Provider: "auth0", UserID: subject}
+	}
+	return &model.LinkedIdentity{Provider: provider, UserID: userID}
+}
+
+// nonNil returns values, or an empty slice for nil so list fields are never null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
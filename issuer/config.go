@@ -0,0 +1,86 @@
+package issuer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+)
+
+// Backend names accepted in Config.Backend
+const (
+	BackendMemory = "memory"
+	BackendSQL    = "sql"
+)
+
+// Open creates the issuer selected by config: its signing keys, loaded from
+// KeyFile or generated, and its refresh token store
+func Open(ctx context.Context, config Config, accounts AccountStore, auditLog *audit.Logger) (*Issuer, error) {
+	var keys *KeySet
+	var err error
+	if config.KeyFile != "" {
+		keys, err = LoadKeySet(config.KeyFile)
+	} else {
+		algorithm := config.Algorithm
+		if algorithm == "" {
+			algorithm = AlgorithmRS256
+		}
+		keys, err = NewKeySet(algorithm, config.withDefaults().KeyOverlap)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var store Store
+	switch config.Backend {
+	case "", BackendMemory:
+		store = NewMemoryStore()
+	case BackendSQL:
+		if config.DatabaseURL == "" {
+			return nil, fmt.Errorf("database URL is required for the sql refresh token backend")
+		}
+		db, err := sql.Open("pgx", config.DatabaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open refresh token database: %w", err)
+		}
+		store, err = NewSQLStore(ctx, db, config.Table)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown refresh token backend: %s", config.Backend)
+	}
+
+	return New(keys, store, accounts, auditLog, config)
+}
+
+// withDefaults returns config with unset durations defaulted
+func (c Config) withDefaults() Config {
+	if c.AccessTokenTTL <= 0 {
+		c.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if c.IDTokenTTL <= 0 {
+		c.IDTokenTTL = DefaultIDTokenTTL
+	}
+	if c.RefreshTokenTTL <= 0 {
+		c.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	if c.RefreshTokenLifetime <= 0 {
+		c.RefreshTokenLifetime = DefaultRefreshTokenLifetime
+	}
+	if c.RotationInterval == 0 {
+		c.RotationInterval = DefaultRotationInterval
+	}
+	if c.KeyOverlap <= 0 {
+		// Long enough for every token a retired key signed to expire
+		c.KeyOverlap = max(c.AccessTokenTTL, c.IDTokenTTL) + time.Hour
+	}
+	if c.ClientID == "" {
+		c.ClientID = DefaultClientID
+	}
+	return c
+}
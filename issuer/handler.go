@@ -0,0 +1,160 @@
+package issuer
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Paths the issuer endpoints are served on
+const (
+	JWKSPath      = "/.well-known/jwks.json"
+	DiscoveryPath = "/.well-known/openid-configuration"
+	TokenPath     = "/oauth/token"
+	RevokePath    = "/oauth/revoke"
+)
+
+// maxRequestBody bounds the size of a token or revocation request
+const maxRequestBody = 4 << 10
+
+// jwksMaxAge is how long verifiers may cache the JWKS. Keys are published a
+// rotation ahead of use, so it only needs to be shorter than the rotation
+// interval.
+const jwksMaxAge = "max-age=300"
+
+// Discovery is the OpenID Provider metadata served on DiscoveryPath. There
+// is no authorization endpoint: users sign in through the challenge
+// endpoints, and clients refresh tokens here.
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// JWKSHandler serves the published public keys
+func (i *Issuer) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", jwksMaxAge)
+		json.NewEncoder(w).Encode(i.keys.JWKS())
+	})
+}
+
+// DiscoveryHandler serves the OpenID Provider metadata
+func (i *Issuer) DiscoveryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		base := strings.TrimSuffix(i.config.URL, "/")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", jwksMaxAge)
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                            i.config.URL,
+			JWKSURI:                           base + JWKSPath,
+			TokenEndpoint:                     base + TokenPath,
+			RevocationEndpoint:                base + RevokePath,
+			GrantTypesSupported:               []string{"refresh_token"},
+			ResponseTypesSupported:            []string{"id_token"},
+			SubjectTypesSupported:             []string{"public"},
+			IDTokenSigningAlgValuesSupported:  []string{i.keys.Algorithm()},
+			TokenEndpointAuthMethodsSupported: []string{"none"},
+			ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "amr", "email", "name"},
+		})
+	})
+}
+
+// TokenHandler serves the refresh token grant (RFC 6749 section 6) to the
+// first-party client, which is public and authenticates with its client_id
+func (i *Issuer) TokenHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		if err := r.ParseForm(); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_request")
+			return
+		}
+		switch {
+		case r.PostForm.Get("grant_type") != "refresh_token":
+			respondError(w, http.StatusBadRequest, "unsupported_grant_type")
+			return
+		case r.PostForm.Get("refresh_token") == "":
+			respondError(w, http.StatusBadRequest, "invalid_request")
+			return
+		case r.PostForm.Has("client_id") && r.PostForm.Get("client_id") != i.config.ClientID:
+			respondError(w, http.StatusUnauthorized, "invalid_client")
+			return
+		}
+
+		tokens, err := i.Refresh(r.Context(), r.PostForm.Get("refresh_token"))
+		switch {
+		case err == nil:
+			w.Header().Set("Pragma", "no-cache")
+			respondJSON(w, http.StatusOK, tokens)
+		case errors.Is(err, ErrInvalidGrant), errors.Is(err, ErrRefreshTokenReused):
+			slog.InfoContext(r.Context(), "refresh token rejected", "error", err)
+			respondError(w, http.StatusBadRequest, "invalid_grant")
+		default:
+			slog.ErrorContext(r.Context(), "token refresh error", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	})
+}
+
+// RevokeHandler serves token revocation (RFC 7009). Refresh tokens revoke
+// their family; access tokens expire on their own and are ignored.
+func (i *Issuer) RevokeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("token") == "" {
+			respondError(w, http.StatusBadRequest, "invalid_request")
+			return
+		}
+
+		if err := i.Revoke(r.Context(), r.PostForm.Get("token")); err != nil {
+			slog.ErrorContext(r.Context(), "token revocation error", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// respondError writes an OAuth error response
+func respondError(w http.ResponseWriter, status int, code string) {
+	respondJSON(w, status, map[string]string{"error": code})
+}
+
+// respondJSON writes a JSON response
+func respondJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
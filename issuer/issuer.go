@@ -0,0 +1,418 @@
+package issuer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/auth"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Defaults for Config
+const (
+	DefaultAccessTokenTTL       = 15 * time.Minute
+	DefaultIDTokenTTL           = time.Hour
+	DefaultRefreshTokenTTL      = 14 * 24 * time.Hour
+	DefaultRefreshTokenLifetime = 90 * 24 * time.Hour
+	DefaultRotationInterval     = 24 * time.Hour
+	DefaultPruneInterval        = time.Hour
+	DefaultClientID             = "first-party"
+)
+
+// AccessTokenType is the typ header of access tokens (RFC 9068), which
+// keeps ID tokens from being accepted as access tokens
+const AccessTokenType = "at+jwt"
+
+// Errors returned by Issuer
+var (
+	ErrInvalidGrant        = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrInvalidClaims       = errors.New("invalid claims")
+	ErrUnknownAccount      = errors.New("account not found")
+	errRefreshTokenRevoked = errors.New("refresh token revoked")
+)
+
+// reservedClaims are set by the issuer and can't be configured
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"client_id": true, "azp": true, "scope": true, "auth_time": true, "amr": true, "cnf": true,
+	"gty": true, "email": true,
+}
+
+// AccountStore finds the account tokens are issued for
+type AccountStore interface {
+	GetAccountByUserID(ctx context.Context, userID string) (*model.Account, error)
+}
+
+// Config holds token issuer configuration
+type Config struct {
+	URL      string // iss claim, an https origin such as https://api.example.com/
+	Audience string // aud of access tokens; the audience auth.Middleware expects
+	ClientID string // aud of ID tokens and client_id of access tokens (default first-party)
+
+	// Signing keys are read from KeyFile when set. Otherwise they are
+	// generated for Algorithm (RS256, the default, or ES256) and rotated
+	// every RotationInterval (default 24h, negative to never rotate), and
+	// retired keys stay published for KeyOverlap (default the longest token
+	// lifetime plus an hour).
+	Algorithm        string
+	KeyFile          string
+	RotationInterval time.Duration
+	KeyOverlap       time.Duration
+
+	AccessTokenTTL       time.Duration // default 15m
+	IDTokenTTL           time.Duration // default 1h
+	RefreshTokenTTL      time.Duration // unused refresh tokens expire after this (default 14 days)
+	RefreshTokenLifetime time.Duration // refresh tokens stop being renewed this long after sign-in (default 90 days)
+
+	// Scope is the scope claim of access tokens (optional). Claims are added
+	// to every access token and ClaimsFunc adds claims for an account, such
+	// as its permissions; neither may set the claims the issuer sets.
+	Scope      string
+	Claims     map[string]any
+	ClaimsFunc func(ctx context.Context, account *model.Account) (map[string]any, error)
+
+	// Revocations refuses to refresh tokens of users whose tokens were
+	// revoked after they signed in (optional). Its entries expire, so a
+	// revocation list should also revoke the stored refresh tokens through
+	// RevokeSubject.
+	Revocations auth.RevocationChecker
+
+	Backend     string // refresh token storage: memory (default) or sql
+	DatabaseURL string // PostgreSQL connection string for the sql backend
+	Table       string // table for the sql backend (default refresh_tokens)
+}
+
+// Tokens is a token response (RFC 6749 section 5.1)
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	IDToken      string `json:"id_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Issuer mints access, ID and refresh tokens for signed-in users. Refresh
+// tokens are single use: each refresh returns a new one, and presenting a
+// used one revokes every token descending from the same sign-in.
+type Issuer struct {
+	keys     *KeySet
+	store    Store
+	accounts AccountStore
+	auditLog *audit.Logger
+	config   Config
+}
+
+// New creates an issuer signing with keys and keeping refresh tokens in store
+func New(keys *KeySet, store Store, accounts AccountStore, auditLog *audit.Logger, config Config) (*Issuer, error) {
+	config = config.withDefaults()
+	issuerURL, err := url.Parse(config.URL)
+	if err != nil || issuerURL.Host == "" || (issuerURL.Path != "" && issuerURL.Path != "/") || issuerURL.RawQuery != "" || issuerURL.Fragment != "" {
+		return nil, fmt.Errorf("issuer URL must be an origin: %q", config.URL)
+	}
+	if issuerURL.Scheme != "https" && !(issuerURL.Scheme == "http" && issuerURL.Hostname() == "localhost") {
+		return nil, fmt.Errorf("issuer URL must use https: %q", config.URL)
+	}
+	if config.Audience == "" {
+		return nil, errors.New("issuer audience is required")
+	}
+	for name := range config.Claims {
+		if reservedClaims[name] {
+			return nil, fmt.Errorf("%w: %s is set by the issuer", ErrInvalidClaims, name)
+		}
+	}
+	if config.RotationInterval > 0 && config.KeyOverlap < max(config.AccessTokenTTL, config.IDTokenTTL) {
+		return nil, errors.New("key overlap must be at least the token lifetime")
+	}
+
+	return &Issuer{
+		keys:     keys,
+		store:    store,
+		accounts: accounts,
+		auditLog: auditLog,
+		config:   config,
+	}, nil
+}
+
+// IssuerURL returns the iss claim of the issued tokens
+func (i *Issuer) IssuerURL() string {
+	return i.config.URL
+}
+
+// VerificationKey returns the published public key with kid, or nil. With
+// IssuerURL it lets auth.Middleware verify the access tokens.
+func (i *Issuer) VerificationKey(kid string) crypto.PublicKey {
+	return i.keys.PublicKey(kid)
+}
+
+// Keys returns the signing keys
+func (i *Issuer) Keys() *KeySet {
+	return i.keys
+}
+
+// Run rotates the signing keys and prunes expired refresh tokens until ctx
+// is cancelled
+func (i *Issuer) Run(ctx context.Context) {
+	go i.keys.Run(ctx, i.config.RotationInterval)
+
+	ticker := time.NewTicker(DefaultPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := i.store.Prune(ctx, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "refresh token prune failed", "error", err)
+		}
+	}
+}
+
+// Issue mints tokens for the user who just signed in with the methods in
+// amr (RFC 8176 values, such as "otp")
+func (i *Issuer) Issue(ctx context.Context, userID string, amr []string) (*Tokens, error) {
+	now := time.Now()
+	familyID, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	return i.issue(ctx, userID, RefreshToken{FamilyID: familyID, UserID: userID, AMR: amr, AuthTime: now}, now)
+}
+
+// Refresh exchanges a refresh token for new tokens. A token that was already
+// used revokes its family, since either it or its successor was stolen.
+func (i *Issuer) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	now := time.Now()
+	token, err := i.store.Use(ctx, hashToken(refreshToken), now)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !token.RevokedAt.IsZero():
+		err = errRefreshTokenRevoked
+	case !token.ExpiresAt.After(now):
+		err = fmt.Errorf("%w: expired", ErrInvalidGrant)
+	case !token.UsedAt.IsZero():
+		if revokeErr := i.store.RevokeFamily(ctx, token.FamilyID, now); revokeErr != nil {
+			return nil, revokeErr
+		}
+		slog.WarnContext(ctx, "refresh token reuse detected", "user_id", token.UserID)
+		i.auditLog.Record(ctx, audit.Event{
+			Type:     audit.TypeRefreshTokenReused,
+			Actor:    token.UserID,
+			Subject:  token.UserID,
+			Outcome:  audit.OutcomeFailure,
+			Reason:   "reuse_detected",
+			Metadata: map[string]string{"used_at": token.UsedAt.UTC().Format(time.RFC3339)},
+		})
+		return nil, ErrRefreshTokenReused
+	case i.config.Revocations != nil && i.config.Revocations.IsRevoked("", token.UserID, token.AuthTime):
+		err = errRefreshTokenRevoked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+	}
+
+	tokens, err := i.issue(ctx, token.UserID, *token, now)
+	if errors.Is(err, ErrUnknownAccount) {
+		// The account was deleted; nothing in the family can be used again
+		if revokeErr := i.store.RevokeFamily(ctx, token.FamilyID, now); revokeErr != nil {
+			return nil, revokeErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+	}
+	return tokens, err
+}
+
+// Revoke revokes the family of a refresh token, such as on sign-out. Unknown
+// tokens are ignored (RFC 7009).
+func (i *Issuer) Revoke(ctx context.Context, refreshToken string) error {
+	now := time.Now()
+	token, err := i.store.Use(ctx, hashToken(refreshToken), now)
+	if errors.Is(err, ErrInvalidGrant) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := i.store.RevokeFamily(ctx, token.FamilyID, now); err != nil {
+		return err
+	}
+	i.auditLog.Record(ctx, audit.Event{
+		Type:     audit.TypeTokenRevoked,
+		Actor:    token.UserID,
+		Subject:  token.UserID,
+		Outcome:  audit.OutcomeSuccess,
+		Reason:   "sign_out",
+		Metadata: map[string]string{"token": "refresh"},
+	})
+	return nil
+}
+
+// RevokeSubject revokes the refresh tokens of subject from sign-ins before
+// issuedBefore, such as when the user is deleted. It lets a revocation list
+// reach the refresh tokens, which outlive its entries.
+func (i *Issuer) RevokeSubject(ctx context.Context, subject string, issuedBefore time.Time) error {
+	return i.store.RevokeUser(ctx, subject, issuedBefore, time.Now())
+}
+
+// issue mints access and ID tokens for the account of userID and stores the
+// next refresh token of family
+func (i *Issuer) issue(ctx context.Context, userID string, family RefreshToken, now time.Time) (*Tokens, error) {
+	account, err := i.accounts.GetAccountByUserID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrUnknownAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := i.accessToken(ctx, account, family, now)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := i.idToken(account, family, now)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	next := RefreshToken{
+		Hash:      hashToken(refreshToken),
+		FamilyID:  family.FamilyID,
+		UserID:    userID,
+		AMR:       family.AMR,
+		AuthTime:  family.AuthTime,
+		CreatedAt: now,
+		ExpiresAt: now.Add(i.config.RefreshTokenTTL),
+	}
+	if limit := family.AuthTime.Add(i.config.RefreshTokenLifetime); next.ExpiresAt.After(limit) {
+		next.ExpiresAt = limit
+	}
+	if next.ExpiresAt.After(now) {
+		if err := i.store.Save(ctx, next); err != nil {
+			return nil, err
+		}
+	} else {
+		// Past its lifetime, the family ends with these tokens
+		refreshToken = ""
+	}
+
+	return &Tokens{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(i.config.AccessTokenTTL / time.Second),
+		IDToken:      idToken,
+		RefreshToken: refreshToken,
+		Scope:        i.config.Scope,
+	}, nil
+}
+
+// accessToken signs an RFC 9068 access token for account
+func (i *Issuer) accessToken(ctx context.Context, account *model.Account, family RefreshToken, now time.Time) (string, error) {
+	jti, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	for name, value := range i.config.Claims {
+		claims[name] = value
+	}
+	if i.config.ClaimsFunc != nil {
+		extra, err := i.config.ClaimsFunc(ctx, account)
+		if err != nil {
+			return "", fmt.Errorf("failed to build token claims: %w", err)
+		}
+		for name, value := range extra {
+			if reservedClaims[name] {
+				return "", fmt.Errorf("%w: %s is set by the issuer", ErrInvalidClaims, name)
+			}
+			claims[name] = value
+		}
+	}
+
+	claims["iss"] = i.config.URL
+	claims["sub"] = account.UserID
+	claims["aud"] = i.config.Audience
+	claims["client_id"] = i.config.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(i.config.AccessTokenTTL).Unix()
+	claims["jti"] = jti
+	claims["auth_time"] = family.AuthTime.Unix()
+	claims["email"] = account.Email
+	if len(family.AMR) > 0 {
+		claims["amr"] = family.AMR
+	}
+	if i.config.Scope != "" {
+		claims["scope"] = i.config.Scope
+	}
+	return i.sign(claims, AccessTokenType)
+}
+
+// idToken signs an OpenID Connect ID token for account
+func (i *Issuer) idToken(account *model.Account, family RefreshToken, now time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":       i.config.URL,
+		"sub":       account.UserID,
+		"aud":       i.config.ClientID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(i.config.IDTokenTTL).Unix(),
+		"auth_time": family.AuthTime.Unix(),
+		"email":     account.Email,
+	}
+	if len(family.AMR) > 0 {
+		claims["amr"] = family.AMR
+	}
+	if account.DisplayName != nil && *account.DisplayName != "" {
+		claims["name"] = *account.DisplayName
+	}
+	return i.sign(claims, "JWT")
+}
+
+// sign signs claims with the current key
+func (i *Issuer) sign(claims jwt.MapClaims, typ string) (string, error) {
+	key := i.keys.signer()
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.id
+	token.Header["typ"] = typ
+	signed, err := token.SignedString(key.private)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, nil
+}
+
+// randomToken returns a random URL-safe token
+func randomToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// hashToken returns the key a refresh token is stored under
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
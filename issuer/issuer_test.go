@@ -0,0 +1,285 @@
+package issuer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/auth"
+	"github.com/example/auth0-gqlgen-demo/revocation"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+const (
+	testIssuerURL = "https://issuer.example.com/"
+	testAudience  = "https://api.example.com"
+	testUserID    = "auth0|user1"
+)
+
+// newTestIssuer creates an issuer with ES256 keys for an account of
+// testUserID, with config's other settings
+func newTestIssuer(t *testing.T, config Config) (*Issuer, *store.MemoryStore) {
+	t.Helper()
+	accounts := store.NewMemoryStore()
+	if _, err := accounts.CreateAccount(context.Background(), testUserID, "user1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	config.URL = testIssuerURL
+	config.Audience = testAudience
+	keys, err := NewKeySet(AlgorithmES256, config.withDefaults().KeyOverlap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := New(keys, NewMemoryStore(), accounts, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer, accounts
+}
+
+// newTestAPI returns a handler trusting issuer's access tokens, answering
+// with the authenticated user ID
+func newTestAPI(issuer *Issuer) http.Handler {
+	config := auth.Auth0Config{Domain: "tenant.example.com", Audience: testAudience, TrustedIssuers: []auth.TrustedIssuer{issuer}}
+	return auth.Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, err := auth.GetUserFromContext(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(info.UserID))
+	}))
+}
+
+// callAPI sends a request with token to api and returns the status and body
+func callAPI(api http.Handler, token string) (int, string) {
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/query", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+	return w.Code, w.Body.String()
+}
+
+func TestIssuedTokensPassMiddleware(t *testing.T) {
+	ctx := context.Background()
+	issuer, _ := newTestIssuer(t, Config{})
+	api := newTestAPI(issuer)
+
+	tokens, err := issuer.Issue(ctx, testUserID, []string{"otp"})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if status, body := callAPI(api, tokens.AccessToken); status != http.StatusOK || body != testUserID {
+		t.Errorf("access token = %d %q, want %d %q", status, body, http.StatusOK, testUserID)
+	}
+
+	// ID tokens aren't access tokens
+	if status, _ := callAPI(api, tokens.IDToken); status != http.StatusUnauthorized {
+		t.Errorf("ID token = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// Tokens signed before a rotation still verify, and new ones too
+	if err := issuer.Keys().Rotate(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := callAPI(api, tokens.AccessToken); status != http.StatusOK {
+		t.Errorf("access token after a rotation = %d, want %d", status, http.StatusOK)
+	}
+	refreshed, err := issuer.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if status, _ := callAPI(api, refreshed.AccessToken); status != http.StatusOK {
+		t.Errorf("access token from the new key = %d, want %d", status, http.StatusOK)
+	}
+
+	// Another issuer's keys are unknown
+	other, _ := newTestIssuer(t, Config{})
+	forged, err := other.Issue(ctx, testUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := callAPI(api, forged.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("access token of another key = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	ctx := context.Background()
+	issuer, _ := newTestIssuer(t, Config{})
+
+	tokens, err := issuer.Issue(ctx, testUserID, []string{"pop"})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	for range 3 {
+		next, err := issuer.Refresh(ctx, tokens.RefreshToken)
+		if err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+		if next.RefreshToken == "" || next.RefreshToken == tokens.RefreshToken || next.AccessToken == tokens.AccessToken {
+			t.Fatalf("Refresh() = %+v, want new tokens", next)
+		}
+		tokens = next
+	}
+
+	if _, err := issuer.Refresh(ctx, "unknown"); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Refresh() of an unknown token error = %v, want %v", err, ErrInvalidGrant)
+	}
+}
+
+func TestRefreshStopsAtLifetime(t *testing.T) {
+	ctx := context.Background()
+	issuer, _ := newTestIssuer(t, Config{RefreshTokenLifetime: 50 * time.Millisecond})
+
+	tokens, err := issuer.Issue(ctx, testUserID, nil)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := issuer.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Refresh() past the lifetime error = %v, want %v", err, ErrInvalidGrant)
+	}
+}
+
+func TestReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	issuer, _ := newTestIssuer(t, Config{})
+
+	stolen, err := issuer.Issue(ctx, testUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := issuer.Issue(ctx, testUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := issuer.Refresh(ctx, stolen.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	latest, err := issuer.Refresh(ctx, next.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	if _, err := issuer.Refresh(ctx, stolen.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Refresh() of a used token error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	// Every token of the sign-in is revoked, but not other sign-ins
+	if _, err := issuer.Refresh(ctx, latest.RefreshToken); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Refresh() of the latest token of the family error = %v, want %v", err, ErrInvalidGrant)
+	}
+	if _, err := issuer.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Errorf("Refresh() of another sign-in error = %v, want nil", err)
+	}
+}
+
+func TestRefreshAfterRevocation(t *testing.T) {
+	ctx := context.Background()
+	// Entries are dropped as soon as they are made, so only the stored
+	// refresh tokens remember the revocation
+	revocations := revocation.NewList(nil, time.Nanosecond)
+	issuer, _ := newTestIssuer(t, Config{Revocations: revocations})
+	revocations.AddRevoker(issuer)
+
+	before, err := issuer.Issue(ctx, testUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, err := issuer.Refresh(ctx, before.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := revocations.RevokeSubject(ctx, testUserID, time.Now(), "test"); err != nil {
+		t.Fatalf("RevokeSubject() error = %v", err)
+	}
+	if err := revocations.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := issuer.Refresh(ctx, refreshed.RefreshToken); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Refresh() of a sign-in before the revocation error = %v, want %v", err, ErrInvalidGrant)
+	}
+	after, err := issuer.Issue(ctx, testUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Refresh(ctx, after.RefreshToken); err != nil {
+		t.Errorf("Refresh() of a sign-in after the revocation error = %v, want nil", err)
+	}
+}
+
+func TestRefreshOfDeletedAccount(t *testing.T) {
+	ctx := context.Background()
+	issuer, accounts := newTestIssuer(t, Config{})
+
+	tokens, err := issuer.Issue(ctx, testUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.DeleteAccount(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Refresh() of a deleted account error = %v, want %v", err, ErrInvalidGrant)
+	}
+}
+
+func TestTokenAndRevokeHandlers(t *testing.T) {
+	ctx := context.Background()
+	issuer, _ := newTestIssuer(t, Config{})
+	post := func(handler http.Handler, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, TokenPath, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	tokens, err := issuer.Issue(ctx, testUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+		wantError  string
+	}{
+		{"refresh", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}, http.StatusOK, ""},
+		{"reuse", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}, http.StatusBadRequest, "invalid_grant"},
+		{"other grant", url.Values{"grant_type": {"password"}}, http.StatusBadRequest, "unsupported_grant_type"},
+		{"no token", url.Values{"grant_type": {"refresh_token"}}, http.StatusBadRequest, "invalid_request"},
+		{"other client", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"x"}, "client_id": {"other"}}, http.StatusUnauthorized, "invalid_client"},
+	}
+	for _, tt := range tests {
+		w := post(issuer.TokenHandler(), tt.form)
+		if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantError) {
+			t.Errorf("%s: POST %s = %d %s, want %d %s", tt.name, TokenPath, w.Code, w.Body, tt.wantStatus, tt.wantError)
+		}
+		if w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: Cache-Control = %q, want no-store", tt.name, w.Header().Get("Cache-Control"))
+		}
+	}
+
+	// Signing out ends the sign-in
+	signedIn, err := issuer.Issue(ctx, testUserID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := post(issuer.RevokeHandler(), url.Values{"token": {signedIn.RefreshToken}}); w.Code != http.StatusOK {
+		t.Fatalf("POST %s = %d, want %d", RevokePath, w.Code, http.StatusOK)
+	}
+	if _, err := issuer.Refresh(ctx, signedIn.RefreshToken); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Refresh() after signing out error = %v, want %v", err, ErrInvalidGrant)
+	}
+	if w := post(issuer.RevokeHandler(), url.Values{"token": {"unknown"}}); w.Code != http.StatusOK {
+		t.Errorf("POST %s of an unknown token = %d, want %d", RevokePath, w.Code, http.StatusOK)
+	}
+}
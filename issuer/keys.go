@@ -0,0 +1,332 @@
+package issuer
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms accepted in Config.Algorithm
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+)
+
+// rsaKeyBits is the size of generated RSA keys
+const rsaKeyBits = 2048
+
+// ErrStaticKeys is returned when rotating keys loaded from a file
+var ErrStaticKeys = errors.New("signing keys loaded from a file are rotated by replacing the file")
+
+// JWK is a public key in the JWKS document
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is the JSON Web Key Set served on JWKSPath
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// signingKey is a key pair with its kid, the RFC 7638 thumbprint of the
+// public key
+type signingKey struct {
+	id        string
+	algorithm string
+	private   crypto.Signer
+	jwk       JWK
+	expiresAt time.Time // when a retired key stops being published; zero for keys in use
+}
+
+// method returns the JWT signing method of the key
+func (k *signingKey) method() jwt.SigningMethod {
+	if k.algorithm == AlgorithmES256 {
+		return jwt.SigningMethodES256
+	}
+	return jwt.SigningMethodRS256
+}
+
+// KeySet holds the signing keys. The current key signs tokens. With
+// generated keys, the next key is published before it is used, so verifiers
+// caching the JWKS already have it when keys rotate, and retired keys stay
+// published for the overlap, so tokens they signed can still be verified.
+type KeySet struct {
+	algorithm string
+	overlap   time.Duration
+	static    bool // loaded from a file, not rotated
+
+	mu      sync.RWMutex
+	current *signingKey
+	next    *signingKey
+	retired []*signingKey
+}
+
+// NewKeySet generates the current and next keys for algorithm. Retired keys
+// are published for overlap, which must be at least the lifetime of the
+// tokens they signed.
+func NewKeySet(algorithm string, overlap time.Duration) (*KeySet, error) {
+	current, err := generateKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	next, err := generateKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{algorithm: algorithm, overlap: overlap, current: current, next: next}, nil
+}
+
+// LoadKeySet reads PEM private keys (PKCS #8, PKCS #1 or SEC 1) from path.
+// The first key signs tokens and the others are only published, so every
+// instance can share the file and keys can be rotated by adding the new key
+// at the top, then removing the old one once its tokens have expired. RSA
+// keys sign with RS256 and P-256 keys with ES256.
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing keys: %w", err)
+	}
+
+	set := &KeySet{static: true}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		private, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		key, err := newSigningKey(private)
+		if err != nil {
+			return nil, err
+		}
+		if set.current == nil {
+			set.current = key
+			set.algorithm = key.algorithm
+		} else {
+			set.retired = append(set.retired, key)
+		}
+	}
+	if set.current == nil {
+		return nil, fmt.Errorf("no PEM private keys found in %s", path)
+	}
+	return set, nil
+}
+
+// Algorithm returns the algorithm of the current key
+func (k *KeySet) Algorithm() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current.algorithm
+}
+
+// Rotate retires the current key, starts signing with the next one and
+// generates a new next key. Retired keys past the overlap are dropped.
+func (k *KeySet) Rotate(now time.Time) error {
+	if k.static {
+		return ErrStaticKeys
+	}
+	next, err := generateKey(k.algorithm)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	retired := k.current
+	retired.expiresAt = now.Add(k.overlap)
+	k.retired = append(k.retired, retired)
+	k.current, k.next = k.next, next
+
+	kept := k.retired[:0]
+	for _, key := range k.retired {
+		if key.expiresAt.After(now) {
+			kept = append(kept, key)
+		}
+	}
+	k.retired = kept
+	return nil
+}
+
+// Run rotates the keys every interval until ctx is cancelled. Keys loaded
+// from a file are never rotated.
+func (k *KeySet) Run(ctx context.Context, interval time.Duration) {
+	if k.static || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := k.Rotate(time.Now()); err != nil {
+			slog.ErrorContext(ctx, "signing key rotation failed", "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "signing key rotated", "kid", k.signer().id)
+	}
+}
+
+// JWKS returns the published public keys: current, next and retired
+func (k *KeySet) JWKS() JWKS {
+	now := time.Now()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{k.current.jwk}}
+	if k.next != nil {
+		jwks.Keys = append(jwks.Keys, k.next.jwk)
+	}
+	for _, key := range k.retired {
+		if key.expiresAt.IsZero() || key.expiresAt.After(now) {
+			jwks.Keys = append(jwks.Keys, key.jwk)
+		}
+	}
+	return jwks
+}
+
+// PublicKey returns the published key with kid, or nil
+func (k *KeySet) PublicKey(kid string) crypto.PublicKey {
+	now := time.Now()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.current.id == kid {
+		return k.current.private.Public()
+	}
+	if k.next != nil && k.next.id == kid {
+		return k.next.private.Public()
+	}
+	for _, key := range k.retired {
+		if key.id == kid && (key.expiresAt.IsZero() || key.expiresAt.After(now)) {
+			return key.private.Public()
+		}
+	}
+	return nil
+}
+
+// signer returns the key tokens are signed with
+func (k *KeySet) signer() *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// generateKey creates a key pair for algorithm
+func generateKey(algorithm string) (*signingKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return newSigningKey(private)
+}
+
+// parsePrivateKey decodes a PEM private key block
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key: %w", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported signing key type: %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block: %s", block.Type)
+	}
+}
+
+// newSigningKey derives the algorithm, JWK and kid of a private key
+func newSigningKey(private crypto.Signer) (*signingKey, error) {
+	key := &signingKey{private: private}
+
+	// The thumbprint covers the required members only; encoding/json sorts
+	// map keys as RFC 7638 requires
+	var required map[string]string
+	switch public := private.Public().(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < rsaKeyBits {
+			return nil, errors.New("RSA signing key is too weak")
+		}
+		key.algorithm = AlgorithmRS256
+		key.jwk = JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}
+		required = map[string]string{"e": key.jwk.E, "kty": "RSA", "n": key.jwk.N}
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return nil, errors.New("EC signing keys must use P-256")
+		}
+		key.algorithm = AlgorithmES256
+		key.jwk = JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, 32))),
+		}
+		required = map[string]string{"crv": "P-256", "kty": "EC", "x": key.jwk.X, "y": key.jwk.Y}
+	default:
+		return nil, fmt.Errorf("unsupported signing key type: %T", public)
+	}
+
+	canonical, err := json.Marshal(required)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(canonical)
+	key.id = base64.RawURLEncoding.EncodeToString(sum[:])
+	key.jwk.Kid = key.id
+	key.jwk.Use = "sig"
+	key.jwk.Alg = key.algorithm
+	return key, nil
+}
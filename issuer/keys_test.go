@@ -0,0 +1,127 @@
+package issuer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// kids returns the key IDs of jwks
+func kids(jwks JWKS) []string {
+	ids := make([]string, 0, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		ids = append(ids, key.Kid)
+	}
+	return ids
+}
+
+func TestKeyRotation(t *testing.T) {
+	keys, err := NewKeySet(AlgorithmES256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := kids(keys.JWKS())
+	if len(published) != 2 || published[0] != keys.signer().id {
+		t.Fatalf("JWKS = %v, want the current key and the next one", published)
+	}
+	first, next := published[0], published[1]
+
+	// The next key signs after a rotation, and the old one stays published
+	now := time.Now()
+	if err := keys.Rotate(now); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if keys.signer().id != next {
+		t.Errorf("signing key = %s, want the published next key %s", keys.signer().id, next)
+	}
+	if published := kids(keys.JWKS()); len(published) != 3 || published[2] != first {
+		t.Errorf("JWKS after rotation = %v, want the retired key %s too", published, first)
+	}
+	if keys.PublicKey(first) == nil {
+		t.Error("PublicKey() of the retired key = nil within the overlap")
+	}
+
+	// Once the overlap has passed, the retired key is dropped
+	if err := keys.Rotate(now.Add(2 * time.Hour)); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	for _, kid := range kids(keys.JWKS()) {
+		if kid == first {
+			t.Errorf("JWKS still has %s after the overlap", first)
+		}
+	}
+	if keys.PublicKey(first) != nil {
+		t.Error("PublicKey() of a key past the overlap != nil")
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	var data []byte
+	for range 2 {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})...)
+	}
+	path := filepath.Join(t.TempDir(), "keys.pem")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadKeySet(path)
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+	if keys.Algorithm() != AlgorithmES256 {
+		t.Errorf("Algorithm() = %s, want %s", keys.Algorithm(), AlgorithmES256)
+	}
+	if published := kids(keys.JWKS()); len(published) != 2 || published[0] != keys.signer().id {
+		t.Errorf("JWKS = %v, want the signing key first, then the other", published)
+	}
+	if err := keys.Rotate(time.Now()); !errors.Is(err, ErrStaticKeys) {
+		t.Errorf("Rotate() of keys from a file error = %v, want %v", err, ErrStaticKeys)
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	issuer, _ := newTestIssuer(t, Config{})
+
+	w := httptest.NewRecorder()
+	issuer.JWKSHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, JWKSPath, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != jwksMaxAge {
+		t.Fatalf("GET %s = %d, Cache-Control %q", JWKSPath, w.Code, w.Header().Get("Cache-Control"))
+	}
+	var jwks JWKS
+	if err := json.NewDecoder(w.Body).Decode(&jwks); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range jwks.Keys {
+		if key.Kty != "EC" || key.Alg != AlgorithmES256 || key.Crv != "P-256" || key.X == "" || key.Y == "" {
+			t.Errorf("published key = %+v, want a P-256 public key", key)
+		}
+		if issuer.VerificationKey(key.Kid) == nil {
+			t.Errorf("VerificationKey(%s) = nil for a published key", key.Kid)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	issuer.JWKSHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, JWKSPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST %s = %d, want %d", JWKSPath, w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,109 @@
+package issuer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RefreshToken is a stored refresh token. Every refresh replaces the token
+// with a new one of the same family, the tokens descending from one sign-in.
+type RefreshToken struct {
+	Hash      string // SHA-256 of the token; the token itself isn't stored
+	FamilyID  string
+	UserID    string
+	AMR       []string  // how the user signed in
+	AuthTime  time.Time // when the user signed in
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    time.Time // when it was exchanged for a new token; zero until then
+	RevokedAt time.Time // when its family was revoked; zero unless revoked
+}
+
+// Store persists refresh tokens so they survive restarts and are shared
+// between instances
+type Store interface {
+	// Save stores a new token
+	Save(ctx context.Context, token RefreshToken) error
+	// Use marks the token with hash as used at now and returns it as it was
+	// before, so exactly one caller sees a zero UsedAt. Unknown tokens
+	// return ErrInvalidGrant.
+	Use(ctx context.Context, hash string, now time.Time) (*RefreshToken, error)
+	// RevokeFamily revokes every token of a family at now
+	RevokeFamily(ctx context.Context, familyID string, now time.Time) error
+	// RevokeUser revokes at now every token of userID from sign-ins before
+	// authBefore
+	RevokeUser(ctx context.Context, userID string, authBefore, now time.Time) error
+	// Prune deletes the tokens that expired at now
+	Prune(ctx context.Context, now time.Time) error
+}
+
+// MemoryStore keeps refresh tokens in memory; they are lost on restart
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]*RefreshToken // key is the hash
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: make(map[string]*RefreshToken)}
+}
+
+// Save stores a new token
+func (s *MemoryStore) Save(ctx context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token.Hash] = &token
+	return nil
+}
+
+// Use marks the token with hash as used and returns it as it was before
+func (s *MemoryStore) Use(ctx context.Context, hash string, now time.Time) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, ErrInvalidGrant
+	}
+	previous := *token
+	if token.UsedAt.IsZero() {
+		token.UsedAt = now
+	}
+	return &previous, nil
+}
+
+// RevokeFamily revokes every token of a family
+func (s *MemoryStore) RevokeFamily(ctx context.Context, familyID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.FamilyID == familyID && token.RevokedAt.IsZero() {
+			token.RevokedAt = now
+		}
+	}
+	return nil
+}
+
+// RevokeUser revokes every token of userID from sign-ins before authBefore
+func (s *MemoryStore) RevokeUser(ctx context.Context, userID string, authBefore, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.UserID == userID && token.AuthTime.Before(authBefore) && token.RevokedAt.IsZero() {
+			token.RevokedAt = now
+		}
+	}
+	return nil
+}
+
+// Prune deletes the tokens that expired at now
+func (s *MemoryStore) Prune(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, token := range s.tokens {
+		if !token.ExpiresAt.After(now) {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
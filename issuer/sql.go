@@ -0,0 +1,133 @@
+package issuer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLStore stores refresh tokens in a SQL table. Queries use PostgreSQL
+// placeholder syntax.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLStore creates a store keeping refresh tokens in table, creating it
+// if needed
+func NewSQLStore(ctx context.Context, db *sql.DB, table string) (*SQLStore, error) {
+	if table == "" {
+		table = "refresh_tokens"
+	}
+	s := &SQLStore{db: db, table: table}
+
+	schema := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		hash       TEXT PRIMARY KEY,
+		family_id  TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		amr        TEXT NOT NULL DEFAULT '',
+		auth_time  TIMESTAMPTZ NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL,
+		used_at    TIMESTAMPTZ,
+		revoked_at TIMESTAMPTZ
+	)`, table)
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("failed to create refresh token table: %w", err)
+	}
+	for _, index := range []string{
+		`CREATE INDEX IF NOT EXISTS %[1]s_family ON %[1]s (family_id)`,
+		`CREATE INDEX IF NOT EXISTS %[1]s_user ON %[1]s (user_id)`,
+	} {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(index, table)); err != nil {
+			return nil, fmt.Errorf("failed to create refresh token index: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// Save stores a new token
+func (s *SQLStore) Save(ctx context.Context, token RefreshToken) error {
+	query := fmt.Sprintf(`INSERT INTO %s (hash, family_id, user_id, amr, auth_time, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`, s.table)
+	_, err := s.db.ExecContext(ctx, query,
+		token.Hash, token.FamilyID, token.UserID, strings.Join(token.AMR, " "),
+		token.AuthTime, token.CreatedAt, token.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+	return nil
+}
+
+// Use marks the token with hash as used and returns it as it was before.
+// The conditional update lets only one of concurrent callers use a token.
+func (s *SQLStore) Use(ctx context.Context, hash string, now time.Time) (*RefreshToken, error) {
+	columns := "hash, family_id, user_id, amr, auth_time, created_at, expires_at, used_at, revoked_at"
+	update := fmt.Sprintf(`UPDATE %s SET used_at = $2 WHERE hash = $1 AND used_at IS NULL RETURNING %s`, s.table, columns)
+	token, err := s.scan(s.db.QueryRowContext(ctx, update, hash, now))
+	if err == nil {
+		token.UsedAt = time.Time{}
+		return token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to use refresh token: %w", err)
+	}
+
+	// Already used, or unknown
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE hash = $1`, columns, s.table)
+	token, err = s.scan(s.db.QueryRowContext(ctx, query, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query refresh token: %w", err)
+	}
+	return token, nil
+}
+
+// RevokeFamily revokes every token of a family
+func (s *SQLStore) RevokeFamily(ctx context.Context, familyID string, now time.Time) error {
+	query := fmt.Sprintf(`UPDATE %s SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL`, s.table)
+	if _, err := s.db.ExecContext(ctx, query, familyID, now); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// RevokeUser revokes every token of userID from sign-ins before authBefore
+func (s *SQLStore) RevokeUser(ctx context.Context, userID string, authBefore, now time.Time) error {
+	query := fmt.Sprintf(`UPDATE %s SET revoked_at = $3 WHERE user_id = $1 AND auth_time < $2 AND revoked_at IS NULL`, s.table)
+	if _, err := s.db.ExecContext(ctx, query, userID, authBefore, now); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes the tokens that expired at now
+func (s *SQLStore) Prune(ctx context.Context, now time.Time) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE expires_at <= $1`, s.table)
+	if _, err := s.db.ExecContext(ctx, query, now); err != nil {
+		return fmt.Errorf("failed to prune refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// scan reads a token row
+func (s *SQLStore) scan(row *sql.Row) (*RefreshToken, error) {
+	var token RefreshToken
+	var amr string
+	var usedAt, revokedAt sql.NullTime
+	if err := row.Scan(&token.Hash, &token.FamilyID, &token.UserID, &amr, &token.AuthTime,
+		&token.CreatedAt, &token.ExpiresAt, &usedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	token.AMR = strings.Fields(amr)
+	token.UsedAt = usedAt.Time
+	token.RevokedAt = revokedAt.Time
+	return &token, nil
+}
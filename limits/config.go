@@ -0,0 +1,54 @@
+package limits
+
+import (
+	"log/slog"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+)
+
+// Defaults for Config
+const (
+	DefaultMaxDepth      = 10
+	DefaultMaxComplexity = 1000
+	DefaultAPQCacheSize  = 1000
+)
+
+// Config holds GraphQL operation limits
+type Config struct {
+	MaxDepth      int    // deepest field nesting allowed (default 10)
+	MaxComplexity int    // highest @cost total allowed (default 1000)
+	APQCacheSize  int    // automatic persisted queries kept in memory (default 1000)
+	ManifestPath  string // persisted query manifest; when set only its operations run and APQ is off
+}
+
+// Apply adds the configured limits and persisted query handling to srv. It
+// returns the allow-list, or nil when no manifest is configured.
+func Apply(srv *handler.Server, config Config) (*AllowList, error) {
+	if config.MaxDepth <= 0 {
+		config.MaxDepth = DefaultMaxDepth
+	}
+	if config.MaxComplexity <= 0 {
+		config.MaxComplexity = DefaultMaxComplexity
+	}
+	if config.APQCacheSize <= 0 {
+		config.APQCacheSize = DefaultAPQCacheSize
+	}
+
+	if config.ManifestPath != "" {
+		// Clients must not be able to register new operations through APQ
+		allowList, err := LoadManifest(config.ManifestPath)
+		if err != nil {
+			return nil, err
+		}
+		srv.Use(allowList)
+		srv.Use(Extension{MaxDepth: config.MaxDepth, MaxComplexity: config.MaxComplexity})
+		slog.Info("persisted query allow-list enabled", "operations", allowList.Len())
+		return allowList, nil
+	}
+
+	srv.Use(extension.AutomaticPersistedQuery{Cache: lru.New[string](config.APQCacheSize)})
+	srv.Use(Extension{MaxDepth: config.MaxDepth, MaxComplexity: config.MaxComplexity})
+	return nil, nil
+}
@@ -0,0 +1,175 @@
+package limits
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Error codes returned in extensions.code when an operation is refused
+const (
+	CodeQueryTooDeep    = "QUERY_TOO_DEEP"
+	CodeQueryTooComplex = "QUERY_TOO_COMPLEX"
+)
+
+// costDirective is the schema directive carrying per-field cost hints
+const costDirective = "cost"
+
+// Extension rejects operations nested deeper than MaxDepth or costing more
+// than MaxComplexity, as computed from the @cost hints in the schema.
+// Introspection fields are not counted. A limit of 0 disables the check.
+type Extension struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = Extension{}
+
+// ExtensionName returns the extension name
+func (Extension) ExtensionName() string {
+	return "QueryLimits"
+}
+
+// Validate is called when adding the extension to the server
+func (Extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationContext measures the operation before it is executed
+func (e Extension) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	if opCtx.Operation == nil {
+		return nil
+	}
+
+	if e.MaxDepth > 0 {
+		if depth := selectionDepth(opCtx.Operation.SelectionSet); depth > e.MaxDepth {
+			return refuse(CodeQueryTooDeep, "query depth %d exceeds the limit of %d", depth, e.MaxDepth)
+		}
+	}
+	if e.MaxComplexity > 0 {
+		if cost := selectionCost(opCtx.Operation.SelectionSet, opCtx.Variables); cost > e.MaxComplexity {
+			return refuse(CodeQueryTooComplex, "query complexity %d exceeds the limit of %d", cost, e.MaxComplexity)
+		}
+	}
+
+	return nil
+}
+
+// selectionDepth returns how deeply fields are nested in set
+func selectionDepth(set ast.SelectionSet) int {
+	depth := 0
+	for _, selection := range set {
+		var d int
+		switch s := selection.(type) {
+		case *ast.Field:
+			if isIntrospection(s) {
+				continue
+			}
+			d = 1 + selectionDepth(s.SelectionSet)
+		case *ast.InlineFragment:
+			d = selectionDepth(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				d = selectionDepth(s.Definition.SelectionSet)
+			}
+		}
+		depth = max(depth, d)
+	}
+	return depth
+}
+
+// selectionCost returns the total cost of the fields in set
+func selectionCost(set ast.SelectionSet, variables map[string]any) int {
+	cost := 0
+	for _, selection := range set {
+		switch s := selection.(type) {
+		case *ast.Field:
+			if !isIntrospection(s) {
+				cost += fieldCost(s, variables)
+			}
+		case *ast.InlineFragment:
+			cost += selectionCost(s.SelectionSet, variables)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				cost += selectionCost(s.Definition.SelectionSet, variables)
+			}
+		}
+	}
+	return cost
+}
+
+// fieldCost applies the field's @cost hint to the cost of its selections
+func fieldCost(field *ast.Field, variables map[string]any) int {
+	children := selectionCost(field.SelectionSet, variables)
+
+	var hint *ast.Directive
+	if field.Definition != nil {
+		hint = field.Definition.Directives.ForName(costDirective)
+	}
+	if hint == nil {
+		if len(field.SelectionSet) == 0 {
+			return 0
+		}
+		return 1 + children
+	}
+
+	hintArgs := hint.ArgumentMap(nil)
+	weight := 1
+	if w, ok := toInt(hintArgs["weight"]); ok {
+		weight = w
+	}
+
+	multiplier := 1
+	if m, ok := toInt(hintArgs["defaultMultiplier"]); ok {
+		multiplier = m
+	}
+	if names, ok := hintArgs["multipliers"].([]any); ok {
+		fieldArgs := field.ArgumentMap(variables)
+		for _, name := range names {
+			if name, ok := name.(string); ok {
+				if m, ok := toInt(fieldArgs[name]); ok {
+					multiplier = m
+					break
+				}
+			}
+		}
+	}
+
+	return weight + max(multiplier, 0)*children
+}
+
+// isIntrospection reports whether field is a schema introspection field
+func isIntrospection(field *ast.Field) bool {
+	return field.Name == "__schema" || field.Name == "__type" || field.Name == "__typename"
+}
+
+// toInt converts an argument value, literal or from variables, to an int
+func toInt(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case json.Number:
+		n, err := strconv.Atoi(string(v))
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// refuse builds the error returned for a refused operation
+func refuse(code, format string, args ...any) *gqlerror.Error {
+	err := gqlerror.Errorf(format, args...)
+	err.Extensions = map[string]any{"code": code}
+	return err
+}
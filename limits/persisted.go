@@ -0,0 +1,145 @@
+package limits
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// Error codes returned in extensions.code by the allow-list
+const (
+	CodePersistedQueryNotFound = "PERSISTED_QUERY_NOT_FOUND"
+	CodeOperationNotAllowed    = "OPERATION_NOT_ALLOWED"
+)
+
+// AllowList only lets clients run the operations of a persisted query
+// manifest. Clients send either the SHA-256 hash of a registered operation,
+// in the same extensions.persistedQuery field Automatic Persisted Queries use,
+// or its exact text.
+type AllowList struct {
+	queries map[string]string // SHA-256 hex digest to query
+	names   []string          // names of the registered operations
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+} = (*AllowList)(nil)
+
+// manifest is the Apollo persisted query manifest format
+type manifest struct {
+	Format     string `json:"format"`
+	Operations []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Body string `json:"body"`
+	} `json:"operations"`
+}
+
+// LoadManifest reads the operations an AllowList accepts from path. The file
+// is either an Apollo persisted query manifest or a JSON object mapping
+// SHA-256 hex digests to operations. Every digest is checked against its
+// operation.
+func LoadManifest(path string) (*AllowList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read persisted query manifest: %w", err)
+	}
+
+	queries := make(map[string]string)
+	var apollo manifest
+	if err := json.Unmarshal(data, &apollo); err == nil && apollo.Format != "" {
+		for _, op := range apollo.Operations {
+			queries[op.ID] = op.Body
+		}
+	} else if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("failed to parse persisted query manifest: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for hash, query := range queries {
+		if hash != queryHash(query) {
+			return nil, fmt.Errorf("persisted query manifest: %s is not the SHA-256 hash of its operation", hash)
+		}
+		doc, err := parser.ParseQuery(&ast.Source{Input: query})
+		if err != nil {
+			return nil, fmt.Errorf("persisted query manifest: %s is not a valid operation: %w", hash, err)
+		}
+		for _, op := range doc.Operations {
+			if op.Name != "" && !seen[op.Name] {
+				seen[op.Name] = true
+				names = append(names, op.Name)
+			}
+		}
+	}
+
+	return &AllowList{queries: queries, names: names}, nil
+}
+
+// OperationNames returns the names of the registered operations. It is safe
+// to call on a nil *AllowList, which has none.
+func (a *AllowList) OperationNames() []string {
+	if a == nil {
+		return nil
+	}
+	return a.names
+}
+
+// Len returns the number of registered operations
+func (a *AllowList) Len() int {
+	return len(a.queries)
+}
+
+// ExtensionName returns the extension name
+func (a *AllowList) ExtensionName() string {
+	return "AllowList"
+}
+
+// Validate is called when adding the extension to the server
+func (a *AllowList) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationParameters resolves hashes to registered operations and
+// refuses operations that aren't registered
+func (a *AllowList) MutateOperationParameters(ctx context.Context, params *graphql.RawParams) *gqlerror.Error {
+	if params.Query == "" {
+		hash := persistedQueryHash(params.Extensions)
+		if hash == "" {
+			return refuse(CodeOperationNotAllowed, "only persisted queries are accepted")
+		}
+		query, ok := a.queries[hash]
+		if !ok {
+			return refuse(CodePersistedQueryNotFound, "PersistedQueryNotFound")
+		}
+		params.Query = query
+		return nil
+	}
+
+	if _, ok := a.queries[queryHash(params.Query)]; !ok {
+		return refuse(CodeOperationNotAllowed, "operation is not in the persisted query allow-list")
+	}
+	return nil
+}
+
+// persistedQueryHash returns extensions.persistedQuery.sha256Hash, or ""
+func persistedQueryHash(extensions map[string]any) string {
+	persisted, _ := extensions["persistedQuery"].(map[string]any)
+	hash, _ := persisted["sha256Hash"].(string)
+	return hash
+}
+
+// queryHash returns the SHA-256 hex digest of query
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
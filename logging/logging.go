@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// fatalHooks run before Fatal exits the process
+var (
+	fatalMu    sync.Mutex
+	fatalHooks []func()
+)
+
+// Config holds logging configuration
+type Config struct {
+	Level  string    // debug, info, warn or error (default info)
+	Format string    // json or text (default json)
+	Output io.Writer // defaults to os.Stderr
+}
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "request_id"
+	userHashKey  contextKey = "user_id_hash"
+)
+
+// Setup builds the service logger and installs it as the slog default, which
+// also routes the standard library log package through it
+func Setup(config Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(defaultString(config.Level, "info"))); err != nil {
+		return nil, fmt.Errorf("invalid log level: %s", config.Level)
+	}
+
+	output := config.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(defaultString(config.Format, "json")) {
+	case "json":
+		handler = slog.NewJSONHandler(output, opts)
+	case "text":
+		handler = slog.NewTextHandler(output, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", config.Format)
+	}
+
+	logger := slog.New(&contextHandler{next: &redactingHandler{next: handler}})
+	slog.SetDefault(logger)
+
+	return logger, nil
+}
+
+// OnFatal registers fn to run before Fatal exits the process, such as
+// flushing buffered spans. os.Exit skips deferred calls, so cleanup that
+// must happen on a fatal error goes here.
+func OnFatal(fn func()) {
+	fatalMu.Lock()
+	defer fatalMu.Unlock()
+	fatalHooks = append(fatalHooks, fn)
+}
+
+// Fatal logs msg at error level, runs the OnFatal hooks, most recent first,
+// and exits the process
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+
+	fatalMu.Lock()
+	hooks := fatalHooks
+	fatalMu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+	os.Exit(1)
+}
+
+// WithRequestID returns a context carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithUser returns a context whose log records carry a hash of userID, so
+// requests can be correlated per user without logging the identifier itself
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userHashKey, HashUserID(userID))
+}
+
+// HashUserID returns a stable, non-reversible identifier for userID
+func HashUserID(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// contextHandler adds request-scoped attributes from the context to each record
+type contextHandler struct {
+	next slog.Handler
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if requestID := RequestIDFromContext(ctx); requestID != "" {
+			r.AddAttrs(slog.String("request_id", requestID))
+		}
+		if userHash, ok := ctx.Value(userHashKey).(string); ok {
+			r.AddAttrs(slog.String("user_id_hash", userHash))
+		}
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{next: h.next.WithGroup(name)}
+}
+
+// defaultString returns value, or fallback when value is empty
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+var (
+	jsonSecretPattern = regexp.MustCompile(`(?i)"(access_token|id_token|refresh_token|client_secret|password|api_key|passage_token)"\s*:\s*"[^"]*"`)
+	bearerPattern     = regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/-]+=*`)
+	jwtPattern        = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phonePattern      = regexp.MustCompile(`\+[1-9][0-9]{6,14}\b|\(?\b[0-9]{3}\)?[ .-][0-9]{3}[ .-][0-9]{4}\b`)
+)
+
+// sensitiveKeys are attribute key fragments whose values are always redacted
+var sensitiveKeys = []string{"token", "secret", "password", "authorization", "api_key", "apikey", "cookie"}
+
+// Redact masks emails, phone numbers, bearer tokens, JWTs and JSON secret
+// fields in s
+func Redact(s string) string {
+	s = jsonSecretPattern.ReplaceAllString(s, `"$1":"[REDACTED]"`)
+	s = bearerPattern.ReplaceAllString(s, "Bearer [REDACTED_TOKEN]")
+	s = jwtPattern.ReplaceAllString(s, "[REDACTED_TOKEN]")
+	s = emailPattern.ReplaceAllString(s, "[REDACTED_EMAIL]")
+	s = phonePattern.ReplaceAllString(s, "[REDACTED_PHONE]")
+	return s
+}
+
+// redactingHandler applies Redact to every message and attribute value
+type redactingHandler struct {
+	next slog.Handler
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return &redactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr redacts a single attribute, recursing into groups
+func redactAttr(a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, "[REDACTED]")
+	}
+
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, ga := range group {
+			redacted[i] = redactAttr(ga)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindString:
+		return slog.String(a.Key, Redact(v.String()))
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+		return slog.String(a.Key, Redact(v.String()))
+	default:
+		return slog.Attr{Key: a.Key, Value: v}
+	}
+}
+
+// isSensitiveKey reports whether an attribute key names a secret
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, fragment := range sensitiveKeys {
+		if strings.Contains(key, fragment) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes each message to a .eml file instead of sending it (for development)
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a mailer writing messages into dir
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send writes msg to <dir>/<timestamp>-<random>.eml
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = m.from
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000"), hex.EncodeToString(suffix))
+
+	if err := os.WriteFile(filepath.Join(m.dir, name), format(msg), 0o600); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package mail
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogMailer writes each message to the application log instead of sending
+// it (for development). Addresses are masked by the log redaction, the body
+// is not.
+type LogMailer struct {
+	from string
+}
+
+// NewLogMailer creates a mailer logging messages
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+// Send logs msg
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = m.from
+	}
+	slog.InfoContext(ctx, "mail message", "from", msg.From, "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
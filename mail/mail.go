@@ -0,0 +1,73 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Transport names accepted in Config.Transport
+const (
+	TransportFile = "file"
+	TransportSMTP = "smtp"
+	TransportLog  = "log"
+)
+
+// Config holds mail delivery configuration
+type Config struct {
+	Transport string // file (default), smtp or log
+	From      string // default sender address
+	Dir       string // output directory for the file transport
+	SMTPAddr  string // host:port of the SMTP server, e.g. a local capture server on localhost:1025
+}
+
+// Open creates a Mailer for the configured transport
+func Open(config Config) (Mailer, error) {
+	from := config.From
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch config.Transport {
+	case "", TransportFile:
+		dir := config.Dir
+		if dir == "" {
+			dir = "mail"
+		}
+		return NewFileMailer(dir, from)
+	case TransportSMTP:
+		if config.SMTPAddr == "" {
+			return nil, fmt.Errorf("SMTP address is required for the smtp mail transport")
+		}
+		return NewSMTPMailer(config.SMTPAddr, from), nil
+	case TransportLog:
+		return NewLogMailer(from), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport: %s", config.Transport)
+	}
+}
+
+// format renders msg as an RFC 5322 message
+func format(msg Message) []byte {
+	return []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		header(msg.From), header(msg.To), header(msg.Subject), time.Now().Format(time.RFC1123Z), msg.Body))
+}
+
+// header strips line breaks so a value can't inject extra headers
+func header(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
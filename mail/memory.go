@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// MemoryMailer keeps each message instead of sending it, for tests that
+// read what was mailed
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryMailer creates a mailer keeping messages in memory
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send keeps msg
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent to the address to, ignoring case,
+// oldest first
+func (m *MemoryMailer) Messages(to string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []Message
+	for _, msg := range m.messages {
+		if strings.EqualFold(msg.To, to) {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
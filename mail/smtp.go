@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+)
+
+// SMTPMailer sends messages through an SMTP server without authentication,
+// such as a local capture server (MailHog, Mailpit) or an internal relay
+type SMTPMailer struct {
+	addr string
+	from string
+}
+
+// NewSMTPMailer creates a mailer sending through the server at addr
+func NewSMTPMailer(addr, from string) *SMTPMailer {
+	return &SMTPMailer{addr: addr, from: from}
+}
+
+// Send delivers msg
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = m.from
+	}
+	if err := smtp.SendMail(m.addr, nil, msg.From, []string{msg.To}, format(msg)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
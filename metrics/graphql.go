@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// DefaultMaxOperationLabels bounds the operation names used as labels when
+// no allow-list names the operations
+const DefaultMaxOperationLabels = 100
+
+// otherOperation labels operations outside the bounded set of names
+const otherOperation = "other"
+
+// GraphQLExtension is a gqlgen handler extension that records per-operation
+// and per-field latency and error counts. Operation names are chosen by
+// clients, so only a bounded set of them become label values.
+type GraphQLExtension struct {
+	known map[string]bool // allow-listed names; nil labels the first names seen
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = (*GraphQLExtension)(nil)
+
+// NewGraphQLExtension creates the extension. Operations named in operations,
+// the persisted query allow-list, are labelled by name. Without an
+// allow-list the first DefaultMaxOperationLabels names seen are. Any other
+// operation is labelled "other".
+func NewGraphQLExtension(operations []string) *GraphQLExtension {
+	e := &GraphQLExtension{seen: make(map[string]bool)}
+	if len(operations) > 0 {
+		e.known = make(map[string]bool, len(operations))
+		for _, name := range operations {
+			e.known[name] = true
+		}
+	}
+	return e
+}
+
+// ExtensionName returns the extension name shown in gqlgen stats
+func (e *GraphQLExtension) ExtensionName() string {
+	return "Metrics"
+}
+
+// Validate is a no-op, the extension works with any schema
+func (e *GraphQLExtension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptResponse measures each operation response
+func (e *GraphQLExtension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	start := time.Now()
+	resp := next(ctx)
+
+	operation, opType := "unknown", "unknown"
+	if graphql.HasOperationContext(ctx) {
+		oc := graphql.GetOperationContext(ctx)
+		if oc.OperationName != "" {
+			operation = e.label(oc.OperationName)
+		} else {
+			operation = "anonymous"
+		}
+		if oc.Operation != nil {
+			opType = string(oc.Operation.Operation)
+		}
+	}
+
+	GraphQLOperationDuration.WithLabelValues(operation, opType).Observe(time.Since(start).Seconds())
+	if resp != nil && len(resp.Errors) > 0 {
+		GraphQLOperationErrors.WithLabelValues(operation, opType).Inc()
+	}
+
+	return resp
+}
+
+// InterceptField measures resolver-backed fields; trivial struct field reads are skipped
+func (e *GraphQLExtension) InterceptField(ctx context.Context, next graphql.Resolver) (any, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	start := time.Now()
+	res, err := next(ctx)
+
+	GraphQLFieldDuration.WithLabelValues(fc.Object, fc.Field.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		GraphQLFieldErrors.WithLabelValues(fc.Object, fc.Field.Name).Inc()
+	}
+
+	return res, err
+}
+
+// label returns the label value for an operation name
+func (e *GraphQLExtension) label(name string) string {
+	if e.known != nil {
+		if e.known[name] {
+			return name
+		}
+		return otherOperation
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.seen[name] {
+		if len(e.seen) >= DefaultMaxOperationLabels {
+			return otherOperation
+		}
+		e.seen[name] = true
+	}
+	return name
+}
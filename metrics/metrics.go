@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "auth0_gqlgen"
+
+// Registry is the Prometheus registry all service metrics are registered with
+var Registry = prometheus.NewRegistry()
+
+var (
+	// AuthRequests counts auth middleware outcomes by reason
+	AuthRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "requests_total",
+		Help:      "Authentication middleware outcomes by reason.",
+	}, []string{"outcome"})
+
+	// JWKSFetchDuration measures how long fetching the JWKS takes
+	JWKSFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "jwks_fetch_duration_seconds",
+		Help:      "Latency of JWKS fetches from the identity provider.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	// IntrospectionDuration measures how long token introspection requests take
+	IntrospectionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "introspection_duration_seconds",
+		Help:      "Latency of token introspection requests; cached results are not observed.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	// GraphQLOperationDuration measures GraphQL operation latency
+	GraphQLOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of GraphQL operations.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "type"})
+
+	// GraphQLOperationErrors counts GraphQL operations that returned errors
+	GraphQLOperationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "operation_errors_total",
+		Help:      "GraphQL operations that returned at least one error.",
+	}, []string{"operation", "type"})
+
+	// GraphQLFieldDuration measures resolver latency per field
+	GraphQLFieldDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "field_duration_seconds",
+		Help:      "Latency of GraphQL field resolvers.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"object", "field"})
+
+	// GraphQLFieldErrors counts resolver errors per field
+	GraphQLFieldErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "field_errors_total",
+		Help:      "GraphQL field resolvers that returned an error.",
+	}, []string{"object", "field"})
+
+	// StoreOperationDuration measures store operation latency
+	StoreOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of account store operations.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "result"})
+
+	// MigrationExchanges counts Passage to Auth0 token exchange outcomes
+	MigrationExchanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "migration",
+		Name:      "exchanges_total",
+		Help:      "Passage to Auth0 token exchange outcomes.",
+	}, []string{"outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		AuthRequests,
+		JWKSFetchDuration,
+		IntrospectionDuration,
+		GraphQLOperationDuration,
+		GraphQLOperationErrors,
+		GraphQLFieldDuration,
+		GraphQLFieldErrors,
+		StoreOperationDuration,
+		MigrationExchanges,
+	)
+}
+
+// Handler returns the HTTP handler serving the /metrics endpoint
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveStoreOperation records the latency and result of a store operation
+func ObserveStoreOperation(operation string, start time.Time, err error) {
+	StoreOperationDuration.WithLabelValues(operation, result(err)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveJWKSFetch records the latency and result of a JWKS fetch
+func ObserveJWKSFetch(start time.Time, err error) {
+	JWKSFetchDuration.WithLabelValues(result(err)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveIntrospection records the latency and result of a token introspection request
+func ObserveIntrospection(start time.Time, err error) {
+	IntrospectionDuration.WithLabelValues(result(err)).Observe(time.Since(start).Seconds())
+}
+
+// result maps an error to a result label value
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -1,12 +1,18 @@
 package migration
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
+
+	"github.com/example/auth0-gqlgen-demo/logging"
+	"github.com/example/auth0-gqlgen-demo/tracing"
 )
 
 // Auth0Issuer handles creating Auth0 users and issuing tokens
@@ -27,7 +33,7 @@ func NewAuth0Issuer(domain, clientID, clientSecret, audience, connection string)
 		clientSecret: clientSecret,
 		audience:     audience,
 		connection:   connection,
-		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		httpClient:   &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(nil)},
 	}
 }
 
@@ -47,7 +53,7 @@ type TokenResponse struct {
 }
 
 // GetManagementToken gets an Auth0 Management API token
-func (a *Auth0Issuer) GetManagementToken() (string, error) {
+func (a *Auth0Issuer) GetManagementToken(ctx context.Context) (string, error) {
 	payload := map[string]string{
 		"grant_type":    "client_credentials",
 		"client_id":     a.clientID,
@@ -55,7 +61,7 @@ func (a *Auth0Issuer) GetManagementToken() (string, error) {
 		"audience":      fmt.Sprintf("https://%s/api/v2/", a.domain),
 	}
 
-	tokenResp, err := a.requestToken(payload)
+	tokenResp, err := a.requestToken(ctx, payload)
 	if err != nil {
 		return "", fmt.Errorf("failed to get management token: %w", err)
 	}
@@ -64,22 +70,22 @@ func (a *Auth0Issuer) GetManagementToken() (string, error) {
 }
 
 // FindOrCreateUser finds or creates a user in Auth0
-func (a *Auth0Issuer) FindOrCreateUser(mgmtToken, email string, emailVerified bool) (*Auth0User, error) {
+func (a *Auth0Issuer) FindOrCreateUser(ctx context.Context, mgmtToken, email string, emailVerified bool) (*Auth0User, error) {
 	// First, try to find existing user by email
-	user, err := a.findUserByEmail(mgmtToken, email)
+	user, err := a.findUserByEmail(ctx, mgmtToken, email)
 	if err == nil && user != nil {
 		return user, nil
 	}
 
 	// User doesn't exist, create them
-	return a.createUser(mgmtToken, email, emailVerified)
+	return a.createUser(ctx, mgmtToken, email, emailVerified)
 }
 
 // findUserByEmail searches for a user by email
-func (a *Auth0Issuer) findUserByEmail(mgmtToken, email string) (*Auth0User, error) {
+func (a *Auth0Issuer) findUserByEmail(ctx context.Context, mgmtToken, email string) (*Auth0User, error) {
 	url := fmt.Sprintf("https://%s/api/v2/users-by-email?email=%s", a.domain, email)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +101,8 @@ func (a *Auth0Issuer) findUserByEmail(mgmtToken, email string) (*Auth0User, erro
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to search user: %s - %s", resp.Status, string(body))
+		logUpstreamError(ctx, "users-by-email", resp.Status, body)
+		return nil, fmt.Errorf("failed to search user: %s", resp.Status)
 	}
 
 	var users []Auth0User
@@ -111,7 +118,7 @@ func (a *Auth0Issuer) findUserByEmail(mgmtToken, email string) (*Auth0User, erro
 }
 
 // createUser creates a new user in Auth0
-func (a *Auth0Issuer) createUser(mgmtToken, email string, emailVerified bool) (*Auth0User, error) {
+func (a *Auth0Issuer) createUser(ctx context.Context, mgmtToken, email string, emailVerified bool) (*Auth0User, error) {
 	url := fmt.Sprintf("https://%s/api/v2/users", a.domain)
 
 	// Generate a random password (user won't use it - they'll use passwordless)
@@ -130,7 +137,7 @@ func (a *Auth0Issuer) createUser(mgmtToken, email string, emailVerified bool) (*
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(payloadBytes)))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(payloadBytes)))
 	if err != nil {
 		return nil, err
 	}
@@ -147,7 +154,8 @@ func (a *Auth0Issuer) createUser(mgmtToken, email string, emailVerified bool) (*
 	body, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("failed to create user: %s - %s", resp.Status, string(body))
+		logUpstreamError(ctx, "create user", resp.Status, body)
+		return nil, fmt.Errorf("failed to create user: %s", resp.Status)
 	}
 
 	var user Auth0User
@@ -158,6 +166,82 @@ func (a *Auth0Issuer) createUser(mgmtToken, email string, emailVerified bool) (*
 	return &user, nil
 }
 
+// UpdateUserEmail sets a user's email in Auth0 as verified, after the
+// service has confirmed ownership of the address itself
+func (a *Auth0Issuer) UpdateUserEmail(ctx context.Context, userID, email string) error {
+	mgmtToken, err := a.GetManagementToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("https://%s/api/v2/users/%s", a.domain, url.PathEscape(userID))
+
+	payload := map[string]interface{}{
+		"email":          email,
+		"email_verified": true,
+		"verify_email":   false, // Already verified by the confirmation code
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", endpoint, strings.NewReader(string(payloadBytes)))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+mgmtToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		logUpstreamError(ctx, "update user", resp.Status, body)
+		return fmt.Errorf("failed to update user email: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// DeleteUser permanently deletes a user from Auth0. A user that no longer
+// exists is not an error.
+func (a *Auth0Issuer) DeleteUser(ctx context.Context, userID string) error {
+	mgmtToken, err := a.GetManagementToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("https://%s/api/v2/users/%s", a.domain, url.PathEscape(userID))
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+mgmtToken)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(resp.Body)
+		logUpstreamError(ctx, "delete user", resp.Status, body)
+		return fmt.Errorf("failed to delete user: %s", resp.Status)
+	}
+
+	return nil
+}
+
 // IssueTokenForUser issues an Auth0 token for a user (using passwordless or impersonation)
 func (a *Auth0Issuer) IssueTokenForUser(userID string) (*TokenResponse, error) {
 	// For production, you might want to use Auth0's impersonation or custom grant
@@ -170,7 +254,7 @@ func (a *Auth0Issuer) IssueTokenForUser(userID string) (*TokenResponse, error) {
 }
 
 // requestToken makes a token request to Auth0
-func (a *Auth0Issuer) requestToken(payload map[string]string) (*TokenResponse, error) {
+func (a *Auth0Issuer) requestToken(ctx context.Context, payload map[string]string) (*TokenResponse, error) {
 	url := fmt.Sprintf("https://%s/oauth/token", a.domain)
 
 	payloadBytes, err := json.Marshal(payload)
@@ -178,7 +262,7 @@ func (a *Auth0Issuer) requestToken(payload map[string]string) (*TokenResponse, e
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(payloadBytes)))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(payloadBytes)))
 	if err != nil {
 		return nil, err
 	}
@@ -194,7 +278,8 @@ func (a *Auth0Issuer) requestToken(payload map[string]string) (*TokenResponse, e
 	body, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("token request failed: %s - %s", resp.Status, string(body))
+		logUpstreamError(ctx, "oauth/token", resp.Status, body)
+		return nil, fmt.Errorf("token request failed: %s", resp.Status)
 	}
 
 	var tokenResp TokenResponse
@@ -205,6 +290,16 @@ func (a *Auth0Issuer) requestToken(payload map[string]string) (*TokenResponse, e
 	return &tokenResp, nil
 }
 
+// logUpstreamError logs a failed Auth0 response. The body is kept out of
+// returned errors because it can contain user emails; it is redacted here.
+func logUpstreamError(ctx context.Context, endpoint, status string, body []byte) {
+	slog.WarnContext(ctx, "auth0 request failed",
+		"endpoint", endpoint,
+		"status", status,
+		"body", logging.Redact(string(body)),
+	)
+}
+
 // generateRandomPassword generates a secure random password
 func generateRandomPassword() string {
 	// In production, use crypto/rand for secure random generation
@@ -2,6 +2,7 @@ package migration
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"strings"
 )
@@ -70,9 +71,11 @@ func (h *Handler) HandleExchangeToken(w http.ResponseWriter, r *http.Request) {
 	// Exchange token
 	result, err := h.service.ExchangeToken(r.Context(), passageToken)
 	if err != nil {
+		// Don't echo upstream error details back to the caller
+		slog.WarnContext(r.Context(), "token exchange failed", "error", err)
 		respondJSON(w, http.StatusUnauthorized, ExchangeTokenResponse{
 			Success: false,
-			Message: err.Error(),
+			Message: "Token exchange failed",
 		})
 		return
 	}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/example/auth0-gqlgen-demo/tracing"
 	passage "github.com/passageidentity/passage-go/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PassageValidator handles validation of Passage JWTs
@@ -41,14 +44,22 @@ type MigratedPassageUser struct {
 
 // ValidateToken validates a Passage JWT and returns user information
 func (v *PassageValidator) ValidateToken(ctx context.Context, token string) (*MigratedPassageUser, error) {
+	// The Passage SDK does not accept a context or HTTP client, so its calls
+	// are wrapped in client spans here instead of using a traced transport
+	attrs := trace.WithAttributes(attribute.String("passage.app_id", v.appID))
+
 	// Authenticate the token with Passage
+	_, span := tracing.Tracer().Start(ctx, "passage.ValidateJWT", trace.WithSpanKind(trace.SpanKindClient), attrs)
 	userID, err := v.client.Auth.ValidateJWT(token)
+	tracing.EndSpan(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("invalid passage token: %w", err)
 	}
 
 	// Get user details from Passage
+	_, span = tracing.Tracer().Start(ctx, "passage.GetUser", trace.WithSpanKind(trace.SpanKindClient), attrs)
 	user, err := v.client.User.Get(userID)
+	tracing.EndSpan(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user details: %w", err)
 	}
@@ -3,8 +3,14 @@ package migration
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/events"
+	"github.com/example/auth0-gqlgen-demo/metrics"
+	"github.com/example/auth0-gqlgen-demo/tracing"
 )
 
 // TokenExchangeService handles the migration token exchange
@@ -15,6 +21,9 @@ type TokenExchangeService struct {
 	// Cache to prevent duplicate migrations and track progress
 	migrationCache map[string]*MigrationRecord
 	cacheMutex     sync.RWMutex
+
+	auditLog *audit.Logger
+	events   *events.Bus
 }
 
 // MigrationRecord tracks a user's migration status
@@ -56,14 +65,19 @@ func NewTokenExchangeService(
 }
 
 // ExchangeToken exchanges a Passage JWT for an Auth0 JWT
-func (s *TokenExchangeService) ExchangeToken(ctx context.Context, passageToken string) (*ExchangeResult, error) {
+func (s *TokenExchangeService) ExchangeToken(ctx context.Context, passageToken string) (result *ExchangeResult, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "migration.ExchangeToken")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	// Step 1: Validate the Passage token
 	migratedUser, err := s.passageValidator.ValidateToken(ctx, passageToken)
 	if err != nil {
+		s.recordExchange(ctx, "invalid_passage_token", "", "")
 		return nil, fmt.Errorf("invalid passage token: %w", err)
 	}
 
 	if migratedUser.Email == "" && migratedUser.Phone == "" {
+		s.recordExchange(ctx, "missing_identifier", migratedUser.ID, "")
 		return nil, fmt.Errorf("passage user has no email or phone")
 	}
 
@@ -81,14 +95,16 @@ func (s *TokenExchangeService) ExchangeToken(ctx context.Context, passageToken s
 	isNewMigration := !exists
 
 	// Step 3: Get Auth0 management token
-	mgmtToken, err := s.auth0Issuer.GetManagementToken()
+	mgmtToken, err := s.auth0Issuer.GetManagementToken(ctx)
 	if err != nil {
+		s.recordExchange(ctx, "management_token_error", migratedUser.ID, "")
 		return nil, fmt.Errorf("failed to get auth0 management token: %w", err)
 	}
 
 	// Step 4: Find or create user in Auth0
-	auth0User, err := s.auth0Issuer.FindOrCreateUser(mgmtToken, identifier, migratedUser.EmailVerified)
+	auth0User, err := s.auth0Issuer.FindOrCreateUser(ctx, mgmtToken, identifier, migratedUser.EmailVerified)
 	if err != nil {
+		s.recordExchange(ctx, "auth0_user_error", migratedUser.ID, "")
 		return nil, fmt.Errorf("failed to create/find auth0 user: %w", err)
 	}
 
@@ -106,6 +122,12 @@ func (s *TokenExchangeService) ExchangeToken(ctx context.Context, passageToken s
 	s.migrationCache[migratedUser.ID] = migration
 	s.cacheMutex.Unlock()
 
+	if isNewMigration {
+		s.recordExchange(ctx, "migrated", migratedUser.ID, auth0User.UserID)
+	} else {
+		s.recordExchange(ctx, "already_migrated", migratedUser.ID, auth0User.UserID)
+	}
+
 	// Step 6: For now, return a response indicating user is migrated
 	// In production, you'd implement custom token issuance via Auth0 Actions
 	return &ExchangeResult{
@@ -126,6 +148,38 @@ func (s *TokenExchangeService) GetMigrationStatus(passageUserID string) (*Migrat
 	return record, exists
 }
 
+// GetMigrationStatusByAuth0UserID returns a copy of the migration status for
+// the Auth0 user a Passage user was migrated to; the cached record keeps
+// changing as the user exchanges tokens
+func (s *TokenExchangeService) GetMigrationStatusByAuth0UserID(auth0UserID string) (*MigrationRecord, bool) {
+	s.cacheMutex.RLock()
+	defer s.cacheMutex.RUnlock()
+
+	for _, record := range s.migrationCache {
+		if record.Auth0UserID == auth0UserID {
+			rec := *record
+			return &rec, true
+		}
+	}
+	return nil, false
+}
+
+// DeleteMigrationRecordsByAuth0UserID removes every migration record for the
+// Auth0 user and returns how many were removed
+func (s *TokenExchangeService) DeleteMigrationRecordsByAuth0UserID(auth0UserID string) int {
+	s.cacheMutex.Lock()
+	defer s.cacheMutex.Unlock()
+
+	removed := 0
+	for passageUserID, record := range s.migrationCache {
+		if record.Auth0UserID == auth0UserID {
+			delete(s.migrationCache, passageUserID)
+			removed++
+		}
+	}
+	return removed
+}
+
 // GetMigrationStats returns statistics about the migration
 func (s *TokenExchangeService) GetMigrationStats() map[string]interface{} {
 	s.cacheMutex.RLock()
@@ -137,3 +191,41 @@ func (s *TokenExchangeService) GetMigrationStats() map[string]interface{} {
 	}
 }
 
+
+// SetAuditLogger enables audit events for token exchanges
+func (s *TokenExchangeService) SetAuditLogger(auditLog *audit.Logger) {
+	s.auditLog = auditLog
+}
+
+// SetEventBus enables publishing token exchanges to migrationEvents subscribers
+func (s *TokenExchangeService) SetEventBus(bus *events.Bus) {
+	s.events = bus
+}
+
+// recordExchange counts a token exchange outcome, writes it to the audit log
+// and publishes it to subscribers
+func (s *TokenExchangeService) recordExchange(ctx context.Context, outcome, passageUserID, auth0UserID string) {
+	metrics.MigrationExchanges.WithLabelValues(outcome).Inc()
+
+	result := audit.OutcomeSuccess
+	if auth0UserID == "" {
+		result = audit.OutcomeFailure
+	}
+	s.auditLog.Record(ctx, audit.Event{
+		Type:    audit.TypeMigrationExchange,
+		Actor:   passageUserID,
+		Subject: auth0UserID,
+		Outcome: result,
+		Reason:  outcome,
+	})
+
+	err := s.events.Publish(ctx, events.TopicMigration, events.MigrationEvent{
+		Time:          time.Now().UTC(),
+		Outcome:       outcome,
+		PassageUserID: passageUserID,
+		Auth0UserID:   auth0UserID,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "failed to publish migration event", "error", err)
+	}
+}
@@ -0,0 +1,295 @@
+package orgs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/auth"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/mail"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+// DefaultInvitationTTL is how long an invitation can be accepted
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+// Store is the organization storage used by the service
+type Store interface {
+	CreateOrganization(ctx context.Context, name string, auth0OrgID *string, ownerID string) (*model.Organization, error)
+	GetOrganization(ctx context.Context, orgID string) (*model.Organization, error)
+	GetMembership(ctx context.Context, orgID, userID string) (*model.Membership, error)
+	ListMemberships(ctx context.Context, orgID string) []*model.Membership
+	ListMembershipsByUser(ctx context.Context, userID string) []*model.Membership
+	SetMemberRole(ctx context.Context, orgID, userID string, role model.OrgRole) (*model.Membership, error)
+	CreateInvitation(ctx context.Context, inv model.Invitation, tokenHash string) (*model.Invitation, error)
+	GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*model.Invitation, error)
+	ListInvitations(ctx context.Context, orgID string, now time.Time) []*model.Invitation
+	AcceptInvitation(ctx context.Context, tokenHash, userID string, now time.Time) (*model.Membership, error)
+}
+
+// rank orders roles by privilege
+var rank = map[model.OrgRole]int{
+	model.OrgRoleMember: 1,
+	model.OrgRoleAdmin:  2,
+	model.OrgRoleOwner:  3,
+}
+
+// Service manages organizations, memberships and invitations and decides
+// what each member may do
+type Service struct {
+	store         Store
+	mailer        mail.Mailer
+	auditLog      *audit.Logger
+	invitationTTL time.Duration
+}
+
+// NewService creates an organization service
+func NewService(store Store, mailer mail.Mailer, auditLog *audit.Logger) *Service {
+	return &Service{
+		store:         store,
+		mailer:        mailer,
+		auditLog:      auditLog,
+		invitationTTL: DefaultInvitationTTL,
+	}
+}
+
+// Authorize returns the caller's membership of orgID if it holds at least
+// minRole. Non-members get store.ErrOrgNotFound so organization IDs can't be
+// probed. A token issued for an Auth0 organization only reaches the workspace
+// linked to it.
+func (s *Service) Authorize(ctx context.Context, user *auth.UserInfo, orgID string, minRole model.OrgRole) (*model.Membership, error) {
+	org, err := s.store.GetOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if !inTokenScope(user, org) {
+		return nil, fmt.Errorf("%w: token is scoped to another organization", auth.ErrForbidden)
+	}
+
+	membership, err := s.store.GetMembership(ctx, orgID, user.UserID)
+	if errors.Is(err, store.ErrMembershipNotFound) {
+		return nil, fmt.Errorf("%w: %s", store.ErrOrgNotFound, orgID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rank[membership.Role] < rank[minRole] {
+		return nil, fmt.Errorf("%w: %s role required", auth.ErrForbidden, roleName(minRole))
+	}
+
+	return membership, nil
+}
+
+// Create creates an organization owned by the caller
+func (s *Service) Create(ctx context.Context, user *auth.UserInfo, name string, auth0OrgID *string) (*model.Organization, error) {
+	// A token scoped to one Auth0 organization can't set up a workspace for
+	// another, and only a token issued through an Auth0 organization can link
+	// a workspace to it
+	if user.OrgID != "" && (auth0OrgID == nil || *auth0OrgID != user.OrgID) {
+		return nil, fmt.Errorf("%w: token is scoped to another organization", auth.ErrForbidden)
+	}
+	if auth0OrgID != nil && *auth0OrgID != user.OrgID {
+		return nil, fmt.Errorf("%w: token was not issued for the Auth0 organization", auth.ErrForbidden)
+	}
+
+	org, err := s.store.CreateOrganization(ctx, name, auth0OrgID, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, audit.TypeOrgCreated, user.UserID, org.ID, nil)
+
+	return org, nil
+}
+
+// Organizations returns the organizations the caller belongs to and its token may reach
+func (s *Service) Organizations(ctx context.Context, user *auth.UserInfo) ([]*model.Organization, error) {
+	orgs := []*model.Organization{}
+	for _, membership := range s.store.ListMembershipsByUser(ctx, user.UserID) {
+		org, err := s.store.GetOrganization(ctx, membership.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		if inTokenScope(user, org) {
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs, nil
+}
+
+// Invite mails an invitation to join orgID with role. Admins may invite
+// members and admins; only owners may invite owners.
+func (s *Service) Invite(ctx context.Context, user *auth.UserInfo, orgID, email string, role model.OrgRole) (*model.Invitation, error) {
+	minRole := model.OrgRoleAdmin
+	if role == model.OrgRoleOwner {
+		minRole = model.OrgRoleOwner
+	}
+	if _, err := s.Authorize(ctx, user, orgID, minRole); err != nil {
+		return nil, err
+	}
+
+	org, err := s.store.GetOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.invitationTTL)
+	inv, err := s.store.CreateInvitation(ctx, model.Invitation{
+		OrgID:         orgID,
+		Email:         email,
+		Role:          role,
+		InvitedBy:     user.UserID,
+		ExpiresAt:     expiresAt.Format(time.RFC3339),
+		ExpiresAtTime: expiresAt,
+	}, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: fmt.Sprintf("You're invited to join %s", org.Name),
+		Body: fmt.Sprintf("You have been invited to join %s as %s.\n\nYour invitation code is:\n\n%s\n\nIt expires on %s. If you weren't expecting this invitation, you can ignore this message.",
+			org.Name, roleName(role), token, expiresAt.UTC().Format("January 2, 2006")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send invitation: %w", err)
+	}
+
+	s.record(ctx, audit.TypeOrgMemberInvited, user.UserID, orgID, map[string]string{"invitation_id": inv.ID, "role": roleName(role)})
+
+	return inv, nil
+}
+
+// Accept adds the caller to the organization of the invitation token.
+// Holding the mailed token is what proves the invitation was meant for the caller.
+func (s *Service) Accept(ctx context.Context, user *auth.UserInfo, token string) (*model.Membership, error) {
+	tokenHash := hashToken(token)
+
+	inv, err := s.store.GetInvitationByTokenHash(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	org, err := s.store.GetOrganization(ctx, inv.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	if !inTokenScope(user, org) {
+		return nil, fmt.Errorf("%w: token is scoped to another organization", auth.ErrForbidden)
+	}
+
+	membership, err := s.store.AcceptInvitation(ctx, tokenHash, user.UserID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, audit.TypeOrgMemberJoined, user.UserID, membership.OrgID, map[string]string{"invitation_id": inv.ID, "role": roleName(membership.Role)})
+
+	return membership, nil
+}
+
+// ChangeRole sets a member's role. Admins may move members between member
+// and admin; granting or revoking the owner role requires an owner.
+func (s *Service) ChangeRole(ctx context.Context, user *auth.UserInfo, orgID, userID string, role model.OrgRole) (*model.Membership, error) {
+	actor, err := s.Authorize(ctx, user, orgID, model.OrgRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.store.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if (target.Role == model.OrgRoleOwner || role == model.OrgRoleOwner) && actor.Role != model.OrgRoleOwner {
+		return nil, fmt.Errorf("%w: owner role required", auth.ErrForbidden)
+	}
+
+	membership, err := s.store.SetMemberRole(ctx, orgID, userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, audit.TypeOrgRoleChanged, user.UserID, orgID, map[string]string{
+		"member": userID,
+		"from":   roleName(target.Role),
+		"to":     roleName(role),
+	})
+
+	return membership, nil
+}
+
+// Members returns the members of orgID; any member may list them
+func (s *Service) Members(ctx context.Context, user *auth.UserInfo, orgID string) ([]*model.Membership, error) {
+	if _, err := s.Authorize(ctx, user, orgID, model.OrgRoleMember); err != nil {
+		return nil, err
+	}
+	return s.store.ListMemberships(ctx, orgID), nil
+}
+
+// Invitations returns the pending invitations of orgID to its admins and owners
+func (s *Service) Invitations(ctx context.Context, user *auth.UserInfo, orgID string) ([]*model.Invitation, error) {
+	if _, err := s.Authorize(ctx, user, orgID, model.OrgRoleAdmin); err != nil {
+		return nil, err
+	}
+	return s.store.ListInvitations(ctx, orgID, time.Now()), nil
+}
+
+// record writes an organization audit event
+func (s *Service) record(ctx context.Context, eventType, actor, orgID string, metadata map[string]string) {
+	s.auditLog.Record(ctx, audit.Event{
+		Type:     eventType,
+		Actor:    actor,
+		Subject:  orgID,
+		Outcome:  audit.OutcomeSuccess,
+		Metadata: metadata,
+	})
+}
+
+// inTokenScope reports whether the caller's token may reach org. Tokens
+// without an org_id claim reach every organization the user belongs to.
+func inTokenScope(user *auth.UserInfo, org *model.Organization) bool {
+	if user.OrgID == "" {
+		return true
+	}
+	return org.Auth0OrgID != nil && *org.Auth0OrgID == user.OrgID
+}
+
+// roleName returns the lowercase name of role, e.g. "admin"
+func roleName(role model.OrgRole) string {
+	switch role {
+	case model.OrgRoleOwner:
+		return "owner"
+	case model.OrgRoleAdmin:
+		return "admin"
+	default:
+		return "member"
+	}
+}
+
+// generateToken returns a random URL-safe invitation token
+func generateToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hash under which an invitation token is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,222 @@
+package privacy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+// ExportPath is the path export links are served on
+const ExportPath = "/export"
+
+// maxExportedAuditEvents bounds each audit query made for an export
+const maxExportedAuditEvents = 1000
+
+// Errors returned when verifying an export token
+var (
+	ErrInvalidExportToken = errors.New("invalid export token")
+	ErrExportTokenExpired = errors.New("export token expired")
+)
+
+// Bundle is the data exported for a user
+type Bundle struct {
+	ExportedAt  time.Time          `json:"exportedAt"`
+	UserID      string             `json:"userId"`
+	Account     *model.Account     `json:"account"`
+	Migration   *MigrationExport   `json:"migration"`
+	Memberships []MembershipExport `json:"memberships"`
+	AuditEvents []audit.Event      `json:"auditEvents"`
+}
+
+// MigrationExport is the exported form of a Passage migration record
+type MigrationExport struct {
+	PassageUserID string    `json:"passageUserId"`
+	Email         string    `json:"email"`
+	MigratedAt    time.Time `json:"migratedAt"`
+	LastExchange  time.Time `json:"lastExchange"`
+}
+
+// MembershipExport is the exported form of an organization membership
+type MembershipExport struct {
+	OrganizationID string        `json:"organizationId"`
+	Role           model.OrgRole `json:"role"`
+	JoinedAt       string        `json:"joinedAt"`
+}
+
+// ExportURL returns a signed link to download the data of userID, valid
+// until the returned time
+func (s *Service) ExportURL(ctx context.Context, userID string) (string, time.Time) {
+	expiresAt := time.Now().Add(s.config.ExportTTL).Truncate(time.Second)
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(expiresAt.Unix(), 10) + ":" + userID))
+	token := payload + "." + s.sign(payload)
+
+	s.auditLog.Record(ctx, audit.Event{
+		Type:    audit.TypeDataExport,
+		Actor:   userID,
+		Subject: userID,
+		Outcome: audit.OutcomeSuccess,
+		Reason:  "link_issued",
+	})
+
+	return strings.TrimRight(s.config.PublicURL, "/") + ExportPath + "?token=" + url.QueryEscape(token), expiresAt
+}
+
+// verifyExportToken returns the user ID an export token was issued for
+func (s *Service) verifyExportToken(token string) (string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return "", ErrInvalidExportToken
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidExportToken
+	}
+	expiry, userID, ok := strings.Cut(string(decoded), ":")
+	if !ok || userID == "" {
+		return "", ErrInvalidExportToken
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", ErrInvalidExportToken
+	}
+	if time.Now().Unix() > expiresAt {
+		return "", ErrExportTokenExpired
+	}
+
+	return userID, nil
+}
+
+// sign returns the base64url HMAC-SHA256 of payload
+func (s *Service) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.config.SigningKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Export collects the account, migration record, organization memberships
+// and audit entries of userID
+func (s *Service) Export(ctx context.Context, userID string) (*Bundle, error) {
+	bundle := &Bundle{
+		ExportedAt:  time.Now().UTC(),
+		UserID:      userID,
+		Memberships: []MembershipExport{},
+		AuditEvents: []audit.Event{},
+	}
+
+	account, err := s.store.GetAccountByUserID(ctx, userID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	bundle.Account = account
+
+	if migrations := s.migrationRecords(); migrations != nil {
+		if record, ok := migrations.GetMigrationStatusByAuth0UserID(userID); ok {
+			bundle.Migration = &MigrationExport{
+				PassageUserID: record.PassageUserID,
+				Email:         record.Email,
+				MigratedAt:    record.MigratedAt,
+				LastExchange:  record.LastExchange,
+			}
+		}
+	}
+
+	for _, membership := range s.store.ListMembershipsByUser(ctx, userID) {
+		bundle.Memberships = append(bundle.Memberships, MembershipExport{
+			OrganizationID: membership.OrgID,
+			Role:           membership.Role,
+			JoinedAt:       membership.JoinedAt,
+		})
+	}
+
+	// Events name the user either as the actor or, for account events, via
+	// the account ID as the subject
+	filters := []audit.Filter{
+		{Actor: userID, Limit: maxExportedAuditEvents},
+		{Subject: userID, Limit: maxExportedAuditEvents},
+	}
+	if account != nil {
+		filters = append(filters, audit.Filter{Subject: account.ID, Limit: maxExportedAuditEvents})
+	}
+
+	seen := make(map[string]bool)
+	for _, filter := range filters {
+		events, err := s.auditLog.Query(ctx, filter)
+		if errors.Is(err, audit.ErrNotQueryable) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query audit log: %w", err)
+		}
+		for _, event := range events {
+			if !seen[event.ID] {
+				seen[event.ID] = true
+				bundle.AuditEvents = append(bundle.AuditEvents, event)
+			}
+		}
+	}
+	sort.Slice(bundle.AuditEvents, func(i, j int) bool {
+		return bundle.AuditEvents[i].Time.After(bundle.AuditEvents[j].Time)
+	})
+
+	return bundle, nil
+}
+
+// ExportHandler serves the bundles behind links created by ExportURL. The
+// signed token in the link is the only credential.
+func (s *Service) ExportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := s.verifyExportToken(r.URL.Query().Get("token"))
+		if errors.Is(err, ErrExportTokenExpired) {
+			http.Error(w, "Export link expired", http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Invalid export link", http.StatusForbidden)
+			return
+		}
+
+		bundle, err := s.Export(r.Context(), userID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "data export failed", "error", err)
+			http.Error(w, "Export failed", http.StatusInternalServerError)
+			return
+		}
+
+		s.auditLog.Record(r.Context(), audit.Event{
+			Type:    audit.TypeDataExport,
+			Actor:   userID,
+			Subject: userID,
+			Outcome: audit.OutcomeSuccess,
+			Reason:  "downloaded",
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="account-export.json"`)
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(bundle)
+	})
+}
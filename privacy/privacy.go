@@ -0,0 +1,143 @@
+package privacy
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/migration"
+)
+
+// Defaults for Config
+const (
+	DefaultGracePeriod   = 30 * 24 * time.Hour
+	DefaultPurgeInterval = time.Hour
+	DefaultExportTTL     = 15 * time.Minute
+)
+
+// AccountStore is the account storage used for deletion and export
+type AccountStore interface {
+	GetAccountByUserID(ctx context.Context, userID string) (*model.Account, error)
+	ScheduleDeletion(ctx context.Context, userID string, purgeAt time.Time) (*model.Account, error)
+	CancelDeletion(ctx context.Context, userID string) (*model.Account, error)
+	ListDueForPurge(ctx context.Context, now time.Time) []*model.Account
+	DeleteAccount(ctx context.Context, userID string) error
+	ListMembershipsByUser(ctx context.Context, userID string) []*model.Membership
+	DeleteMembershipsByUser(ctx context.Context, userID string) int
+}
+
+// IdentityProvider deletes users held by the identity provider
+type IdentityProvider interface {
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+// MigrationRecords looks up and removes Passage migration records
+type MigrationRecords interface {
+	GetMigrationStatusByAuth0UserID(auth0UserID string) (*migration.MigrationRecord, bool)
+	DeleteMigrationRecordsByAuth0UserID(auth0UserID string) int
+}
+
+// Config holds account deletion and data export settings
+type Config struct {
+	GracePeriod   time.Duration // time between a deletion request and the purge
+	PurgeInterval time.Duration // how often Run looks for accounts to purge
+	ExportTTL     time.Duration // lifetime of signed export URLs
+	SigningKey    []byte        // HMAC key for export URLs; random when empty
+	PublicURL     string        // base URL export links are built on, e.g. https://api.example.com
+}
+
+// Service handles account deletion requests, purges accounts once their
+// grace period has passed and serves data exports
+type Service struct {
+	store    AccountStore
+	idp      IdentityProvider
+	auditLog *audit.Logger
+	config   Config
+
+	mu         sync.RWMutex
+	migrations MigrationRecords
+}
+
+// NewService creates a privacy service. idp may be nil, in which case only
+// local data is purged.
+func NewService(store AccountStore, idp IdentityProvider, auditLog *audit.Logger, config Config) (*Service, error) {
+	if config.GracePeriod <= 0 {
+		config.GracePeriod = DefaultGracePeriod
+	}
+	if config.PurgeInterval <= 0 {
+		config.PurgeInterval = DefaultPurgeInterval
+	}
+	if config.ExportTTL <= 0 {
+		config.ExportTTL = DefaultExportTTL
+	}
+	if len(config.SigningKey) == 0 {
+		// Export links then stop working on restart, which is acceptable for short-lived URLs
+		config.SigningKey = make([]byte, 32)
+		if _, err := rand.Read(config.SigningKey); err != nil {
+			return nil, fmt.Errorf("failed to generate export signing key: %w", err)
+		}
+	}
+
+	return &Service{
+		store:    store,
+		idp:      idp,
+		auditLog: auditLog,
+		config:   config,
+	}, nil
+}
+
+// SetMigrations enables export and purge of Passage migration records
+func (s *Service) SetMigrations(migrations MigrationRecords) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.migrations = migrations
+}
+
+// migrationRecords returns the configured migration records, or nil
+func (s *Service) migrationRecords() MigrationRecords {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.migrations
+}
+
+// ScheduleDeletion schedules the account for userID to be purged after the
+// grace period. Until then the deletion can be cancelled.
+func (s *Service) ScheduleDeletion(ctx context.Context, userID string) (*model.Account, error) {
+	account, err := s.store.ScheduleDeletion(ctx, userID, time.Now().Add(s.config.GracePeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, audit.Event{
+		Type:     audit.TypeAccountDeletion,
+		Actor:    userID,
+		Subject:  account.ID,
+		Outcome:  audit.OutcomeSuccess,
+		Reason:   "requested",
+		Metadata: map[string]string{"purge_at": account.DeletionScheduledAt.UTC().Format(time.RFC3339)},
+	})
+
+	return account, nil
+}
+
+// CancelDeletion cancels a scheduled deletion of the account for userID
+func (s *Service) CancelDeletion(ctx context.Context, userID string) (*model.Account, error) {
+	account, err := s.store.CancelDeletion(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, audit.Event{
+		Type:    audit.TypeAccountDeletion,
+		Actor:   userID,
+		Subject: account.ID,
+		Outcome: audit.OutcomeSuccess,
+		Reason:  "cancelled",
+	})
+
+	return account, nil
+}
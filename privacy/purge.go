@@ -0,0 +1,89 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+// Run purges due accounts every PurgeInterval until ctx is cancelled
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := s.PurgeDue(ctx); err != nil {
+			slog.ErrorContext(ctx, "account purge incomplete", "purged", purged, "error", err)
+		} else if purged > 0 {
+			slog.InfoContext(ctx, "purged deleted accounts", "purged", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDue permanently deletes every account whose grace period has passed.
+// Accounts that fail to purge are left in place and retried on the next run.
+func (s *Service) PurgeDue(ctx context.Context) (purged int, err error) {
+	var errs []error
+	for _, account := range s.store.ListDueForPurge(ctx, time.Now()) {
+		if err := s.purge(ctx, account); err != nil {
+			errs = append(errs, fmt.Errorf("account %s: %w", account.ID, err))
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+// purge deletes the identity provider user first so a failure there leaves
+// the local account scheduled and the purge is retried
+func (s *Service) purge(ctx context.Context, account *model.Account) error {
+	if s.idp != nil {
+		if err := s.idp.DeleteUser(ctx, account.UserID); err != nil {
+			s.recordPurge(ctx, account, audit.OutcomeFailure, "identity_provider", nil)
+			return fmt.Errorf("failed to delete identity provider user: %w", err)
+		}
+	}
+
+	removed := 0
+	if migrations := s.migrationRecords(); migrations != nil {
+		removed = migrations.DeleteMigrationRecordsByAuth0UserID(account.UserID)
+	}
+
+	memberships := s.store.DeleteMembershipsByUser(ctx, account.UserID)
+
+	if err := s.store.DeleteAccount(ctx, account.UserID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		s.recordPurge(ctx, account, audit.OutcomeFailure, "store", nil)
+		return err
+	}
+
+	s.recordPurge(ctx, account, audit.OutcomeSuccess, "", map[string]string{
+		"migration_records": strconv.Itoa(removed),
+		"memberships":       strconv.Itoa(memberships),
+	})
+	return nil
+}
+
+// recordPurge writes an account.purged audit event. Only the account ID is
+// kept so the event holds no personal data once the account is gone.
+func (s *Service) recordPurge(ctx context.Context, account *model.Account, outcome, reason string, metadata map[string]string) {
+	s.auditLog.Record(ctx, audit.Event{
+		Type:     audit.TypeAccountPurged,
+		Subject:  account.ID,
+		Outcome:  outcome,
+		Reason:   reason,
+		Metadata: metadata,
+	})
+}
@@ -0,0 +1,63 @@
+package revocation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+)
+
+// Backend names accepted in Config.Backend
+const (
+	BackendMemory = "memory"
+	BackendSQL    = "sql"
+)
+
+// Defaults for Config
+const (
+	DefaultRetention       = 24 * time.Hour
+	DefaultRefreshInterval = 30 * time.Second
+)
+
+// Config holds token revocation configuration
+type Config struct {
+	Backend     string        // memory (default) or sql
+	DatabaseURL string        // PostgreSQL connection string for the sql backend
+	Table       string        // table for the sql backend (default token_revocations)
+	Retention   time.Duration // longest access token lifetime (default 24h)
+}
+
+// Open creates the denylist selected by config and loads the stored entries
+func Open(ctx context.Context, config Config) (*List, error) {
+	if config.Retention <= 0 {
+		config.Retention = DefaultRetention
+	}
+
+	switch config.Backend {
+	case "", BackendMemory:
+		return NewList(nil, config.Retention), nil
+	case BackendSQL:
+		if config.DatabaseURL == "" {
+			return nil, fmt.Errorf("database URL is required for the sql revocation backend")
+		}
+		db, err := sql.Open("pgx", config.DatabaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open revocation database: %w", err)
+		}
+		backend, err := NewSQLBackend(ctx, db, config.Table)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		list := NewList(backend, config.Retention)
+		if err := list.Refresh(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("unknown revocation backend: %s", config.Backend)
+	}
+}
@@ -0,0 +1,234 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Entry kinds
+const (
+	KindToken   = "token"   // a single token, keyed by its jti claim
+	KindSubject = "subject" // every token of a subject issued before a time
+)
+
+// ErrInvalidEntry is returned when an entry has no key
+var ErrInvalidEntry = errors.New("invalid revocation")
+
+// Entry is a revoked token or subject
+type Entry struct {
+	Kind         string
+	Key          string    // jti for tokens, sub for subjects
+	IssuedBefore time.Time // subjects only: tokens issued before this are revoked
+	ExpiresAt    time.Time // when every token the entry covers has expired
+	Reason       string
+	CreatedAt    time.Time
+}
+
+// Backend persists entries so they survive restarts and are shared between
+// instances
+type Backend interface {
+	// Save stores entry. A subject revoked again keeps the later IssuedBefore
+	// and ExpiresAt.
+	Save(ctx context.Context, entry Entry) error
+	// Load returns the entries that haven't expired at now
+	Load(ctx context.Context, now time.Time) ([]Entry, error)
+	// Prune deletes the entries that expired at now
+	Prune(ctx context.Context, now time.Time) error
+}
+
+// SubjectRevoker revokes a subject's tokens held elsewhere, such as refresh
+// tokens, which outlive the list's entries
+type SubjectRevoker interface {
+	RevokeSubject(ctx context.Context, subject string, issuedBefore time.Time) error
+}
+
+// List is the denylist consulted when authenticating requests. Lookups are
+// served from memory; with a Backend, revocations are also written to it and
+// Refresh picks up those made by other instances.
+type List struct {
+	backend   Backend // nil keeps entries in memory only
+	retention time.Duration
+
+	mu       sync.RWMutex
+	tokens   map[string]time.Time // jti to expiry
+	subjects map[string]Entry     // sub to its latest revocation
+	revokers []SubjectRevoker
+}
+
+// NewList creates a denylist. Entries are kept for retention, which must be
+// at least the lifetime of the access tokens being revoked, unless a token's
+// own expiry is given.
+func NewList(backend Backend, retention time.Duration) *List {
+	return &List{
+		backend:   backend,
+		retention: retention,
+		tokens:    make(map[string]time.Time),
+		subjects:  make(map[string]Entry),
+	}
+}
+
+// RevokeToken revokes the token whose jti claim is tokenID. expiresAt is the
+// token's exp; when zero the entry is kept for the retention period.
+func (l *List) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time, reason string) (*Entry, error) {
+	now := time.Now()
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(l.retention)
+	}
+	return l.revoke(ctx, Entry{
+		Kind:      KindToken,
+		Key:       tokenID,
+		ExpiresAt: expiresAt,
+		Reason:    reason,
+		CreatedAt: now,
+	})
+}
+
+// AddRevoker has RevokeSubject also revoke the subject through r
+func (l *List) AddRevoker(r SubjectRevoker) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.revokers = append(l.revokers, r)
+}
+
+// RevokeSubject revokes every token of subject issued before issuedBefore,
+// such as all tokens of a user deleted at that time, including those held
+// by the revokers added with AddRevoker
+func (l *List) RevokeSubject(ctx context.Context, subject string, issuedBefore time.Time, reason string) (*Entry, error) {
+	entry, err := l.revoke(ctx, Entry{
+		Kind:         KindSubject,
+		Key:          subject,
+		IssuedBefore: issuedBefore,
+		ExpiresAt:    issuedBefore.Add(l.retention),
+		Reason:       reason,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	revokers := l.revokers
+	l.mu.RUnlock()
+	for _, r := range revokers {
+		if err := r.RevokeSubject(ctx, subject, issuedBefore); err != nil {
+			return nil, fmt.Errorf("failed to revoke subject: %w", err)
+		}
+	}
+	return entry, nil
+}
+
+// revoke persists entry, then adds it to the in-memory index
+func (l *List) revoke(ctx context.Context, entry Entry) (*Entry, error) {
+	if entry.Key == "" {
+		return nil, fmt.Errorf("%w: %s key is empty", ErrInvalidEntry, entry.Kind)
+	}
+	if l.backend != nil {
+		if err := l.backend.Save(ctx, entry); err != nil {
+			return nil, fmt.Errorf("failed to save revocation: %w", err)
+		}
+	}
+
+	l.mu.Lock()
+	l.add(entry)
+	l.mu.Unlock()
+
+	slog.InfoContext(ctx, "token revocation added", "kind", entry.Kind, "reason", entry.Reason)
+	return &entry, nil
+}
+
+// add indexes entry; callers hold mu
+func (l *List) add(entry Entry) {
+	switch entry.Kind {
+	case KindToken:
+		if entry.ExpiresAt.After(l.tokens[entry.Key]) {
+			l.tokens[entry.Key] = entry.ExpiresAt
+		}
+	case KindSubject:
+		if current, ok := l.subjects[entry.Key]; !ok || entry.IssuedBefore.After(current.IssuedBefore) {
+			l.subjects[entry.Key] = entry
+		}
+	}
+}
+
+// IsRevoked reports whether the token identified by tokenID (jti), subject
+// (sub) and issuedAt (iat) is revoked. A token without iat counts as issued
+// before any subject revocation. It is safe to call on a nil *List, which
+// revokes nothing.
+func (l *List) IsRevoked(tokenID, subject string, issuedAt time.Time) bool {
+	if l == nil {
+		return false
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if tokenID != "" {
+		if _, ok := l.tokens[tokenID]; ok {
+			return true
+		}
+	}
+	if entry, ok := l.subjects[subject]; ok && issuedAt.Before(entry.IssuedBefore) {
+		return true
+	}
+	return false
+}
+
+// Refresh drops expired entries and, with a Backend, reloads the entries of
+// every instance from it
+func (l *List) Refresh(ctx context.Context) error {
+	now := time.Now()
+	if l.backend == nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for key, expiresAt := range l.tokens {
+			if !expiresAt.After(now) {
+				delete(l.tokens, key)
+			}
+		}
+		for key, entry := range l.subjects {
+			if !entry.ExpiresAt.After(now) {
+				delete(l.subjects, key)
+			}
+		}
+		return nil
+	}
+
+	if err := l.backend.Prune(ctx, now); err != nil {
+		return fmt.Errorf("failed to prune revocations: %w", err)
+	}
+	entries, err := l.backend.Load(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to load revocations: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = make(map[string]time.Time, len(entries))
+	l.subjects = make(map[string]Entry)
+	for _, entry := range entries {
+		l.add(entry)
+	}
+	return nil
+}
+
+// Run calls Refresh every interval until ctx is cancelled
+func (l *List) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := l.Refresh(ctx); err != nil {
+			slog.ErrorContext(ctx, "revocation refresh failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package revocation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLBackend stores entries in a SQL table. Queries use PostgreSQL
+// placeholder syntax.
+type SQLBackend struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLBackend creates a backend storing entries in table, creating it if
+// needed
+func NewSQLBackend(ctx context.Context, db *sql.DB, table string) (*SQLBackend, error) {
+	if table == "" {
+		table = "token_revocations"
+	}
+	b := &SQLBackend{db: db, table: table}
+
+	schema := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		kind          TEXT NOT NULL,
+		key           TEXT NOT NULL,
+		issued_before TIMESTAMPTZ,
+		expires_at    TIMESTAMPTZ NOT NULL,
+		reason        TEXT NOT NULL DEFAULT '',
+		created_at    TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (kind, key)
+	)`, table)
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("failed to create revocation table: %w", err)
+	}
+
+	return b, nil
+}
+
+// Save inserts entry, keeping the later cutoff and expiry of a subject
+// revoked again
+func (b *SQLBackend) Save(ctx context.Context, entry Entry) error {
+	var issuedBefore sql.NullTime
+	if entry.Kind == KindSubject {
+		issuedBefore = sql.NullTime{Time: entry.IssuedBefore, Valid: true}
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %[1]s (kind, key, issued_before, expires_at, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (kind, key) DO UPDATE SET
+			issued_before = GREATEST(%[1]s.issued_before, EXCLUDED.issued_before),
+			expires_at = GREATEST(%[1]s.expires_at, EXCLUDED.expires_at),
+			reason = EXCLUDED.reason,
+			created_at = EXCLUDED.created_at`, b.table)
+	_, err := b.db.ExecContext(ctx, query,
+		entry.Kind, entry.Key, issuedBefore, entry.ExpiresAt, entry.Reason, entry.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert revocation: %w", err)
+	}
+	return nil
+}
+
+// Load returns the entries that haven't expired at now
+func (b *SQLBackend) Load(ctx context.Context, now time.Time) ([]Entry, error) {
+	query := fmt.Sprintf(`SELECT kind, key, issued_before, expires_at, reason, created_at
+		FROM %s WHERE expires_at > $1`, b.table)
+	rows, err := b.db.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revocations: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		var issuedBefore sql.NullTime
+		if err := rows.Scan(&entry.Kind, &entry.Key, &issuedBefore, &entry.ExpiresAt, &entry.Reason, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan revocation: %w", err)
+		}
+		entry.IssuedBefore = issuedBefore.Time
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Prune deletes the entries that expired at now
+func (b *SQLBackend) Prune(ctx context.Context, now time.Time) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE expires_at <= $1`, b.table)
+	if _, err := b.db.ExecContext(ctx, query, now); err != nil {
+		return fmt.Errorf("failed to prune revocations: %w", err)
+	}
+	return nil
+}
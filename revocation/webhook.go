@@ -0,0 +1,173 @@
+package revocation
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+)
+
+// WebhookPath is where the Auth0 log stream webhook is served
+const WebhookPath = "/webhooks/auth0/log-stream"
+
+// maxWebhookBody bounds a log stream batch
+const maxWebhookBody = 5 << 20
+
+// webhookActor is the audit actor of revocations made from the log stream
+const webhookActor = "auth0-log-stream"
+
+// Auth0 log event types that revoke a user's tokens
+const (
+	logTypeUserDeleted     = "sdu"  // Successful User Deletion
+	logTypePasswordChanged = "scp"  // Successful Change Password
+	logTypeManagementAPI   = "sapi" // Successful Management API operation, checked for user blocks
+)
+
+// logEvent is an entry of an Auth0 custom webhook log stream batch
+type logEvent struct {
+	LogID string `json:"log_id"`
+	Data  struct {
+		Type    string    `json:"type"`
+		Date    time.Time `json:"date"`
+		UserID  string    `json:"user_id"`
+		Details struct {
+			Request struct {
+				Method string `json:"method"`
+				Path   string `json:"path"`
+				Body   struct {
+					Blocked *bool `json:"blocked"`
+				} `json:"body"`
+			} `json:"request"`
+		} `json:"details"`
+	} `json:"data"`
+}
+
+// LogStreamHandler receives an Auth0 custom webhook log stream and revokes
+// the tokens of users who are deleted, change their password or are blocked.
+// Auth0 must send token as its Authorization header. Batches are accepted in
+// the JSON array, JSON lines and JSON object formats.
+func (l *List) LogStreamHandler(token string, auditLog *audit.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !webhookAuthorized(r, token) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+		if err != nil {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		batch, err := decodeLogEvents(body)
+		if err != nil {
+			http.Error(w, "Invalid log stream batch", http.StatusBadRequest)
+			return
+		}
+
+		// Fail the whole batch so Auth0 retries it; revoking twice is harmless
+		if err := l.applyLogEvents(r.Context(), batch, auditLog); err != nil {
+			slog.ErrorContext(r.Context(), "log stream revocation failed", "error", err)
+			http.Error(w, "Revocation failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// applyLogEvents revokes the subjects of the events in batch that call for it
+func (l *List) applyLogEvents(ctx context.Context, batch []logEvent, auditLog *audit.Logger) error {
+	for _, event := range batch {
+		subject, reason := revokedSubject(event)
+		if subject == "" {
+			continue
+		}
+		issuedBefore := event.Data.Date
+		if issuedBefore.IsZero() {
+			issuedBefore = time.Now()
+		}
+
+		entry, err := l.RevokeSubject(ctx, subject, issuedBefore, reason)
+		if err != nil {
+			return err
+		}
+		auditLog.Record(ctx, audit.Event{
+			Type:     audit.TypeTokenRevoked,
+			Actor:    webhookActor,
+			Subject:  entry.Key,
+			Outcome:  audit.OutcomeSuccess,
+			Reason:   reason,
+			Metadata: map[string]string{"kind": entry.Kind, "log_id": event.LogID},
+		})
+	}
+	return nil
+}
+
+// revokedSubject returns the user whose tokens event revokes and why, or ""
+func revokedSubject(event logEvent) (subject, reason string) {
+	switch event.Data.Type {
+	case logTypeUserDeleted:
+		return event.Data.UserID, "user_deleted"
+	case logTypePasswordChanged:
+		return event.Data.UserID, "password_changed"
+	case logTypeManagementAPI:
+		request := event.Data.Details.Request
+		if !strings.EqualFold(request.Method, http.MethodPatch) || request.Body.Blocked == nil || !*request.Body.Blocked {
+			return "", ""
+		}
+		userID, ok := strings.CutPrefix(request.Path, "/api/v2/users/")
+		if !ok || userID == "" || strings.Contains(userID, "/") {
+			return "", ""
+		}
+		if unescaped, err := url.PathUnescape(userID); err == nil {
+			userID = unescaped
+		}
+		return userID, "user_blocked"
+	default:
+		return "", ""
+	}
+}
+
+// decodeLogEvents parses a batch in any of the log stream content formats
+func decodeLogEvents(body []byte) ([]logEvent, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []logEvent
+		err := json.Unmarshal(body, &batch)
+		return batch, err
+	}
+
+	var batch []logEvent
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var event logEvent
+		if err := dec.Decode(&event); errors.Is(err, io.EOF) {
+			return batch, nil
+		} else if err != nil {
+			return nil, err
+		}
+		batch = append(batch, event)
+	}
+}
+
+// webhookAuthorized reports whether r carries token as its Authorization
+// header, with or without the Bearer scheme
+func webhookAuthorized(r *http.Request, token string) bool {
+	got := r.Header.Get("Authorization")
+	if scheme, rest, ok := strings.Cut(got, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		got = strings.TrimSpace(rest)
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
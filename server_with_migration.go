@@ -1,24 +1,65 @@
 package main
 
 import (
-	"log"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/example/auth0-gqlgen-demo/audit"
 	"github.com/example/auth0-gqlgen-demo/auth"
+	"github.com/example/auth0-gqlgen-demo/challenge"
+	"github.com/example/auth0-gqlgen-demo/emailchange"
+	"github.com/example/auth0-gqlgen-demo/emailotp"
+	"github.com/example/auth0-gqlgen-demo/events"
 	"github.com/example/auth0-gqlgen-demo/graph"
+	"github.com/example/auth0-gqlgen-demo/issuer"
+	"github.com/example/auth0-gqlgen-demo/limits"
+	"github.com/example/auth0-gqlgen-demo/logging"
+	"github.com/example/auth0-gqlgen-demo/mail"
+	"github.com/example/auth0-gqlgen-demo/metrics"
 	"github.com/example/auth0-gqlgen-demo/migration"
+	"github.com/example/auth0-gqlgen-demo/orgs"
+	"github.com/example/auth0-gqlgen-demo/privacy"
+	"github.com/example/auth0-gqlgen-demo/revocation"
 	"github.com/example/auth0-gqlgen-demo/store"
+	"github.com/example/auth0-gqlgen-demo/tracing"
+	"github.com/example/auth0-gqlgen-demo/webauthn"
+	"github.com/vektah/gqlparser/v2/ast"
 )
 
 func main() {
+	// Logging configuration (LOG_LEVEL: debug, info, warn, error; LOG_FORMAT: json, text)
+	if _, err := logging.Setup(logging.Config{
+		Level:  os.Getenv("LOG_LEVEL"),
+		Format: os.Getenv("LOG_FORMAT"),
+	}); err != nil {
+		slog.Error("Failed to initialize logging", "error", err)
+		os.Exit(1)
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
 	// Auth0 Configuration
 	auth0Domain := os.Getenv("AUTH0_DOMAIN")
 	auth0Audience := os.Getenv("AUTH0_AUDIENCE")
 	if auth0Domain == "" || auth0Audience == "" {
-		log.Fatal("AUTH0_DOMAIN and AUTH0_AUDIENCE environment variables are required")
+		logging.Fatal("AUTH0_DOMAIN and AUTH0_AUDIENCE environment variables are required")
 	}
 
 	// Passage Configuration (for migration)
@@ -33,26 +74,410 @@ func main() {
 		auth0Connection = "Username-Password-Authentication"
 	}
 
-	// Initialize storage
-	memoryStore := store.NewMemoryStore()
+	// Tracing configuration (TRACE_EXPORTER: none, stdout or otlp;
+	// OTEL_TRACES_SAMPLER_ARG is the fraction of new traces sampled)
+	sampleRatio, _ := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName:  os.Getenv("OTEL_SERVICE_NAME"),
+		Exporter:     os.Getenv("TRACE_EXPORTER"),
+		OTLPEndpoint: os.Getenv("OTLP_ENDPOINT"),
+		OTLPInsecure: os.Getenv("OTLP_INSECURE") == "true",
+		SampleRatio:  sampleRatio,
+	})
+	if err != nil {
+		logging.Fatal("Failed to initialize tracing", "error", err)
+	}
+	// The server exits through logging.Fatal or a signal, never by
+	// returning, so buffered spans are flushed explicitly
+	flushTracing := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}
+	logging.OnFatal(flushTracing)
+
+	// Audit log configuration (AUDIT_SINK: memory, file or sql)
+	auditMaxBytes, _ := strconv.ParseInt(os.Getenv("AUDIT_FILE_MAX_BYTES"), 10, 64)
+	auditBackups, _ := strconv.Atoi(os.Getenv("AUDIT_FILE_BACKUPS"))
+	auditLog, err := audit.Open(context.Background(), audit.Config{
+		Sink:         os.Getenv("AUDIT_SINK"),
+		FilePath:     os.Getenv("AUDIT_FILE"),
+		FileMaxBytes: auditMaxBytes,
+		FileBackups:  auditBackups,
+		DatabaseURL:  os.Getenv("AUDIT_DATABASE_URL"),
+	})
+	if err != nil {
+		logging.Fatal("Failed to initialize audit log", "error", err)
+	}
+
+	// Mail configuration (MAIL_TRANSPORT: file, smtp or log)
+	mailer, err := mail.Open(mail.Config{
+		Transport: os.Getenv("MAIL_TRANSPORT"),
+		From:      os.Getenv("MAIL_FROM"),
+		Dir:       os.Getenv("MAIL_DIR"),
+		SMTPAddr:  os.Getenv("SMTP_ADDR"),
+	})
+	if err != nil {
+		logging.Fatal("Failed to initialize mail delivery", "error", err)
+	}
+
+	// Confirmed email changes and account purges are pushed to Auth0 when
+	// Management API credentials are set
+	var emailIDP emailchange.IdentityProvider
+	var privacyIDP privacy.IdentityProvider
+	if auth0ClientID != "" && auth0ClientSecret != "" {
+		auth0Users := migration.NewAuth0Issuer(auth0Domain, auth0ClientID, auth0ClientSecret, auth0Audience, auth0Connection)
+		emailIDP = auth0Users
+		privacyIDP = auth0Users
+	}
+	emailChange := emailchange.NewService(mailer, emailIDP)
+
+	// Account storage (STORE: memory or sql)
+	accountStore, err := store.Open(context.Background(), store.Config{
+		Driver:      os.Getenv("STORE"),
+		DatabaseURL: os.Getenv("DATABASE_URL"),
+	})
+	if err != nil {
+		logging.Fatal("Failed to initialize account store", "error", err)
+	}
+
+	// Account deletion and data export (ACCOUNT_DELETION_GRACE_PERIOD, PURGE_INTERVAL,
+	// EXPORT_URL_TTL as Go durations; PUBLIC_URL is the base of export links)
+	deletionGrace, _ := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD"))
+	purgeInterval, _ := time.ParseDuration(os.Getenv("PURGE_INTERVAL"))
+	exportTTL, _ := time.ParseDuration(os.Getenv("EXPORT_URL_TTL"))
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + port
+	}
+	privacyService, err := privacy.NewService(accountStore, privacyIDP, auditLog, privacy.Config{
+		GracePeriod:   deletionGrace,
+		PurgeInterval: purgeInterval,
+		ExportTTL:     exportTTL,
+		SigningKey:    []byte(os.Getenv("EXPORT_SIGNING_KEY")),
+		PublicURL:     publicURL,
+	})
+	if err != nil {
+		logging.Fatal("Failed to initialize account deletion", "error", err)
+	}
+	go privacyService.Run(context.Background())
+
+	// Organizations; invitations are delivered through the configured mail transport
+	orgService := orgs.NewService(accountStore, mailer, auditLog)
+
+	// Subscription events (EVENTS_BROKER: memory or postgres)
+	eventBus, err := events.Open(events.Config{
+		Broker:      os.Getenv("EVENTS_BROKER"),
+		DatabaseURL: os.Getenv("EVENTS_DATABASE_URL"),
+	})
+	if err != nil {
+		logging.Fatal("Failed to initialize event bus", "error", err)
+	}
+	go eventBus.Run(context.Background())
+
+	// Token revocation (REVOCATION_BACKEND: memory or sql; REVOCATION_RETENTION
+	// as a Go duration, at least the longest access token lifetime)
+	revocationRetention, _ := time.ParseDuration(os.Getenv("REVOCATION_RETENTION"))
+	revocations, err := revocation.Open(context.Background(), revocation.Config{
+		Backend:     os.Getenv("REVOCATION_BACKEND"),
+		DatabaseURL: os.Getenv("REVOCATION_DATABASE_URL"),
+		Retention:   revocationRetention,
+	})
+	if err != nil {
+		logging.Fatal("Failed to initialize token revocation", "error", err)
+	}
+	go revocations.Run(context.Background(), revocation.DefaultRefreshInterval)
+
+	// Passkeys (WEBAUTHN_RP_ID, the domain they are scoped to, enables them).
+	// WEBAUTHN_ORIGINS is comma-separated; WEBAUTHN_ATTESTATION_ROOTS is a PEM
+	// bundle that must issue packed and apple attestation certificates.
+	var passkeys *webauthn.Service
+	if rpID := os.Getenv("WEBAUTHN_RP_ID"); rpID != "" {
+		attestationRoots, err := webauthn.LoadAttestationRoots(os.Getenv("WEBAUTHN_ATTESTATION_ROOTS"))
+		if err != nil {
+			logging.Fatal("Failed to load WebAuthn attestation roots", "error", err)
+		}
+		passkeys, err = webauthn.NewService(accountStore, auditLog, webauthn.Config{
+			RPID:             rpID,
+			RPName:           os.Getenv("WEBAUTHN_RP_NAME"),
+			Origins:          auth.ParseList(os.Getenv("WEBAUTHN_ORIGINS")),
+			UserVerification: os.Getenv("WEBAUTHN_USER_VERIFICATION"),
+			Attestation:      os.Getenv("WEBAUTHN_ATTESTATION"),
+			AttestationRoots: attestationRoots,
+		})
+		if err != nil {
+			logging.Fatal("Failed to configure passkeys", "error", err)
+		}
+	}
+
+	// Email sign-in codes (EMAIL_OTP_ENABLED=true), mailed through the mail transport
+	var emailOTP *emailotp.Service
+	if os.Getenv("EMAIL_OTP_ENABLED") == "true" {
+		codeTTL, _ := time.ParseDuration(os.Getenv("EMAIL_OTP_CODE_TTL"))
+		resendInterval, _ := time.ParseDuration(os.Getenv("EMAIL_OTP_RESEND_INTERVAL"))
+		maxAttempts, _ := strconv.Atoi(os.Getenv("EMAIL_OTP_MAX_ATTEMPTS"))
+		maxSends, _ := strconv.Atoi(os.Getenv("EMAIL_OTP_MAX_SENDS"))
+		emailOTP = emailotp.NewService(accountStore, mailer, auditLog, emailotp.Config{
+			CodeTTL:        codeTTL,
+			MaxAttempts:    maxAttempts,
+			ResendInterval: resendInterval,
+			MaxSends:       maxSends,
+			Secret:         []byte(os.Getenv("EMAIL_OTP_SECRET")),
+		})
+	}
+
+	// First-party token issuer (ISSUER_URL, its https origin, enables it).
+	// ISSUER_SIGNING_KEYS_FILE holds PEM keys shared by every instance; without
+	// it ISSUER_ALGORITHM keys are generated and rotated every
+	// ISSUER_KEY_ROTATION. ISSUER_CLAIMS is a JSON object of claims added to
+	// access tokens; ISSUER_BACKEND (memory or sql) stores refresh tokens.
+	var tokenIssuer *issuer.Issuer
+	var trustedIssuers []auth.TrustedIssuer
+	if issuerURL := os.Getenv("ISSUER_URL"); issuerURL != "" {
+		var issuerClaims map[string]any
+		if raw := os.Getenv("ISSUER_CLAIMS"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &issuerClaims); err != nil {
+				logging.Fatal("Invalid ISSUER_CLAIMS", "error", err)
+			}
+		}
+		keyRotation, _ := time.ParseDuration(os.Getenv("ISSUER_KEY_ROTATION"))
+		accessTokenTTL, _ := time.ParseDuration(os.Getenv("ISSUER_ACCESS_TOKEN_TTL"))
+		refreshTokenTTL, _ := time.ParseDuration(os.Getenv("ISSUER_REFRESH_TOKEN_TTL"))
+		refreshTokenLifetime, _ := time.ParseDuration(os.Getenv("ISSUER_REFRESH_TOKEN_LIFETIME"))
+		tokenIssuer, err = issuer.Open(context.Background(), issuer.Config{
+			URL:                  issuerURL,
+			Audience:             auth0Audience,
+			ClientID:             os.Getenv("ISSUER_CLIENT_ID"),
+			Algorithm:            os.Getenv("ISSUER_ALGORITHM"),
+			KeyFile:              os.Getenv("ISSUER_SIGNING_KEYS_FILE"),
+			RotationInterval:     keyRotation,
+			AccessTokenTTL:       accessTokenTTL,
+			RefreshTokenTTL:      refreshTokenTTL,
+			RefreshTokenLifetime: refreshTokenLifetime,
+			Scope:                os.Getenv("ISSUER_SCOPE"),
+			Claims:               issuerClaims,
+			Revocations:          revocations,
+			Backend:              os.Getenv("ISSUER_BACKEND"),
+			DatabaseURL:          os.Getenv("ISSUER_DATABASE_URL"),
+		}, accountStore, auditLog)
+		if err != nil {
+			logging.Fatal("Failed to configure token issuer", "error", err)
+		}
+		go tokenIssuer.Run(context.Background())
+		revocations.AddRevoker(tokenIssuer)
+		trustedIssuers = append(trustedIssuers, tokenIssuer)
+	}
+
+	// Challenge sign-in over the enabled methods, passkey first and email
+	// code as the fallback (CHALLENGE_MAX_ATTEMPTS, CHALLENGE_SESSION_TTL);
+	// completed sign-ins get tokens from the issuer when it is enabled
+	var challenges *challenge.Sessions
+	var challengeMethods []challenge.Method
+	if passkeys != nil {
+		challengeMethods = append(challengeMethods, challenge.PasskeyMethod(passkeys))
+	}
+	if emailOTP != nil {
+		challengeMethods = append(challengeMethods, challenge.EmailCodeMethod(emailOTP))
+	}
+	if len(challengeMethods) > 0 {
+		challengeAttempts, _ := strconv.Atoi(os.Getenv("CHALLENGE_MAX_ATTEMPTS"))
+		challengeTTL, _ := time.ParseDuration(os.Getenv("CHALLENGE_SESSION_TTL"))
+		flow, err := challenge.New(challenge.Config{Methods: challengeMethods, MaxAttempts: challengeAttempts})
+		if err != nil {
+			logging.Fatal("Failed to configure challenge sign-in", "error", err)
+		}
+		challenges = challenge.NewSessions(flow, accountStore, auditLog, challenge.SessionsConfig{TTL: challengeTTL, Issuer: tokenIssuer})
+	}
+
+	// Auth0 token validation for GraphQL requests and websocket connections
+	// A malformed duration is fatal rather than silently turning a check off
+	authLeeway, err := time.ParseDuration(cmp.Or(os.Getenv("AUTH_LEEWAY"), "0"))
+	if err != nil {
+		logging.Fatal("Invalid AUTH_LEEWAY", "error", err)
+	}
+	authMaxTokenAge, err := time.ParseDuration(cmp.Or(os.Getenv("AUTH_MAX_TOKEN_AGE"), "0"))
+	if err != nil {
+		logging.Fatal("Invalid AUTH_MAX_TOKEN_AGE", "error", err)
+	}
+	config := auth.Auth0Config{
+		Domain:      auth0Domain,
+		Audience:    auth0Audience,
+		Audit:       auditLog,
+		Clients:     accountStore,
+		TokenCookie: os.Getenv("AUTH_TOKEN_COOKIE"), // optional cookie holding the access token
+
+		// AUTH_ALLOW_ANONYMOUS=true serves public fields to requests without a token
+		AllowAnonymous: os.Getenv("AUTH_ALLOW_ANONYMOUS") == "true",
+
+		// Claim checks: AUTH_LEEWAY and AUTH_MAX_TOKEN_AGE as Go durations,
+		// AUTH_REQUIRED_CLAIMS and AUTH_ALLOWED_CLIENTS as comma-separated lists
+		Leeway:         authLeeway,
+		MaxTokenAge:    authMaxTokenAge,
+		RequiredClaims: auth.ParseList(os.Getenv("AUTH_REQUIRED_CLAIMS")),
+		AllowedClients: auth.ParseList(os.Getenv("AUTH_ALLOWED_CLIENTS")),
+
+		Revocations:    revocations,
+		TrustedIssuers: trustedIssuers, // tokens of the first-party issuer, when enabled
+	}
+
+	// Token introspection (RFC 7662) for opaque tokens and other issuers;
+	// INTROSPECTION_URL enables it, cache TTLs are Go durations
+	if introspectionURL := os.Getenv("INTROSPECTION_URL"); introspectionURL != "" {
+		cacheTTL, _ := time.ParseDuration(os.Getenv("INTROSPECTION_CACHE_TTL"))
+		negativeCacheTTL, _ := time.ParseDuration(os.Getenv("INTROSPECTION_NEGATIVE_CACHE_TTL"))
+		introspector, err := auth.NewIntrospector(auth.IntrospectionConfig{
+			Endpoint:         introspectionURL,
+			ClientID:         os.Getenv("INTROSPECTION_CLIENT_ID"),
+			ClientSecret:     os.Getenv("INTROSPECTION_CLIENT_SECRET"),
+			AuthMethod:       os.Getenv("INTROSPECTION_AUTH_METHOD"),
+			Issuer:           os.Getenv("INTROSPECTION_ISSUER"),
+			SubjectPrefix:    os.Getenv("INTROSPECTION_SUBJECT_PREFIX"),
+			CacheTTL:         cacheTTL,
+			NegativeCacheTTL: negativeCacheTTL,
+		})
+		if err != nil {
+			logging.Fatal("Failed to configure token introspection", "error", err)
+		}
+		config.Introspection = introspector
+	}
+
+	// Audited client IPs come from X-Forwarded-For, and DPoP request URLs
+	// from X-Forwarded-Proto, only behind TRUSTED_PROXIES (comma-separated
+	// addresses or CIDR ranges)
+	trustedProxies, err := audit.ParseTrustedProxies(auth.ParseList(os.Getenv("TRUSTED_PROXIES")))
+	if err != nil {
+		logging.Fatal("Invalid TRUSTED_PROXIES", "error", err)
+	}
+
+	// DPoP sender-constrained tokens (RFC 9449). DPOP_ENABLED=true accepts
+	// them; DPOP_REQUIRED=true, DPOP_REQUIRED_AUDIENCES or DPOP_REQUIRED_PATHS
+	// (comma-separated) refuse Bearer tokens. PUBLIC_URL, when set, is the
+	// base proofs are checked against behind a proxy.
+	if os.Getenv("DPOP_ENABLED") == "true" {
+		dpop, err := auth.NewDPoPVerifier(auth.DPoPConfig{
+			Required:          os.Getenv("DPOP_REQUIRED") == "true",
+			RequiredAudiences: auth.ParseList(os.Getenv("DPOP_REQUIRED_AUDIENCES")),
+			RequiredPaths:     auth.ParseList(os.Getenv("DPOP_REQUIRED_PATHS")),
+			BaseURL:           os.Getenv("PUBLIC_URL"),
+			TrustedProxies:    trustedProxies,
+		})
+		if err != nil {
+			logging.Fatal("Failed to configure DPoP", "error", err)
+		}
+		config.DPoP = dpop
+	}
+
+	// Mutual TLS (RFC 8705). TLS_CERT_FILE and TLS_KEY_FILE serve HTTPS;
+	// TLS_CLIENT_CA_FILE verifies client certificates against a PEM bundle,
+	// and TLS_CLIENT_CERT_REQUIRED=true refuses connections without one.
+	// MTLS_CERTIFICATE_PRINCIPALS=true authenticates service clients by their
+	// certificate alone; MTLS_BOUND_CLIENTS (comma-separated) must bind their
+	// tokens to their certificate.
+	tlsCertFile, tlsKeyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	clientCAFile := os.Getenv("TLS_CLIENT_CA_FILE")
+	if clientCAFile != "" && tlsCertFile == "" {
+		logging.Fatal("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	tlsConfig, err := auth.ServerTLSConfig(clientCAFile, os.Getenv("TLS_CLIENT_CERT_REQUIRED") == "true")
+	if err != nil {
+		logging.Fatal("Failed to configure TLS", "error", err)
+	}
+	if clientCAFile != "" {
+		config.MTLS = &auth.MTLSConfig{
+			CertificatePrincipals: os.Getenv("MTLS_CERTIFICATE_PRINCIPALS") == "true",
+			BoundClients:          auth.ParseList(os.Getenv("MTLS_BOUND_CLIENTS")),
+		}
+	}
 
 	// Initialize GraphQL server
 	resolver := &graph.Resolver{
-		Store: memoryStore,
+		Store:       accountStore,
+		Audit:       auditLog,
+		EmailChange: emailChange,
+		Privacy:     privacyService,
+		Orgs:        orgService,
+		Events:      eventBus,
+		Revocations: revocations,
+		Passkeys:    passkeys,
 	}
-	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver, Directives: graph.Directives()}))
+	// Websocket subscriptions authenticate with the connection_init payload,
+	// server-sent events with the Authorization header like other requests
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		InitFunc:              auth.WebsocketInit(config),
+	})
+	srv.AddTransport(transport.SSE{})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+	srv.Use(extension.Introspection{})
 
-	// GraphQL endpoints with Auth0 middleware
-	config := auth.Auth0Config{
-		Domain:   auth0Domain,
-		Audience: auth0Audience,
+	// Operation limits (GRAPHQL_MAX_DEPTH, GRAPHQL_MAX_COMPLEXITY); setting
+	// PERSISTED_QUERIES_MANIFEST only allows the operations listed in it
+	maxDepth, _ := strconv.Atoi(os.Getenv("GRAPHQL_MAX_DEPTH"))
+	maxComplexity, _ := strconv.Atoi(os.Getenv("GRAPHQL_MAX_COMPLEXITY"))
+	apqCacheSize, _ := strconv.Atoi(os.Getenv("GRAPHQL_APQ_CACHE_SIZE"))
+	allowList, err := limits.Apply(srv, limits.Config{
+		MaxDepth:      maxDepth,
+		MaxComplexity: maxComplexity,
+		APQCacheSize:  apqCacheSize,
+		ManifestPath:  os.Getenv("PERSISTED_QUERIES_MANIFEST"),
+	})
+	if err != nil {
+		logging.Fatal("Failed to configure GraphQL limits", "error", err)
 	}
+
+	srv.SetErrorPresenter(graph.ErrorPresenter)
+	srv.SetRecoverFunc(graph.Recover)
+	srv.Use(metrics.NewGraphQLExtension(allowList.OperationNames()))
+	srv.Use(tracing.GraphQLExtension{})
+
+	// GraphQL endpoints with Auth0 middleware
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
 	http.Handle("/query", auth.Middleware(config)(srv))
+	http.Handle("/metrics", metrics.Handler())
+	http.Handle(privacy.ExportPath, privacyService.ExportHandler())
+
+	// Auth0 log stream webhook revoking the tokens of deleted, blocked and
+	// password-changed users (set REVOCATION_WEBHOOK_TOKEN to enable)
+	if webhookToken := os.Getenv("REVOCATION_WEBHOOK_TOKEN"); webhookToken != "" {
+		http.Handle(revocation.WebhookPath, revocations.LogStreamHandler(webhookToken, auditLog))
+	}
+
+	// Passkey login; registration goes through GraphQL
+	if passkeys != nil {
+		http.Handle(webauthn.LoginOptionsPath, passkeys.LoginOptionsHandler())
+		http.Handle(webauthn.LoginPath, passkeys.LoginHandler(tokenIssuer))
+	}
+
+	// Email code sign-in
+	if emailOTP != nil {
+		http.Handle(emailotp.StartPath, emailOTP.StartHandler())
+		http.Handle(emailotp.VerifyPath, emailOTP.VerifyHandler())
+	}
+
+	// Challenge sign-in
+	if challenges != nil {
+		http.Handle(challenge.InitiatePath, challenges.InitiateHandler())
+		http.Handle(challenge.RespondPath, challenges.RespondHandler())
+	}
+
+	// First-party token issuer
+	if tokenIssuer != nil {
+		http.Handle(issuer.JWKSPath, tokenIssuer.JWKSHandler())
+		http.Handle(issuer.DiscoveryPath, tokenIssuer.DiscoveryHandler())
+		http.Handle(issuer.TokenPath, tokenIssuer.TokenHandler())
+		http.Handle(issuer.RevokePath, tokenIssuer.RevokeHandler())
+	}
 
 	// Migration endpoints (if Passage credentials are provided)
 	if passageAppID != "" && passageAPIKey != "" {
-		log.Println("Migration endpoints enabled")
+		slog.Info("Migration endpoints enabled")
 		
 		// Initialize migration service
 		migrationService, err := migration.NewTokenExchangeService(
@@ -65,8 +490,12 @@ func main() {
 			auth0Connection,
 		)
 		if err != nil {
-			log.Fatalf("Failed to initialize migration service: %v", err)
+			logging.Fatal("Failed to initialize migration service", "error", err)
 		}
+		migrationService.SetAuditLogger(auditLog)
+		migrationService.SetEventBus(eventBus)
+		resolver.Migrations = migrationService
+		privacyService.SetMigrations(migrationService)
 
 		migrationHandler := migration.NewHandler(migrationService)
 		
@@ -74,18 +503,48 @@ func main() {
 		http.HandleFunc("/migrate/exchange-token", migrationHandler.HandleExchangeToken)
 		http.HandleFunc("/migrate/stats", migrationHandler.HandleMigrationStats)
 		
-		log.Println("  POST /migrate/exchange-token - Exchange Passage JWT for Auth0 user")
-		log.Println("  GET  /migrate/stats - View migration statistics")
+		slog.Info("  POST /migrate/exchange-token - Exchange Passage JWT for Auth0 user")
+		slog.Info("  GET  /migrate/stats - View migration statistics")
 	} else {
-		log.Println("Migration endpoints disabled (set PASSAGE_APP_ID and PASSAGE_API_KEY to enable)")
+		slog.Info("Migration endpoints disabled (set PASSAGE_APP_ID and PASSAGE_API_KEY to enable)")
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	server := &http.Server{
+		Addr:      ":" + port,
+		Handler:   tracing.Middleware(logging.Middleware(audit.Middleware(trustedProxies)(http.DefaultServeMux))),
+		TLSConfig: tlsConfig,
 	}
 
-	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	// On SIGINT or SIGTERM, let requests in flight finish, then flush traces
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+		slog.Info("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Graceful shutdown failed", "error", err)
+		}
+	}()
+
+	if tlsCertFile != "" {
+		slog.Info("connect to https://localhost:" + port + "/ for GraphQL playground")
+		err = server.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+	} else {
+		slog.Info("connect to http://localhost:" + port + "/ for GraphQL playground")
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		<-stopped
+		if emailOTP != nil {
+			emailOTP.Wait() // sign-in codes still being mailed
+		}
+		flushTracing()
+		return
+	}
+	logging.Fatal("Server stopped", "error", err)
 }
 
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// Errors returned by service client operations
+var (
+	ErrClientNotFound = errors.New("service client not found")
+	ErrClientConflict = errors.New("service client already registered")
+)
+
+// ServiceClientUpdate holds registration changes; nil fields are left unchanged
+type ServiceClientUpdate struct {
+	Name        *string
+	Permissions []string // nil leaves permissions unchanged, empty revokes all
+}
+
+// RegisterServiceClient registers a service client with the permissions it is granted
+func (s *MemoryStore) RegisterServiceClient(ctx context.Context, clientID, name string, permissions []string) (client *model.ServiceClient, err error) {
+	_, done := instrument(ctx, "register_service_client")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.clients[clientID]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrClientConflict, clientID)
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	client = &model.ServiceClient{
+		ClientID:    clientID,
+		Name:        name,
+		Permissions: append([]string{}, permissions...),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.clients[clientID] = client
+
+	return client, nil
+}
+
+// GetServiceClient retrieves a service client registration
+func (s *MemoryStore) GetServiceClient(ctx context.Context, clientID string) (client *model.ServiceClient, err error) {
+	_, done := instrument(ctx, "get_service_client")
+	defer func() { done(err) }()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, exists := s.clients[clientID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+
+	return client, nil
+}
+
+// UpdateServiceClient applies update to a service client registration
+func (s *MemoryStore) UpdateServiceClient(ctx context.Context, clientID string, update ServiceClientUpdate) (client *model.ServiceClient, err error) {
+	_, done := instrument(ctx, "update_service_client")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.clients[clientID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+
+	updated := *existing
+	if update.Name != nil {
+		updated.Name = *update.Name
+	}
+	if update.Permissions != nil {
+		updated.Permissions = append([]string{}, update.Permissions...)
+	}
+	updated.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	s.clients[clientID] = &updated
+
+	return &updated, nil
+}
+
+// DeleteServiceClient removes a service client registration
+func (s *MemoryStore) DeleteServiceClient(ctx context.Context, clientID string) (err error) {
+	_, done := instrument(ctx, "delete_service_client")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.clients[clientID]; !exists {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	delete(s.clients, clientID)
+
+	return nil
+}
+
+// ListServiceClients returns all service client registrations ordered by client ID
+func (s *MemoryStore) ListServiceClients(ctx context.Context) []*model.ServiceClient {
+	_, done := instrument(ctx, "list_service_clients")
+	defer done(nil)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clients := make([]*model.ServiceClient, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ClientID < clients[j].ClientID })
+
+	return clients
+}
+
+// ClientPermissions returns the permissions granted to a service client,
+// or none if it is not registered. It implements auth.ClientRegistry.
+func (s *MemoryStore) ClientPermissions(ctx context.Context, clientID string) ([]string, error) {
+	client, err := s.GetServiceClient(ctx, clientID)
+	if errors.Is(err, ErrClientNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client.Permissions, nil
+}
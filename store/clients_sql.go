@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// clientColumns are selected, in this order, by every service client query
+const clientColumns = `client_id, name, permissions, created_at, updated_at`
+
+// RegisterServiceClient registers a service client with the permissions it is granted
+func (s *SQLStore) RegisterServiceClient(ctx context.Context, clientID, name string, permissions []string) (client *model.ServiceClient, err error) {
+	ctx, done := instrument(ctx, "register_service_client")
+	defer func() { done(err) }()
+
+	row := s.db.QueryRowContext(ctx, `INSERT INTO service_clients (client_id, name, permissions, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (client_id) DO NOTHING
+		RETURNING `+clientColumns, clientID, name, strings.Join(permissions, " "), storedNow())
+	client, err = scanServiceClient(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrClientConflict, clientID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert service client: %w", err)
+	}
+	return client, nil
+}
+
+// GetServiceClient retrieves a service client registration
+func (s *SQLStore) GetServiceClient(ctx context.Context, clientID string) (client *model.ServiceClient, err error) {
+	ctx, done := instrument(ctx, "get_service_client")
+	defer func() { done(err) }()
+
+	row := s.db.QueryRowContext(ctx, `SELECT `+clientColumns+` FROM service_clients WHERE client_id = $1`, clientID)
+	client, err = scanServiceClient(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	return client, err
+}
+
+// UpdateServiceClient applies update to a service client registration
+func (s *SQLStore) UpdateServiceClient(ctx context.Context, clientID string, update ServiceClientUpdate) (client *model.ServiceClient, err error) {
+	ctx, done := instrument(ctx, "update_service_client")
+	defer func() { done(err) }()
+
+	args := []any{clientID, storedNow()}
+	assignments := []string{"updated_at = $2"}
+	if update.Name != nil {
+		args = append(args, *update.Name)
+		assignments = append(assignments, fmt.Sprintf("name = $%d", len(args)))
+	}
+	if update.Permissions != nil {
+		args = append(args, strings.Join(update.Permissions, " "))
+		assignments = append(assignments, fmt.Sprintf("permissions = $%d", len(args)))
+	}
+
+	row := s.db.QueryRowContext(ctx, `UPDATE service_clients SET `+strings.Join(assignments, ", ")+`
+		WHERE client_id = $1
+		RETURNING `+clientColumns, args...)
+	client, err = scanServiceClient(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	return client, err
+}
+
+// DeleteServiceClient removes a service client registration
+func (s *SQLStore) DeleteServiceClient(ctx context.Context, clientID string) (err error) {
+	ctx, done := instrument(ctx, "delete_service_client")
+	defer func() { done(err) }()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM service_clients WHERE client_id = $1`, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete service client: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	return nil
+}
+
+// ListServiceClients returns all service client registrations ordered by client ID
+func (s *SQLStore) ListServiceClients(ctx context.Context) []*model.ServiceClient {
+	ctx, done := instrument(ctx, "list_service_clients")
+
+	clients, err := s.queryServiceClients(ctx)
+	done(err)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list service clients", "error", err)
+		return []*model.ServiceClient{}
+	}
+	return clients
+}
+
+// queryServiceClients loads every service client registration
+func (s *SQLStore) queryServiceClients(ctx context.Context) ([]*model.ServiceClient, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+clientColumns+` FROM service_clients ORDER BY client_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query service clients: %w", err)
+	}
+	defer rows.Close()
+
+	clients := []*model.ServiceClient{}
+	for rows.Next() {
+		client, err := scanServiceClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// ClientPermissions returns the permissions granted to a service client,
+// or none if it is not registered. It implements auth.ClientRegistry.
+func (s *SQLStore) ClientPermissions(ctx context.Context, clientID string) ([]string, error) {
+	client, err := s.GetServiceClient(ctx, clientID)
+	if errors.Is(err, ErrClientNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client.Permissions, nil
+}
+
+// scanServiceClient reads a row of clientColumns
+func scanServiceClient(row interface{ Scan(...any) error }) (*model.ServiceClient, error) {
+	var client model.ServiceClient
+	var permissions string
+	var createdAt, updatedAt time.Time
+	err := row.Scan(&client.ClientID, &client.Name, &permissions, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan service client: %w", err)
+	}
+
+	client.Permissions = strings.Fields(permissions)
+	client.CreatedAt = createdAt.Format(time.RFC3339)
+	client.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &client, nil
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+)
+
+// Driver names accepted in Config.Driver
+const (
+	DriverMemory = "memory"
+	DriverSQL    = "sql"
+)
+
+// Config holds account store configuration
+type Config struct {
+	Driver      string // memory (default) or sql
+	DatabaseURL string // PostgreSQL connection string for the sql driver
+}
+
+// Open creates the store selected by config
+func Open(ctx context.Context, config Config) (Store, error) {
+	switch config.Driver {
+	case "", DriverMemory:
+		return NewMemoryStore(), nil
+	case DriverSQL:
+		if config.DatabaseURL == "" {
+			return nil, fmt.Errorf("database URL is required for the sql store")
+		}
+		db, err := sql.Open("pgx", config.DatabaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open account database: %w", err)
+		}
+		s, err := NewSQLStore(ctx, db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown store driver: %s", config.Driver)
+	}
+}
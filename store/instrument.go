@@ -0,0 +1,21 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/metrics"
+	"github.com/example/auth0-gqlgen-demo/tracing"
+)
+
+// instrument starts a span for a store operation and returns a function that
+// ends it and records the operation's latency and result
+func instrument(ctx context.Context, operation string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "store."+operation)
+
+	return ctx, func(err error) {
+		tracing.EndSpan(span, err)
+		metrics.ObserveStoreOperation(operation, start, err)
+	}
+}
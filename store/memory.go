@@ -1,43 +1,127 @@
 package store
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/example/auth0-gqlgen-demo/graph/model"
 )
 
+// Errors returned by store operations
+var (
+	ErrNotFound        = errors.New("account not found")
+	ErrConflict        = errors.New("account already exists")
+	ErrPendingDeletion = errors.New("account is scheduled for deletion")
+)
+
 // MemoryStore is an in-memory storage for accounts
 type MemoryStore struct {
 	mu       sync.RWMutex
-	accounts map[string]*model.Account // key is userID
+	accounts map[string]*model.Account       // key is userID
+	clients  map[string]*model.ServiceClient // key is clientID
 	nextID   int
+
+	orgs        map[string]*model.Organization          // key is org ID
+	memberships map[string]map[string]*model.Membership // keys are org ID, then userID
+	invitations map[string]*model.Invitation            // key is token hash
+	nextOrgID   int
+	nextInvID   int
+
+	passkeys map[string]*model.Passkey // key is credential ID
 }
 
 // NewMemoryStore creates a new in-memory store
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
 		accounts: make(map[string]*model.Account),
+		clients:  make(map[string]*model.ServiceClient),
 		nextID:   1,
+
+		orgs:        make(map[string]*model.Organization),
+		memberships: make(map[string]map[string]*model.Membership),
+		invitations: make(map[string]*model.Invitation),
+		nextOrgID:   1,
+		nextInvID:   1,
+
+		passkeys: make(map[string]*model.Passkey),
 	}
 }
 
 // GetAccountByUserID retrieves an account by Auth0 user ID
-func (s *MemoryStore) GetAccountByUserID(userID string) (*model.Account, error) {
+func (s *MemoryStore) GetAccountByUserID(ctx context.Context, userID string) (account *model.Account, err error) {
+	_, done := instrument(ctx, "get_account_by_user_id")
+	defer func() { done(err) }()
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	account, exists := s.accounts[userID]
 	if !exists {
-		return nil, fmt.Errorf("account not found for user ID: %s", userID)
+		return nil, fmt.Errorf("%w for user ID: %s", ErrNotFound, userID)
+	}
+
+	return account, nil
+}
+
+// GetAccountByEmail retrieves the oldest account with email, ignoring case
+func (s *MemoryStore) GetAccountByEmail(ctx context.Context, email string) (account *model.Account, err error) {
+	_, done := instrument(ctx, "get_account_by_email")
+	defer func() { done(err) }()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account = s.oldestWithEmail(email, false)
+	if account == nil {
+		return nil, fmt.Errorf("%w for email: %s", ErrNotFound, email)
+	}
+
+	return account, nil
+}
+
+// GetAccountByVerifiedEmail retrieves the oldest account whose email is
+// email, ignoring case, and verified
+func (s *MemoryStore) GetAccountByVerifiedEmail(ctx context.Context, email string) (account *model.Account, err error) {
+	_, done := instrument(ctx, "get_account_by_verified_email")
+	defer func() { done(err) }()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account = s.oldestWithEmail(email, true)
+	if account == nil {
+		return nil, fmt.Errorf("%w for verified email: %s", ErrNotFound, email)
 	}
 
 	return account, nil
 }
 
+// oldestWithEmail returns the oldest account with email, or nil. The caller
+// holds s.mu.
+func (s *MemoryStore) oldestWithEmail(email string, verified bool) *model.Account {
+	var account *model.Account
+	for _, candidate := range s.accounts {
+		if !strings.EqualFold(candidate.Email, email) || (verified && !candidate.EmailVerified) {
+			continue
+		}
+		if account == nil || accountSortKey(candidate).Before(accountSortKey(account)) {
+			account = candidate
+		}
+	}
+	return account
+}
+
 // CreateAccount creates a new account
-func (s *MemoryStore) CreateAccount(userID, email string) (*model.Account, error) {
+func (s *MemoryStore) CreateAccount(ctx context.Context, userID, email string) (account *model.Account, err error) {
+	_, done := instrument(ctx, "create_account")
+	defer func() { done(err) }()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -47,11 +131,15 @@ func (s *MemoryStore) CreateAccount(userID, email string) (*model.Account, error
 	}
 
 	// Create new account
-	account := &model.Account{
-		ID:        fmt.Sprintf("%d", s.nextID),
-		Email:     email,
-		UserID:    userID,
-		CreatedAt: time.Now().Format(time.RFC3339),
+	now := time.Now()
+	account = &model.Account{
+		ID:             fmt.Sprintf("%d", s.nextID),
+		Email:          email,
+		UserID:         userID,
+		Source:         model.AccountSourceAuth0,
+		CreatedAt:      now.Format(time.RFC3339),
+		UpdatedAt:      now.Format(time.RFC3339),
+		EmailUpdatedAt: now,
 	}
 
 	s.accounts[userID] = account
@@ -60,13 +148,18 @@ func (s *MemoryStore) CreateAccount(userID, email string) (*model.Account, error
 	return account, nil
 }
 
-// CreateAccountIfNotExists creates an account if it doesn't exist, otherwise returns existing
-func (s *MemoryStore) CreateAccountIfNotExists(userID, email string) (*model.Account, error) {
+// CreateAccountIfNotExists creates an account if it doesn't exist, otherwise returns existing.
+// created reports whether a new account was created. emailVerified records
+// whether the identity provider verified email.
+func (s *MemoryStore) CreateAccountIfNotExists(ctx context.Context, userID, email string, emailVerified bool, source model.AccountSource) (account *model.Account, created bool, err error) {
+	_, done := instrument(ctx, "create_account_if_not_exists")
+	defer func() { done(err) }()
+
 	// First try to get existing account (read lock)
 	s.mu.RLock()
 	if existing, exists := s.accounts[userID]; exists {
 		s.mu.RUnlock()
-		return existing, nil
+		return existing, false, nil
 	}
 	s.mu.RUnlock()
 
@@ -76,33 +169,231 @@ func (s *MemoryStore) CreateAccountIfNotExists(userID, email string) (*model.Acc
 
 	// Double-check after acquiring write lock
 	if existing, exists := s.accounts[userID]; exists {
-		return existing, nil
+		return existing, false, nil
 	}
 
 	// Create new account
-	account := &model.Account{
-		ID:        fmt.Sprintf("%d", s.nextID),
-		Email:     email,
-		UserID:    userID,
-		CreatedAt: time.Now().Format(time.RFC3339),
+	now := time.Now()
+	account = &model.Account{
+		ID:             fmt.Sprintf("%d", s.nextID),
+		Email:          email,
+		UserID:         userID,
+		Source:         source,
+		CreatedAt:      now.Format(time.RFC3339),
+		UpdatedAt:      now.Format(time.RFC3339),
+		EmailUpdatedAt: now,
+		EmailVerified:  emailVerified && email != "",
 	}
 
 	s.accounts[userID] = account
 	s.nextID++
 
-	return account, nil
+	return account, true, nil
+}
+
+// AccountUpdate holds profile changes; nil fields are left unchanged and an
+// empty string clears a text field
+type AccountUpdate struct {
+	DisplayName         *string
+	AvatarURL           *string
+	Locale              *string
+	Timezone            *string
+	MarketingEmailOptIn *bool
+	MarketingPushOptIn  *bool
+}
+
+// UpdateAccount applies update to the account for userID
+func (s *MemoryStore) UpdateAccount(ctx context.Context, userID string, update AccountUpdate) (account *model.Account, err error) {
+	_, done := instrument(ctx, "update_account")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.accounts[userID]
+	if !exists {
+		return nil, fmt.Errorf("%w for user ID: %s", ErrNotFound, userID)
+	}
+	if existing.DeletionScheduledAt != nil {
+		return nil, ErrPendingDeletion
+	}
+
+	// Copy so readers holding the previous pointer never see a partial update
+	updated := *existing
+	setOptional(&updated.DisplayName, update.DisplayName)
+	setOptional(&updated.AvatarURL, update.AvatarURL)
+	setOptional(&updated.Locale, update.Locale)
+	setOptional(&updated.Timezone, update.Timezone)
+	if update.MarketingEmailOptIn != nil {
+		updated.MarketingEmailOptIn = *update.MarketingEmailOptIn
+	}
+	if update.MarketingPushOptIn != nil {
+		updated.MarketingPushOptIn = *update.MarketingPushOptIn
+	}
+	updated.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	s.accounts[userID] = &updated
+
+	return &updated, nil
+}
+
+// UpdateEmail replaces the email address of the account for userID with
+// one verified to be the user's
+func (s *MemoryStore) UpdateEmail(ctx context.Context, userID, email string) (account *model.Account, err error) {
+	_, done := instrument(ctx, "update_email")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.accounts[userID]
+	if !exists {
+		return nil, fmt.Errorf("%w for user ID: %s", ErrNotFound, userID)
+	}
+	if existing.DeletionScheduledAt != nil {
+		return nil, ErrPendingDeletion
+	}
+
+	now := time.Now()
+	updated := *existing
+	updated.Email = email
+	updated.EmailUpdatedAt = now
+	updated.EmailVerified = true
+	updated.UpdatedAt = now.Format(time.RFC3339)
+
+	s.accounts[userID] = &updated
+
+	return &updated, nil
+}
+
+// ScheduleDeletion marks the account for userID to be purged at purgeAt.
+// An account already scheduled for deletion is returned unchanged.
+func (s *MemoryStore) ScheduleDeletion(ctx context.Context, userID string, purgeAt time.Time) (account *model.Account, err error) {
+	_, done := instrument(ctx, "schedule_deletion")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.accounts[userID]
+	if !exists {
+		return nil, fmt.Errorf("%w for user ID: %s", ErrNotFound, userID)
+	}
+	if existing.DeletionScheduledAt != nil {
+		return existing, nil
+	}
+
+	updated := *existing
+	updated.DeletionScheduledAt = &purgeAt
+	updated.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	s.accounts[userID] = &updated
+
+	return &updated, nil
 }
 
-// ListAccounts returns all accounts (for debugging)
-func (s *MemoryStore) ListAccounts() []*model.Account {
+// CancelDeletion clears a scheduled deletion of the account for userID
+func (s *MemoryStore) CancelDeletion(ctx context.Context, userID string) (account *model.Account, err error) {
+	_, done := instrument(ctx, "cancel_deletion")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.accounts[userID]
+	if !exists {
+		return nil, fmt.Errorf("%w for user ID: %s", ErrNotFound, userID)
+	}
+	if existing.DeletionScheduledAt == nil {
+		return existing, nil
+	}
+
+	updated := *existing
+	updated.DeletionScheduledAt = nil
+	updated.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	s.accounts[userID] = &updated
+
+	return &updated, nil
+}
+
+// ListDueForPurge returns accounts whose scheduled deletion is at or before now
+func (s *MemoryStore) ListDueForPurge(ctx context.Context, now time.Time) []*model.Account {
+	_, done := instrument(ctx, "list_due_for_purge")
+	defer done(nil)
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	var due []*model.Account
+	for _, account := range s.accounts {
+		if account.DeletionScheduledAt != nil && !account.DeletionScheduledAt.After(now) {
+			due = append(due, account)
+		}
+	}
+
+	return due
+}
+
+// DeleteAccount permanently removes the account for userID
+func (s *MemoryStore) DeleteAccount(ctx context.Context, userID string) (err error) {
+	_, done := instrument(ctx, "delete_account")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.accounts[userID]; !exists {
+		return fmt.Errorf("%w for user ID: %s", ErrNotFound, userID)
+	}
+	delete(s.accounts, userID)
+	for id, passkey := range s.passkeys {
+		if passkey.UserID == userID {
+			delete(s.passkeys, id)
+		}
+	}
+
+	return nil
+}
+
+// setOptional applies a text field update: nil leaves the field unchanged,
+// an empty string clears it
+func setOptional(field **string, value *string) {
+	switch {
+	case value == nil:
+	case *value == "":
+		*field = nil
+	default:
+		v := *value
+		*field = &v
+	}
+}
+
+// ListAccounts returns a page of the accounts matching filter, ordered by
+// creation time and then ID
+func (s *MemoryStore) ListAccounts(ctx context.Context, filter AccountFilter, page PageRequest) (result *Page[*model.Account], err error) {
+	_, done := instrument(ctx, "list_accounts")
+	defer func() { done(err) }()
+
+	s.mu.RLock()
 	accounts := make([]*model.Account, 0, len(s.accounts))
 	for _, account := range s.accounts {
-		accounts = append(accounts, account)
+		if filter.matches(account) {
+			accounts = append(accounts, account)
+		}
 	}
+	s.mu.RUnlock()
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accountSortKey(accounts[i]).Before(accountSortKey(accounts[j]))
+	})
 
-	return accounts
+	return paginate(accounts, accountSortKey, page)
 }
 
+// accountSortKey orders accounts by creation time, then numeric ID
+func accountSortKey(account *model.Account) SortKey {
+	createdAt, _ := time.Parse(time.RFC3339, account.CreatedAt)
+	id, _ := strconv.ParseInt(account.ID, 10, 64)
+	return SortKey{Time: createdAt, ID: id}
+}
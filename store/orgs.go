@@ -0,0 +1,283 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// Errors returned by organization operations
+var (
+	ErrOrgNotFound        = errors.New("organization not found")
+	ErrOrgConflict        = errors.New("Auth0 organization is already linked to a workspace")
+	ErrMembershipNotFound = errors.New("membership not found")
+	ErrAlreadyMember      = errors.New("already a member of the organization")
+	ErrLastOwner          = errors.New("organization must keep at least one owner")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationExpired  = errors.New("invitation expired")
+)
+
+// CreateOrganization creates an organization with ownerID as its first owner
+func (s *MemoryStore) CreateOrganization(ctx context.Context, name string, auth0OrgID *string, ownerID string) (org *model.Organization, err error) {
+	_, done := instrument(ctx, "create_organization")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if auth0OrgID != nil {
+		for _, existing := range s.orgs {
+			if existing.Auth0OrgID != nil && *existing.Auth0OrgID == *auth0OrgID {
+				return nil, fmt.Errorf("%w: %s", ErrOrgConflict, *auth0OrgID)
+			}
+		}
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	org = &model.Organization{
+		ID:         fmt.Sprintf("org_%d", s.nextOrgID),
+		Name:       name,
+		Auth0OrgID: auth0OrgID,
+		CreatedAt:  now,
+	}
+	s.orgs[org.ID] = org
+	s.memberships[org.ID] = map[string]*model.Membership{
+		ownerID: {OrgID: org.ID, UserID: ownerID, Role: model.OrgRoleOwner, JoinedAt: now},
+	}
+	s.nextOrgID++
+
+	return org, nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (s *MemoryStore) GetOrganization(ctx context.Context, orgID string) (org *model.Organization, err error) {
+	_, done := instrument(ctx, "get_organization")
+	defer func() { done(err) }()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	org, exists := s.orgs[orgID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrOrgNotFound, orgID)
+	}
+
+	return org, nil
+}
+
+// GetMembership retrieves userID's membership of an organization
+func (s *MemoryStore) GetMembership(ctx context.Context, orgID, userID string) (membership *model.Membership, err error) {
+	_, done := instrument(ctx, "get_membership")
+	defer func() { done(err) }()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	membership, exists := s.memberships[orgID][userID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s in %s", ErrMembershipNotFound, userID, orgID)
+	}
+
+	return membership, nil
+}
+
+// ListMemberships returns the members of an organization in the order they joined
+func (s *MemoryStore) ListMemberships(ctx context.Context, orgID string) []*model.Membership {
+	_, done := instrument(ctx, "list_memberships")
+	defer done(nil)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	memberships := make([]*model.Membership, 0, len(s.memberships[orgID]))
+	for _, membership := range s.memberships[orgID] {
+		memberships = append(memberships, membership)
+	}
+	sortMemberships(memberships)
+
+	return memberships
+}
+
+// ListMembershipsByUser returns every membership held by userID
+func (s *MemoryStore) ListMembershipsByUser(ctx context.Context, userID string) []*model.Membership {
+	_, done := instrument(ctx, "list_memberships_by_user")
+	defer done(nil)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var memberships []*model.Membership
+	for _, members := range s.memberships {
+		if membership, ok := members[userID]; ok {
+			memberships = append(memberships, membership)
+		}
+	}
+	sortMemberships(memberships)
+
+	return memberships
+}
+
+// DeleteMembershipsByUser removes every membership held by userID and returns
+// how many were removed. Organizations are kept even if they lose their last owner.
+func (s *MemoryStore) DeleteMembershipsByUser(ctx context.Context, userID string) (removed int) {
+	_, done := instrument(ctx, "delete_memberships_by_user")
+	defer done(nil)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, members := range s.memberships {
+		if _, ok := members[userID]; ok {
+			delete(members, userID)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// SetMemberRole changes a member's role. The last owner cannot be demoted.
+func (s *MemoryStore) SetMemberRole(ctx context.Context, orgID, userID string, role model.OrgRole) (membership *model.Membership, err error) {
+	_, done := instrument(ctx, "set_member_role")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.memberships[orgID][userID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s in %s", ErrMembershipNotFound, userID, orgID)
+	}
+
+	if existing.Role == model.OrgRoleOwner && role != model.OrgRoleOwner {
+		owners := 0
+		for _, m := range s.memberships[orgID] {
+			if m.Role == model.OrgRoleOwner {
+				owners++
+			}
+		}
+		if owners == 1 {
+			return nil, ErrLastOwner
+		}
+	}
+
+	updated := *existing
+	updated.Role = role
+	s.memberships[orgID][userID] = &updated
+
+	return &updated, nil
+}
+
+// CreateInvitation stores a pending invitation identified by the hash of its
+// token, replacing any pending invitation for the same organization and email
+func (s *MemoryStore) CreateInvitation(ctx context.Context, inv model.Invitation, tokenHash string) (created *model.Invitation, err error) {
+	_, done := instrument(ctx, "create_invitation")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.orgs[inv.OrgID]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrOrgNotFound, inv.OrgID)
+	}
+
+	for hash, pending := range s.invitations {
+		if pending.OrgID == inv.OrgID && strings.EqualFold(pending.Email, inv.Email) {
+			delete(s.invitations, hash)
+		}
+	}
+
+	inv.ID = fmt.Sprintf("inv_%d", s.nextInvID)
+	inv.CreatedAt = time.Now().Format(time.RFC3339)
+	s.invitations[tokenHash] = &inv
+	s.nextInvID++
+
+	return &inv, nil
+}
+
+// GetInvitationByTokenHash retrieves a pending invitation by the hash of its token
+func (s *MemoryStore) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (inv *model.Invitation, err error) {
+	_, done := instrument(ctx, "get_invitation")
+	defer func() { done(err) }()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pending, exists := s.invitations[tokenHash]
+	if !exists {
+		return nil, ErrInvitationNotFound
+	}
+
+	return pending, nil
+}
+
+// ListInvitations returns the unexpired pending invitations of an organization
+func (s *MemoryStore) ListInvitations(ctx context.Context, orgID string, now time.Time) []*model.Invitation {
+	_, done := instrument(ctx, "list_invitations")
+	defer done(nil)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invitations := []*model.Invitation{}
+	for _, pending := range s.invitations {
+		if pending.OrgID == orgID && now.Before(pending.ExpiresAtTime) {
+			invitations = append(invitations, pending)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].CreatedAt < invitations[j].CreatedAt })
+
+	return invitations
+}
+
+// AcceptInvitation consumes the invitation with the given token hash and adds
+// userID to its organization with the invited role
+func (s *MemoryStore) AcceptInvitation(ctx context.Context, tokenHash, userID string, now time.Time) (membership *model.Membership, err error) {
+	_, done := instrument(ctx, "accept_invitation")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, exists := s.invitations[tokenHash]
+	if !exists {
+		return nil, ErrInvitationNotFound
+	}
+	if !now.Before(pending.ExpiresAtTime) {
+		delete(s.invitations, tokenHash)
+		return nil, ErrInvitationExpired
+	}
+	members, exists := s.memberships[pending.OrgID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrOrgNotFound, pending.OrgID)
+	}
+	if _, isMember := members[userID]; isMember {
+		return nil, ErrAlreadyMember
+	}
+
+	membership = &model.Membership{
+		OrgID:    pending.OrgID,
+		UserID:   userID,
+		Role:     pending.Role,
+		JoinedAt: now.Format(time.RFC3339),
+	}
+	members[userID] = membership
+	delete(s.invitations, tokenHash)
+
+	return membership, nil
+}
+
+// sortMemberships orders memberships by join time, then user ID
+func sortMemberships(memberships []*model.Membership) {
+	sort.Slice(memberships, func(i, j int) bool {
+		if memberships[i].JoinedAt != memberships[j].JoinedAt {
+			return memberships[i].JoinedAt < memberships[j].JoinedAt
+		}
+		return memberships[i].UserID < memberships[j].UserID
+	})
+}
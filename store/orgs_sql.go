@@ -0,0 +1,434 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// Columns selected, in this order, by every organization, membership and
+// invitation query
+const (
+	orgColumns        = `id, name, auth0_org_id, created_at`
+	membershipColumns = `org_id, user_id, role, joined_at`
+	invitationColumns = `id, org_id, email, role, invited_by, created_at, expires_at`
+)
+
+// CreateOrganization creates an organization with ownerID as its first owner
+func (s *SQLStore) CreateOrganization(ctx context.Context, name string, auth0OrgID *string, ownerID string) (org *model.Organization, err error) {
+	ctx, done := instrument(ctx, "create_organization")
+	defer func() { done(err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := storedNow()
+	row := tx.QueryRowContext(ctx, `INSERT INTO organizations (name, auth0_org_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (auth0_org_id) DO NOTHING
+		RETURNING `+orgColumns, name, auth0OrgID, now)
+	org, err = scanOrganization(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrOrgConflict, *auth0OrgID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert organization: %w", err)
+	}
+
+	orgID, _ := parseOrgID(org.ID)
+	_, err = tx.ExecContext(ctx, `INSERT INTO memberships (org_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)`,
+		orgID, ownerID, string(model.OrgRoleOwner), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert membership: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+	return org, nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (s *SQLStore) GetOrganization(ctx context.Context, orgID string) (org *model.Organization, err error) {
+	ctx, done := instrument(ctx, "get_organization")
+	defer func() { done(err) }()
+
+	id, ok := parseOrgID(orgID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrOrgNotFound, orgID)
+	}
+	row := s.db.QueryRowContext(ctx, `SELECT `+orgColumns+` FROM organizations WHERE id = $1`, id)
+	org, err = scanOrganization(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrOrgNotFound, orgID)
+	}
+	return org, err
+}
+
+// GetMembership retrieves userID's membership of an organization
+func (s *SQLStore) GetMembership(ctx context.Context, orgID, userID string) (membership *model.Membership, err error) {
+	ctx, done := instrument(ctx, "get_membership")
+	defer func() { done(err) }()
+
+	id, ok := parseOrgID(orgID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s in %s", ErrMembershipNotFound, userID, orgID)
+	}
+	row := s.db.QueryRowContext(ctx, `SELECT `+membershipColumns+` FROM memberships WHERE org_id = $1 AND user_id = $2`, id, userID)
+	membership, err = scanMembership(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s in %s", ErrMembershipNotFound, userID, orgID)
+	}
+	return membership, err
+}
+
+// ListMemberships returns the members of an organization in the order they joined
+func (s *SQLStore) ListMemberships(ctx context.Context, orgID string) []*model.Membership {
+	ctx, done := instrument(ctx, "list_memberships")
+
+	id, ok := parseOrgID(orgID)
+	if !ok {
+		done(nil)
+		return []*model.Membership{}
+	}
+	memberships, err := s.queryMemberships(ctx, `WHERE org_id = $1`, id)
+	done(err)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list memberships", "error", err)
+		return []*model.Membership{}
+	}
+	return memberships
+}
+
+// ListMembershipsByUser returns every membership held by userID
+func (s *SQLStore) ListMembershipsByUser(ctx context.Context, userID string) []*model.Membership {
+	ctx, done := instrument(ctx, "list_memberships_by_user")
+
+	memberships, err := s.queryMemberships(ctx, `WHERE user_id = $1`, userID)
+	done(err)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list memberships", "error", err)
+		return nil
+	}
+	return memberships
+}
+
+// queryMemberships loads the memberships matching where, ordered by join
+// time, then user ID
+func (s *SQLStore) queryMemberships(ctx context.Context, where string, args ...any) ([]*model.Membership, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+membershipColumns+` FROM memberships `+where+` ORDER BY joined_at, user_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query memberships: %w", err)
+	}
+	defer rows.Close()
+
+	memberships := []*model.Membership{}
+	for rows.Next() {
+		membership, err := scanMembership(rows)
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, membership)
+	}
+	return memberships, rows.Err()
+}
+
+// DeleteMembershipsByUser removes every membership held by userID and returns
+// how many were removed. Organizations are kept even if they lose their last owner.
+func (s *SQLStore) DeleteMembershipsByUser(ctx context.Context, userID string) int {
+	ctx, done := instrument(ctx, "delete_memberships_by_user")
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM memberships WHERE user_id = $1`, userID)
+	done(err)
+	if err != nil {
+		// The purge job retries on its next run
+		slog.ErrorContext(ctx, "failed to delete memberships", "error", err)
+		return 0
+	}
+	removed, _ := result.RowsAffected()
+	return int(removed)
+}
+
+// SetMemberRole changes a member's role. The last owner cannot be demoted.
+func (s *SQLStore) SetMemberRole(ctx context.Context, orgID, userID string, role model.OrgRole) (membership *model.Membership, err error) {
+	ctx, done := instrument(ctx, "set_member_role")
+	defer func() { done(err) }()
+
+	id, ok := parseOrgID(orgID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s in %s", ErrMembershipNotFound, userID, orgID)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to change member role: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the organization serializes role changes, so two owners can't
+	// demote each other at once
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM organizations WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return nil, fmt.Errorf("failed to lock organization: %w", err)
+	}
+
+	existing, err := scanMembership(tx.QueryRowContext(ctx, `SELECT `+membershipColumns+` FROM memberships
+		WHERE org_id = $1 AND user_id = $2`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s in %s", ErrMembershipNotFound, userID, orgID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.Role == model.OrgRoleOwner && role != model.OrgRoleOwner {
+		var owners int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM memberships WHERE org_id = $1 AND role = $2`,
+			id, string(model.OrgRoleOwner)).Scan(&owners)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count owners: %w", err)
+		}
+		if owners == 1 {
+			return nil, ErrLastOwner
+		}
+	}
+
+	membership, err = scanMembership(tx.QueryRowContext(ctx, `UPDATE memberships SET role = $3
+		WHERE org_id = $1 AND user_id = $2
+		RETURNING `+membershipColumns, id, userID, string(role)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update membership: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to change member role: %w", err)
+	}
+	return membership, nil
+}
+
+// CreateInvitation stores a pending invitation identified by the hash of its
+// token, replacing any pending invitation for the same organization and email
+func (s *SQLStore) CreateInvitation(ctx context.Context, inv model.Invitation, tokenHash string) (created *model.Invitation, err error) {
+	ctx, done := instrument(ctx, "create_invitation")
+	defer func() { done(err) }()
+
+	id, ok := parseOrgID(inv.OrgID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrOrgNotFound, inv.OrgID)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM organizations WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to query organization: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrOrgNotFound, inv.OrgID)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM invitations WHERE org_id = $1 AND lower(email) = lower($2)`, id, inv.Email); err != nil {
+		return nil, fmt.Errorf("failed to replace invitation: %w", err)
+	}
+	row := tx.QueryRowContext(ctx, `INSERT INTO invitations (token_hash, org_id, email, role, invited_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+invitationColumns,
+		tokenHash, id, inv.Email, string(inv.Role), inv.InvitedBy, storedNow(), inv.ExpiresAtTime)
+	created, err = scanInvitation(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert invitation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+	return created, nil
+}
+
+// GetInvitationByTokenHash retrieves a pending invitation by the hash of its token
+func (s *SQLStore) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (inv *model.Invitation, err error) {
+	ctx, done := instrument(ctx, "get_invitation")
+	defer func() { done(err) }()
+
+	row := s.db.QueryRowContext(ctx, `SELECT `+invitationColumns+` FROM invitations WHERE token_hash = $1`, tokenHash)
+	inv, err = scanInvitation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+	return inv, err
+}
+
+// ListInvitations returns the unexpired pending invitations of an organization
+func (s *SQLStore) ListInvitations(ctx context.Context, orgID string, now time.Time) []*model.Invitation {
+	ctx, done := instrument(ctx, "list_invitations")
+
+	id, ok := parseOrgID(orgID)
+	if !ok {
+		done(nil)
+		return []*model.Invitation{}
+	}
+	invitations, err := s.queryInvitations(ctx, id, now)
+	done(err)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list invitations", "error", err)
+		return []*model.Invitation{}
+	}
+	return invitations
+}
+
+// queryInvitations loads the invitations of an organization unexpired at now
+func (s *SQLStore) queryInvitations(ctx context.Context, orgID int64, now time.Time) ([]*model.Invitation, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+invitationColumns+` FROM invitations
+		WHERE org_id = $1 AND expires_at > $2 ORDER BY created_at, id`, orgID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []*model.Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// AcceptInvitation consumes the invitation with the given token hash and adds
+// userID to its organization with the invited role
+func (s *SQLStore) AcceptInvitation(ctx context.Context, tokenHash, userID string, now time.Time) (membership *model.Membership, err error) {
+	ctx, done := instrument(ctx, "accept_invitation")
+	defer func() { done(err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Deleting the invitation up front lets only one caller consume it
+	pending, err := scanInvitation(tx.QueryRowContext(ctx, `DELETE FROM invitations WHERE token_hash = $1
+		RETURNING `+invitationColumns, tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(pending.ExpiresAtTime) {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to delete expired invitation: %w", err)
+		}
+		return nil, ErrInvitationExpired
+	}
+
+	// An existing member keeps the invitation, as with MemoryStore
+	orgID, _ := parseOrgID(pending.OrgID)
+	membership, err = scanMembership(tx.QueryRowContext(ctx, `INSERT INTO memberships (org_id, user_id, role, joined_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (org_id, user_id) DO NOTHING
+		RETURNING `+membershipColumns, orgID, userID, string(pending.Role), now.Truncate(time.Second)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAlreadyMember
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert membership: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+	return membership, nil
+}
+
+// parseOrgID returns the row ID of an organization ID such as "org_12"
+func parseOrgID(orgID string) (int64, bool) {
+	digits, ok := strings.CutPrefix(orgID, "org_")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(digits, 10, 64)
+	return id, err == nil
+}
+
+// formatOrgID returns the organization ID of a row ID, matching MemoryStore
+func formatOrgID(id int64) string {
+	return fmt.Sprintf("org_%d", id)
+}
+
+// scanOrganization reads a row of orgColumns
+func scanOrganization(row interface{ Scan(...any) error }) (*model.Organization, error) {
+	var id int64
+	var org model.Organization
+	var auth0OrgID sql.NullString
+	var createdAt time.Time
+	err := row.Scan(&id, &org.Name, &auth0OrgID, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan organization: %w", err)
+	}
+
+	org.ID = formatOrgID(id)
+	org.Auth0OrgID = nullableString(auth0OrgID)
+	org.CreatedAt = createdAt.Format(time.RFC3339)
+	return &org, nil
+}
+
+// scanMembership reads a row of membershipColumns
+func scanMembership(row interface{ Scan(...any) error }) (*model.Membership, error) {
+	var orgID int64
+	var membership model.Membership
+	var role string
+	var joinedAt time.Time
+	err := row.Scan(&orgID, &membership.UserID, &role, &joinedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan membership: %w", err)
+	}
+
+	membership.OrgID = formatOrgID(orgID)
+	membership.Role = model.OrgRole(role)
+	membership.JoinedAt = joinedAt.Format(time.RFC3339)
+	return &membership, nil
+}
+
+// scanInvitation reads a row of invitationColumns
+func scanInvitation(row interface{ Scan(...any) error }) (*model.Invitation, error) {
+	var id, orgID int64
+	var inv model.Invitation
+	var role string
+	var createdAt time.Time
+	err := row.Scan(&id, &orgID, &inv.Email, &role, &inv.InvitedBy, &createdAt, &inv.ExpiresAtTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan invitation: %w", err)
+	}
+
+	inv.ID = fmt.Sprintf("inv_%d", id)
+	inv.OrgID = formatOrgID(orgID)
+	inv.Role = model.OrgRole(role)
+	inv.CreatedAt = createdAt.Format(time.RFC3339)
+	inv.ExpiresAt = inv.ExpiresAtTime.Format(time.RFC3339)
+	return &inv, nil
+}
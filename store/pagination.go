@@ -0,0 +1,178 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page size limits for paginated listings
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Errors returned for malformed page requests
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidPage   = errors.New("invalid page request")
+)
+
+// cursorVersion prefixes encoded cursors so the format can change later
+const cursorVersion = "v1"
+
+// PageRequest selects a page of a listing with Relay connection semantics:
+// After and Before narrow the listing, then First takes items from the start
+// or Last from the end. First and Last can't be combined; with neither set
+// the first DefaultPageSize items are returned.
+type PageRequest struct {
+	First  *int
+	After  *string
+	Last   *int
+	Before *string
+}
+
+// Edge is an item of a page and the cursor pointing at it
+type Edge[T any] struct {
+	Cursor string
+	Node   T
+}
+
+// Page is one page of a listing
+type Page[T any] struct {
+	Edges           []Edge[T]
+	HasNextPage     bool
+	HasPreviousPage bool
+	TotalCount      int // items matching the filter, ignoring the page bounds
+}
+
+// SortKey is the position of an item in a listing ordered by time, then by
+// ID to break ties. Every store orders listings the same way so cursors mean
+// the same thing regardless of the backend.
+type SortKey struct {
+	Time time.Time
+	ID   int64
+}
+
+// Before reports whether k sorts before other
+func (k SortKey) Before(other SortKey) bool {
+	if !k.Time.Equal(other.Time) {
+		return k.Time.Before(other.Time)
+	}
+	return k.ID < other.ID
+}
+
+// Cursor encodes k as an opaque cursor
+func (k SortKey) Cursor() string {
+	raw := fmt.Sprintf("%s:%d:%d", cursorVersion, k.Time.UnixNano(), k.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseCursor decodes a cursor created by SortKey.Cursor
+func parseCursor(cursor string) (SortKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return SortKey{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || parts[0] != cursorVersion {
+		return SortKey{}, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return SortKey{}, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return SortKey{}, ErrInvalidCursor
+	}
+	return SortKey{Time: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
+
+// pageBounds is a validated PageRequest
+type pageBounds struct {
+	after   *SortKey
+	before  *SortKey
+	limit   int
+	fromEnd bool // take the last limit items rather than the first
+}
+
+// bounds validates the request and decodes its cursors
+func (p PageRequest) bounds() (pageBounds, error) {
+	b := pageBounds{limit: DefaultPageSize}
+
+	switch {
+	case p.First != nil && p.Last != nil:
+		return b, fmt.Errorf("%w: first and last can't be combined", ErrInvalidPage)
+	case p.First != nil:
+		b.limit = *p.First
+	case p.Last != nil:
+		b.limit = *p.Last
+		b.fromEnd = true
+	}
+	if b.limit < 0 || b.limit > MaxPageSize {
+		return b, fmt.Errorf("%w: page size must be between 0 and %d", ErrInvalidPage, MaxPageSize)
+	}
+
+	if p.After != nil {
+		key, err := parseCursor(*p.After)
+		if err != nil {
+			return b, fmt.Errorf("%w: after", err)
+		}
+		b.after = &key
+	}
+	if p.Before != nil {
+		key, err := parseCursor(*p.Before)
+		if err != nil {
+			return b, fmt.Errorf("%w: before", err)
+		}
+		b.before = &key
+	}
+
+	return b, nil
+}
+
+// paginate returns a page of items, which must be sorted by key and already filtered
+func paginate[T any](items []T, key func(T) SortKey, page PageRequest) (*Page[T], error) {
+	bounds, err := page.bounds()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Page[T]{TotalCount: len(items)}
+
+	// Narrow to the items strictly between the cursors
+	start, end := 0, len(items)
+	if bounds.after != nil {
+		for start < end && !bounds.after.Before(key(items[start])) {
+			start++
+		}
+		result.HasPreviousPage = start > 0
+	}
+	if bounds.before != nil {
+		for end > start && !key(items[end-1]).Before(*bounds.before) {
+			end--
+		}
+		result.HasNextPage = end < len(items)
+	}
+
+	if bounds.fromEnd {
+		if end-start > bounds.limit {
+			start = end - bounds.limit
+			result.HasPreviousPage = true
+		}
+	} else if end-start > bounds.limit {
+		end = start + bounds.limit
+		result.HasNextPage = true
+	}
+
+	result.Edges = make([]Edge[T], 0, end-start)
+	for _, item := range items[start:end] {
+		result.Edges = append(result.Edges, Edge[T]{Cursor: key(item).Cursor(), Node: item})
+	}
+
+	return result, nil
+}
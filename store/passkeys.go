@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// Errors returned by passkey operations
+var (
+	ErrPasskeyNotFound = errors.New("passkey not found")
+	ErrPasskeyConflict = errors.New("passkey already registered")
+	ErrPasskeyCounter  = errors.New("passkey signature counter did not increase")
+)
+
+// AddPasskey registers a passkey to the account of passkey.UserID
+func (s *MemoryStore) AddPasskey(ctx context.Context, passkey model.Passkey) (added *model.Passkey, err error) {
+	_, done := instrument(ctx, "add_passkey")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.accounts[passkey.UserID]; !exists {
+		return nil, fmt.Errorf("%w for user ID: %s", ErrNotFound, passkey.UserID)
+	}
+	if _, exists := s.passkeys[passkey.ID]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrPasskeyConflict, passkey.ID)
+	}
+
+	passkey.CreatedAt = time.Now().Format(time.RFC3339)
+	passkey.LastUsedAt = nil
+	if passkey.Transports == nil {
+		passkey.Transports = []string{}
+	}
+	s.passkeys[passkey.ID] = &passkey
+
+	return copyPasskey(&passkey), nil
+}
+
+// GetPasskey retrieves a passkey by credential ID
+func (s *MemoryStore) GetPasskey(ctx context.Context, credentialID string) (passkey *model.Passkey, err error) {
+	_, done := instrument(ctx, "get_passkey")
+	defer func() { done(err) }()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	passkey, exists := s.passkeys[credentialID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrPasskeyNotFound, credentialID)
+	}
+
+	return copyPasskey(passkey), nil
+}
+
+// ListPasskeys returns the passkeys of userID, oldest first
+func (s *MemoryStore) ListPasskeys(ctx context.Context, userID string) []*model.Passkey {
+	_, done := instrument(ctx, "list_passkeys")
+	defer done(nil)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	passkeys := []*model.Passkey{}
+	for _, passkey := range s.passkeys {
+		if passkey.UserID == userID {
+			passkeys = append(passkeys, copyPasskey(passkey))
+		}
+	}
+	sort.Slice(passkeys, func(i, j int) bool {
+		if passkeys[i].CreatedAt != passkeys[j].CreatedAt {
+			return passkeys[i].CreatedAt < passkeys[j].CreatedAt
+		}
+		return passkeys[i].ID < passkeys[j].ID
+	})
+
+	return passkeys
+}
+
+// RecordPasskeyUse stores the signature counter and backup state reported
+// by a successful assertion. The counter is compared and set at once: it
+// fails with ErrPasskeyCounter unless signCount is above the stored counter
+// or both are zero, for authenticators that don't count.
+func (s *MemoryStore) RecordPasskeyUse(ctx context.Context, credentialID string, signCount uint32, backedUp bool, usedAt time.Time) (passkey *model.Passkey, err error) {
+	_, done := instrument(ctx, "record_passkey_use")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.passkeys[credentialID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrPasskeyNotFound, credentialID)
+	}
+	if signCount <= existing.SignCount && (signCount != 0 || existing.SignCount != 0) {
+		return nil, fmt.Errorf("%w: %d after %d", ErrPasskeyCounter, signCount, existing.SignCount)
+	}
+
+	updated := *existing
+	updated.SignCount = signCount
+	updated.BackedUp = backedUp
+	lastUsed := usedAt.Format(time.RFC3339)
+	updated.LastUsedAt = &lastUsed
+	s.passkeys[credentialID] = &updated
+
+	return copyPasskey(&updated), nil
+}
+
+// DeletePasskey removes a passkey of userID
+func (s *MemoryStore) DeletePasskey(ctx context.Context, userID, credentialID string) (err error) {
+	_, done := instrument(ctx, "delete_passkey")
+	defer func() { done(err) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	passkey, exists := s.passkeys[credentialID]
+	if !exists || passkey.UserID != userID {
+		return fmt.Errorf("%w: %s", ErrPasskeyNotFound, credentialID)
+	}
+	delete(s.passkeys, credentialID)
+
+	return nil
+}
+
+// copyPasskey returns a copy of a stored passkey that callers may change
+func copyPasskey(passkey *model.Passkey) *model.Passkey {
+	copied := *passkey
+	copied.Transports = append([]string{}, passkey.Transports...)
+	copied.PublicKey = append([]byte(nil), passkey.PublicKey...)
+	if passkey.LastUsedAt != nil {
+		lastUsed := *passkey.LastUsedAt
+		copied.LastUsedAt = &lastUsed
+	}
+	return &copied
+}
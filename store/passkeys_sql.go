@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// passkeyColumns are selected, in this order, by every passkey query
+const passkeyColumns = `credential_id, user_id, name, public_key, sign_count, aaguid,
+	attestation_format, transports, backup_eligible, backed_up, created_at, last_used_at`
+
+// AddPasskey registers a passkey to the account of passkey.UserID
+func (s *SQLStore) AddPasskey(ctx context.Context, passkey model.Passkey) (added *model.Passkey, err error) {
+	ctx, done := instrument(ctx, "add_passkey")
+	defer func() { done(err) }()
+
+	if _, err := s.getAccount(ctx, passkey.UserID); err != nil {
+		return nil, err
+	}
+
+	row := s.db.QueryRowContext(ctx, `INSERT INTO passkeys (credential_id, user_id, name, public_key, sign_count, aaguid,
+			attestation_format, transports, backup_eligible, backed_up, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (credential_id) DO NOTHING
+		RETURNING `+passkeyColumns,
+		passkey.ID, passkey.UserID, passkey.Name, passkey.PublicKey, int64(passkey.SignCount), passkey.Aaguid,
+		passkey.AttestationFormat, strings.Join(passkey.Transports, ","), passkey.BackupEligible, passkey.BackedUp, time.Now(),
+	)
+	added, err = scanPasskey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrPasskeyConflict, passkey.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert passkey: %w", err)
+	}
+	return added, nil
+}
+
+// GetPasskey retrieves a passkey by credential ID
+func (s *SQLStore) GetPasskey(ctx context.Context, credentialID string) (passkey *model.Passkey, err error) {
+	ctx, done := instrument(ctx, "get_passkey")
+	defer func() { done(err) }()
+
+	row := s.db.QueryRowContext(ctx, `SELECT `+passkeyColumns+` FROM passkeys WHERE credential_id = $1`, credentialID)
+	passkey, err = scanPasskey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrPasskeyNotFound, credentialID)
+	}
+	return passkey, err
+}
+
+// ListPasskeys returns the passkeys of userID, oldest first
+func (s *SQLStore) ListPasskeys(ctx context.Context, userID string) []*model.Passkey {
+	ctx, done := instrument(ctx, "list_passkeys")
+
+	passkeys, err := s.queryPasskeys(ctx, userID)
+	done(err)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list passkeys", "error", err)
+		return []*model.Passkey{}
+	}
+	return passkeys
+}
+
+// queryPasskeys loads the passkeys of userID
+func (s *SQLStore) queryPasskeys(ctx context.Context, userID string) ([]*model.Passkey, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+passkeyColumns+` FROM passkeys
+		WHERE user_id = $1 ORDER BY created_at, credential_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	passkeys := []*model.Passkey{}
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	return passkeys, rows.Err()
+}
+
+// RecordPasskeyUse stores the signature counter and backup state reported
+// by a successful assertion. The counter is compared and set in one
+// statement, so of two logins racing with the same counter only one wins.
+func (s *SQLStore) RecordPasskeyUse(ctx context.Context, credentialID string, signCount uint32, backedUp bool, usedAt time.Time) (passkey *model.Passkey, err error) {
+	ctx, done := instrument(ctx, "record_passkey_use")
+	defer func() { done(err) }()
+
+	row := s.db.QueryRowContext(ctx, `UPDATE passkeys SET sign_count = $2, backed_up = $3, last_used_at = $4
+		WHERE credential_id = $1 AND (sign_count < $2 OR ($2 = 0 AND sign_count = 0))
+		RETURNING `+passkeyColumns, credentialID, int64(signCount), backedUp, usedAt)
+	passkey, err = scanPasskey(row)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return passkey, err
+	}
+
+	// Nothing was updated: tell a missing passkey from a stale counter
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM passkeys WHERE credential_id = $1)`, credentialID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check passkey: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrPasskeyNotFound, credentialID)
+	}
+	return nil, fmt.Errorf("%w: %d", ErrPasskeyCounter, signCount)
+}
+
+// DeletePasskey removes a passkey of userID
+func (s *SQLStore) DeletePasskey(ctx context.Context, userID, credentialID string) (err error) {
+	ctx, done := instrument(ctx, "delete_passkey")
+	defer func() { done(err) }()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM passkeys WHERE credential_id = $1 AND user_id = $2`, credentialID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrPasskeyNotFound, credentialID)
+	}
+
+	return nil
+}
+
+// scanPasskey reads a row of passkeyColumns
+func scanPasskey(row interface{ Scan(...any) error }) (*model.Passkey, error) {
+	var (
+		passkey    model.Passkey
+		signCount  int64
+		transports string
+		createdAt  time.Time
+		lastUsedAt sql.NullTime
+	)
+	err := row.Scan(
+		&passkey.ID, &passkey.UserID, &passkey.Name, &passkey.PublicKey, &signCount, &passkey.Aaguid,
+		&passkey.AttestationFormat, &transports, &passkey.BackupEligible, &passkey.BackedUp, &createdAt, &lastUsedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan passkey: %w", err)
+	}
+
+	passkey.SignCount = uint32(signCount)
+	passkey.Transports = []string{}
+	if transports != "" {
+		passkey.Transports = strings.Split(transports, ",")
+	}
+	passkey.CreatedAt = createdAt.Format(time.RFC3339)
+	if lastUsedAt.Valid {
+		lastUsed := lastUsedAt.Time.Format(time.RFC3339)
+		passkey.LastUsedAt = &lastUsed
+	}
+
+	return &passkey, nil
+}
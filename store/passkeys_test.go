@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// newPasskeyStore returns a store with a passkey of auth0|user1
+func newPasskeyStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	ctx := context.Background()
+	s := NewMemoryStore()
+	if _, err := s.CreateAccount(ctx, "auth0|user1", "user1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	passkey := model.Passkey{ID: "credential", UserID: "auth0|user1", Name: "Phone", PublicKey: []byte{1, 2, 3}, Transports: []string{"internal"}}
+	if _, err := s.AddPasskey(ctx, passkey); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestGetPasskeyReturnsCopy(t *testing.T) {
+	ctx := context.Background()
+	s := newPasskeyStore(t)
+
+	passkey, err := s.GetPasskey(ctx, "credential")
+	if err != nil {
+		t.Fatalf("GetPasskey() error = %v", err)
+	}
+	passkey.SignCount = 100
+	passkey.PublicKey[0] = 9
+	passkey.Transports[0] = "usb"
+	s.ListPasskeys(ctx, "auth0|user1")[0].Name = "Changed"
+
+	stored, _ := s.GetPasskey(ctx, "credential")
+	if stored.SignCount != 0 || stored.PublicKey[0] != 1 || stored.Transports[0] != "internal" || stored.Name != "Phone" {
+		t.Errorf("stored passkey = %+v, want it unchanged by callers", stored)
+	}
+}
+
+func TestRecordPasskeyUseComparesCounter(t *testing.T) {
+	ctx := context.Background()
+	s := newPasskeyStore(t)
+
+	tests := []struct {
+		signCount uint32
+		wantErr   error
+	}{
+		{0, nil}, // zero after zero: the authenticator doesn't count
+		{0, nil},
+		{5, nil},
+		{5, ErrPasskeyCounter},
+		{3, ErrPasskeyCounter},
+		{0, ErrPasskeyCounter},
+		{6, nil},
+	}
+	for _, tt := range tests {
+		_, err := s.RecordPasskeyUse(ctx, "credential", tt.signCount, false, time.Now())
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("RecordPasskeyUse(%d) error = %v, want %v", tt.signCount, err, tt.wantErr)
+		}
+	}
+	if passkey, _ := s.GetPasskey(ctx, "credential"); passkey.SignCount != 6 {
+		t.Errorf("stored counter = %d, want 6", passkey.SignCount)
+	}
+
+	if _, err := s.RecordPasskeyUse(ctx, "unknown", 1, false, time.Now()); !errors.Is(err, ErrPasskeyNotFound) {
+		t.Errorf("RecordPasskeyUse() of an unknown passkey error = %v, want %v", err, ErrPasskeyNotFound)
+	}
+}
@@ -0,0 +1,525 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// accountColumns are selected, in this order, by every account query
+const accountColumns = `id, user_id, email, display_name, avatar_url, locale, timezone,
+	marketing_email_opt_in, marketing_push_opt_in, source,
+	created_at, updated_at, email_updated_at, deletion_scheduled_at, email_verified`
+
+// SQLStore keeps accounts, passkeys, service clients and organizations in
+// PostgreSQL tables
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a store using db, creating its tables if needed
+func NewSQLStore(ctx context.Context, db *sql.DB) (*SQLStore, error) {
+	schema := []string{
+		`CREATE TABLE IF NOT EXISTS accounts (
+			id                     BIGSERIAL PRIMARY KEY,
+			user_id                TEXT NOT NULL UNIQUE,
+			email                  TEXT NOT NULL,
+			display_name           TEXT,
+			avatar_url             TEXT,
+			locale                 TEXT,
+			timezone               TEXT,
+			marketing_email_opt_in BOOLEAN NOT NULL DEFAULT FALSE,
+			marketing_push_opt_in  BOOLEAN NOT NULL DEFAULT FALSE,
+			source                 TEXT NOT NULL DEFAULT 'AUTH0',
+			created_at             TIMESTAMPTZ NOT NULL,
+			updated_at             TIMESTAMPTZ NOT NULL,
+			email_updated_at       TIMESTAMPTZ NOT NULL,
+			deletion_scheduled_at  TIMESTAMPTZ,
+			email_verified         BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		// Tables created before verification was tracked start unverified;
+		// a verified token claim for the address verifies it
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE`,
+		`CREATE INDEX IF NOT EXISTS accounts_created_at_id ON accounts (created_at, id)`,
+		`CREATE INDEX IF NOT EXISTS accounts_email ON accounts (lower(email))`,
+		`CREATE TABLE IF NOT EXISTS passkeys (
+			credential_id      TEXT PRIMARY KEY,
+			user_id            TEXT NOT NULL REFERENCES accounts (user_id) ON DELETE CASCADE,
+			name               TEXT NOT NULL,
+			public_key         BYTEA NOT NULL,
+			sign_count         BIGINT NOT NULL,
+			aaguid             TEXT NOT NULL,
+			attestation_format TEXT NOT NULL,
+			transports         TEXT NOT NULL DEFAULT '',
+			backup_eligible    BOOLEAN NOT NULL,
+			backed_up          BOOLEAN NOT NULL,
+			created_at         TIMESTAMPTZ NOT NULL,
+			last_used_at       TIMESTAMPTZ
+		)`,
+		`CREATE INDEX IF NOT EXISTS passkeys_user_id ON passkeys (user_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS service_clients (
+			client_id   TEXT PRIMARY KEY,
+			name        TEXT NOT NULL,
+			permissions TEXT NOT NULL DEFAULT '',
+			created_at  TIMESTAMPTZ NOT NULL,
+			updated_at  TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS organizations (
+			id           BIGSERIAL PRIMARY KEY,
+			name         TEXT NOT NULL,
+			auth0_org_id TEXT UNIQUE,
+			created_at   TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS memberships (
+			org_id    BIGINT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+			user_id   TEXT NOT NULL,
+			role      TEXT NOT NULL,
+			joined_at TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY (org_id, user_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS memberships_user_id ON memberships (user_id)`,
+		`CREATE TABLE IF NOT EXISTS invitations (
+			id         BIGSERIAL PRIMARY KEY,
+			token_hash TEXT NOT NULL UNIQUE,
+			org_id     BIGINT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+			email      TEXT NOT NULL,
+			role       TEXT NOT NULL,
+			invited_by TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS invitations_org_email ON invitations (org_id, lower(email))`,
+	}
+	for _, statement := range schema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return nil, fmt.Errorf("failed to create tables: %w", err)
+		}
+	}
+
+	return &SQLStore{db: db}, nil
+}
+
+// storedNow returns the current time at the precision MemoryStore keeps,
+// which is the RFC 3339 seconds it returns. Storing created_at the same way
+// makes cursors and createdAfter/createdBefore filters behave alike on both
+// backends.
+func storedNow() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+// GetAccountByUserID retrieves an account by Auth0 user ID
+func (s *SQLStore) GetAccountByUserID(ctx context.Context, userID string) (account *model.Account, err error) {
+	ctx, done := instrument(ctx, "get_account_by_user_id")
+	defer func() { done(err) }()
+
+	return s.getAccount(ctx, userID)
+}
+
+// getAccount loads an account without instrumenting the call
+func (s *SQLStore) getAccount(ctx context.Context, userID string) (*model.Account, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts WHERE user_id = $1`, userID)
+	account, _, err := scanAccount(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w for user ID: %s", ErrNotFound, userID)
+	}
+	return account, err
+}
+
+// GetAccountByEmail retrieves the oldest account with email, ignoring case
+func (s *SQLStore) GetAccountByEmail(ctx context.Context, email string) (account *model.Account, err error) {
+	ctx, done := instrument(ctx, "get_account_by_email")
+	defer func() { done(err) }()
+
+	row := s.db.QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts
+		WHERE lower(email) = lower($1) ORDER BY created_at, id LIMIT 1`, email)
+	account, _, err = scanAccount(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w for email: %s", ErrNotFound, email)
+	}
+	return account, err
+}
+
+// GetAccountByVerifiedEmail retrieves the oldest account whose email is
+// email, ignoring case, and verified
+func (s *SQLStore) GetAccountByVerifiedEmail(ctx context.Context, email string) (account *model.Account, err error) {
+	ctx, done := instrument(ctx, "get_account_by_verified_email")
+	defer func() { done(err) }()
+
+	row := s.db.QueryRowContext(ctx, `SELECT `+accountColumns+` FROM accounts
+		WHERE lower(email) = lower($1) AND email_verified ORDER BY created_at, id LIMIT 1`, email)
+	account, _, err = scanAccount(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w for verified email: %s", ErrNotFound, email)
+	}
+	return account, err
+}
+
+// CreateAccount creates a new account, or returns the existing one
+func (s *SQLStore) CreateAccount(ctx context.Context, userID, email string) (account *model.Account, err error) {
+	ctx, done := instrument(ctx, "create_account")
+	defer func() { done(err) }()
+
+	account, _, err = s.insertAccount(ctx, userID, email, false, model.AccountSourceAuth0)
+	return account, err
+}
+
+// CreateAccountIfNotExists creates an account if it doesn't exist, otherwise returns existing.
+// created reports whether a new account was created. emailVerified records
+// whether the identity provider verified email.
+func (s *SQLStore) CreateAccountIfNotExists(ctx context.Context, userID, email string, emailVerified bool, source model.AccountSource) (account *model.Account, created bool, err error) {
+	ctx, done := instrument(ctx, "create_account_if_not_exists")
+	defer func() { done(err) }()
+
+	return s.insertAccount(ctx, userID, email, emailVerified, source)
+}
+
+// insertAccount inserts an account unless one exists for userID
+func (s *SQLStore) insertAccount(ctx context.Context, userID, email string, emailVerified bool, source model.AccountSource) (*model.Account, bool, error) {
+	now := storedNow()
+	row := s.db.QueryRowContext(ctx, `INSERT INTO accounts (user_id, email, source, created_at, updated_at, email_updated_at, email_verified)
+		VALUES ($1, $2, $3, $4, $4, $4, $5)
+		ON CONFLICT (user_id) DO NOTHING
+		RETURNING `+accountColumns, userID, email, string(source), now, emailVerified && email != "")
+	account, _, err := scanAccount(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		account, err = s.getAccount(ctx, userID)
+		return account, false, err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to insert account: %w", err)
+	}
+	return account, true, nil
+}
+
+// UpdateAccount applies update to the account for userID
+func (s *SQLStore) UpdateAccount(ctx context.Context, userID string, update AccountUpdate) (account *model.Account, err error) {
+	ctx, done := instrument(ctx, "update_account")
+	defer func() { done(err) }()
+
+	// Each text field takes a "set" flag and a value; NULLIF turns an empty
+	// string into NULL, matching setOptional
+	args := []any{userID, time.Now()}
+	assignments := []string{"updated_at = $2"}
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{
+		{"display_name", update.DisplayName},
+		{"avatar_url", update.AvatarURL},
+		{"locale", update.Locale},
+		{"timezone", update.Timezone},
+	} {
+		if field.value != nil {
+			args = append(args, *field.value)
+			assignments = append(assignments, fmt.Sprintf("%s = NULLIF($%d, '')", field.column, len(args)))
+		}
+	}
+	if update.MarketingEmailOptIn != nil {
+		args = append(args, *update.MarketingEmailOptIn)
+		assignments = append(assignments, fmt.Sprintf("marketing_email_opt_in = $%d", len(args)))
+	}
+	if update.MarketingPushOptIn != nil {
+		args = append(args, *update.MarketingPushOptIn)
+		assignments = append(assignments, fmt.Sprintf("marketing_push_opt_in = $%d", len(args)))
+	}
+
+	row := s.db.QueryRowContext(ctx, `UPDATE accounts SET `+strings.Join(assignments, ", ")+`
+		WHERE user_id = $1 AND deletion_scheduled_at IS NULL
+		RETURNING `+accountColumns, args...)
+	account, _, err = scanAccount(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, s.notUpdatable(ctx, userID)
+	}
+	return account, err
+}
+
+// UpdateEmail replaces the email address of the account for userID with
+// one verified to be the user's
+func (s *SQLStore) UpdateEmail(ctx context.Context, userID, email string) (account *model.Account, err error) {
+	ctx, done := instrument(ctx, "update_email")
+	defer func() { done(err) }()
+
+	row := s.db.QueryRowContext(ctx, `UPDATE accounts SET email = $2, email_updated_at = $3, updated_at = $3, email_verified = TRUE
+		WHERE user_id = $1 AND deletion_scheduled_at IS NULL
+		RETURNING `+accountColumns, userID, email, time.Now())
+	account, _, err = scanAccount(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, s.notUpdatable(ctx, userID)
+	}
+	return account, err
+}
+
+// notUpdatable explains why an update guarded by "deletion_scheduled_at IS
+// NULL" matched no row
+func (s *SQLStore) notUpdatable(ctx context.Context, userID string) error {
+	if _, err := s.getAccount(ctx, userID); err != nil {
+		return err
+	}
+	return ErrPendingDeletion
+}
+
+// ScheduleDeletion marks the account for userID to be purged at purgeAt.
+// An account already scheduled for deletion is returned unchanged.
+func (s *SQLStore) ScheduleDeletion(ctx context.Context, userID string, purgeAt time.Time) (account *model.Account, err error) {
+	ctx, done := instrument(ctx, "schedule_deletion")
+	defer func() { done(err) }()
+
+	row := s.db.QueryRowContext(ctx, `UPDATE accounts SET deletion_scheduled_at = $2, updated_at = $3
+		WHERE user_id = $1 AND deletion_scheduled_at IS NULL
+		RETURNING `+accountColumns, userID, purgeAt, time.Now())
+	account, _, err = scanAccount(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.getAccount(ctx, userID)
+	}
+	return account, err
+}
+
+// CancelDeletion clears a scheduled deletion of the account for userID
+func (s *SQLStore) CancelDeletion(ctx context.Context, userID string) (account *model.Account, err error) {
+	ctx, done := instrument(ctx, "cancel_deletion")
+	defer func() { done(err) }()
+
+	row := s.db.QueryRowContext(ctx, `UPDATE accounts SET deletion_scheduled_at = NULL, updated_at = $2
+		WHERE user_id = $1 AND deletion_scheduled_at IS NOT NULL
+		RETURNING `+accountColumns, userID, time.Now())
+	account, _, err = scanAccount(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.getAccount(ctx, userID)
+	}
+	return account, err
+}
+
+// ListDueForPurge returns accounts whose scheduled deletion is at or before now
+func (s *SQLStore) ListDueForPurge(ctx context.Context, now time.Time) []*model.Account {
+	ctx, done := instrument(ctx, "list_due_for_purge")
+
+	accounts, err := s.queryAccounts(ctx, `SELECT `+accountColumns+` FROM accounts
+		WHERE deletion_scheduled_at <= $1 ORDER BY deletion_scheduled_at`, now)
+	done(err)
+	if err != nil {
+		// The purge job retries on its next run
+		slog.ErrorContext(ctx, "failed to list accounts due for purge", "error", err)
+		return nil
+	}
+
+	result := make([]*model.Account, len(accounts))
+	for i, a := range accounts {
+		result[i] = a.account
+	}
+	return result
+}
+
+// DeleteAccount permanently removes the account for userID
+func (s *SQLStore) DeleteAccount(ctx context.Context, userID string) (err error) {
+	ctx, done := instrument(ctx, "delete_account")
+	defer func() { done(err) }()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM accounts WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete account: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w for user ID: %s", ErrNotFound, userID)
+	}
+
+	return nil
+}
+
+// ListAccounts returns a page of the accounts matching filter, ordered by
+// creation time and then ID
+func (s *SQLStore) ListAccounts(ctx context.Context, filter AccountFilter, page PageRequest) (result *Page[*model.Account], err error) {
+	ctx, done := instrument(ctx, "list_accounts")
+	defer func() { done(err) }()
+
+	bounds, err := page.bounds()
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args := accountFilterSQL(filter)
+
+	result = &Page[*model.Account]{}
+	countQuery := `SELECT COUNT(*) FROM accounts` + whereClause(conditions)
+	if err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&result.TotalCount); err != nil {
+		return nil, fmt.Errorf("failed to count accounts: %w", err)
+	}
+
+	// existsBeyond reports whether a filtered account lies at or beyond a
+	// cursor, which tells whether there are pages before after or past before
+	existsBeyond := func(op string, key SortKey) (bool, error) {
+		c, a := keyset(conditions, args, op, key)
+		var exists bool
+		err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM accounts`+whereClause(c)+`)`, a...).Scan(&exists)
+		return exists, err
+	}
+
+	window, windowArgs := conditions, args
+	if bounds.after != nil {
+		window, windowArgs = keyset(window, windowArgs, ">", *bounds.after)
+		if result.HasPreviousPage, err = existsBeyond("<=", *bounds.after); err != nil {
+			return nil, fmt.Errorf("failed to query accounts: %w", err)
+		}
+	}
+	if bounds.before != nil {
+		window, windowArgs = keyset(window, windowArgs, "<", *bounds.before)
+		if result.HasNextPage, err = existsBeyond(">=", *bounds.before); err != nil {
+			return nil, fmt.Errorf("failed to query accounts: %w", err)
+		}
+	}
+
+	// Fetch one extra row to learn whether the window holds more than a page
+	order := "ASC"
+	if bounds.fromEnd {
+		order = "DESC"
+	}
+	windowArgs = append(windowArgs, bounds.limit+1)
+	query := fmt.Sprintf(`SELECT %s FROM accounts%s ORDER BY created_at %s, id %s LIMIT $%d`,
+		accountColumns, whereClause(window), order, order, len(windowArgs))
+
+	accounts, err := s.queryAccounts(ctx, query, windowArgs...)
+	if err != nil {
+		return nil, err
+	}
+	if len(accounts) > bounds.limit {
+		accounts = accounts[:bounds.limit]
+		if bounds.fromEnd {
+			result.HasPreviousPage = true
+		} else {
+			result.HasNextPage = true
+		}
+	}
+	if bounds.fromEnd {
+		for i, j := 0, len(accounts)-1; i < j; i, j = i+1, j-1 {
+			accounts[i], accounts[j] = accounts[j], accounts[i]
+		}
+	}
+
+	result.Edges = make([]Edge[*model.Account], len(accounts))
+	for i, a := range accounts {
+		result.Edges[i] = Edge[*model.Account]{Cursor: a.key.Cursor(), Node: a.account}
+	}
+
+	return result, nil
+}
+
+// accountFilterSQL translates filter into WHERE conditions and arguments
+func accountFilterSQL(filter AccountFilter) ([]string, []any) {
+	var conditions []string
+	var args []any
+	if filter.EmailPrefix != "" {
+		args = append(args, escapeLike(strings.ToLower(filter.EmailPrefix))+"%")
+		conditions = append(conditions, fmt.Sprintf("lower(email) LIKE $%d", len(args)))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		args = append(args, filter.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		args = append(args, filter.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if filter.Source != "" {
+		args = append(args, string(filter.Source))
+		conditions = append(conditions, fmt.Sprintf("source = $%d", len(args)))
+	}
+	return conditions, args
+}
+
+// keyset returns copies of conditions and args with a row comparison of the
+// sort key against key added
+func keyset(conditions []string, args []any, op string, key SortKey) ([]string, []any) {
+	args = append(append([]any{}, args...), key.Time, key.ID)
+	condition := fmt.Sprintf("(created_at, id) %s ($%d, $%d)", op, len(args)-1, len(args))
+	return append(append([]string{}, conditions...), condition), args
+}
+
+// whereClause joins conditions into a WHERE clause, or returns "" for none
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// keyedAccount is an account and its position in listings
+type keyedAccount struct {
+	account *model.Account
+	key     SortKey
+}
+
+// queryAccounts runs a query selecting accountColumns
+func (s *SQLStore) queryAccounts(ctx context.Context, query string, args ...any) ([]keyedAccount, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []keyedAccount
+	for rows.Next() {
+		account, key, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, keyedAccount{account: account, key: key})
+	}
+
+	return accounts, rows.Err()
+}
+
+// scanAccount reads a row of accountColumns
+func scanAccount(row interface{ Scan(...any) error }) (*model.Account, SortKey, error) {
+	var (
+		id                                       int64
+		account                                  model.Account
+		displayName, avatarURL, locale, timezone sql.NullString
+		source                                   string
+		createdAt, updatedAt                     time.Time
+		deletionScheduledAt                      sql.NullTime
+	)
+	err := row.Scan(
+		&id, &account.UserID, &account.Email, &displayName, &avatarURL, &locale, &timezone,
+		&account.MarketingEmailOptIn, &account.MarketingPushOptIn, &source,
+		&createdAt, &updatedAt, &account.EmailUpdatedAt, &deletionScheduledAt, &account.EmailVerified,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, SortKey{}, err
+	}
+	if err != nil {
+		return nil, SortKey{}, fmt.Errorf("failed to scan account: %w", err)
+	}
+
+	account.ID = strconv.FormatInt(id, 10)
+	account.DisplayName = nullableString(displayName)
+	account.AvatarURL = nullableString(avatarURL)
+	account.Locale = nullableString(locale)
+	account.Timezone = nullableString(timezone)
+	account.Source = model.AccountSource(source)
+	account.CreatedAt = createdAt.Format(time.RFC3339)
+	account.UpdatedAt = updatedAt.Format(time.RFC3339)
+	if deletionScheduledAt.Valid {
+		account.DeletionScheduledAt = &deletionScheduledAt.Time
+	}
+
+	return &account, SortKey{Time: createdAt, ID: id}, nil
+}
+
+// nullableString converts a nullable column to an optional field
+func nullableString(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	return &value.String
+}
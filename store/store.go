@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+)
+
+// Store is the storage used by the GraphQL resolvers. MemoryStore and
+// SQLStore implement it.
+type Store interface {
+	AccountStore
+	ServiceClientStore
+	OrganizationStore
+	PasskeyStore
+}
+
+// AccountStore stores user accounts
+type AccountStore interface {
+	GetAccountByUserID(ctx context.Context, userID string) (*model.Account, error)
+	GetAccountByEmail(ctx context.Context, email string) (*model.Account, error)
+	GetAccountByVerifiedEmail(ctx context.Context, email string) (*model.Account, error)
+	CreateAccount(ctx context.Context, userID, email string) (*model.Account, error)
+	CreateAccountIfNotExists(ctx context.Context, userID, email string, emailVerified bool, source model.AccountSource) (*model.Account, bool, error)
+	UpdateAccount(ctx context.Context, userID string, update AccountUpdate) (*model.Account, error)
+	UpdateEmail(ctx context.Context, userID, email string) (*model.Account, error)
+	ScheduleDeletion(ctx context.Context, userID string, purgeAt time.Time) (*model.Account, error)
+	CancelDeletion(ctx context.Context, userID string) (*model.Account, error)
+	ListDueForPurge(ctx context.Context, now time.Time) []*model.Account
+	DeleteAccount(ctx context.Context, userID string) error
+	ListAccounts(ctx context.Context, filter AccountFilter, page PageRequest) (*Page[*model.Account], error)
+}
+
+// ServiceClientStore stores service client registrations
+type ServiceClientStore interface {
+	RegisterServiceClient(ctx context.Context, clientID, name string, permissions []string) (*model.ServiceClient, error)
+	GetServiceClient(ctx context.Context, clientID string) (*model.ServiceClient, error)
+	UpdateServiceClient(ctx context.Context, clientID string, update ServiceClientUpdate) (*model.ServiceClient, error)
+	DeleteServiceClient(ctx context.Context, clientID string) error
+	ListServiceClients(ctx context.Context) []*model.ServiceClient
+	ClientPermissions(ctx context.Context, clientID string) ([]string, error)
+}
+
+// OrganizationStore stores organizations, memberships and invitations
+type OrganizationStore interface {
+	CreateOrganization(ctx context.Context, name string, auth0OrgID *string, ownerID string) (*model.Organization, error)
+	GetOrganization(ctx context.Context, orgID string) (*model.Organization, error)
+	GetMembership(ctx context.Context, orgID, userID string) (*model.Membership, error)
+	ListMemberships(ctx context.Context, orgID string) []*model.Membership
+	ListMembershipsByUser(ctx context.Context, userID string) []*model.Membership
+	DeleteMembershipsByUser(ctx context.Context, userID string) int
+	SetMemberRole(ctx context.Context, orgID, userID string, role model.OrgRole) (*model.Membership, error)
+	CreateInvitation(ctx context.Context, inv model.Invitation, tokenHash string) (*model.Invitation, error)
+	GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*model.Invitation, error)
+	ListInvitations(ctx context.Context, orgID string, now time.Time) []*model.Invitation
+	AcceptInvitation(ctx context.Context, tokenHash, userID string, now time.Time) (*model.Membership, error)
+}
+
+// PasskeyStore stores WebAuthn credentials registered to accounts
+type PasskeyStore interface {
+	AddPasskey(ctx context.Context, passkey model.Passkey) (*model.Passkey, error)
+	GetPasskey(ctx context.Context, credentialID string) (*model.Passkey, error)
+	ListPasskeys(ctx context.Context, userID string) []*model.Passkey
+	RecordPasskeyUse(ctx context.Context, credentialID string, signCount uint32, backedUp bool, usedAt time.Time) (*model.Passkey, error)
+	DeletePasskey(ctx context.Context, userID, credentialID string) error
+}
+
+// AccountFilter selects accounts in ListAccounts. Zero values match everything.
+type AccountFilter struct {
+	EmailPrefix   string              // case-insensitive
+	CreatedAfter  time.Time           // inclusive
+	CreatedBefore time.Time           // exclusive
+	Source        model.AccountSource // empty matches every source
+}
+
+// matches reports whether account passes the filter
+func (f AccountFilter) matches(account *model.Account) bool {
+	if f.EmailPrefix != "" && !strings.HasPrefix(strings.ToLower(account.Email), strings.ToLower(f.EmailPrefix)) {
+		return false
+	}
+	if f.Source != "" && account.Source != f.Source {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() || !f.CreatedBefore.IsZero() {
+		createdAt, err := time.Parse(time.RFC3339, account.CreatedAt)
+		if err != nil {
+			return false
+		}
+		if !f.CreatedAfter.IsZero() && createdAt.Before(f.CreatedAfter) {
+			return false
+		}
+		if !f.CreatedBefore.IsZero() && !createdAt.Before(f.CreatedBefore) {
+			return false
+		}
+	}
+	return true
+}
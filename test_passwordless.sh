@@ -13,6 +13,10 @@ AUTH0_AUDIENCE="${AUTH0_AUDIENCE:-https://dev-4skztpo8mxaq8d12.us.auth0.com/api/
 CLIENT_ID="${CLIENT_ID:-HFGjKwNvymtShqtohLZhVeN8s9UjPRDi}"
 CLIENT_SECRET="${CLIENT_SECRET:-f6twKJm4m47d-o3lQK5JkDbbVfXe6rhHHmnFApBQMhyL3IRZrjD0GGF87QueN5IF}"
 GRAPHQL_URL="${GRAPHQL_URL:-http://localhost:8080/query}"
+# auth0 (default) uses Auth0's passwordless API; native uses the server's
+# built-in sign-in codes (EMAIL_OTP_ENABLED=true)
+OTP_PROVIDER="${OTP_PROVIDER:-auth0}"
+SERVER_URL="${SERVER_URL:-${GRAPHQL_URL%/query}}"
 
 echo -e "${YELLOW}========================================${NC}"
 echo -e "${YELLOW}Passwordless OTP Authentication Test${NC}"
@@ -24,6 +28,7 @@ echo "  Auth0 Audience: $AUTH0_AUDIENCE"
 echo "  Client ID: $CLIENT_ID"
 echo "  Client Secret: ${CLIENT_SECRET:0:20}...${CLIENT_SECRET: -10}"
 echo "  GraphQL URL: $GRAPHQL_URL"
+echo "  OTP Provider: $OTP_PROVIDER"
 echo ""
 
 # Check if email is provided as argument
@@ -39,6 +44,56 @@ if [ -z "$EMAIL" ]; then
     exit 1
 fi
 
+if [ "$OTP_PROVIDER" = "native" ]; then
+    echo ""
+    echo -e "${GREEN}Step 1: Requesting a sign-in code from the server...${NC}"
+    echo "Sending code to: $EMAIL"
+    echo ""
+
+    RESPONSE=$(curl -s -w "\n%{http_code}" --request POST \
+      --url "$SERVER_URL/email-otp/start" \
+      --header 'content-type: application/json' \
+      --data "{\"email\": \"$EMAIL\"}")
+    STATUS=$(echo "$RESPONSE" | tail -n 1)
+    echo "$RESPONSE" | sed '$d' | python3 -m json.tool 2>/dev/null || echo "$RESPONSE" | sed '$d'
+    echo ""
+
+    if [ "$STATUS" != "202" ]; then
+        echo -e "${RED}❌ Error requesting sign-in code (HTTP $STATUS)!${NC}"
+        echo "  • Is the server running with EMAIL_OTP_ENABLED=true?"
+        echo "  • A 429 means a code was sent recently; wait and retry"
+        exit 1
+    fi
+
+    echo -e "${GREEN}✅ Code requested!${NC}"
+    echo -e "${YELLOW}📧 Only addresses with an account get a code. Check the mail transport (MAIL_DIR, SMTP capture or the server log).${NC}"
+    echo ""
+    echo -n "Enter the 6-digit code: "
+    read OTP_CODE
+
+    echo ""
+    echo -e "${GREEN}Step 2: Verifying the code...${NC}"
+    echo ""
+
+    RESPONSE=$(curl -s -w "\n%{http_code}" --request POST \
+      --url "$SERVER_URL/email-otp/verify" \
+      --header 'content-type: application/json' \
+      --data "{\"email\": \"$EMAIL\", \"code\": \"$OTP_CODE\"}")
+    STATUS=$(echo "$RESPONSE" | tail -n 1)
+    echo "$RESPONSE" | sed '$d' | python3 -m json.tool 2>/dev/null || echo "$RESPONSE" | sed '$d'
+    echo ""
+
+    if [ "$STATUS" != "200" ]; then
+        echo -e "${RED}❌ Sign-in failed (HTTP $STATUS)!${NC}"
+        echo "  • The code is wrong, expired or was already used"
+        echo "  • Too many wrong guesses discard the code; request a new one"
+        exit 1
+    fi
+
+    echo -e "${GREEN}✅ Signed in!${NC}"
+    exit 0
+fi
+
 echo ""
 echo -e "${GREEN}Step 1: Requesting OTP code...${NC}"
 echo "Sending code to: $EMAIL"
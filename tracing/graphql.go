@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GraphQLExtension is a gqlgen handler extension that creates a span for each
+// operation and each resolver-backed field
+type GraphQLExtension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = GraphQLExtension{}
+
+// ExtensionName returns the extension name shown in gqlgen stats
+func (GraphQLExtension) ExtensionName() string {
+	return "Tracing"
+}
+
+// Validate is a no-op, the extension works with any schema
+func (GraphQLExtension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptResponse wraps each operation response in a span
+func (GraphQLExtension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	name, attrs := "graphql.operation", []attribute.KeyValue{}
+	if graphql.HasOperationContext(ctx) {
+		oc := graphql.GetOperationContext(ctx)
+		if oc.Operation != nil {
+			opType := string(oc.Operation.Operation)
+			name = "graphql." + opType
+			attrs = append(attrs, attribute.String("graphql.operation.type", opType))
+		}
+		if oc.OperationName != "" {
+			name += " " + oc.OperationName
+			attrs = append(attrs, attribute.String("graphql.operation.name", oc.OperationName))
+		}
+	}
+
+	ctx, span := Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+	resp := next(ctx)
+
+	var err error
+	if resp != nil && len(resp.Errors) > 0 {
+		err = errors.New(resp.Errors.Error())
+	}
+	EndSpan(span, err)
+
+	return resp
+}
+
+// InterceptField wraps resolver-backed fields in a span; trivial struct field reads are skipped
+func (GraphQLExtension) InterceptField(ctx context.Context, next graphql.Resolver) (any, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	ctx, span := Tracer().Start(ctx, "graphql.resolve "+fc.Object+"."+fc.Field.Name, trace.WithAttributes(
+		attribute.String("graphql.field.object", fc.Object),
+		attribute.String("graphql.field.name", fc.Field.Name),
+		attribute.String("graphql.field.path", fc.Path().String()),
+	))
+	res, err := next(ctx)
+	EndSpan(span, err)
+
+	return res, err
+}
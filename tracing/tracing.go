@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/example/auth0-gqlgen-demo"
+
+// Exporter names accepted in Config.Exporter
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Config holds tracing configuration
+type Config struct {
+	ServiceName  string
+	Exporter     string  // none, stdout or otlp
+	OTLPEndpoint string  // host:port of the OTLP/HTTP collector, e.g. localhost:4318
+	OTLPInsecure bool    // use plain HTTP instead of HTTPS for the collector
+	SampleRatio  float64 // fraction of new traces to sample, 0 means always
+}
+
+// Setup installs the global tracer provider and W3C trace-context propagator.
+// The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	// Propagate trace context even when spans are not exported, so callers'
+	// traces continue through this service
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	switch config.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		exporter = exp
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{}
+		if config.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(config.OTLPEndpoint))
+		}
+		if config.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		exporter = exp
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %s", config.Exporter)
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = "auth0-gqlgen-demo"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if config.SampleRatio > 0 && config.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(config.SampleRatio)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used for the service's own spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Middleware starts a server span for each request, continuing any trace
+// context sent by the caller
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+	)
+}
+
+// Transport wraps an HTTP transport so outbound requests get client spans and
+// carry the trace-context headers. A nil base uses http.DefaultTransport.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base)
+}
+
+// EndSpan records err on span, if any, and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
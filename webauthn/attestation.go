@@ -0,0 +1,234 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Attestation statement formats (WebAuthn section 8)
+const (
+	FormatNone   = "none"
+	FormatPacked = "packed"
+	FormatApple  = "apple"
+)
+
+// Certificate extensions checked by attestation formats
+var (
+	oidFIDOAAGUID   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+	oidAppleNonce   = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 8, 2}
+	packedSubjectOU = "Authenticator Attestation"
+)
+
+// attestation is a parsed attestation object
+type attestation struct {
+	format   string
+	stmt     map[any]any
+	authData *authenticatorData
+}
+
+// parseAttestationObject decodes a CBOR attestation object
+func parseAttestationObject(raw []byte) (*attestation, error) {
+	value, rest, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("unexpected data after attestation object")
+	}
+	object, ok := value.(map[any]any)
+	if !ok {
+		return nil, errors.New("attestation object is not a map")
+	}
+	format, _ := object["fmt"].(string)
+	stmt, ok := object["attStmt"].(map[any]any)
+	if format == "" || !ok {
+		return nil, errors.New("attestation object has no format or statement")
+	}
+	rawAuthData, _ := object["authData"].([]byte)
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialKey == nil {
+		return nil, errors.New("attestation has no attested credential data")
+	}
+	return &attestation{format: format, stmt: stmt, authData: authData}, nil
+}
+
+// verify checks the attestation statement over the authenticator data and
+// clientDataHash. Certificate chains must lead to roots when it is set; none
+// and self attestation carry no chain and are always accepted.
+func (a *attestation) verify(clientDataHash []byte, roots *x509.CertPool, now time.Time) error {
+	switch a.format {
+	case FormatNone:
+		if len(a.stmt) != 0 {
+			return fmt.Errorf("%w: none attestation with a statement", ErrInvalidAttestation)
+		}
+		return nil
+	case FormatPacked:
+		return a.verifyPacked(clientDataHash, roots, now)
+	case FormatApple:
+		return a.verifyApple(clientDataHash, roots, now)
+	default:
+		return fmt.Errorf("%w: unsupported format %q", ErrInvalidAttestation, a.format)
+	}
+}
+
+// verifyPacked verifies a packed attestation (WebAuthn section 8.2), either
+// self attestation with the credential key or an attestation certificate
+func (a *attestation) verifyPacked(clientDataHash []byte, roots *x509.CertPool, now time.Time) error {
+	alg, ok := a.stmt["alg"].(int64)
+	sig, _ := a.stmt["sig"].([]byte)
+	if !ok || len(sig) == 0 {
+		return fmt.Errorf("%w: packed statement without alg or sig", ErrInvalidAttestation)
+	}
+	signed := append(append([]byte{}, a.authData.raw...), clientDataHash...)
+
+	if _, hasChain := a.stmt["x5c"]; !hasChain {
+		if alg != a.authData.credentialKey.alg {
+			return fmt.Errorf("%w: self attestation alg differs from the credential's", ErrInvalidAttestation)
+		}
+		if err := a.authData.credentialKey.verify(signed, sig); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+		}
+		return nil
+	}
+
+	chain, err := a.certificates()
+	if err != nil {
+		return err
+	}
+	cert := chain[0]
+	if err := verifySignature(alg, cert.PublicKey, signed, sig); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAttestation, err)
+	}
+
+	// Attestation certificate requirements (section 8.2.1)
+	if cert.Version != 3 || cert.IsCA || !cert.BasicConstraintsValid {
+		return fmt.Errorf("%w: attestation certificate must be a v3 end-entity certificate", ErrInvalidAttestation)
+	}
+	subject := cert.Subject
+	if len(subject.Country) == 0 || len(subject.Organization) == 0 || subject.CommonName == "" ||
+		len(subject.OrganizationalUnit) == 0 || subject.OrganizationalUnit[0] != packedSubjectOU {
+		return fmt.Errorf("%w: attestation certificate subject", ErrInvalidAttestation)
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidFIDOAAGUID) {
+			continue
+		}
+		var aaguid []byte
+		if ext.Critical {
+			return fmt.Errorf("%w: AAGUID extension must not be critical", ErrInvalidAttestation)
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &aaguid); err != nil || !bytes.Equal(aaguid, a.authData.aaguid) {
+			return fmt.Errorf("%w: certificate AAGUID differs from the authenticator's", ErrInvalidAttestation)
+		}
+	}
+
+	return verifyChain(chain, roots, now)
+}
+
+// appleNonce is the value of the Apple anonymous attestation nonce extension
+type appleNonce struct {
+	Nonce []byte `asn1:"tag:1,explicit"`
+}
+
+// verifyApple verifies an Apple anonymous attestation (WebAuthn section 8.8)
+func (a *attestation) verifyApple(clientDataHash []byte, roots *x509.CertPool, now time.Time) error {
+	chain, err := a.certificates()
+	if err != nil {
+		return err
+	}
+	cert := chain[0]
+
+	expected := sha256.Sum256(append(append([]byte{}, a.authData.raw...), clientDataHash...))
+	var nonce []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidAppleNonce) {
+			var value appleNonce
+			if _, err := asn1.Unmarshal(ext.Value, &value); err != nil {
+				return fmt.Errorf("%w: invalid nonce extension", ErrInvalidAttestation)
+			}
+			nonce = value.Nonce
+		}
+	}
+	if !bytes.Equal(nonce, expected[:]) {
+		return fmt.Errorf("%w: nonce mismatch", ErrInvalidAttestation)
+	}
+
+	key, ok := cert.PublicKey.(interface{ Equal(x crypto.PublicKey) bool })
+	if !ok || !key.Equal(a.authData.credentialKey.key) {
+		return fmt.Errorf("%w: certificate key differs from the credential key", ErrInvalidAttestation)
+	}
+
+	return verifyChain(chain, roots, now)
+}
+
+// certificates parses the statement's x5c chain, attestation certificate first
+func (a *attestation) certificates() ([]*x509.Certificate, error) {
+	x5c, ok := a.stmt["x5c"].([]any)
+	if !ok || len(x5c) == 0 {
+		return nil, fmt.Errorf("%w: statement without x5c", ErrInvalidAttestation)
+	}
+	chain := make([]*x509.Certificate, 0, len(x5c))
+	for _, item := range x5c {
+		der, _ := item.([]byte)
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid x5c certificate: %v", ErrInvalidAttestation, err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+// verifyChain verifies an attestation chain against roots. Without roots only
+// the validity period of the attestation certificate is checked.
+func verifyChain(chain []*x509.Certificate, roots *x509.CertPool, now time.Time) error {
+	if roots == nil {
+		cert := chain[0]
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("%w: attestation certificate is not valid now", ErrInvalidAttestation)
+		}
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: untrusted attestation certificate: %v", ErrInvalidAttestation, err)
+	}
+	return nil
+}
+
+// LoadAttestationRoots reads a PEM bundle of attestation root certificates,
+// returning nil when path is empty
+func LoadAttestationRoots(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	bundle, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attestation roots: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in attestation roots %s", path)
+	}
+	return roots, nil
+}
@@ -0,0 +1,214 @@
+package webauthn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCA issues attestation certificates
+type testCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Attestation Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{key: key, cert: cert}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// issue returns the DER of an end-entity certificate for public with subject
+// and extensions
+func (ca *testCA) issue(t *testing.T, public crypto.PublicKey, subject pkix.Name, extensions []pkix.Extension) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions:       extensions,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, public, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// packedSubject is a subject meeting the packed attestation requirements
+var packedSubject = pkix.Name{
+	Country:            []string{"US"},
+	Organization:       []string{"Example Authenticators"},
+	OrganizationalUnit: []string{packedSubjectOU},
+	CommonName:         "Example Key",
+}
+
+// aaguidExtension returns the FIDO AAGUID certificate extension
+func aaguidExtension(t *testing.T, aaguid []byte) pkix.Extension {
+	t.Helper()
+	value, err := asn1.Marshal(aaguid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: oidFIDOAAGUID, Value: value}
+}
+
+// packedSelfStatement signs with the credential key itself
+func (a *testAuthenticator) packedSelfStatement(t *testing.T, authData, clientDataHash []byte) cborPairs {
+	return cborPairs{"alg", AlgES256, "sig", a.sign(t, authData, clientDataHash)}
+}
+
+// packedStatement returns a packed statement signed with an attestation key
+// certified by ca with subject and extensions
+func packedStatement(ca *testCA, subject pkix.Name, extensions func(t *testing.T) []pkix.Extension) statementFunc {
+	return func(t *testing.T, authData, clientDataHash []byte) cborPairs {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := ca.issue(t, &key.PublicKey, subject, extensions(t))
+		return cborPairs{"alg", AlgES256, "sig", sig, "x5c", []any{cert}}
+	}
+}
+
+// appleStatement returns an Apple anonymous statement certifying the
+// credential key with a nonce over nonceData, or over the authenticator
+// data and client data hash when it is nil
+func (a *testAuthenticator) appleStatement(ca *testCA, nonceData []byte) statementFunc {
+	return func(t *testing.T, authData, clientDataHash []byte) cborPairs {
+		signed := nonceData
+		if signed == nil {
+			signed = append(append([]byte{}, authData...), clientDataHash...)
+		}
+		nonce := sha256.Sum256(signed)
+		value, err := asn1.Marshal(appleNonce{Nonce: nonce[:]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := ca.issue(t, &a.key.PublicKey, pkix.Name{CommonName: "Apple Anonymous"}, []pkix.Extension{{Id: oidAppleNonce, Value: value}})
+		return cborPairs{"alg", AlgES256, "x5c", []any{cert}}
+	}
+}
+
+func TestAttestation(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	authenticator := newTestAuthenticator(t)
+	withAAGUID := func(aaguid []byte) func(t *testing.T) []pkix.Extension {
+		return func(t *testing.T) []pkix.Extension { return []pkix.Extension{aaguidExtension(t, aaguid)} }
+	}
+	noExtensions := func(t *testing.T) []pkix.Extension { return nil }
+
+	tests := []struct {
+		name      string
+		format    string
+		statement statementFunc
+		roots     *x509.CertPool
+		wantErr   error
+	}{
+		{name: "none", format: FormatNone, statement: noneStatement},
+		{name: "none with a statement", format: FormatNone, statement: authenticator.packedSelfStatement, wantErr: ErrInvalidAttestation},
+		{name: "packed self attestation", format: FormatPacked, statement: authenticator.packedSelfStatement},
+		{
+			name:   "packed self attestation over other data",
+			format: FormatPacked,
+			statement: func(t *testing.T, authData, clientDataHash []byte) cborPairs {
+				return authenticator.packedSelfStatement(t, authData, make([]byte, 32))
+			},
+			wantErr: ErrInvalidAttestation,
+		},
+		{name: "packed certificate", format: FormatPacked, statement: packedStatement(ca, packedSubject, withAAGUID(testAAGUID)), roots: ca.pool()},
+		{name: "packed certificate without roots", format: FormatPacked, statement: packedStatement(ca, packedSubject, noExtensions)},
+		{name: "packed certificate from another root", format: FormatPacked, statement: packedStatement(otherCA, packedSubject, noExtensions), roots: ca.pool(), wantErr: ErrInvalidAttestation},
+		{name: "packed certificate for another model", format: FormatPacked, statement: packedStatement(ca, packedSubject, withAAGUID(make([]byte, 16))), roots: ca.pool(), wantErr: ErrInvalidAttestation},
+		{name: "packed certificate with a bad subject", format: FormatPacked, statement: packedStatement(ca, pkix.Name{CommonName: "Example Key"}, noExtensions), roots: ca.pool(), wantErr: ErrInvalidAttestation},
+		{name: "apple", format: FormatApple, statement: authenticator.appleStatement(ca, nil), roots: ca.pool()},
+		{name: "apple with another nonce", format: FormatApple, statement: authenticator.appleStatement(ca, []byte("other")), roots: ca.pool(), wantErr: ErrInvalidAttestation},
+		{name: "apple from another root", format: FormatApple, statement: authenticator.appleStatement(otherCA, nil), roots: ca.pool(), wantErr: ErrInvalidAttestation},
+		{name: "apple for another key", format: FormatApple, statement: newTestAuthenticator(t).appleStatement(ca, nil), roots: ca.pool(), wantErr: ErrInvalidAttestation},
+		{name: "unsupported format", format: "tpm", statement: noneStatement, wantErr: ErrInvalidAttestation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, _ := newTestService(t, Config{AttestationRoots: tt.roots})
+			options, err := s.BeginRegistration(ctx, testUserID, "user1@example.com", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			passkey, err := s.FinishRegistration(ctx, testUserID, "Key", authenticator.register(t, options, tt.format, tt.statement))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FinishRegistration() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && passkey.AttestationFormat != tt.format {
+				t.Errorf("attestation format = %q, want %q", passkey.AttestationFormat, tt.format)
+			}
+		})
+	}
+}
+
+func TestRegistrationRejects(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, Config{})
+	authenticator := newTestAuthenticator(t)
+
+	options, _ := s.BeginRegistration(ctx, testUserID, "user1@example.com", "")
+	wrongRP := *options
+	wrongRP.RP.ID = "evil.example"
+	if _, err := s.FinishRegistration(ctx, testUserID, "", authenticator.register(t, &wrongRP, FormatNone, noneStatement)); !errors.Is(err, ErrOriginMismatch) {
+		t.Errorf("FinishRegistration() for another RP ID error = %v, want %v", err, ErrOriginMismatch)
+	}
+
+	// A registration started for one user can't finish for another
+	options, _ = s.BeginRegistration(ctx, testUserID, "user1@example.com", "")
+	if _, err := s.FinishRegistration(ctx, "auth0|user2", "", authenticator.register(t, options, FormatNone, noneStatement)); !errors.Is(err, ErrUnknownChallenge) {
+		t.Errorf("FinishRegistration() for another user error = %v, want %v", err, ErrUnknownChallenge)
+	}
+
+	options, _ = s.BeginRegistration(ctx, testUserID, "user1@example.com", "")
+	response := authenticator.register(t, options, FormatNone, noneStatement)
+	response.RawID = encode([]byte("another credential"))
+	if _, err := s.FinishRegistration(ctx, testUserID, "", response); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("FinishRegistration() with another credential ID error = %v, want %v", err, ErrInvalidResponse)
+	}
+}
@@ -0,0 +1,107 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Authenticator data flags (WebAuthn section 6.1)
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackedUp       = 0x10
+	flagAttestedData   = 0x40
+	flagExtensionData  = 0x80
+)
+
+// minAuthenticatorData is the size of the rpIdHash, flags and signCount
+const minAuthenticatorData = 37
+
+// maxCredentialIDLength is the longest credential ID accepted (WebAuthn
+// section 7.1 step 25)
+const maxCredentialIDLength = 1023
+
+// authenticatorData is parsed authenticator data
+type authenticatorData struct {
+	raw       []byte
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	// Present only in registration responses
+	aaguid        []byte
+	credentialID  []byte
+	credentialKey *credentialKey
+	rawKey        []byte // COSE_Key encoding of credentialKey
+}
+
+func (d *authenticatorData) userPresent() bool    { return d.flags&flagUserPresent != 0 }
+func (d *authenticatorData) userVerified() bool   { return d.flags&flagUserVerified != 0 }
+func (d *authenticatorData) backupEligible() bool { return d.flags&flagBackupEligible != 0 }
+func (d *authenticatorData) backedUp() bool       { return d.flags&flagBackedUp != 0 }
+
+// parseAuthenticatorData parses raw authenticator data, including the
+// attested credential data when the AT flag is set
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < minAuthenticatorData {
+		return nil, errors.New("authenticator data too short")
+	}
+	data := &authenticatorData{
+		raw:       raw,
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if data.backedUp() && !data.backupEligible() {
+		return nil, errors.New("authenticator data is backed up but not backup eligible")
+	}
+
+	rest := raw[minAuthenticatorData:]
+	if data.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		data.aaguid = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength > maxCredentialIDLength || idLength > len(rest) {
+			return nil, errors.New("invalid credential ID length")
+		}
+		data.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		key, after, err := parseCredentialKey(rest)
+		if err != nil {
+			return nil, err
+		}
+		data.credentialKey = key
+		data.rawKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if data.flags&flagExtensionData != 0 {
+		extensions, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid authenticator extensions: %w", err)
+		}
+		if _, ok := extensions.(map[any]any); !ok {
+			return nil, errors.New("authenticator extensions are not a map")
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("unexpected trailing authenticator data")
+	}
+	return data, nil
+}
+
+// formatAAGUID returns an AAGUID in its usual UUID form
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	h := hex.EncodeToString(aaguid)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -0,0 +1,167 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CBOR (RFC 8949) major types
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborTag      = 6
+	cborSimple   = 7
+)
+
+// maxCBORDepth bounds the nesting of decoded CBOR items
+const maxCBORDepth = 16
+
+var errCBORTruncated = errors.New("truncated CBOR")
+
+// decodeCBOR decodes the first CBOR item of data and returns it with the
+// bytes that follow it. Only the definite-length subset WebAuthn uses is
+// supported. Integers decode to int64, byte strings to []byte, text to
+// string, arrays to []any and maps to map[any]any keyed by int64 or string.
+// Tags are dropped, keeping the tagged item.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errors.New("CBOR nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, nil, errCBORTruncated
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	if major == cborSimple {
+		return decodeCBORSimple(info, data)
+	}
+
+	arg, data, err := cborArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("CBOR integer overflows int64")
+		}
+		return int64(arg), data, nil
+	case cborNegative:
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("CBOR integer overflows int64")
+		}
+		return -1 - int64(arg), data, nil
+	case cborBytes, cborText:
+		if arg > uint64(len(data)) {
+			return nil, nil, errCBORTruncated
+		}
+		value := data[:arg]
+		if major == cborText {
+			return string(value), data[arg:], nil
+		}
+		return append([]byte{}, value...), data[arg:], nil
+	case cborArray:
+		if arg > uint64(len(data)) {
+			return nil, nil, errCBORTruncated // each item takes at least a byte
+		}
+		items := make([]any, 0, arg)
+		for range arg {
+			var item any
+			if item, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case cborMap:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, errCBORTruncated
+		}
+		entries := make(map[any]any, arg)
+		for range arg {
+			var key, value any
+			if key, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("unsupported CBOR map key type %T", key)
+			}
+			if _, dup := entries[key]; dup {
+				return nil, nil, fmt.Errorf("duplicate CBOR map key %v", key)
+			}
+			if value, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			entries[key] = value
+		}
+		return entries, data, nil
+	default: // cborTag
+		return decodeCBORItem(data, depth+1)
+	}
+}
+
+// cborArgument reads the argument encoded by the additional information of
+// an item's initial byte
+func cborArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		if len(data) < 1 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(data[0]), data[1:], nil
+	case info == 25:
+		if len(data) < 2 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26:
+		if len(data) < 4 {
+			return 0, nil, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27:
+		if len(data) < 8 {
+			return 0, nil, errCBORTruncated
+		}
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	default:
+		return 0, nil, errors.New("indefinite-length CBOR is not supported")
+	}
+}
+
+// decodeCBORSimple decodes false, true, null and undefined. Floats are
+// skipped and decode to nil; WebAuthn structures don't use them.
+func decodeCBORSimple(info byte, data []byte) (any, []byte, error) {
+	switch info {
+	case 20:
+		return false, data, nil
+	case 21:
+		return true, data, nil
+	case 22, 23:
+		return nil, data, nil
+	case 25, 26, 27:
+		size := 1 << (info - 24)
+		if len(data) < size {
+			return nil, nil, errCBORTruncated
+		}
+		return nil, data[size:], nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported CBOR simple value %d", info)
+	}
+}
@@ -0,0 +1,196 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cborPairs is a CBOR map written in the order of its alternating keys and
+// values, the way authenticators write COSE keys and attestation objects
+type cborPairs []any
+
+// encodeCBOR encodes the value types decodeCBOR returns, for building
+// authenticator responses in tests
+func encodeCBOR(value any) []byte {
+	switch v := value.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return cborHead(cborNegative, uint64(-1-v))
+		}
+		return cborHead(cborUnsigned, uint64(v))
+	case []byte:
+		return append(cborHead(cborBytes, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(cborText, uint64(len(v))), v...)
+	case []any:
+		out := cborHead(cborArray, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case cborPairs:
+		out := cborHead(cborMap, uint64(len(v)/2))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	default:
+		panic("encodeCBOR: unsupported type")
+	}
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, arg)
+	}
+}
+
+// fromHex decodes a hex fixture, ignoring spaces
+func fromHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	// Examples from RFC 8949 appendix A
+	tests := []struct {
+		hex  string
+		want any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1a000f4240", int64(1000000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"3903e7", int64(-1000)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f90000", nil},
+		{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			got, rest, err := decodeCBOR(fromHex(t, tt.hex))
+			if err != nil {
+				t.Fatalf("decodeCBOR() error = %v", err)
+			}
+			if len(rest) != 0 || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCBOR() = %#v rest %x, want %#v", got, rest, tt.want)
+			}
+		})
+	}
+
+	if got, rest, err := decodeCBOR([]byte{0x01, 0x02}); err != nil || got != int64(1) || !bytes.Equal(rest, []byte{0x02}) {
+		t.Errorf("decodeCBOR() of two items = %v rest %x, %v, want 1 rest 02", got, rest, err)
+	}
+}
+
+func TestDecodeCBORRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		{"empty", ""},
+		{"truncated argument", "19 03"},
+		{"truncated bytes", "44 0102"},
+		{"indefinite length", "5f 41 00 ff"},
+		{"integer overflow", "1b ffffffffffffffff"},
+		{"array longer than the data", "9b 00000000ffffffff 00"},
+		{"duplicate map key", "a2 01 02 01 03"},
+		{"byte string map key", "a1 41 00 01"},
+		{"unsupported simple value", "f8 20"},
+		{"nested too deeply", strings.Repeat("81", maxCBORDepth+2) + "00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _, err := decodeCBOR(fromHex(t, tt.hex)); err == nil {
+				t.Errorf("decodeCBOR(%s) = %#v, want an error", tt.hex, got)
+			}
+		})
+	}
+}
+
+func TestEncodeCBORRoundTrip(t *testing.T) {
+	value := cborPairs{"fmt", "none", "attStmt", cborPairs{}, int64(-257), []any{[]byte{1}, int64(70000)}}
+	got, rest, err := decodeCBOR(encodeCBOR(value))
+	want := map[any]any{"fmt": "none", "attStmt": map[any]any{}, int64(-257): []any{[]byte{1}, int64(70000)}}
+	if err != nil || len(rest) != 0 || !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeCBOR(encodeCBOR()) = %#v, %v, want %#v", got, err, want)
+	}
+}
+
+// The P-256 base point, a valid public key
+const (
+	p256X = "6b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296"
+	p256Y = "4fe342e2fe1a7f9b8ee7eb4a7c0f9e162bce33576b315ececbb6406837bf51f5"
+)
+
+func TestParseCredentialKey(t *testing.T) {
+	// {1: 2 (EC2), 3: -7 (ES256), -1: 1 (P-256), -2: x, -3: y}
+	ec2 := "a5 0102 0326 2001 215820" + p256X + " 225820" + p256Y
+	key, rest, err := parseCredentialKey(fromHex(t, ec2+"ff"))
+	if err != nil {
+		t.Fatalf("parseCredentialKey() error = %v", err)
+	}
+	public, ok := key.key.(*ecdsa.PublicKey)
+	if key.alg != AlgES256 || !ok || hex.EncodeToString(public.X.Bytes()) != p256X || !bytes.Equal(rest, []byte{0xff}) {
+		t.Errorf("parseCredentialKey() = alg %d %T rest %x, want an ES256 key with rest ff", key.alg, key.key, rest)
+	}
+
+	// {1: 1 (OKP), 3: -8 (EdDSA), -1: 6 (Ed25519), -2: x}
+	okp := "a4 0101 0327 2006 215820" + strings.Repeat("11", ed25519.PublicKeySize)
+	if key, _, err := parseCredentialKey(fromHex(t, okp)); err != nil || key.alg != AlgEdDSA {
+		t.Errorf("parseCredentialKey() of an Ed25519 key = %v, %v, want EdDSA", key, err)
+	}
+
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		{"not a map", "01"},
+		{"curve unsuited to alg", "a5 0102 0326 2002 215820" + p256X + " 225820" + p256Y},
+		{"point off the curve", "a5 0102 0326 2001 215820" + p256X + " 225820" + p256Y[:62] + "f6"},
+		{"short coordinates", "a5 0102 0326 2001 2141 00 2241 00"},
+		{"Ed25519 with ES256", "a4 0101 0326 2006 215820" + strings.Repeat("11", ed25519.PublicKeySize)},
+		// {1: 3 (RSA), 3: -257 (RS256), -1: 1024-bit n, -2: 65537}
+		{"small RSA key", "a4 0103 03390100 20590080" + strings.Repeat("c3", 128) + " 2143010001"},
+		{"symmetric key", "a3 0104 0305 2041 00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if key, _, err := parseCredentialKey(fromHex(t, tt.hex)); err == nil {
+				t.Errorf("parseCredentialKey() = %+v, want an error", key)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) accepted for credentials and
+// attestation signatures
+const (
+	AlgES256 = -7
+	AlgES384 = -35
+	AlgES512 = -36
+	AlgEdDSA = -8
+	AlgRS256 = -257
+	AlgPS256 = -37
+)
+
+// supportedAlgorithms are offered to authenticators, most preferred first
+var supportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgES384, AlgES512, AlgPS256, AlgRS256}
+
+// COSE key parameters (RFC 9052 section 7 and RFC 9053)
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+	coseCurve     = -1 // crv for EC2 and OKP keys, n for RSA keys
+	coseX         = -2 // x for EC2 and OKP keys, e for RSA keys
+	coseY         = -3
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveP384    = 2
+	coseCurveP521    = 3
+	coseCurveEd25519 = 6
+)
+
+// minRSAKeyBits is the smallest RSA credential key accepted
+const minRSAKeyBits = 2048
+
+var errUnsupportedAlgorithm = errors.New("unsupported COSE algorithm")
+
+// credentialKey is a parsed COSE_Key
+type credentialKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parseCredentialKey decodes the COSE_Key at the start of data, returning it
+// with the bytes that follow it
+func parseCredentialKey(data []byte) (*credentialKey, []byte, error) {
+	value, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	params, ok := value.(map[any]any)
+	if !ok {
+		return nil, nil, errors.New("credential public key is not a COSE_Key")
+	}
+	key, err := coseKey(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, rest, nil
+}
+
+// coseKey converts COSE_Key parameters to a public key, checking that its
+// type and curve suit its algorithm
+func coseKey(params map[any]any) (*credentialKey, error) {
+	kty, _ := params[int64(coseKeyType)].(int64)
+	alg, _ := params[int64(coseAlgorithm)].(int64)
+
+	switch kty {
+	case coseKeyTypeEC2:
+		crv, _ := params[int64(coseCurve)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+		var curve elliptic.Curve
+		switch {
+		case alg == AlgES256 && crv == coseCurveP256:
+			curve = elliptic.P256()
+		case alg == AlgES384 && crv == coseCurveP384:
+			curve = elliptic.P384()
+		case alg == AlgES512 && crv == coseCurveP521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: EC2 key with alg %d and crv %d", errUnsupportedAlgorithm, alg, crv)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC2 key coordinates")
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC2 key is not on its curve")
+		}
+		return &credentialKey{alg: alg, key: key}, nil
+	case coseKeyTypeOKP:
+		crv, _ := params[int64(coseCurve)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		if alg != AlgEdDSA || crv != coseCurveEd25519 {
+			return nil, fmt.Errorf("%w: OKP key with alg %d and crv %d", errUnsupportedAlgorithm, alg, crv)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return &credentialKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	case coseKeyTypeRSA:
+		n, _ := params[int64(coseCurve)].([]byte)
+		e, _ := params[int64(coseX)].([]byte)
+		if alg != AlgRS256 && alg != AlgPS256 {
+			return nil, fmt.Errorf("%w: RSA key with alg %d", errUnsupportedAlgorithm, alg)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(e) == 0 || len(e) > 4 || exponent.Int64() < 3 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits", minRSAKeyBits)
+		}
+		return &credentialKey{alg: alg, key: key}, nil
+	default:
+		return nil, fmt.Errorf("%w: key type %d", errUnsupportedAlgorithm, kty)
+	}
+}
+
+// verify checks signature over data with the key
+func (k *credentialKey) verify(data, signature []byte) error {
+	return verifySignature(k.alg, k.key, data, signature)
+}
+
+// verifySignature checks a WebAuthn signature made with alg, which for
+// ECDSA is ASN.1 DER encoded
+func verifySignature(alg int64, key crypto.PublicKey, data, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case AlgES256, AlgRS256, AlgPS256:
+		hash = crypto.SHA256
+	case AlgES384:
+		hash = crypto.SHA384
+	case AlgES512:
+		hash = crypto.SHA512
+	case AlgEdDSA:
+		k, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(k, data, signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %d", errUnsupportedAlgorithm, alg)
+	}
+
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	var valid bool
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		valid = (alg == AlgES256 || alg == AlgES384 || alg == AlgES512) && ecdsa.VerifyASN1(k, digest, signature)
+	case *rsa.PublicKey:
+		switch alg {
+		case AlgRS256:
+			valid = rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+		case AlgPS256:
+			valid = rsa.VerifyPSS(k, hash, digest, signature, nil) == nil
+		}
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/example/auth0-gqlgen-demo/issuer"
+)
+
+// Paths the login endpoints are served on
+const (
+	LoginOptionsPath = "/webauthn/login/options"
+	LoginPath        = "/webauthn/login"
+)
+
+// maxResponseBody bounds the size of an authenticator response
+const maxResponseBody = 64 << 10
+
+// LoginResult is the body returned for a successful login
+type LoginResult struct {
+	UserID       string         `json:"userId"`
+	CredentialID string         `json:"credentialId"`
+	UserVerified bool           `json:"userVerified"`
+	Tokens       *issuer.Tokens `json:"tokens,omitempty"`
+}
+
+// LoginOptionsHandler serves POST requests for the options of a login with
+// a discoverable passkey. The user isn't asked for first, so the endpoint
+// reveals nothing about which accounts exist.
+func (s *Service) LoginOptionsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		options, err := s.BeginLogin(r.Context(), "")
+		if errors.Is(err, ErrTooManyChallenges) {
+			slog.WarnContext(r.Context(), "passkey login refused", "error", err)
+			respondJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "temporarily_unavailable"})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to start passkey login", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, options)
+	})
+}
+
+// LoginHandler serves POST requests carrying an AuthenticationResponseJSON
+// and returns the user the passkey belongs to, with tokens from tokens when
+// it is set. Failures get a generic 401; the reason is logged and audited.
+func (s *Service) LoginHandler(tokens *issuer.Issuer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var response AssertionResponse
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxResponseBody)).Decode(&response); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+
+		assertion, err := s.FinishLogin(r.Context(), response)
+		if err != nil {
+			slog.InfoContext(r.Context(), "passkey login failed", "reason", FailureReason(err), "error", err)
+			status := http.StatusUnauthorized
+			if FailureReason(err) == "error" {
+				// Not a verification failure, e.g. the store is unavailable
+				status = http.StatusInternalServerError
+			}
+			respondJSON(w, status, map[string]string{"error": "login_failed"})
+			return
+		}
+
+		result := LoginResult{
+			UserID:       assertion.UserID,
+			CredentialID: assertion.Passkey.ID,
+			UserVerified: assertion.UserVerified,
+		}
+		if tokens != nil {
+			if result.Tokens, err = tokens.Issue(r.Context(), assertion.UserID, []string{"pop"}); err != nil {
+				slog.ErrorContext(r.Context(), "failed to issue tokens for passkey login", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+		respondJSON(w, http.StatusOK, result)
+	})
+}
+
+// DecodeRegistrationResponse parses a RegistrationResponseJSON document
+func DecodeRegistrationResponse(data string) (RegistrationResponse, error) {
+	var response RegistrationResponse
+	if len(data) > maxResponseBody {
+		return response, fmt.Errorf("%w: response too large", ErrInvalidResponse)
+	}
+	if err := json.Unmarshal([]byte(data), &response); err != nil {
+		return response, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return response, nil
+}
+
+// respondJSON writes a JSON response
+func respondJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,672 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/audit"
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+// User verification requirements (WebAuthn section 5.8.6)
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+// Defaults for Config
+const (
+	DefaultTimeout     = 5 * time.Minute
+	DefaultMaxSessions = 10000
+)
+
+// challengeSize is the number of random bytes in a challenge
+const challengeSize = 32
+
+// Ceremonies a challenge is issued for
+const (
+	ceremonyRegistration = "webauthn.create"
+	ceremonyLogin        = "webauthn.get"
+)
+
+// Errors returned by the registration and login ceremonies
+var (
+	ErrInvalidResponse    = errors.New("invalid WebAuthn response")
+	ErrUnknownChallenge   = errors.New("unknown or expired WebAuthn challenge")
+	ErrOriginMismatch     = errors.New("WebAuthn origin or relying party mismatch")
+	ErrUserVerification   = errors.New("user verification required")
+	ErrInvalidAttestation = errors.New("invalid attestation")
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrUnknownCredential  = errors.New("unknown credential")
+	ErrCredentialExists   = errors.New("credential already registered")
+	ErrCounterRegression  = errors.New("signature counter did not increase")
+	ErrTooManyChallenges  = errors.New("too many outstanding WebAuthn challenges")
+)
+
+// CredentialStore stores the passkeys registered to accounts
+type CredentialStore interface {
+	AddPasskey(ctx context.Context, passkey model.Passkey) (*model.Passkey, error)
+	GetPasskey(ctx context.Context, credentialID string) (*model.Passkey, error)
+	ListPasskeys(ctx context.Context, userID string) []*model.Passkey
+	RecordPasskeyUse(ctx context.Context, credentialID string, signCount uint32, backedUp bool, usedAt time.Time) (*model.Passkey, error)
+	DeletePasskey(ctx context.Context, userID, credentialID string) error
+}
+
+// Config holds relying party settings
+type Config struct {
+	RPID   string // relying party ID: the domain passkeys are scoped to, e.g. example.com
+	RPName string // shown by authenticators (default RPID)
+
+	// Origins lists the origins responses may come from (default
+	// https://RPID). iOS apps using associated domains report https://RPID.
+	Origins []string
+
+	Timeout          time.Duration // lifetime of a challenge (default 5m)
+	UserVerification string        // required (default), preferred or discouraged
+	Attestation      string        // conveyance requested at registration: none (default), indirect or direct
+
+	// AttestationRoots, when set, must issue the certificates of packed and
+	// apple attestation statements (optional)
+	AttestationRoots *x509.CertPool
+
+	MaxSessions int // outstanding challenges kept (default 10000)
+}
+
+// Service runs the WebAuthn registration and login ceremonies of a relying
+// party. Challenges are held in memory and can be answered once.
+type Service struct {
+	store    CredentialStore
+	auditLog *audit.Logger
+	config   Config
+	rpIDHash [32]byte
+
+	mu       sync.Mutex
+	sessions map[string]session // key is the base64url challenge
+}
+
+// session is an outstanding challenge
+type session struct {
+	ceremony  string
+	userID    string // empty for logins with a discoverable credential
+	expiresAt time.Time
+}
+
+// NewService creates a relying party storing credentials in store
+func NewService(store CredentialStore, auditLog *audit.Logger, config Config) (*Service, error) {
+	if config.RPID == "" {
+		return nil, errors.New("WebAuthn relying party ID is required")
+	}
+	if config.RPName == "" {
+		config.RPName = config.RPID
+	}
+	if len(config.Origins) == 0 {
+		config.Origins = []string{"https://" + config.RPID}
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	switch config.UserVerification {
+	case "":
+		config.UserVerification = UserVerificationRequired
+	case UserVerificationRequired, UserVerificationPreferred, UserVerificationDiscouraged:
+	default:
+		return nil, fmt.Errorf("unknown user verification requirement: %s", config.UserVerification)
+	}
+	switch config.Attestation {
+	case "":
+		config.Attestation = "none"
+	case "none", "indirect", "direct":
+	default:
+		return nil, fmt.Errorf("unknown attestation conveyance: %s", config.Attestation)
+	}
+	if config.MaxSessions <= 0 {
+		config.MaxSessions = DefaultMaxSessions
+	}
+
+	return &Service{
+		store:    store,
+		auditLog: auditLog,
+		config:   config,
+		rpIDHash: sha256.Sum256([]byte(config.RPID)),
+		sessions: make(map[string]session),
+	}, nil
+}
+
+// RelyingParty identifies the relying party to authenticators
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// User identifies the account a credential is created for
+type User struct {
+	ID          string `json:"id"` // base64url user handle
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter is an accepted credential algorithm
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor refers to a registered credential
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"` // base64url credential ID
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection states the authenticators a registration accepts
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the options of a registration ceremony, in the
+// PublicKeyCredentialCreationOptionsJSON form of WebAuthn Level 3
+type CreationOptions struct {
+	RP                     RelyingParty           `json:"rp"`
+	User                   User                   `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"` // milliseconds
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options of a login ceremony, in the
+// PublicKeyCredentialRequestOptionsJSON form of WebAuthn Level 3
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"` // milliseconds
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is an authenticator's answer to a registration
+// ceremony, in the RegistrationResponseJSON form. Binary fields are base64url.
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is an authenticator's answer to a login ceremony, in the
+// AuthenticationResponseJSON form. Binary fields are base64url.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Assertion is a verified login
+type Assertion struct {
+	UserID       string
+	Passkey      *model.Passkey
+	UserVerified bool
+}
+
+// clientData is the part of the collected client data that is checked
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// BeginRegistration starts registering a passkey for userID. name and
+// displayName are shown by the authenticator, e.g. an email address and the
+// user's name. Passkeys the user already has are excluded.
+func (s *Service) BeginRegistration(ctx context.Context, userID, name, displayName string) (*CreationOptions, error) {
+	challenge, err := s.newChallenge(ceremonyRegistration, userID)
+	if err != nil {
+		return nil, err
+	}
+	if displayName == "" {
+		displayName = name
+	}
+
+	params := make([]CredentialParameter, len(supportedAlgorithms))
+	for i, alg := range supportedAlgorithms {
+		params[i] = CredentialParameter{Type: "public-key", Alg: alg}
+	}
+
+	return &CreationOptions{
+		RP:                 RelyingParty{ID: s.config.RPID, Name: s.config.RPName},
+		User:               User{ID: encode(userHandle(userID)), Name: name, DisplayName: displayName},
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            s.config.Timeout.Milliseconds(),
+		ExcludeCredentials: s.descriptors(ctx, userID),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   s.config.UserVerification,
+		},
+		Attestation: s.config.Attestation,
+	}, nil
+}
+
+// FinishRegistration verifies the response to a registration started for
+// userID and stores the new passkey under name
+func (s *Service) FinishRegistration(ctx context.Context, userID, name string, response RegistrationResponse) (passkey *model.Passkey, err error) {
+	defer func() {
+		if err != nil {
+			s.record(ctx, audit.TypePasskeyRegistered, userID, "", err)
+		}
+	}()
+
+	rawClientData, data, err := s.clientData(response.Response.ClientDataJSON, ceremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if sess, err := s.consume(data.Challenge, ceremonyRegistration); err != nil {
+		return nil, err
+	} else if sess.userID != userID {
+		return nil, ErrUnknownChallenge
+	}
+
+	rawObject, err := decode(response.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestationObject: %v", ErrInvalidResponse, err)
+	}
+	object, err := parseAttestationObject(rawObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	authData := object.authData
+	if err := s.checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	rawID, err := decode(response.RawID)
+	if err != nil || response.Type != "public-key" || !bytes.Equal(rawID, authData.credentialID) {
+		return nil, fmt.Errorf("%w: credential ID differs from the attested one", ErrInvalidResponse)
+	}
+
+	clientDataHash := sha256.Sum256(rawClientData)
+	if err := object.verify(clientDataHash[:], s.config.AttestationRoots, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+	transports := response.Response.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+	passkey, err = s.store.AddPasskey(ctx, model.Passkey{
+		ID:                encode(authData.credentialID),
+		UserID:            userID,
+		Name:              name,
+		Aaguid:            formatAAGUID(authData.aaguid),
+		AttestationFormat: object.format,
+		Transports:        transports,
+		BackedUp:          authData.backedUp(),
+		PublicKey:         authData.rawKey,
+		SignCount:         authData.signCount,
+		BackupEligible:    authData.backupEligible(),
+	})
+	if errors.Is(err, store.ErrPasskeyConflict) {
+		return nil, ErrCredentialExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, audit.TypePasskeyRegistered, userID, passkey.ID, nil)
+	return passkey, nil
+}
+
+// BeginLogin starts a login. With an empty userID any discoverable passkey
+// of the relying party can answer, so the user needn't be known first;
+// otherwise only the passkeys of userID can.
+func (s *Service) BeginLogin(ctx context.Context, userID string) (*RequestOptions, error) {
+	challenge, err := s.newChallenge(ceremonyLogin, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.requestOptions(ctx, userID, challenge), nil
+}
+
+// LoginOptions creates the options of a login like BeginLogin, but doesn't
+// remember the challenge. It is for callers that keep their own state, such
+// as the challenge flow, and check the response with VerifyLogin.
+func (s *Service) LoginOptions(ctx context.Context, userID string) (*RequestOptions, error) {
+	random := make([]byte, challengeSize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return s.requestOptions(ctx, userID, encode(random)), nil
+}
+
+// requestOptions returns the options of a login with challenge
+func (s *Service) requestOptions(ctx context.Context, userID, challenge string) *RequestOptions {
+	options := &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          s.config.Timeout.Milliseconds(),
+		RPID:             s.config.RPID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: s.config.UserVerification,
+	}
+	if userID != "" {
+		options.AllowCredentials = s.descriptors(ctx, userID)
+	}
+	return options
+}
+
+// FinishLogin verifies the response to a login and records the use of the
+// passkey. A signature counter that doesn't increase fails the login, as
+// the passkey may have been cloned; passkeys that always report zero, like
+// synced ones, are exempt.
+func (s *Service) FinishLogin(ctx context.Context, response AssertionResponse) (*Assertion, error) {
+	rawClientData, data, err := s.clientData(response.Response.ClientDataJSON, ceremonyLogin)
+	if err != nil {
+		s.record(ctx, audit.TypePasskeyLogin, "", response.RawID, err)
+		return nil, err
+	}
+	sess, err := s.consume(data.Challenge, ceremonyLogin)
+	if err != nil {
+		s.record(ctx, audit.TypePasskeyLogin, "", response.RawID, err)
+		return nil, err
+	}
+	return s.verifyAssertion(ctx, sess.userID, rawClientData, response)
+}
+
+// VerifyLogin verifies the response to options created by LoginOptions for
+// userID, with the same checks as FinishLogin. challenge is the challenge of
+// those options; the caller must make sure it is answered only once and not
+// after it expires.
+func (s *Service) VerifyLogin(ctx context.Context, userID, challenge string, response AssertionResponse) (*Assertion, error) {
+	rawClientData, data, err := s.clientData(response.Response.ClientDataJSON, ceremonyLogin)
+	if err == nil && subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		err = ErrUnknownChallenge
+	}
+	if err != nil {
+		s.record(ctx, audit.TypePasskeyLogin, userID, response.RawID, err)
+		return nil, err
+	}
+	return s.verifyAssertion(ctx, userID, rawClientData, response)
+}
+
+// verifyAssertion verifies a login response whose client data has been
+// checked. expectedUserID is the user the login was started for, if any.
+func (s *Service) verifyAssertion(ctx context.Context, expectedUserID string, rawClientData []byte, response AssertionResponse) (assertion *Assertion, err error) {
+	userID := expectedUserID
+	defer func() {
+		if err != nil {
+			s.record(ctx, audit.TypePasskeyLogin, userID, response.RawID, err)
+		}
+	}()
+
+	if response.Type != "public-key" {
+		return nil, fmt.Errorf("%w: type %q", ErrInvalidResponse, response.Type)
+	}
+	rawID, err := decode(response.RawID)
+	if err != nil || len(rawID) == 0 {
+		return nil, fmt.Errorf("%w: rawId", ErrInvalidResponse)
+	}
+	passkey, err := s.store.GetPasskey(ctx, encode(rawID))
+	if errors.Is(err, store.ErrPasskeyNotFound) {
+		return nil, ErrUnknownCredential
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expectedUserID != "" && expectedUserID != passkey.UserID {
+		return nil, ErrUnknownCredential
+	}
+	userID = passkey.UserID
+
+	// The user handle is required when the user wasn't identified first
+	handle, err := decode(response.Response.UserHandle)
+	if err != nil {
+		return nil, fmt.Errorf("%w: userHandle", ErrInvalidResponse)
+	}
+	if (len(handle) > 0 || expectedUserID == "") && subtle.ConstantTimeCompare(handle, userHandle(passkey.UserID)) != 1 {
+		return nil, ErrUnknownCredential
+	}
+
+	rawAuthData, err := decode(response.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: authenticatorData", ErrInvalidResponse)
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if err := s.checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.backupEligible() != passkey.BackupEligible {
+		return nil, fmt.Errorf("%w: backup eligibility changed", ErrInvalidResponse)
+	}
+
+	key, _, err := parseCredentialKey(passkey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := decode(response.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature", ErrInvalidResponse)
+	}
+	clientDataHash := sha256.Sum256(rawClientData)
+	if err := key.verify(append(append([]byte{}, rawAuthData...), clientDataHash[:]...), signature); err != nil {
+		return nil, err
+	}
+
+	if (authData.signCount != 0 || passkey.SignCount != 0) && authData.signCount <= passkey.SignCount {
+		return nil, fmt.Errorf("%w: %d after %d", ErrCounterRegression, authData.signCount, passkey.SignCount)
+	}
+
+	// The store sets the counter only if no concurrent login has moved it
+	// past this one, so a cloned authenticator can't win a race
+	passkey, err = s.store.RecordPasskeyUse(ctx, passkey.ID, authData.signCount, authData.backedUp(), time.Now())
+	if errors.Is(err, store.ErrPasskeyCounter) {
+		return nil, fmt.Errorf("%w: %v", ErrCounterRegression, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, audit.TypePasskeyLogin, passkey.UserID, passkey.ID, nil)
+	return &Assertion{UserID: passkey.UserID, Passkey: passkey, UserVerified: authData.userVerified()}, nil
+}
+
+// ListPasskeys returns the passkeys of userID
+func (s *Service) ListPasskeys(ctx context.Context, userID string) []*model.Passkey {
+	return s.store.ListPasskeys(ctx, userID)
+}
+
+// DeletePasskey removes a passkey of userID. The authenticator keeps the
+// credential, which can no longer be used to log in.
+func (s *Service) DeletePasskey(ctx context.Context, userID, credentialID string) error {
+	if err := s.store.DeletePasskey(ctx, userID, credentialID); err != nil {
+		return err
+	}
+	s.record(ctx, audit.TypePasskeyRemoved, userID, credentialID, nil)
+	return nil
+}
+
+// clientData decodes the collected client data and checks its type and
+// origin
+func (s *Service) clientData(encoded, ceremony string) ([]byte, *clientData, error) {
+	raw, err := decode(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: clientDataJSON: %v", ErrInvalidResponse, err)
+	}
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, nil, fmt.Errorf("%w: clientDataJSON: %v", ErrInvalidResponse, err)
+	}
+	if data.Type != ceremony {
+		return nil, nil, fmt.Errorf("%w: client data type %q", ErrInvalidResponse, data.Type)
+	}
+	if data.CrossOrigin || !slices.Contains(s.config.Origins, data.Origin) {
+		return nil, nil, fmt.Errorf("%w: origin %q", ErrOriginMismatch, data.Origin)
+	}
+	return raw, &data, nil
+}
+
+// checkAuthenticatorData checks the relying party, user presence and, when
+// required, user verification
+func (s *Service) checkAuthenticatorData(data *authenticatorData) error {
+	if subtle.ConstantTimeCompare(data.rpIDHash, s.rpIDHash[:]) != 1 {
+		return fmt.Errorf("%w: rpIdHash", ErrOriginMismatch)
+	}
+	if !data.userPresent() {
+		return fmt.Errorf("%w: user not present", ErrInvalidResponse)
+	}
+	if s.config.UserVerification == UserVerificationRequired && !data.userVerified() {
+		return ErrUserVerification
+	}
+	return nil
+}
+
+// descriptors returns the passkeys of userID as credential descriptors
+func (s *Service) descriptors(ctx context.Context, userID string) []CredentialDescriptor {
+	descriptors := []CredentialDescriptor{}
+	for _, passkey := range s.store.ListPasskeys(ctx, userID) {
+		descriptors = append(descriptors, CredentialDescriptor{Type: "public-key", ID: passkey.ID, Transports: passkey.Transports})
+	}
+	return descriptors
+}
+
+// newChallenge creates and remembers a challenge. When too many are
+// outstanding, expired ones are dropped; if none have expired it returns
+// ErrTooManyChallenges rather than cancel a ceremony in progress.
+func (s *Service) newChallenge(ceremony, userID string) (string, error) {
+	random := make([]byte, challengeSize)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	challenge := encode(random)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.sessions) >= s.config.MaxSessions {
+		for k, sess := range s.sessions {
+			if now.After(sess.expiresAt) {
+				delete(s.sessions, k)
+			}
+		}
+		if len(s.sessions) >= s.config.MaxSessions {
+			return "", ErrTooManyChallenges
+		}
+	}
+	s.sessions[challenge] = session{ceremony: ceremony, userID: userID, expiresAt: now.Add(s.config.Timeout)}
+
+	return challenge, nil
+}
+
+// consume removes and returns an unexpired challenge issued for ceremony
+func (s *Service) consume(challenge, ceremony string) (session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[challenge]
+	if !ok {
+		return session{}, ErrUnknownChallenge
+	}
+	delete(s.sessions, challenge)
+	if sess.ceremony != ceremony || time.Now().After(sess.expiresAt) {
+		return session{}, ErrUnknownChallenge
+	}
+	return sess, nil
+}
+
+// record writes an audit event for a passkey registration, login or removal
+func (s *Service) record(ctx context.Context, eventType, userID, credentialID string, err error) {
+	event := audit.Event{
+		Type:    eventType,
+		Actor:   userID,
+		Subject: userID,
+		Outcome: audit.OutcomeSuccess,
+	}
+	if credentialID != "" {
+		event.Metadata = map[string]string{"credential_id": credentialID}
+	}
+	if err != nil {
+		event.Outcome = audit.OutcomeFailure
+		event.Reason = FailureReason(err)
+	}
+	s.auditLog.Record(ctx, event)
+}
+
+// FailureReason maps a ceremony error to a short label for logs and audit
+// events
+func FailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrUnknownChallenge):
+		return "unknown_challenge"
+	case errors.Is(err, ErrOriginMismatch):
+		return "origin_mismatch"
+	case errors.Is(err, ErrUserVerification):
+		return "user_verification"
+	case errors.Is(err, ErrInvalidAttestation):
+		return "invalid_attestation"
+	case errors.Is(err, ErrInvalidSignature):
+		return "invalid_signature"
+	case errors.Is(err, ErrUnknownCredential):
+		return "unknown_credential"
+	case errors.Is(err, ErrCredentialExists):
+		return "credential_exists"
+	case errors.Is(err, ErrCounterRegression):
+		return "counter_regression"
+	case errors.Is(err, ErrInvalidResponse):
+		return "invalid_response"
+	case errors.Is(err, ErrTooManyChallenges):
+		return "too_many_challenges"
+	default:
+		return "error"
+	}
+}
+
+// userHandle returns the WebAuthn user handle of userID. It is a hash so the
+// handle kept by authenticators carries no account data.
+func userHandle(userID string) []byte {
+	sum := sha256.Sum256([]byte("webauthn-user:" + userID))
+	return sum[:]
+}
+
+// encode returns the unpadded base64url encoding used by WebAuthn JSON
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decode accepts base64url with or without padding
+func decode(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
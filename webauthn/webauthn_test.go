@@ -0,0 +1,484 @@
+package webauthn
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/auth0-gqlgen-demo/graph/model"
+	"github.com/example/auth0-gqlgen-demo/issuer"
+	"github.com/example/auth0-gqlgen-demo/store"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+	testUserID = "auth0|user1"
+)
+
+// testAAGUID is the authenticator model attested by the test authenticator
+var testAAGUID = []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+
+// testAuthenticator is a P-256 authenticator holding one credential
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	flags     byte
+	signCount uint32
+	synced    bool // the counter stays zero, as with synced passkeys
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &testAuthenticator{key: key, id: id, flags: flagUserPresent | flagUserVerified}
+}
+
+// coseKey returns the credential public key as a COSE_Key
+func (a *testAuthenticator) coseKey() []byte {
+	return encodeCBOR(cborPairs{
+		coseKeyType, coseKeyTypeEC2,
+		coseAlgorithm, AlgES256,
+		coseCurve, coseCurveP256,
+		coseX, a.key.X.FillBytes(make([]byte, 32)),
+		coseY, a.key.Y.FillBytes(make([]byte, 32)),
+	})
+}
+
+// authenticatorData returns authenticator data for rpID, with the attested
+// credential data when attested is set
+func (a *testAuthenticator) authenticatorData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedData
+	}
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, testAAGUID...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+// sign signs authenticator data and a client data hash with the credential
+func (a *testAuthenticator) sign(t *testing.T, authData, clientDataHash []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+// testClientData returns the client data JSON of a ceremony from origin
+func testClientData(ceremony, challenge, origin string) []byte {
+	return []byte(`{"type":"` + ceremony + `","challenge":"` + challenge + `","origin":"` + origin + `","crossOrigin":false}`)
+}
+
+// statementFunc returns the attestation statement over authenticator data
+// and a client data hash
+type statementFunc func(t *testing.T, authData, clientDataHash []byte) cborPairs
+
+// noneStatement is the empty statement of none attestation
+func noneStatement(t *testing.T, authData, clientDataHash []byte) cborPairs {
+	return cborPairs{}
+}
+
+// register answers creation options with an attestation of format
+func (a *testAuthenticator) register(t *testing.T, options *CreationOptions, format string, statement statementFunc) RegistrationResponse {
+	t.Helper()
+	clientData := testClientData(ceremonyRegistration, options.Challenge, testOrigin)
+	clientDataHash := sha256.Sum256(clientData)
+	authData := a.authenticatorData(options.RP.ID, true)
+	object := encodeCBOR(cborPairs{
+		"fmt", format,
+		"attStmt", statement(t, authData, clientDataHash[:]),
+		"authData", authData,
+	})
+
+	var response RegistrationResponse
+	response.ID = encode(a.id)
+	response.RawID = encode(a.id)
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = encode(clientData)
+	response.Response.AttestationObject = encode(object)
+	response.Response.Transports = []string{"internal", "hybrid"}
+	return response
+}
+
+// login answers request options, counting the use of the credential
+func (a *testAuthenticator) login(t *testing.T, options *RequestOptions, userID string) AssertionResponse {
+	t.Helper()
+	if !a.synced {
+		a.signCount++
+	}
+	clientData := testClientData(ceremonyLogin, options.Challenge, testOrigin)
+	clientDataHash := sha256.Sum256(clientData)
+	authData := a.authenticatorData(options.RPID, false)
+
+	var response AssertionResponse
+	response.ID = encode(a.id)
+	response.RawID = encode(a.id)
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = encode(clientData)
+	response.Response.AuthenticatorData = encode(authData)
+	response.Response.Signature = encode(a.sign(t, authData, clientDataHash[:]))
+	response.Response.UserHandle = encode(userHandle(userID))
+	return response
+}
+
+// newTestService creates a relying party for example.com over a store with
+// the account of testUserID
+func newTestService(t *testing.T, config Config) (*Service, *store.MemoryStore) {
+	t.Helper()
+	accounts := store.NewMemoryStore()
+	if _, err := accounts.CreateAccount(context.Background(), testUserID, "user1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	config.RPID = testRPID
+	s, err := NewService(accounts, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, accounts
+}
+
+// registerPasskey registers a passkey of authenticator for testUserID
+func registerPasskey(t *testing.T, s *Service, authenticator *testAuthenticator) *model.Passkey {
+	t.Helper()
+	ctx := context.Background()
+	options, err := s.BeginRegistration(ctx, testUserID, "user1@example.com", "")
+	if err != nil {
+		t.Fatalf("BeginRegistration() error = %v", err)
+	}
+	passkey, err := s.FinishRegistration(ctx, testUserID, "Phone", authenticator.register(t, options, FormatNone, noneStatement))
+	if err != nil {
+		t.Fatalf("FinishRegistration() error = %v", err)
+	}
+	return passkey
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, Config{})
+	authenticator := newTestAuthenticator(t)
+	authenticator.flags |= flagBackupEligible | flagBackedUp
+
+	passkey := registerPasskey(t, s, authenticator)
+	if passkey.ID != encode(authenticator.id) || passkey.UserID != testUserID || passkey.AttestationFormat != FormatNone ||
+		passkey.Aaguid != "01234567-89ab-cdef-0123-456789abcdef" || !passkey.BackupEligible || !passkey.BackedUp {
+		t.Errorf("FinishRegistration() = %+v", passkey)
+	}
+
+	// Registering the same credential again is refused
+	options, _ := s.BeginRegistration(ctx, testUserID, "user1@example.com", "")
+	if len(options.ExcludeCredentials) != 1 || options.ExcludeCredentials[0].ID != passkey.ID {
+		t.Errorf("excludeCredentials = %+v, want the registered passkey", options.ExcludeCredentials)
+	}
+	if _, err := s.FinishRegistration(ctx, testUserID, "", authenticator.register(t, options, FormatNone, noneStatement)); !errors.Is(err, ErrCredentialExists) {
+		t.Errorf("FinishRegistration() of a registered credential error = %v, want %v", err, ErrCredentialExists)
+	}
+
+	login, err := s.BeginLogin(ctx, "")
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	assertion, err := s.FinishLogin(ctx, authenticator.login(t, login, testUserID))
+	if err != nil {
+		t.Fatalf("FinishLogin() error = %v", err)
+	}
+	if assertion.UserID != testUserID || !assertion.UserVerified || assertion.Passkey.SignCount != 1 || assertion.Passkey.LastUsedAt == nil {
+		t.Errorf("FinishLogin() = %+v, passkey %+v", assertion, assertion.Passkey)
+	}
+}
+
+func TestLoginRejects(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, Config{})
+	authenticator := newTestAuthenticator(t)
+	registerPasskey(t, s, authenticator)
+
+	tests := []struct {
+		name    string
+		userID  string // user the login is started for
+		prepare func(t *testing.T, response *AssertionResponse)
+		want    error
+	}{
+		{
+			name: "tampered signature",
+			prepare: func(t *testing.T, response *AssertionResponse) {
+				signature, _ := decode(response.Response.Signature)
+				signature[len(signature)-1] ^= 0x01
+				response.Response.Signature = encode(signature)
+			},
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "tampered authenticator data",
+			prepare: func(t *testing.T, response *AssertionResponse) {
+				authData, _ := decode(response.Response.AuthenticatorData)
+				authData[36]++ // raise the counter after signing
+				response.Response.AuthenticatorData = encode(authData)
+			},
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "tampered client data",
+			prepare: func(t *testing.T, response *AssertionResponse) {
+				clientData, _ := decode(response.Response.ClientDataJSON)
+				response.Response.ClientDataJSON = encode([]byte(strings.Replace(string(clientData), `"crossOrigin":false`, `"crossOrigin":false,"extra":1`, 1)))
+			},
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "another origin",
+			prepare: func(t *testing.T, response *AssertionResponse) {
+				clientData, _ := decode(response.Response.ClientDataJSON)
+				response.Response.ClientDataJSON = encode([]byte(strings.Replace(string(clientData), testOrigin, "https://evil.example", 1)))
+			},
+			want: ErrOriginMismatch,
+		},
+		{
+			name: "unknown credential",
+			prepare: func(t *testing.T, response *AssertionResponse) {
+				response.RawID = encode([]byte("another credential"))
+			},
+			want: ErrUnknownCredential,
+		},
+		{
+			name: "another user's handle",
+			prepare: func(t *testing.T, response *AssertionResponse) {
+				response.Response.UserHandle = encode(userHandle("auth0|user2"))
+			},
+			want: ErrUnknownCredential,
+		},
+		{
+			name:   "login started for another user",
+			userID: "auth0|user2",
+			want:   ErrUnknownCredential,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := s.BeginLogin(ctx, tt.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response := authenticator.login(t, options, testUserID)
+			if tt.prepare != nil {
+				tt.prepare(t, &response)
+			}
+			if _, err := s.FinishLogin(ctx, response); !errors.Is(err, tt.want) {
+				t.Errorf("FinishLogin() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Without user verification the login is refused when it is required
+	authenticator.flags &^= flagUserVerified
+	options, _ := s.BeginLogin(ctx, "")
+	if _, err := s.FinishLogin(ctx, authenticator.login(t, options, testUserID)); !errors.Is(err, ErrUserVerification) {
+		t.Errorf("FinishLogin() without user verification error = %v, want %v", err, ErrUserVerification)
+	}
+}
+
+func TestCounterRegression(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, Config{})
+	authenticator := newTestAuthenticator(t)
+	registerPasskey(t, s, authenticator)
+
+	login := func() error {
+		t.Helper()
+		options, err := s.BeginLogin(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.FinishLogin(ctx, authenticator.login(t, options, testUserID))
+		return err
+	}
+
+	authenticator.signCount = 4
+	if err := login(); err != nil {
+		t.Fatalf("login with counter 5 error = %v", err)
+	}
+	// A clone still at an earlier counter is refused, and so is a repeat
+	for _, count := range []uint32{2, 4} {
+		authenticator.signCount = count
+		if err := login(); !errors.Is(err, ErrCounterRegression) {
+			t.Errorf("login with counter %d after 5 error = %v, want %v", count+1, err, ErrCounterRegression)
+		}
+	}
+}
+
+func TestZeroCounterIsExempt(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, Config{})
+	authenticator := newTestAuthenticator(t)
+	authenticator.synced = true
+	registerPasskey(t, s, authenticator)
+
+	for range 2 {
+		options, _ := s.BeginLogin(ctx, "")
+		if _, err := s.FinishLogin(ctx, authenticator.login(t, options, testUserID)); err != nil {
+			t.Fatalf("FinishLogin() with a zero counter error = %v", err)
+		}
+	}
+}
+
+// racingStore is a store where another login of the same passkey finishes
+// between reading the passkey and recording its use
+type racingStore struct {
+	*store.MemoryStore
+	race func()
+}
+
+func (s *racingStore) RecordPasskeyUse(ctx context.Context, credentialID string, signCount uint32, backedUp bool, usedAt time.Time) (*model.Passkey, error) {
+	if s.race != nil {
+		s.race()
+		s.race = nil
+	}
+	return s.MemoryStore.RecordPasskeyUse(ctx, credentialID, signCount, backedUp, usedAt)
+}
+
+func TestConcurrentLoginsWithOneCounter(t *testing.T) {
+	ctx := context.Background()
+	accounts := store.NewMemoryStore()
+	if _, err := accounts.CreateAccount(ctx, testUserID, "user1@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	racing := &racingStore{MemoryStore: accounts}
+	s, err := NewService(racing, nil, Config{RPID: testRPID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := newTestAuthenticator(t)
+	passkey := registerPasskey(t, s, authenticator)
+
+	// A clone answers with the same counter and records it first
+	racing.race = func() {
+		if _, err := accounts.RecordPasskeyUse(ctx, passkey.ID, 1, false, time.Now()); err != nil {
+			t.Errorf("RecordPasskeyUse() of the clone error = %v", err)
+		}
+	}
+	options, _ := s.BeginLogin(ctx, "")
+	if _, err := s.FinishLogin(ctx, authenticator.login(t, options, testUserID)); !errors.Is(err, ErrCounterRegression) {
+		t.Errorf("FinishLogin() losing the race error = %v, want %v", err, ErrCounterRegression)
+	}
+}
+
+func TestChallenges(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, Config{MaxSessions: 2})
+	authenticator := newTestAuthenticator(t)
+	registerPasskey(t, s, authenticator)
+
+	// A challenge is answered once
+	options, _ := s.BeginLogin(ctx, "")
+	response := authenticator.login(t, options, testUserID)
+	if _, err := s.FinishLogin(ctx, response); err != nil {
+		t.Fatalf("FinishLogin() error = %v", err)
+	}
+	if _, err := s.FinishLogin(ctx, response); !errors.Is(err, ErrUnknownChallenge) {
+		t.Errorf("FinishLogin() replayed error = %v, want %v", err, ErrUnknownChallenge)
+	}
+
+	// A registration challenge can't be used to log in
+	creation, _ := s.BeginRegistration(ctx, testUserID, "user1@example.com", "")
+	if _, err := s.FinishLogin(ctx, authenticator.login(t, &RequestOptions{Challenge: creation.Challenge, RPID: testRPID}, testUserID)); !errors.Is(err, ErrUnknownChallenge) {
+		t.Errorf("FinishLogin() of a registration challenge error = %v, want %v", err, ErrUnknownChallenge)
+	}
+
+	// An expired challenge is refused
+	options, _ = s.BeginLogin(ctx, "")
+	s.mu.Lock()
+	sess := s.sessions[options.Challenge]
+	sess.expiresAt = time.Now().Add(-time.Second)
+	s.sessions[options.Challenge] = sess
+	s.mu.Unlock()
+	if _, err := s.FinishLogin(ctx, authenticator.login(t, options, testUserID)); !errors.Is(err, ErrUnknownChallenge) {
+		t.Errorf("FinishLogin() of an expired challenge error = %v, want %v", err, ErrUnknownChallenge)
+	}
+
+	// A full table refuses new challenges until one expires
+	first, _ := s.BeginLogin(ctx, "")
+	if _, err := s.BeginLogin(ctx, ""); err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	if _, err := s.BeginLogin(ctx, ""); !errors.Is(err, ErrTooManyChallenges) {
+		t.Fatalf("BeginLogin() with a full table error = %v, want %v", err, ErrTooManyChallenges)
+	}
+	if _, err := s.FinishLogin(ctx, authenticator.login(t, first, testUserID)); err != nil {
+		t.Errorf("FinishLogin() of an outstanding challenge error = %v, want nil", err)
+	}
+	s.mu.Lock()
+	for challenge, sess := range s.sessions {
+		sess.expiresAt = time.Now().Add(-time.Second)
+		s.sessions[challenge] = sess
+	}
+	s.mu.Unlock()
+	if _, err := s.BeginLogin(ctx, ""); err != nil {
+		t.Errorf("BeginLogin() once challenges expired error = %v, want nil", err)
+	}
+}
+
+func TestLoginHandler(t *testing.T) {
+	ctx := context.Background()
+	s, accounts := newTestService(t, Config{})
+	authenticator := newTestAuthenticator(t)
+	registerPasskey(t, s, authenticator)
+	tokens, err := issuer.Open(ctx, issuer.Config{URL: "https://api.example.com/", Audience: "https://api.example.com"}, accounts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(handler http.Handler, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		encoded, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(encoded))))
+		return w
+	}
+
+	w := post(s.LoginOptionsHandler(), LoginOptionsPath, nil)
+	var options RequestOptions
+	if err := json.Unmarshal(w.Body.Bytes(), &options); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("login options = %d %s", w.Code, w.Body)
+	}
+	response := authenticator.login(t, &options, testUserID)
+
+	w = post(s.LoginHandler(tokens), LoginPath, response)
+	var result LoginResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("login = %d %s", w.Code, w.Body)
+	}
+	if result.UserID != testUserID || result.Tokens == nil || result.Tokens.AccessToken == "" || result.Tokens.RefreshToken == "" {
+		t.Errorf("login result = %+v, want tokens for %s", result, testUserID)
+	}
+
+	// A replayed response gets the generic failure
+	w = post(s.LoginHandler(tokens), LoginPath, response)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "login_failed") {
+		t.Errorf("replayed login = %d %s, want 401 login_failed", w.Code, w.Body)
+	}
+}